@@ -7,8 +7,8 @@ import (
 	"net/http"
 	"strings"
 
+	"imuslab.com/bokofs/bokofsd/mod/auth"
 	"imuslab.com/bokofs/bokofsd/mod/diskinfo"
-	"imuslab.com/bokofs/bokofsd/mod/diskinfo/lsblk"
 	"imuslab.com/bokofs/bokofsd/mod/netstat"
 )
 
@@ -16,6 +16,7 @@ import (
 	API Router
 
 	This module handle routing of the API calls
+	All the API calls require login, see user.go for the login API
 */
 
 // Primary handler for the API router
@@ -40,12 +41,46 @@ func HandlerAPIcalls() http.Handler {
 			HandleInfoAPIcalls().ServeHTTP(w, r)
 			return
 		case "smart":
-			// Request to /api/smart/*
+			// Request to /api/smart/*, only admin can start or schedule self-tests
+			if r.Method != http.MethodGet && !auth.RequireAdmin(w, r) {
+				return
+			}
 			HandleSMARTCalls().ServeHTTP(w, r)
 			return
 		case "raid":
-			// Request to /api/raid/*
+			// Request to /api/raid/*, only admin can make changes to RAID arrays
+			if r.Method != http.MethodGet && !auth.RequireAdmin(w, r) {
+				return
+			}
 			HandleRAIDCalls().ServeHTTP(w, r)
+		case "partition":
+			// Request to /api/partition/*, only admin can edit partition tables
+			if r.Method != http.MethodGet && !auth.RequireAdmin(w, r) {
+				return
+			}
+			HandlePartitionCalls().ServeHTTP(w, r)
+		case "disk":
+			// Request to /api/disk/*, only admin can mount or unmount devices
+			if !auth.RequireAdmin(w, r) {
+				return
+			}
+			HandleDiskCalls().ServeHTTP(w, r)
+		case "workers":
+			// Request to /api/workers/*, non-admin users can only list the workers they have access to
+			if len(pathParts) > 2 && pathParts[2] == "list" && !isAdminRequest(r) {
+				handleListAccessibleWorkers(w, r)
+				return
+			}
+			if !auth.RequireAdmin(w, r) {
+				return
+			}
+			HandleWorkerCalls().ServeHTTP(w, r)
+		case "events":
+			// Request to /api/events?topics=netstat,raid.sync, the live status stream, see live.go
+			handleEventStream(w, r)
+		case "users":
+			// Request to /api/users/*, permission checks are done in the handlers
+			HandleUserCalls().ServeHTTP(w, r)
 		default:
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
@@ -64,31 +99,45 @@ func HandleInfoAPIcalls() http.Handler {
 			// Get the current network statistics
 			netstatBuffer.HandleGetBufferedNetworkInterfaceStats(w, r)
 			return
+		case "io":
+			// Get the I/O throughput and latency of a disk or md device, e.g. /io/sda, or all devices with /io/all
+			if len(pathParts) < 2 || pathParts[1] == "" {
+				http.Error(w, "Bad Request - Invalid disk name", http.StatusBadRequest)
+				return
+			}
+
+			var js []byte
+			if pathParts[1] == "all" {
+				js, _ = json.Marshal(blkstatSampler.GetAll())
+			} else {
+				ioStat, err := blkstatSampler.Get(pathParts[1])
+				if err != nil {
+					http.Error(w, "Not Found", http.StatusNotFound)
+					return
+				}
+				js, _ = json.Marshal(ioStat)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(js)
+			return
+		case "history":
+			// Get the history of a metric, require name and resolution (Optional, 1s, 1m or 1h)
+			// List all available metrics if name is not given
+			metricsStore.HandleQuery(w, r)
+			return
 		case "iface":
 			// Get the list of network interfaces
 			netstat.HandleListNetworkInterfaces(w, r)
 			return
 		case "list":
 			// List all block devices and their partitions
-			blockDevices, err := lsblk.GetLSBLKOutput()
+			disks, err := diskinfo.GetAllDisks()
 			if err != nil {
-				log.Println("Error getting block devices:", err)
+				log.Println("Error getting disk info:", err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
-
-			disks := make([]*diskinfo.Disk, 0)
-			for _, device := range blockDevices {
-				if device.Type == "disk" {
-					disk, err := diskinfo.GetDiskInfo(device.Name)
-					if err != nil {
-						log.Println("Error getting disk info:", err)
-						http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-						return
-					}
-					disks = append(disks, disk)
-				}
-			}
 			// Convert the block devices to JSON and write it to the response
 			js, _ := json.Marshal(disks)
 			w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"imuslab.com/bokofs/bokofsd/mod/disktool/automount"
+	"imuslab.com/bokofs/bokofsd/mod/notifier"
+)
+
+/*
+	config.go
+
+	This file handles the loading of the system config file.
+	If the config file does not exist, a default one will be created
+*/
+
+type SystemConfig struct {
+	ChunkRootPath   string `json:"chunk_root_path"`
+	FileSystemType  string `json:"file_system_type"`
+	Mode            string `json:"mode"`
+	AuthServer      string `json:"auth_server"` //Remote auth server URL, leave empty to use local user store only
+	DiskAutoMount   bool   `json:"disk_auto_mount"`
+	DiskMountPoint  string `json:"disk_mount_point"`
+	DiskUUID        string `json:"disk_uuid"`
+	DiskDevFile     string `json:"disk_dev_file"`
+	UseCacheDisk    bool   `json:"use_cache_disk"`
+	CacheAutoMount  bool   `json:"cache_auto_mount"`
+	CacheMountPoint string `json:"cache_mount_point"`
+	CacheUUID       string `json:"cache_uuid"`
+	CacheDevFile    string `json:"cache_dev_file"`
+
+	/* Auto Mount */
+	AutoMountRules     []*automount.Rule `json:"auto_mount_rules"`     //Mount file systems by UUID and serve them as workers
+	AutoMountRemovable bool              `json:"auto_mount_removable"` //Mount and serve USB / removable drives that are plugged in
+	AutoMountRoot      string            `json:"auto_mount_root"`      //Where removable drives are mounted
+
+	/* Health Monitoring */
+	SMARTCheckInterval    int            `json:"smart_check_interval"`    //In minutes
+	SMARTTemperatureLimit int            `json:"smart_temperature_limit"` //In Celsius
+	RAIDCheckInterval     int            `json:"raid_check_interval"`     //In seconds
+	Notifiers             NotifierConfig `json:"notifiers"`
+}
+
+// NotifierConfig defines where the alerts are sent to, leave a notifier
+// empty to disable it
+type NotifierConfig struct {
+	LogFile string                   `json:"log_file"` //Relative to the config folder if not absolute
+	SMTP    *notifier.SMTPOptions    `json:"smtp"`
+	Webhook *notifier.WebhookOptions `json:"webhook"`
+}
+
+// getDefaultSystemConfig returns the default config
+func getDefaultSystemConfig() *SystemConfig {
+	return &SystemConfig{
+		ChunkRootPath:   "/mnt/chunks",
+		FileSystemType:  "ext4",
+		Mode:            "production",
+		AuthServer:      "",
+		DiskAutoMount:   false,
+		DiskMountPoint:  "/mnt/disk",
+		DiskUUID:        "",
+		DiskDevFile:     "",
+		UseCacheDisk:    false,
+		CacheAutoMount:  false,
+		CacheMountPoint: "/mnt/cache",
+		CacheUUID:       "",
+		CacheDevFile:    "",
+
+		AutoMountRules:     []*automount.Rule{},
+		AutoMountRemovable: false,
+		AutoMountRoot:      "/media/bokofs",
+
+		SMARTCheckInterval:    5,
+		SMARTTemperatureLimit: 55,
+		RAIDCheckInterval:     30,
+		Notifiers: NotifierConfig{
+			LogFile: ALERT_LOG_FILE,
+		},
+	}
+}
+
+// loadSystemConfig loads the config file from the config folder,
+// create one with default values if it does not exist
+func loadSystemConfig(configFolderPath string) (*SystemConfig, error) {
+	configFilePath := filepath.Join(configFolderPath, SYSTEM_CONFIG_FILE)
+	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
+		fmt.Printf("Config file does not exist. Creating default config at %s\n", configFilePath)
+		defaultConfig := getDefaultSystemConfig()
+		js, _ := json.MarshalIndent(defaultConfig, "", "  ")
+		if err := os.WriteFile(configFilePath, js, 0644); err != nil {
+			return nil, fmt.Errorf("error writing default config: %v", err)
+		}
+		return defaultConfig, nil
+	}
+
+	content, err := os.ReadFile(configFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	//Start from the default values so missing keys are filled in
+	systemConfig := getDefaultSystemConfig()
+	if err := json.Unmarshal(content, systemConfig); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %v", err)
+	}
+	return systemConfig, nil
+}
@@ -1,31 +1,70 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"net/http"
 
+	"imuslab.com/bokofs/bokofsd/mod/auth"
+	"imuslab.com/bokofs/bokofsd/mod/bokofs"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/blkstat"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/smart"
+	"imuslab.com/bokofs/bokofsd/mod/disktool/automount"
+	"imuslab.com/bokofs/bokofsd/mod/disktool/diskfs"
 	"imuslab.com/bokofs/bokofsd/mod/disktool/raid"
+	"imuslab.com/bokofs/bokofsd/mod/eventbus"
+	"imuslab.com/bokofs/bokofsd/mod/exporter"
 	"imuslab.com/bokofs/bokofsd/mod/netstat"
+	"imuslab.com/bokofs/bokofsd/mod/notifier"
+	"imuslab.com/bokofs/bokofsd/mod/timeseries"
 )
 
 const (
-	CSRF_COOKIENAME = "bokofs-csrf"
+	CSRF_COOKIENAME      = "bokofs-csrf"
+	WORKER_REGISTRY_FILE = "workers.json"
+	SYSTEM_CONFIG_FILE   = "config.json"
+	USER_STORE_FILE      = "users.json"
+	METRICS_HISTORY_FILE = "timeseries.json"
+	ALERT_LOG_FILE       = "alerts.log"
+	RAID_EVENT_LOG_FILE  = "raid_events.log"
+	MOUNT_TABLE_FILE     = "mounts.json"
+	RAID_REPLACE_FILE    = "raid_replace.json"
+	RAID_SCRUB_FILE      = "raid_scrub.json"
+	SMART_SELFTEST_FILE  = "smart_selftest.json"
 )
 
 var (
 	/* Start Flags */
-	httpPort = flag.Int("p", 9000, "Port to serve on (Plain HTTP)")
-	devMode  = flag.Bool("dev", false, "Enable development mode")
-	config   = flag.String("c", "./config", "Path to the config folder")
-
-	//serveSecure = flag.Bool("s", false, "Serve HTTPS. Default false")
+	httpPort      = flag.Int("p", 9000, "Port to serve on (Plain HTTP)")
+	httpsPort     = flag.Int("sp", 9443, "Port to serve on (HTTPS)")
+	devMode       = flag.Bool("dev", false, "Enable development mode")
+	config        = flag.String("c", "./config", "Path to the config folder")
+	serveSecure   = flag.Bool("s", false, "Serve HTTPS. Use cert.pem and key.pem in config folder or a generated self-signed certificate. Default false")
+	redirectHTTPS = flag.Bool("redirect", false, "Redirect requests on the plain HTTP port to HTTPS. Only work with -s")
 
 	/* Runtime Variables */
 	sysuuid        string                          //System UUID (UUIDv4)
+	systemConfig   *SystemConfig                   //The system config loaded from config.json
 	webfs          http.FileSystem                 //The web filesystem for static files
 	csrfMiddleware func(http.Handler) http.Handler //CSRF protection middleware
+	tlsCertificate *tls.Certificate                //The certificate for HTTPS, nil if serving plain HTTP
 
 	/* Modules */
-	netstatBuffer *netstat.NetStatBuffers
-	raidManager   *raid.Manager
+	authManager    *auth.Manager
+	autoMounter    *automount.Manager
+	metricsStore   *timeseries.Store
+	blkstatSampler *blkstat.Sampler
+	eventHub       *eventbus.Hub
+	formatter      *diskfs.Formatter
+	metricExporter *exporter.Exporter
+	mountTable     *diskfs.MountTable
+	netstatBuffer  *netstat.NetStatBuffers
+	notifyAgent    *notifier.Dispatcher
+	raidManager    *raid.Manager
+	raidReplacer   *raid.Replacer
+	raidScrubber   *raid.Scrubber
+	smartMonitor   *smart.HealthMonitor
+	smartSelfTests *smart.SelfTestRunner
+	webdavServer   *bokofs.Server
+	workerRegistry *bokofs.WorkerRegistry
 )
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+/*
+	disk.go
+
+	This file handles the mount management and formatting API routing
+
+	Support APIs
+
+	/disk/mounts - List the mounts in the bokoFS mount table
+	/disk/mount - Mount a device by dev or uuid to a mount point
+	/disk/unmount - Unmount a mount point, device or uuid
+	/disk/busy - List the processes using a mount point
+	/disk/format - Format a device in the background
+	/disk/formats - List the file systems that can be created on this host
+	/disk/jobs - List the format jobs and their progress
+*/
+
+func HandleDiskCalls() http.Handler {
+	return http.StripPrefix("/disk/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(r.URL.Path, "/")
+
+		switch pathParts[0] {
+		case "mounts":
+			// List the mount table entries and their state
+			mountTable.HandleListMounts(w, r)
+			return
+		case "mount":
+			// Mount a device, require mountpoint, dev or uuid, fstype (Optional), options (Optional),
+			// readonly (Optional) and persist (Optional, default true)
+			mountTable.HandleMount(w, r)
+			return
+		case "unmount":
+			// Unmount a device, require target (mount point, dev or uuid) and force (Optional)
+			mountTable.HandleUnmount(w, r)
+			return
+		case "busy":
+			// List the open files under a mount point, require "target=/mnt/storage" as a query parameter
+			mountTable.HandleListOpenHandles(w, r)
+			return
+		case "format":
+			// Format a device, require dev and fstype, label, blocksize, reserved, inoderatio,
+			// dataprofile, metadataprofile and full (bool) are optional
+			formatter.HandleFormat(w, r)
+			return
+		case "formats":
+			// List the file systems supported by the installed mkfs tools
+			formatter.HandleListSupportedFormats(w, r)
+			return
+		case "jobs":
+			// List the format jobs, optional "id=" as a query parameter to get a single job
+			formatter.HandleListFormatJobs(w, r)
+			return
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+	}))
+}
+
+// checkMountPointNotServed returns an error if a worker is serving files from the mount point,
+// as the worker would serve the empty folder after unmount
+func checkMountPointNotServed(mountPoint string) error {
+	for _, record := range workerRegistry.List() {
+		servePath, _ := filepath.Abs(record.ServePath)
+		if servePath == mountPoint || strings.HasPrefix(servePath, mountPoint+"/") {
+			return errors.New("mount point is served by worker " + record.NodeName + ", remove the worker first")
+		}
+	}
+	for _, mount := range autoMounter.List() {
+		if mount.MountPoint == mountPoint {
+			return errors.New("mount point is managed by the auto mounter")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"time"
+
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/blkstat"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/smart"
+	"imuslab.com/bokofs/bokofsd/mod/disktool/raid"
+)
+
+/*
+	history.go
+
+	This file handles the collectors that record the metrics
+	history into the time series store
+
+	Series names
+
+	disk.{dev}.read_bps - Read bytes per second of a disk or md device
+	disk.{dev}.write_bps - Write bytes per second of a disk or md device
+	disk.{dev}.util - Utilization percentage of a disk or md device
+	smart.{dev}.temperature - SMART temperature in Celsius
+	raid.{md}.sync_speed - RAID sync speed in bytes per second
+*/
+
+const RAID_SYNC_SPEED_INTERVAL = 5 * time.Second
+
+// startHistoryCollectors starts the background collectors. SMART temperatures
+// are recorded from the readings of the SMART health monitor
+func startHistoryCollectors() {
+	blkstatSampler.OnSample = func(stats []*blkstat.IOStat) {
+		recordDiskIOStats(stats)
+		eventHub.Publish(TOPIC_BLKSTAT, stats, true)
+	}
+	go collectRAIDSyncSpeed()
+}
+
+// recordDiskIOStats records the I/O rates from the blkstat sampler
+func recordDiskIOStats(stats []*blkstat.IOStat) {
+	for _, stat := range stats {
+		metricsStore.Record("disk."+stat.DeviceName+".read_bps", stat.ReadBytesPerSec)
+		metricsStore.Record("disk."+stat.DeviceName+".write_bps", stat.WriteBytesPerSec)
+		metricsStore.Record("disk."+stat.DeviceName+".util", stat.Utilization)
+	}
+}
+
+// recordSMARTTemperature records the temperature of each reading from the SMART health monitor
+func recordSMARTTemperature(healthInfo *smart.DriveHealthInfo) {
+	if healthInfo.Temperature > 0 {
+		metricsStore.Record("smart."+healthInfo.DeviceName+".temperature", float64(healthInfo.Temperature))
+	}
+}
+
+// collectRAIDSyncSpeed records the sync speed of RAID arrays that are syncing
+// and publish the sync progress to the event hub
+func collectRAIDSyncSpeed() {
+	ticker := time.NewTicker(RAID_SYNC_SPEED_INTERVAL)
+	defer ticker.Stop()
+	for range ticker.C {
+		syncStates, err := raidManager.GetSyncStates()
+		if err != nil {
+			continue
+		}
+		if syncStates == nil {
+			syncStates = []raid.SyncState{}
+		}
+		eventHub.Publish(TOPIC_RAID_SYNC, syncStates, true)
+
+		for _, syncState := range syncStates {
+			metricsStore.Record("raid."+syncState.DeviceName+".sync_speed", float64(syncState.SpeedBytesPerSecond()))
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"time"
+
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/blkstat"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
+	"imuslab.com/bokofs/bokofsd/mod/disktool/automount"
+)
+
+/*
+	hotplug.go
+
+	This file handles block devices being attached or removed. Each change is
+	published to the disk.hotplug topic and the auto mounter mount / unmount
+	the drives that match the rules in config.json (or any USB drive if
+	auto_mount_removable is enabled) as workers under /disk/
+*/
+
+const (
+	HOTPLUG_SCAN_INTERVAL = 2 * time.Second
+)
+
+// initAutoMounter creates the auto mounter from the system config
+func initAutoMounter(configFolderPath string) (*automount.Manager, error) {
+	rules := append([]*automount.Rule{}, systemConfig.AutoMountRules...)
+	if systemConfig.DiskAutoMount && systemConfig.DiskUUID != "" {
+		//Legacy single disk setting
+		rules = append(rules, &automount.Rule{
+			UUID:       systemConfig.DiskUUID,
+			MountPoint: systemConfig.DiskMountPoint,
+		})
+	}
+
+	return automount.NewManager(&automount.Options{
+		Rules:          rules,
+		MountRemovable: systemConfig.AutoMountRemovable,
+		RemovableRoot:  systemConfig.AutoMountRoot,
+		ThumbnailRoot:  filepath.Join(configFolderPath, "thumbs"),
+		Server:         webdavServer,
+		IsNameReserved: func(nodeName string) bool {
+			//Saved workers that failed to load (e.g. disk not attached yet) keep their names
+			_, err := workerRegistry.GetRecord(nodeName)
+			return err == nil
+		},
+	})
+}
+
+// startHotplugWatcher listens to block device uevents, or poll /sys/block if
+// uevents are not available (e.g. non-Linux hosts)
+func startHotplugWatcher() {
+	err := inventory.Default().Watch(handleBlockDeviceChange)
+	if err != nil {
+		log.Println("[Hotplug] Unable to listen to uevents, fallback to polling /sys/block: " + err.Error())
+		go pollBlockDeviceHotplug()
+	}
+}
+
+// handleBlockDeviceChange is called after a block device is added, removed or changed
+func handleBlockDeviceChange(action string, devname string) {
+	log.Println("[Hotplug] Block device " + action + ": " + devname)
+	eventHub.Publish(TOPIC_DISK_HOTPLUG, &HotplugEvent{Action: action, Device: devname}, false)
+	autoMounter.Sync()
+}
+
+// pollBlockDeviceHotplug detects hotplug by comparing the block devices in /sys/block
+func pollBlockDeviceHotplug() {
+	knownDevices := map[string]bool{}
+	if devices, err := blkstat.ListBlockDevices(); err == nil {
+		for _, dev := range devices {
+			knownDevices[dev] = true
+		}
+	}
+
+	ticker := time.NewTicker(HOTPLUG_SCAN_INTERVAL)
+	defer ticker.Stop()
+	for range ticker.C {
+		devices, err := blkstat.ListBlockDevices()
+		if err != nil {
+			continue
+		}
+
+		currentDevices := map[string]bool{}
+		added := []string{}
+		removed := []string{}
+		for _, dev := range devices {
+			currentDevices[dev] = true
+			if !knownDevices[dev] {
+				added = append(added, dev)
+			}
+		}
+		for dev := range knownDevices {
+			if !currentDevices[dev] {
+				removed = append(removed, dev)
+			}
+		}
+		knownDevices = currentDevices
+
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+		inventory.Default().Invalidate()
+		for _, dev := range added {
+			handleBlockDeviceChange("add", dev)
+		}
+		for _, dev := range removed {
+			handleBlockDeviceChange("remove", dev)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"imuslab.com/bokofs/bokofsd/mod/bokofs/bokothumb"
+	"imuslab.com/bokofs/bokofsd/mod/eventbus"
+)
+
+/*
+	live.go
+
+	This file publish the live status of the system to the event hub,
+	which is streamed to the web UI via /api/events?topics=...
+
+	Topics
+
+	netstat - Network rx / tx in bits per second, every second
+	blkstat - I/O rates of all disks and md devices, every second
+	raid.sync - Sync progress of RAID arrays, every 5 seconds
+	raid.event - Events raised by the RAID monitor
+	raid.replace - Step and progress of RAID disk replacement jobs
+	raid.scrub - Status and progress of RAID scrubs
+	smart.selftest - Status and progress of SMART self-tests
+	disk.hotplug - Block device added or removed
+	disk.format - Status and progress of format jobs
+	thumbnail - Progress of folder thumbnail rendering
+
+	Only netstat, blkstat and raid.sync are states, their last event is
+	retained and sent to new subscribers. The others are not sent again
+	when the browser reconnects
+*/
+
+const (
+	TOPIC_NETSTAT      = "netstat"
+	TOPIC_BLKSTAT      = "blkstat"
+	TOPIC_RAID_SYNC    = "raid.sync"
+	TOPIC_RAID_EVENT   = "raid.event"
+	TOPIC_RAID_REPLACE = "raid.replace"
+	TOPIC_RAID_SCRUB   = "raid.scrub"
+	TOPIC_SMART_TEST   = "smart.selftest"
+	TOPIC_DISK_HOTPLUG = "disk.hotplug"
+	TOPIC_DISK_FORMAT  = "disk.format"
+	TOPIC_THUMBNAIL    = "thumbnail"
+)
+
+type NetstatEvent struct {
+	RX int64 //Received bits per second
+	TX int64 //Transmitted bits per second
+}
+
+type HotplugEvent struct {
+	Action string //add, remove or change
+	Device string //e.g. sdb
+}
+
+// startEventPublishers hooks the producers of live status to the event hub
+func startEventPublishers() {
+	netstatBuffer.SetSampleHandler(func(rx int64, tx int64) {
+		eventHub.Publish(TOPIC_NETSTAT, &NetstatEvent{RX: rx, TX: tx}, true)
+	})
+	webdavServer.SetThumbnailProgressHandler(func(progress *bokothumb.Progress) {
+		eventHub.Publish(TOPIC_THUMBNAIL, progress, false)
+	})
+}
+
+// handleEventStream serve the event stream, thumbnail progress of workers
+// the user has no access to are filtered out
+func handleEventStream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	eventHub.HandleSubscribe(w, r, func(event *eventbus.Event) bool {
+		if event.Topic != TOPIC_THUMBNAIL {
+			return true
+		}
+
+		progress := &bokothumb.Progress{}
+		if err := json.Unmarshal(event.Data, progress); err != nil {
+			return false
+		}
+		return authManager.CheckWorkerAccess(ctx, progress.NodeName, false)
+	})
+}
@@ -1,16 +1,17 @@
 package main
 
 import (
+	"crypto/tls"
 	"embed"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
-
-	"imuslab.com/bokofs/bokofsd/mod/bokofs"
-	"imuslab.com/bokofs/bokofsd/mod/bokofs/bokoworker"
 )
 
 //go:embed web/*
@@ -35,48 +36,49 @@ func main() {
 		os.Exit(0)
 	}()
 
-	//DEBUG
-	wds, err := bokofs.NewWebdavInterfaceServer("/disk/", "/thumb/")
-	if err != nil {
-		panic(err)
-	}
-
-	test, err := bokoworker.NewFSWorker(&bokoworker.Options{
-		NodeName:       "test",
-		ServePath:      "./test",
-		ThumbnailStore: "./tmp/test/",
-	})
-	if err != nil {
-		panic(err)
-	}
-	wds.AddWorker(test)
-
-	test2, err := bokoworker.NewFSWorker(&bokoworker.Options{
-		NodeName:       "test2",
-		ServePath:      "./mod",
-		ThumbnailStore: "./tmp/mod/",
-	})
-	if err != nil {
-		panic(err)
-	}
-	wds.AddWorker(test2)
-
-	//END DEBUG
-
 	/* Static Web Server */
-	http.Handle("/", csrfMiddleware(tmplMiddleware(http.FileServer(webfs))))
+	http.Handle("/", csrfMiddleware(authManager.HandleAuthPage(tmplMiddleware(http.FileServer(webfs)), "/login.html")))
 
 	/* WebDAV Handlers */
-	http.Handle("/disk/", wds.FsHandler())     //Note the trailing slash
-	http.Handle("/thumb/", wds.ThumbHandler()) //Note the trailing slash
+	http.Handle("/disk/", authManager.HandleAuth(webdavServer.FsHandler()))     //Note the trailing slash
+	http.Handle("/thumb/", authManager.HandleAuth(webdavServer.ThumbHandler())) //Note the trailing slash
 
 	/* REST API Handlers */
-	http.Handle("/meta", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// TODO: Implement handler logic for /meta
-		fmt.Fprintln(w, "Meta handler not implemented yet")
-	}))
+	http.Handle("/meta", authManager.HandleAuthAPI(http.HandlerFunc(HandleMetadataRequest)))
+
+	/* Prometheus Metrics, use basic_auth in the scrape config */
+	http.Handle("/metrics", authManager.HandleAuth(metricExporter))
 
-	http.Handle("/api/", csrfMiddleware(HandlerAPIcalls()))
+	http.Handle("/api/auth/", csrfMiddleware(HandleAuthCalls()))
+	http.Handle("/api/", csrfMiddleware(authManager.HandleAuthAPI(HandlerAPIcalls())))
+
+	if *serveSecure {
+		if *redirectHTTPS {
+			// Redirect all plain HTTP requests to HTTPS
+			go func() {
+				addr := fmt.Sprintf(":%d", *httpPort)
+				fmt.Printf("Redirecting HTTP requests on %s to HTTPS\n", addr)
+				if err := http.ListenAndServe(addr, http.HandlerFunc(handleHTTPSRedirect)); err != nil {
+					fmt.Fprintf(os.Stderr, "Error starting redirect server: %v\n", err)
+				}
+			}()
+		}
+
+		addr := fmt.Sprintf(":%d", *httpsPort)
+		server := &http.Server{
+			Addr: addr,
+			TLSConfig: &tls.Config{
+				Certificates: []tls.Certificate{*tlsCertificate},
+				MinVersion:   tls.VersionTLS12,
+			},
+		}
+		fmt.Printf("Starting static web server on %s (HTTPS)\n", addr)
+		if err := server.ListenAndServeTLS("", ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting server: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	addr := fmt.Sprintf(":%d", *httpPort)
 	fmt.Printf("Starting static web server on %s\n", addr)
@@ -85,3 +87,21 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// handleHTTPSRedirect redirects the request to the same path on the HTTPS port
+func handleHTTPSRedirect(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+	targetHost := net.JoinHostPort(host, strconv.Itoa(*httpsPort))
+	if *httpsPort == 443 {
+		targetHost = strings.TrimSuffix(targetHost, ":443")
+	}
+	target := "https://" + targetHost + r.URL.RequestURI()
+
+	//Use 308 so WebDAV clients keep the method and body
+	http.Redirect(w, r, target, http.StatusPermanentRedirect)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"imuslab.com/bokofs/bokofsd/mod/metadata"
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	meta.go
+
+	This file handles the /meta endpoint, which return the metadata
+	of a file served by the workers without downloading it
+
+	Example: /meta?path=/disk1/photos/a.jpg
+	Add checksum=true to include the SHA256 of the file, which reads the whole file
+*/
+
+func HandleMetadataRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	targetPath, err := utils.GetPara(r, "path")
+	if err != nil {
+		http.Error(w, "Bad Request - Missing path", http.StatusBadRequest)
+		return
+	}
+
+	realPath, err := webdavServer.ResolvePath(r.Context(), targetPath)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	//The checksum is opt-in, hashing a large video takes minutes
+	withChecksum, _ := utils.GetBool(r, "checksum")
+	fileMeta, err := metadata.GetFileMetadata(realPath, withChecksum)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	fileMeta.Path = targetPath
+
+	js, _ := json.Marshal(fileMeta)
+	utils.SendJSONResponse(w, string(js))
+}
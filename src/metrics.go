@@ -0,0 +1,199 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/smart"
+	"imuslab.com/bokofs/bokofsd/mod/exporter"
+	"imuslab.com/bokofs/bokofsd/mod/netstat"
+)
+
+/*
+	metrics.go
+
+	This file registers the collectors of the Prometheus exporter served at /metrics.
+	Slow collectors run in the background and scraping only read the cached values
+*/
+
+const (
+	PARTITION_METRICS_INTERVAL = time.Minute
+	RAID_METRICS_INTERVAL      = 15 * time.Second
+)
+
+// initMetricsExporter creates the exporter and registers all collectors
+func initMetricsExporter() *exporter.Exporter {
+	e := exporter.NewExporter()
+	e.Register("smart", 0, collectSMARTMetrics) //Read from the SMART health monitor snapshots
+	e.Register("partition", PARTITION_METRICS_INTERVAL, collectPartitionMetrics)
+	e.Register("raid", RAID_METRICS_INTERVAL, collectRAIDMetrics)
+	e.Register("network", 0, collectNetworkMetrics)
+	e.Register("webdav", 0, collectWebDAVMetrics)
+	e.Start()
+	return e
+}
+
+// collectSMARTMetrics exports the latest SMART health of each disk polled by the health monitor
+func collectSMARTMetrics() ([]*exporter.Metric, error) {
+	metrics := []*exporter.Metric{}
+	for _, healthInfo := range smartMonitor.GetSnapshots() {
+		metrics = append(metrics, smartHealthToMetrics(healthInfo)...)
+	}
+	return metrics, nil
+}
+
+func smartHealthToMetrics(info *smart.DriveHealthInfo) []*exporter.Metric {
+	labels := map[string]string{
+		"device": info.DeviceName,
+		"model":  info.DeviceModel,
+		"serial": info.SerialNumber,
+	}
+
+	healthy := 0.0
+	if info.IsHealthy {
+		healthy = 1
+	}
+
+	newMetric := func(name string, help string, metricType exporter.MetricType, value float64) *exporter.Metric {
+		return &exporter.Metric{
+			Name:   name,
+			Help:   help,
+			Type:   metricType,
+			Labels: labels,
+			Value:  value,
+		}
+	}
+
+	return []*exporter.Metric{
+		newMetric("bokofs_smart_healthy", "1 if the SMART overall health test passed", exporter.Gauge, healthy),
+		newMetric("bokofs_smart_temperature_celsius", "Drive temperature reported by SMART", exporter.Gauge, float64(info.Temperature)),
+		newMetric("bokofs_smart_power_on_hours", "Power on hours of the drive", exporter.Counter, float64(info.PowerOnHours)),
+		newMetric("bokofs_smart_power_cycle_count", "Power cycle count of the drive", exporter.Counter, float64(info.PowerCycleCount)),
+		newMetric("bokofs_smart_reallocated_sectors", "Reallocated sector count (HDD)", exporter.Gauge, float64(info.ReallocatedSectors)),
+		newMetric("bokofs_smart_reallocated_nand_blocks", "Reallocated NAND block count (SSD)", exporter.Gauge, float64(info.ReallocateNANDBlocks)),
+		newMetric("bokofs_smart_wear_leveling_count", "Wear leveling count (SSD / NVMe)", exporter.Gauge, float64(info.WearLevelingCount)),
+		newMetric("bokofs_smart_uncorrectable_errors", "Uncorrectable error count", exporter.Gauge, float64(info.UncorrectableErrors)),
+		newMetric("bokofs_smart_pending_sectors", "Current pending sector count (HDD)", exporter.Gauge, float64(info.PendingSectors)),
+		newMetric("bokofs_smart_ecc_recovered", "ECC recovered count", exporter.Counter, float64(info.ECCRecovered)),
+		newMetric("bokofs_smart_udma_crc_errors", "UDMA CRC error count", exporter.Counter, float64(info.UDMACRCErrors)),
+		newMetric("bokofs_smart_lba_written_total", "Total LBAs written", exporter.Counter, float64(info.TotalLBAWritten)),
+		newMetric("bokofs_smart_lba_read_total", "Total LBAs read", exporter.Counter, float64(info.TotalLBARead)),
+	}
+}
+
+// collectPartitionMetrics exports the size and usage of mounted partitions
+func collectPartitionMetrics() ([]*exporter.Metric, error) {
+	disks, err := diskinfo.GetAllDisks()
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := []*exporter.Metric{}
+	for _, disk := range disks {
+		for _, partition := range disk.Partitions {
+			if partition.MountPoint == "" {
+				continue
+			}
+
+			labels := map[string]string{
+				"device":     partition.Name,
+				"disk":       disk.Name,
+				"uuid":       partition.UUID,
+				"fstype":     partition.FsType,
+				"mountpoint": partition.MountPoint,
+			}
+			metrics = append(metrics,
+				&exporter.Metric{Name: "bokofs_partition_size_bytes", Help: "Size of the partition", Labels: labels, Value: float64(partition.Size)},
+				&exporter.Metric{Name: "bokofs_partition_used_bytes", Help: "Used space of the partition", Labels: labels, Value: float64(partition.Used)},
+				&exporter.Metric{Name: "bokofs_partition_free_bytes", Help: "Free space of the partition", Labels: labels, Value: float64(partition.Free)},
+			)
+		}
+	}
+	return metrics, nil
+}
+
+// collectRAIDMetrics exports the device counts, state and sync progress of RAID arrays
+func collectRAIDMetrics() ([]*exporter.Metric, error) {
+	raidDevices, err := raidManager.GetRAIDDevicesFromProcMDStat()
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := []*exporter.Metric{}
+	for _, raidDevice := range raidDevices {
+		info, err := raidManager.GetRAIDInfo("/dev/" + raidDevice.Name)
+		if err != nil {
+			continue
+		}
+
+		labels := map[string]string{
+			"device": raidDevice.Name,
+			"level":  info.RaidLevel,
+			"name":   info.Name,
+		}
+		degraded := 0.0
+		if strings.Contains(info.State, "degraded") {
+			degraded = 1
+		}
+
+		metrics = append(metrics,
+			&exporter.Metric{Name: "bokofs_raid_devices", Help: "No. of devices the array is configured with", Labels: labels, Value: float64(info.RaidDevices)},
+			&exporter.Metric{Name: "bokofs_raid_active_devices", Help: "No. of active devices in the array", Labels: labels, Value: float64(info.ActiveDevices)},
+			&exporter.Metric{Name: "bokofs_raid_working_devices", Help: "No. of working devices in the array", Labels: labels, Value: float64(info.WorkingDevices)},
+			&exporter.Metric{Name: "bokofs_raid_failed_devices", Help: "No. of failed devices in the array", Labels: labels, Value: float64(info.FailedDevices)},
+			&exporter.Metric{Name: "bokofs_raid_spare_devices", Help: "No. of spare devices in the array", Labels: labels, Value: float64(info.SpareDevices)},
+			&exporter.Metric{Name: "bokofs_raid_degraded", Help: "1 if the array is degraded", Labels: labels, Value: degraded},
+			&exporter.Metric{
+				Name:   "bokofs_raid_state",
+				Help:   "State of the array reported by mdadm, always 1",
+				Labels: map[string]string{"device": raidDevice.Name, "state": info.State},
+				Value:  1,
+			},
+		)
+	}
+
+	syncStates, err := raidManager.GetSyncStates()
+	if err == nil {
+		for _, syncState := range syncStates {
+			labels := map[string]string{"device": syncState.DeviceName}
+			metrics = append(metrics,
+				&exporter.Metric{Name: "bokofs_raid_sync_progress_percent", Help: "Progress of the running resync or recovery", Labels: labels, Value: syncState.ResyncPercent},
+				&exporter.Metric{Name: "bokofs_raid_sync_speed_bytes", Help: "Speed of the running resync or recovery in bytes per second", Labels: labels, Value: float64(syncState.SpeedBytesPerSecond())},
+			)
+		}
+	}
+	return metrics, nil
+}
+
+// collectNetworkMetrics exports the network flow from the netstat buffer
+func collectNetworkMetrics() ([]*exporter.Metric, error) {
+	rxTotal, txTotal := netstatBuffer.GetTotals()
+	metrics := []*exporter.Metric{
+		{Name: "bokofs_network_receive_bits_total", Help: "Total bits received by all interfaces", Type: exporter.Counter, Value: float64(rxTotal)},
+		{Name: "bokofs_network_transmit_bits_total", Help: "Total bits transmitted by all interfaces", Type: exporter.Counter, Value: float64(txTotal)},
+	}
+
+	if rx, ok := metricsStore.Latest(netstat.SERIES_RX); ok {
+		metrics = append(metrics, &exporter.Metric{Name: "bokofs_network_receive_bits_per_second", Help: "Receive rate in the last second", Value: rx.Value})
+	}
+	if tx, ok := metricsStore.Latest(netstat.SERIES_TX); ok {
+		metrics = append(metrics, &exporter.Metric{Name: "bokofs_network_transmit_bits_per_second", Help: "Transmit rate in the last second", Value: tx.Value})
+	}
+	return metrics, nil
+}
+
+// collectWebDAVMetrics exports the no. of WebDAV requests served by each worker
+func collectWebDAVMetrics() ([]*exporter.Metric, error) {
+	metrics := []*exporter.Metric{}
+	for _, count := range webdavServer.GetRequestCounts() {
+		metrics = append(metrics, &exporter.Metric{
+			Name:   "bokofs_webdav_requests_total",
+			Help:   "No. of WebDAV requests served by the worker",
+			Type:   exporter.Counter,
+			Labels: map[string]string{"worker": count.NodeName, "method": count.Method},
+			Value:  float64(count.Count),
+		})
+	}
+	return metrics, nil
+}
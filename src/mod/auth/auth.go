@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Auth
+
+	This module handle the authentication and authorization of bokoFS.
+	WebDAV clients authenticate with HTTP Basic and the web UI uses a session
+	cookie. Credentials are checked against the local user store, or the
+	configured auth server for users without a local password.
+*/
+
+// Permission of a user to a worker
+type Permission string
+
+const (
+	PermissionNone      Permission = "none"
+	PermissionRead      Permission = "read"
+	PermissionReadWrite Permission = "read-write"
+)
+
+const (
+	SESSION_COOKIE_NAME   = "bokofs-session"
+	DEFAULT_ADMIN_NAME    = "admin"
+	CREDENTIAL_CACHE_TIME = 5 * time.Minute
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUnauthorized       = errors.New("unauthorized")
+)
+
+type Options struct {
+	UserFile       string        //Path to the user store, e.g. ./config/users.json
+	AuthServer     string        //URL of the remote auth server, leave empty to use local user store only
+	SessionTimeout time.Duration //Idle timeout of web UI sessions
+	SecureCookie   bool          //Set the Secure flag on session cookies (require HTTPS)
+}
+
+type Manager struct {
+	Options *Options
+
+	/* Private Properties */
+	users           map[string]*User
+	userMutex       sync.RWMutex
+	sessions        sync.Map //Session token to *session
+	credentialCache sync.Map //Username to *cachedCredential, to skip hashing on every WebDAV request
+	remote          *remoteAuthServer
+}
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+// NewAuthManager creates a new auth manager and load the user store from file.
+// If the user store does not exists, a new one will be created with an admin user
+func NewAuthManager(options *Options) (*Manager, error) {
+	if options.SessionTimeout <= 0 {
+		options.SessionTimeout = 24 * time.Hour
+	}
+
+	thisManager := Manager{
+		Options: options,
+		users:   map[string]*User{},
+	}
+
+	if options.AuthServer != "" {
+		thisManager.remote = newRemoteAuthServer(options.AuthServer)
+	}
+
+	if _, err := os.Stat(options.UserFile); os.IsNotExist(err) {
+		//First boot, create the default admin account
+		password, err := generateRandomPassword()
+		if err != nil {
+			return nil, err
+		}
+
+		adminUser, err := newUser(DEFAULT_ADMIN_NAME, password, true)
+		if err != nil {
+			return nil, err
+		}
+		thisManager.users[adminUser.Username] = adminUser
+		if err := thisManager.saveUsers(); err != nil {
+			return nil, err
+		}
+		log.Println("[Auth] Default admin account created. Username: " + DEFAULT_ADMIN_NAME + ", Password: " + password)
+		log.Println("[Auth] Please change the password after login")
+	} else {
+		err = thisManager.loadUsers()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//Clear expired sessions periodically
+	go func() {
+		for {
+			time.Sleep(10 * time.Minute)
+			thisManager.clearExpiredSessions()
+		}
+	}()
+
+	return &thisManager, nil
+}
+
+// Authenticate checks the request for a valid session cookie or
+// HTTP Basic credentials and returns the user if any
+func (m *Manager) Authenticate(r *http.Request) (*User, error) {
+	//Web UI session
+	if cookie, err := r.Cookie(SESSION_COOKIE_NAME); err == nil && cookie.Value != "" {
+		username, err := m.getSessionUser(cookie.Value)
+		if err == nil {
+			return m.GetUser(username)
+		}
+	}
+
+	//WebDAV clients with basic auth
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	return m.VerifyCredentials(username, password)
+}
+
+// VerifyCredentials checks the username and password against the local
+// user store or the remote auth server
+func (m *Manager) VerifyCredentials(username string, password string) (*User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	if m.credentialIsCached(username, password) {
+		return m.getUserOrRemoteGuest(username)
+	}
+
+	user, err := m.GetUser(username)
+	if err == nil && user.PasswordHash != "" {
+		//Local account
+		if !user.checkPassword(password) {
+			return nil, ErrInvalidCredentials
+		}
+		m.cacheCredential(username, password)
+		return user, nil
+	}
+
+	//No local password, check with the auth server
+	if m.remote == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	valid, err := m.remote.verify(username, password)
+	if err != nil {
+		log.Println("[Auth] Unable to reach auth server: " + err.Error())
+		return nil, ErrInvalidCredentials
+	}
+
+	if !valid {
+		return nil, ErrInvalidCredentials
+	}
+
+	m.cacheCredential(username, password)
+	return m.getUserOrRemoteGuest(username)
+}
+
+// getUserOrRemoteGuest returns the local user record, or a user without any
+// worker permission if the user only exists on the auth server
+func (m *Manager) getUserOrRemoteGuest(username string) (*User, error) {
+	user, err := m.GetUser(username)
+	if err == nil {
+		return user, nil
+	}
+
+	if m.remote == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &User{
+		Username:    username,
+		Permissions: map[string]Permission{},
+	}, nil
+}
+
+// CheckWorkerAccess checks if the user in the request context can access the given worker.
+// Set write to true to check for read-write permission
+func (m *Manager) CheckWorkerAccess(ctx context.Context, nodeName string, write bool) bool {
+	user, ok := GetUserFromContext(ctx)
+	if !ok {
+		return false
+	}
+
+	permission := user.GetPermission(nodeName)
+	if write {
+		return permission == PermissionReadWrite
+	}
+	return permission == PermissionRead || permission == PermissionReadWrite
+}
+
+// WithUser returns a copy of the context with the user attached
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// GetUserFromContext returns the authenticated user of a request context
+func GetUserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userContextKey).(*User)
+	return user, ok && user != nil
+}
+
+// IsValidPermission checks if the given permission string is valid
+func IsValidPermission(permission string) bool {
+	switch Permission(permission) {
+	case PermissionNone, PermissionRead, PermissionReadWrite:
+		return true
+	}
+	return false
+}
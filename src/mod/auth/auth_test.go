@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newStubAuthServer creates a local stand-in of the remote auth server
+func newStubAuthServer(t *testing.T, username string, password string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || u != username || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestManager(t *testing.T, authServer string) *Manager {
+	m, err := NewAuthManager(&Options{
+		UserFile:   filepath.Join(t.TempDir(), "users.json"),
+		AuthServer: authServer,
+	})
+	if err != nil {
+		t.Fatalf("unable to create auth manager: %v", err)
+	}
+	return m
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	//Test vector from RFC 7914 section 11
+	got := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if hex.EncodeToString(got) != want {
+		t.Errorf("unexpected key: %x", got)
+	}
+}
+
+func TestLocalUser(t *testing.T) {
+	m := newTestManager(t, "")
+	if _, err := m.GetUser(DEFAULT_ADMIN_NAME); err != nil {
+		t.Fatalf("default admin not created: %v", err)
+	}
+
+	if err := m.AddUser("alice", "secret", false); err != nil {
+		t.Fatalf("unable to add user: %v", err)
+	}
+
+	if _, err := m.VerifyCredentials("alice", "wrong"); err == nil {
+		t.Errorf("wrong password accepted")
+	}
+
+	user, err := m.VerifyCredentials("alice", "secret")
+	if err != nil {
+		t.Fatalf("valid password rejected: %v", err)
+	}
+
+	//Reload the user store from disk
+	reloaded, err := NewAuthManager(&Options{UserFile: m.Options.UserFile})
+	if err != nil {
+		t.Fatalf("unable to reload user store: %v", err)
+	}
+	if _, err := reloaded.VerifyCredentials(user.Username, "secret"); err != nil {
+		t.Errorf("password not persisted: %v", err)
+	}
+
+	if err := m.AddUser("bob", "", false); err == nil {
+		t.Errorf("user without password accepted without auth server")
+	}
+}
+
+func TestSetPermissionWhileReading(t *testing.T) {
+	m := newTestManager(t, "")
+	if err := m.AddUser("alice", "secret", false); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := m.GetUser("alice")
+
+	//Requests keep reading the user they authenticated with
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			user.GetPermission("disk1")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if err := m.SetPermission("alice", "disk1", PermissionRead); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.SetPermission("alice", "disk1", PermissionNone); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+
+	if err := m.SetPermission("alice", "disk1", PermissionReadWrite); err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := m.GetUser("alice")
+	if updated.GetPermission("disk1") != PermissionReadWrite {
+		t.Errorf("permission not updated")
+	}
+	if user.GetPermission("disk1") != PermissionNone {
+		t.Errorf("permission of the shared user modified")
+	}
+}
+
+func TestRemoteAuthServer(t *testing.T) {
+	stub := newStubAuthServer(t, "carol", "remote-secret")
+	m := newTestManager(t, stub.URL)
+
+	if _, err := m.VerifyCredentials("carol", "wrong"); err == nil {
+		t.Errorf("wrong password accepted by remote auth")
+	}
+
+	user, err := m.VerifyCredentials("carol", "remote-secret")
+	if err != nil {
+		t.Fatalf("valid remote credentials rejected: %v", err)
+	}
+
+	//Users only known by the auth server have no access to any worker
+	ctx := WithUser(context.Background(), user)
+	if m.CheckWorkerAccess(ctx, "disk1", false) {
+		t.Errorf("remote guest should not access workers")
+	}
+
+	//Register the remote user locally to grant permissions
+	if err := m.AddUser("carol", "", false); err != nil {
+		t.Fatalf("unable to add remote user: %v", err)
+	}
+	if err := m.SetPermission("carol", "/disk1", PermissionRead); err != nil {
+		t.Fatalf("unable to set permission: %v", err)
+	}
+
+	user, err = m.VerifyCredentials("carol", "remote-secret")
+	if err != nil {
+		t.Fatalf("valid remote credentials rejected: %v", err)
+	}
+	ctx = WithUser(context.Background(), user)
+	if !m.CheckWorkerAccess(ctx, "disk1", false) {
+		t.Errorf("read permission not granted")
+	}
+	if m.CheckWorkerAccess(ctx, "disk1", true) {
+		t.Errorf("write permission should not be granted")
+	}
+	if m.CheckWorkerAccess(ctx, "disk2", false) {
+		t.Errorf("access to other workers should not be granted")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	m := newTestManager(t, "")
+	if err := m.AddUser("alice", "secret", false); err != nil {
+		t.Fatalf("unable to add user: %v", err)
+	}
+
+	protected := m.HandleAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := GetUserFromContext(r.Context())
+		w.Write([]byte(user.Username))
+	}))
+
+	//No credentials
+	rec := httptest.NewRecorder()
+	protected.ServeHTTP(rec, httptest.NewRequest("PROPFIND", "/disk/", nil))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("expected basic auth challenge, got %d", rec.Code)
+	}
+
+	//Basic auth
+	req := httptest.NewRequest("PROPFIND", "/disk/", nil)
+	req.SetBasicAuth("alice", "secret")
+	rec = httptest.NewRecorder()
+	protected.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "alice" {
+		t.Errorf("basic auth rejected, got %d", rec.Code)
+	}
+
+	//Login and use the session cookie
+	form := url.Values{"username": {"alice"}, "password": {"secret"}}
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	m.HandleLogin(rec, req)
+	cookies := rec.Result().Cookies()
+	if len(cookies) == 0 || cookies[0].Name != SESSION_COOKIE_NAME {
+		t.Fatalf("session cookie not set")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/disk/", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	protected.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("session cookie rejected, got %d", rec.Code)
+	}
+
+	//Sessions are removed with the user
+	if err := m.RemoveUser("alice"); err != nil {
+		t.Fatalf("unable to remove user: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	protected.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("session of removed user accepted, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	handlers.go
+
+	This file contains the REST API handlers for login
+	and user management
+*/
+
+// HandleLogin handles the login request from the web UI
+func (m *Manager) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	username, err := utils.PostPara(r, "username")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid username given")
+		return
+	}
+
+	password, err := utils.PostPara(r, "password")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid password given")
+		return
+	}
+
+	user, err := m.VerifyCredentials(username, password)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	err = m.CreateSession(w, user.Username)
+	if err != nil {
+		utils.SendErrorResponse(w, "unable to create session")
+		return
+	}
+
+	utils.SendOK(w)
+}
+
+// HandleLogout handles the logout request from the web UI
+func (m *Manager) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	m.DestroySession(w, r)
+	utils.SendOK(w)
+}
+
+// HandleWhoAmI returns the current user. Must be used after the auth middleware
+func (m *Manager) HandleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		utils.SendErrorResponse(w, "unauthorized")
+		return
+	}
+
+	js, _ := json.Marshal(user.info())
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleListUsers returns the list of users, admin only
+func (m *Manager) HandleListUsers(w http.ResponseWriter, r *http.Request) {
+	if !RequireAdmin(w, r) {
+		return
+	}
+
+	results := []*userInfo{}
+	for _, user := range m.ListUsers() {
+		results = append(results, user.info())
+	}
+
+	js, _ := json.Marshal(results)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleAddUser creates a new user, admin only
+func (m *Manager) HandleAddUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	if !RequireAdmin(w, r) {
+		return
+	}
+
+	username, err := utils.PostPara(r, "username")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid username given")
+		return
+	}
+
+	//Password is optional if the user is authenticated by the auth server
+	password, _ := utils.PostPara(r, "password")
+	isAdmin, _ := utils.PostBool(r, "admin")
+
+	err = m.AddUser(username, password, isAdmin)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	utils.SendOK(w)
+}
+
+// HandleRemoveUser removes a user, admin only
+func (m *Manager) HandleRemoveUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	if !RequireAdmin(w, r) {
+		return
+	}
+
+	username, err := utils.PostPara(r, "username")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid username given")
+		return
+	}
+
+	err = m.RemoveUser(username)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	utils.SendOK(w)
+}
+
+// HandleSetPassword changes the password of a user.
+// Admin can change the password of any user, other users can only change their own
+func (m *Manager) HandleSetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	currentUser, ok := GetUserFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		utils.SendErrorResponse(w, "unauthorized")
+		return
+	}
+
+	username, err := utils.PostPara(r, "username")
+	if err != nil {
+		username = currentUser.Username
+	}
+
+	if username != currentUser.Username && !RequireAdmin(w, r) {
+		return
+	}
+
+	password, err := utils.PostPara(r, "password")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid password given")
+		return
+	}
+
+	err = m.SetPassword(username, password)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	utils.SendOK(w)
+}
+
+// HandleSetPermission sets the permission of a user on a worker, admin only
+func (m *Manager) HandleSetPermission(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	if !RequireAdmin(w, r) {
+		return
+	}
+
+	username, err := utils.PostPara(r, "username")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid username given")
+		return
+	}
+
+	nodeName, err := utils.PostPara(r, "nodeName")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid nodeName given")
+		return
+	}
+
+	permission, err := utils.PostPara(r, "permission")
+	if err != nil || !IsValidPermission(strings.ToLower(permission)) {
+		utils.SendErrorResponse(w, "invalid permission given")
+		return
+	}
+
+	err = m.SetPermission(username, nodeName, Permission(strings.ToLower(permission)))
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	utils.SendOK(w)
+}
+
+// userInfo is the public information of a user, without password hash
+type userInfo struct {
+	Username    string                `json:"username"`
+	IsAdmin     bool                  `json:"is_admin"`
+	Remote      bool                  `json:"remote"` //Authenticated by the auth server
+	Permissions map[string]Permission `json:"permissions"`
+}
+
+func (u *User) info() *userInfo {
+	return &userInfo{
+		Username:    u.Username,
+		IsAdmin:     u.IsAdmin,
+		Remote:      u.PasswordHash == "",
+		Permissions: u.Permissions,
+	}
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	middleware.go
+
+	HTTP middlewares that require the request to be authenticated
+	before passing it to the next handler
+*/
+
+// HandleAuth protects WebDAV endpoints. Unauthenticated requests are
+// rejected with a basic auth challenge so WebDAV clients can prompt for login
+func (m *Manager) HandleAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := m.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="bokoFS", charset="UTF-8"`)
+			http.Error(w, "401 - Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	})
+}
+
+// HandleAuthAPI protects the REST API. Unauthenticated requests are
+// rejected without a basic auth challenge to prevent browser login popups
+func (m *Manager) HandleAuthAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := m.Authenticate(r)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			utils.SendErrorResponse(w, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	})
+}
+
+// HandleAuthPage protects the web UI. Unauthenticated requests are redirected
+// to the login page. The login page and static assets are served without login
+func (m *Manager) HandleAuthPage(next http.Handler, loginPage string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == loginPage || strings.HasPrefix(r.URL.Path, "/js/") || strings.HasPrefix(r.URL.Path, "/img/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := m.Authenticate(r)
+		if err != nil {
+			http.Redirect(w, r, loginPage, http.StatusTemporaryRedirect)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	})
+}
+
+// RequireAdmin rejects requests from non-admin users. Must be used after the auth middleware
+func RequireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !user.IsAdmin {
+		w.WriteHeader(http.StatusForbidden)
+		utils.SendErrorResponse(w, "permission denied")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+/*
+	remote.go
+
+	This file handle credential verification with the remote auth server.
+	The auth server is requested with the user credentials in the HTTP Basic
+	auth header. Any 2xx response means the credentials are valid and 401 / 403
+	means invalid. Other status codes are treated as server errors.
+*/
+
+type remoteAuthServer struct {
+	url    string
+	client *http.Client
+}
+
+func newRemoteAuthServer(url string) *remoteAuthServer {
+	return &remoteAuthServer{
+		url: url,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// verify checks the credentials with the auth server
+func (s *remoteAuthServer) verify(username string, password string) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.SetBasicAuth(username, password)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return true, nil
+	} else if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return false, nil
+	}
+	return false, fmt.Errorf("auth server returned unexpected status %d", resp.StatusCode)
+}
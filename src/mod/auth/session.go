@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	session.go
+
+	This file handle the web UI sessions and the credential cache
+*/
+
+type session struct {
+	Username  string
+	expiresAt atomic.Int64 //Unix nano, extended on every request so it is accessed atomically
+}
+
+type cachedCredential struct {
+	hash      [sha256.Size]byte
+	expiresAt time.Time
+}
+
+// CreateSession creates a new session for the user and set the session cookie
+func (m *Manager) CreateSession(w http.ResponseWriter, username string) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+
+	thisSession := &session{Username: username}
+	thisSession.setExpiry(time.Now().Add(m.Options.SessionTimeout))
+	m.sessions.Store(token, thisSession)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SESSION_COOKIE_NAME,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   m.Options.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(m.Options.SessionTimeout.Seconds()),
+	})
+	return nil
+}
+
+// DestroySession removes the session of the request and clear the session cookie
+func (m *Manager) DestroySession(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SESSION_COOKIE_NAME); err == nil {
+		m.sessions.Delete(cookie.Value)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SESSION_COOKIE_NAME,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   m.Options.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+}
+
+// getSessionUser returns the username of a valid session and extend its expiry time
+func (m *Manager) getSessionUser(token string) (string, error) {
+	value, ok := m.sessions.Load(token)
+	if !ok {
+		return "", errors.New("session not found")
+	}
+
+	thisSession := value.(*session)
+	if thisSession.expired(time.Now()) {
+		m.sessions.Delete(token)
+		return "", errors.New("session expired")
+	}
+
+	thisSession.setExpiry(time.Now().Add(m.Options.SessionTimeout))
+	return thisSession.Username, nil
+}
+
+// setExpiry sets the expiry time of the session
+func (s *session) setExpiry(t time.Time) {
+	s.expiresAt.Store(t.UnixNano())
+}
+
+// expired checks if the session is expired at the given time
+func (s *session) expired(now time.Time) bool {
+	return now.UnixNano() > s.expiresAt.Load()
+}
+
+// removeUserSessions removes all sessions of a given user
+func (m *Manager) removeUserSessions(username string) {
+	m.sessions.Range(func(key, value interface{}) bool {
+		if value.(*session).Username == username {
+			m.sessions.Delete(key)
+		}
+		return true
+	})
+}
+
+// clearExpiredSessions removes expired sessions and cached credentials
+func (m *Manager) clearExpiredSessions() {
+	now := time.Now()
+	m.sessions.Range(func(key, value interface{}) bool {
+		if value.(*session).expired(now) {
+			m.sessions.Delete(key)
+		}
+		return true
+	})
+
+	m.credentialCache.Range(func(key, value interface{}) bool {
+		if now.After(value.(*cachedCredential).expiresAt) {
+			m.credentialCache.Delete(key)
+		}
+		return true
+	})
+}
+
+/*
+	Credential Cache
+
+	WebDAV clients send the basic auth header on every request. To avoid
+	running the password hash or calling the auth server every time,
+	verified credentials are cached for a short period of time
+*/
+
+func (m *Manager) cacheCredential(username string, password string) {
+	m.credentialCache.Store(username, &cachedCredential{
+		hash:      sha256.Sum256([]byte(username + ":" + password)),
+		expiresAt: time.Now().Add(CREDENTIAL_CACHE_TIME),
+	})
+}
+
+func (m *Manager) credentialIsCached(username string, password string) bool {
+	value, ok := m.credentialCache.Load(username)
+	if !ok {
+		return false
+	}
+
+	cached := value.(*cachedCredential)
+	if time.Now().After(cached.expiresAt) {
+		m.credentialCache.Delete(username)
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(username + ":" + password))
+	return subtle.ConstantTimeCompare(hash[:], cached.hash[:]) == 1
+}
@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+	user.go
+
+	This file handle the local user store
+*/
+
+const (
+	PASSWORD_HASH_ITERATIONS = 100000
+	PASSWORD_HASH_LENGTH     = 32
+)
+
+type User struct {
+	Username     string                `json:"username"`
+	PasswordHash string                `json:"password_hash,omitempty"` //Leave empty to authenticate with the auth server
+	Salt         string                `json:"salt,omitempty"`
+	IsAdmin      bool                  `json:"is_admin"`    //Admin can access all workers and management APIs
+	Permissions  map[string]Permission `json:"permissions"` //Worker node name to permission
+}
+
+// newUser creates a new user, leave password empty for users authenticated by the auth server
+func newUser(username string, password string, isAdmin bool) (*User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || strings.ContainsAny(username, ": /") {
+		return nil, errors.New("invalid username")
+	}
+
+	thisUser := User{
+		Username:    username,
+		IsAdmin:     isAdmin,
+		Permissions: map[string]Permission{},
+	}
+
+	if password != "" {
+		err := thisUser.setPassword(password)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &thisUser, nil
+}
+
+// GetPermission returns the permission of this user on the given worker
+func (u *User) GetPermission(nodeName string) Permission {
+	if u.IsAdmin {
+		return PermissionReadWrite
+	}
+
+	nodeName = strings.TrimPrefix(nodeName, "/")
+	permission, ok := u.Permissions[nodeName]
+	if !ok {
+		return PermissionNone
+	}
+	return permission
+}
+
+// clone returns a copy of the user with its own permission map. Users in the
+// store are shared with the running requests, so they are replaced instead of modified
+func (u *User) clone() *User {
+	copied := *u
+	copied.Permissions = make(map[string]Permission, len(u.Permissions))
+	for nodeName, permission := range u.Permissions {
+		copied.Permissions[nodeName] = permission
+	}
+	return &copied
+}
+
+// setPassword generates a new salt and update the password hash
+func (u *User) setPassword(password string) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	u.Salt = hex.EncodeToString(salt)
+	u.PasswordHash = hex.EncodeToString(pbkdf2SHA256([]byte(password), salt, PASSWORD_HASH_ITERATIONS, PASSWORD_HASH_LENGTH))
+	return nil
+}
+
+// checkPassword checks if the password matches the stored hash
+func (u *User) checkPassword(password string) bool {
+	salt, err := hex.DecodeString(u.Salt)
+	if err != nil {
+		return false
+	}
+
+	expectedHash, err := hex.DecodeString(u.PasswordHash)
+	if err != nil {
+		return false
+	}
+
+	hash := pbkdf2SHA256([]byte(password), salt, PASSWORD_HASH_ITERATIONS, PASSWORD_HASH_LENGTH)
+	return subtle.ConstantTimeCompare(hash, expectedHash) == 1
+}
+
+// pbkdf2SHA256 derives a key from the password using PBKDF2 with HMAC-SHA256 (RFC 8018)
+func pbkdf2SHA256(password []byte, salt []byte, iterations int, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u = prf.Sum(u[:0])
+		t := make([]byte, hashLen)
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// generateRandomPassword generates a random password for the default account
+func generateRandomPassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+/*
+	User Store
+*/
+
+// GetUser returns the user with the given username
+func (m *Manager) GetUser(username string) (*User, error) {
+	m.userMutex.RLock()
+	defer m.userMutex.RUnlock()
+	user, ok := m.users[username]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return user, nil
+}
+
+// ListUsers returns all the users sorted by username
+func (m *Manager) ListUsers() []*User {
+	m.userMutex.RLock()
+	defer m.userMutex.RUnlock()
+	results := []*User{}
+	for _, user := range m.users {
+		results = append(results, user)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Username < results[j].Username
+	})
+	return results
+}
+
+// AddUser creates a new user. Leave password empty to authenticate the user with the auth server
+func (m *Manager) AddUser(username string, password string, isAdmin bool) error {
+	if password == "" && m.remote == nil {
+		return errors.New("password is required when auth server is not configured")
+	}
+
+	newUser, err := newUser(username, password, isAdmin)
+	if err != nil {
+		return err
+	}
+
+	m.userMutex.Lock()
+	defer m.userMutex.Unlock()
+	if _, ok := m.users[newUser.Username]; ok {
+		return errors.New("user already exists")
+	}
+	m.users[newUser.Username] = newUser
+	return m.saveUsersWithoutLock()
+}
+
+// RemoveUser removes a user and all of its sessions
+func (m *Manager) RemoveUser(username string) error {
+	m.userMutex.Lock()
+	defer m.userMutex.Unlock()
+	user, ok := m.users[username]
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	if user.IsAdmin && m.countAdminsWithoutLock() <= 1 {
+		return errors.New("cannot remove the last admin account")
+	}
+
+	delete(m.users, username)
+	m.credentialCache.Delete(username)
+	m.removeUserSessions(username)
+	return m.saveUsersWithoutLock()
+}
+
+// SetPassword changes the password of a user
+func (m *Manager) SetPassword(username string, password string) error {
+	if password == "" {
+		return errors.New("password cannot be empty")
+	}
+
+	m.userMutex.Lock()
+	defer m.userMutex.Unlock()
+	user, ok := m.users[username]
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	updatedUser := user.clone()
+	err := updatedUser.setPassword(password)
+	if err != nil {
+		return err
+	}
+	m.users[username] = updatedUser
+	m.credentialCache.Delete(username)
+	return m.saveUsersWithoutLock()
+}
+
+// SetPermission sets the permission of a user on a given worker
+func (m *Manager) SetPermission(username string, nodeName string, permission Permission) error {
+	if !IsValidPermission(string(permission)) {
+		return errors.New("invalid permission given")
+	}
+
+	nodeName = strings.TrimPrefix(nodeName, "/")
+	if nodeName == "" {
+		return errors.New("invalid node name given")
+	}
+
+	m.userMutex.Lock()
+	defer m.userMutex.Unlock()
+	user, ok := m.users[username]
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	//Copy on write, GetPermission of the running requests reads the old map without lock
+	updatedUser := user.clone()
+	if permission == PermissionNone {
+		delete(updatedUser.Permissions, nodeName)
+	} else {
+		updatedUser.Permissions[nodeName] = permission
+	}
+	m.users[username] = updatedUser
+	return m.saveUsersWithoutLock()
+}
+
+func (m *Manager) countAdminsWithoutLock() int {
+	count := 0
+	for _, user := range m.users {
+		if user.IsAdmin {
+			count++
+		}
+	}
+	return count
+}
+
+// loadUsers loads the user store from file
+func (m *Manager) loadUsers() error {
+	content, err := os.ReadFile(m.Options.UserFile)
+	if err != nil {
+		return err
+	}
+
+	users := []*User{}
+	err = json.Unmarshal(content, &users)
+	if err != nil {
+		return errors.New("unable to parse user store: " + err.Error())
+	}
+
+	m.userMutex.Lock()
+	defer m.userMutex.Unlock()
+	for _, user := range users {
+		if user.Permissions == nil {
+			user.Permissions = map[string]Permission{}
+		}
+		m.users[user.Username] = user
+	}
+	return nil
+}
+
+// saveUsers writes the user store to file
+func (m *Manager) saveUsers() error {
+	m.userMutex.RLock()
+	defer m.userMutex.RUnlock()
+	return m.saveUsersWithoutLock()
+}
+
+func (m *Manager) saveUsersWithoutLock() error {
+	users := []*User{}
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	js, err := json.MarshalIndent(users, "", " ")
+	if err != nil {
+		return err
+	}
+	//The user store contains password hashes, keep it private
+	return os.WriteFile(m.Options.UserFile, js, 0600)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"golang.org/x/net/webdav"
 )
@@ -51,6 +53,9 @@ func (r *RouterDir) cleanPrefix(name string) string {
 
 func (r *RouterDir) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
 	// Implement the Mkdir method
+	if r.ReadOnly {
+		return webdav.ErrForbidden
+	}
 	name = r.cleanPrefix(name)
 	fmt.Println("[Bokodir]", "Mkdir called to "+name)
 	return r.dir.Mkdir(ctx, name, perm)
@@ -60,11 +65,18 @@ func (r *RouterDir) OpenFile(ctx context.Context, name string, flag int, perm os
 	// Implement the OpenFile method
 	name = r.cleanPrefix(name)
 	fmt.Println("[Bokodir]", "OpenFile called to "+name)
+	// Check if the file is being opened with write permissions
+	if r.ReadOnly && flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, webdav.ErrForbidden
+	}
 	return r.dir.OpenFile(ctx, name, flag, perm)
 }
 
 func (r *RouterDir) RemoveAll(ctx context.Context, name string) error {
 	// Implement the RemoveAll method
+	if r.ReadOnly {
+		return webdav.ErrForbidden
+	}
 	name = r.cleanPrefix(name)
 	fmt.Println("[Bokodir]", "RemoveAll called to "+name)
 	return r.dir.RemoveAll(ctx, name)
@@ -72,6 +84,9 @@ func (r *RouterDir) RemoveAll(ctx context.Context, name string) error {
 
 func (r *RouterDir) Rename(ctx context.Context, oldName, newName string) error {
 	// Implement the Rename method
+	if r.ReadOnly {
+		return webdav.ErrForbidden
+	}
 	oldName = r.cleanPrefix(oldName)
 	newName = r.cleanPrefix(newName)
 	fmt.Println("[Bokodir]", "Rename called from "+oldName+" to "+newName)
@@ -85,5 +100,25 @@ func (r *RouterDir) Stat(ctx context.Context, name string) (os.FileInfo, error)
 	return r.dir.Stat(ctx, name)
 }
 
+// Chtimes changes the access and modification times of the named file
+func (r *RouterDir) Chtimes(ctx context.Context, name string, atime time.Time, mtime time.Time) error {
+	if r.ReadOnly {
+		return webdav.ErrForbidden
+	}
+	name = r.cleanPrefix(name)
+	return os.Chtimes(r.resolve(name), atime, mtime)
+}
+
+// ResolvePath returns the path on disk of the given WebDAV path, e.g. /disk1/photos/a.jpg
+func (r *RouterDir) ResolvePath(name string) string {
+	return r.resolve(r.cleanPrefix(name))
+}
+
+// resolve returns the path on disk of the given name, which must be cleaned
+// the same way as webdav.Dir so it cannot escape from the DiskPath
+func (r *RouterDir) resolve(name string) string {
+	return filepath.Join(r.DiskPath, filepath.FromSlash(path.Clean("/"+name)))
+}
+
 // Ensure RouterDir implements the FileSystem interface
 var _ webdav.FileSystem = (*RouterDir)(nil)
@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"golang.org/x/net/webdav"
+	"imuslab.com/bokofs/bokofsd/mod/bokofs/bokothumb"
 	"imuslab.com/bokofs/bokofsd/mod/bokofs/bokoworker"
 )
 
@@ -25,6 +26,9 @@ type Server struct {
 	ThumbRouter   FlowRouter //The thumbnail router
 	fsprefix      string
 	thumbprefix   string
+	accessChecker AccessChecker //Optional, allow all access if not set
+	requestCounts sync.Map      //Request counters of each worker, see stats.go
+	thumbProgress func(progress *bokothumb.Progress)
 }
 
 /* NewWebdavInterfaceServer creates a new WebDAV server instance */
@@ -80,18 +84,51 @@ func (s *Server) AddWorker(worker *bokoworker.Worker) error {
 	if _, ok := s.LoadedWorkers.Load(worker.NodeName); ok {
 		return os.ErrExist
 	}
+	worker.Thumbnails.OnProgress = s.thumbProgress
 	s.LoadedWorkers.Store(worker.NodeName, worker)
 	return nil
 }
 
-func (s *Server) RemoveWorker(workerRootPath string) {
-	s.LoadedWorkers.Delete(workerRootPath)
+// RemoveWorker unregister a worker by its node name, accept both disk1 and /disk1
+func (s *Server) RemoveWorker(nodeName string) {
+	if !strings.HasPrefix(nodeName, "/") {
+		nodeName = "/" + nodeName
+	}
+	s.LoadedWorkers.Delete(nodeName)
+}
+
+// GetWorker returns a loaded worker by its node name, accept both disk1 and /disk1
+func (s *Server) GetWorker(nodeName string) (*bokoworker.Worker, error) {
+	if !strings.HasPrefix(nodeName, "/") {
+		nodeName = "/" + nodeName
+	}
+	worker, ok := s.LoadedWorkers.Load(nodeName)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return worker.(*bokoworker.Worker), nil
+}
+
+// SetAccessChecker sets the function that decide which workers the request can access
+func (s *Server) SetAccessChecker(checker AccessChecker) {
+	s.accessChecker = checker
+}
+
+// SetThumbnailProgressHandler sets the function to be called when the thumbnail
+// rendering of a folder makes progress. It applies to workers loaded later
+func (s *Server) SetThumbnailProgressHandler(handler func(progress *bokothumb.Progress)) {
+	s.thumbProgress = handler
+	s.LoadedWorkers.Range(func(key, value interface{}) bool {
+		value.(*bokoworker.Worker).Thumbnails.OnProgress = handler
+		return true
+	})
 }
 
 func (s *Server) FsHandler() http.Handler {
+	lockSystem := webdav.NewMemLS()
 	srv := &webdav.Handler{
 		FileSystem: s.FsRouter,
-		LockSystem: webdav.NewMemLS(),
+		LockSystem: lockSystem,
 		Logger: func(r *http.Request, err error) {
 			if err != nil {
 				log.Printf("WEBDAV [%s]: %s, ERROR: %s\n", r.Method, r.URL, err)
@@ -100,7 +137,18 @@ func (s *Server) FsHandler() http.Handler {
 			}
 		},
 	}
-	return srv
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rootRouter, ok := s.FsRouter.(*RootRouter); ok {
+			s.countRequest(rootRouter, r)
+
+			//COPY across workers cannot be done by the default webdav handler
+			if rootRouter.serveCrossWorkerCopy(w, r, lockSystem) {
+				return
+			}
+		}
+		srv.ServeHTTP(w, r)
+	})
 }
 
 func (s *Server) ThumbHandler() http.Handler {
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 
 	"golang.org/x/net/webdav"
 	"imuslab.com/bokofs/bokofsd/mod/renderer"
@@ -23,10 +24,19 @@ type Resolutions struct {
 	Height int
 }
 
+// Progress is the progress of rendering the thumbnails of a folder
+type Progress struct {
+	NodeName  string //The worker node name, e.g. /disk1
+	Folder    string //The folder being rendered, relative to the worker root
+	Total     int    //No. of files in the folder
+	Completed int    //No. of files rendered (or failed)
+}
+
 type RouterDir struct {
-	Prefix     string //Path prefix to trim, usually is the root path of the worker
-	ThumbStore string //Path to the thumbnail store
-	FsPath     string //Disk path for the corrisponding file system to create thumbnail
+	Prefix     string                   //Path prefix to trim, usually is the root path of the worker
+	ThumbStore string                   //Path to the thumbnail store
+	FsPath     string                   //Disk path for the corrisponding file system to create thumbnail
+	OnProgress func(progress *Progress) //Optional, called when a thumbnail of a folder job is rendered
 
 	/* Private Properties */
 	renderer *renderer.RenderHandler
@@ -85,6 +95,13 @@ func (r *RouterDir) OpenFile(ctx context.Context, name string, flag int, perm os
 
 		//Start thumbnail rendering in background
 		outputFolder := filepath.Join(r.ThumbStore, name)
+		total := 0
+		for _, entry := range contents {
+			if !entry.IsDir() {
+				total++
+			}
+		}
+		completed := atomic.Int32{}
 		for _, entry := range contents {
 			if entry.IsDir() {
 				os.MkdirAll(filepath.Join(outputFolder, entry.Name()), 0755)
@@ -92,6 +109,14 @@ func (r *RouterDir) OpenFile(ctx context.Context, name string, flag int, perm os
 			}
 			go func() {
 				r.renderer.RenderThumbnail(filepath.Join(r.FsPath, name, entry.Name()), outputFolder)
+				if r.OnProgress != nil {
+					r.OnProgress(&Progress{
+						NodeName:  r.Prefix,
+						Folder:    name,
+						Total:     total,
+						Completed: int(completed.Add(1)),
+					})
+				}
 			}()
 		}
 	} else {
@@ -20,12 +20,14 @@ type Options struct {
 	NodeName       string //The node name (also the id) of the directory tree, e.g. disk1
 	ServePath      string // The actual path to serve, e.g. /media/disk1/mydir
 	ThumbnailStore string // The path to the thumbnail store, e.g. /media/disk1/thumbs
+	ReadOnly       bool   // Reject all write operations from WebDAV clients
 }
 
 type Worker struct {
 	/* Worker Properties */
 	NodeName  string //The node name (also the id) of the directory tree, e.g. disk1
 	ServePath string // The actual path to serve, e.g. /media/disk1/mydir
+	ReadOnly  bool   // Reject all write operations from WebDAV clients
 
 	/* Runtime Properties */
 	Filesystem *bokofile.RouterDir  //The file system to serve
@@ -43,7 +45,7 @@ func NewFSWorker(options *Options) (*Worker, error) {
 	}
 
 	mountPath, _ = filepath.Abs(mountPath)
-	fs, err := bokofile.CreateRouterFromDir(mountPath, nodeName, false)
+	fs, err := bokofile.CreateRouterFromDir(mountPath, nodeName, options.ReadOnly)
 	if err != nil {
 		return nil, err
 	}
@@ -58,6 +60,7 @@ func NewFSWorker(options *Options) (*Worker, error) {
 	return &Worker{
 		NodeName:  nodeName,
 		ServePath: mountPath,
+		ReadOnly:  options.ReadOnly,
 
 		Filesystem: fs,
 		Thumbnails: thumbrender,
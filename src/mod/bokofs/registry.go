@@ -0,0 +1,351 @@
+package bokofs
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"imuslab.com/bokofs/bokofsd/mod/bokofs/bokoworker"
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	registry.go
+
+	The worker registry keeps the list of workers (shares) served by this
+	bokoFS instance in a json file under the config folder, so they can be
+	loaded on startup and edited at runtime without recompiling.
+*/
+
+// WorkerRecord is the persistent setting of a worker
+type WorkerRecord struct {
+	NodeName       string `json:"node_name"`       //The node name (also the id) of the worker, e.g. disk1
+	ServePath      string `json:"serve_path"`      //The actual path to serve, e.g. /media/disk1/mydir
+	ThumbnailStore string `json:"thumbnail_store"` //The path to the thumbnail store, leave empty to use default
+	ReadOnly       bool   `json:"read_only"`       //Label this worker as read only
+}
+
+type WorkerRegistry struct {
+	ConfigFile    string          //Path to the worker registry file, e.g. ./config/workers.json
+	ThumbnailRoot string          //Default root folder of thumbnail stores
+	Records       []*WorkerRecord //Registered workers
+	server        *Server
+	mutex         sync.RWMutex
+}
+
+// NewWorkerRegistry create a new worker registry backed by the given config file
+func NewWorkerRegistry(s *Server, configFile string, thumbnailRoot string) (*WorkerRegistry, error) {
+	thisRegistry := WorkerRegistry{
+		ConfigFile:    configFile,
+		ThumbnailRoot: thumbnailRoot,
+		Records:       []*WorkerRecord{},
+		server:        s,
+	}
+
+	if !utils.FileExists(configFile) {
+		//Create an empty registry file
+		err := thisRegistry.saveToFile()
+		if err != nil {
+			return nil, err
+		}
+		return &thisRegistry, nil
+	}
+
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &thisRegistry.Records)
+	if err != nil {
+		return nil, errors.New("unable to parse worker registry: " + err.Error())
+	}
+
+	return &thisRegistry, nil
+}
+
+// LoadAll create workers from all the records and add them to the server
+// workers that failed to load will be skipped with an error log
+func (wr *WorkerRegistry) LoadAll() {
+	wr.mutex.RLock()
+	defer wr.mutex.RUnlock()
+	for _, record := range wr.Records {
+		err := wr.startWorker(record)
+		if err != nil {
+			log.Println("[bokofs] Unable to load worker " + record.NodeName + ": " + err.Error())
+			continue
+		}
+		log.Println("[bokofs] Worker " + record.NodeName + " loaded from " + record.ServePath)
+	}
+}
+
+// List returns a copy of all the registered worker records
+func (wr *WorkerRegistry) List() []*WorkerRecord {
+	wr.mutex.RLock()
+	defer wr.mutex.RUnlock()
+	results := []*WorkerRecord{}
+	for _, record := range wr.Records {
+		thisRecord := *record
+		results = append(results, &thisRecord)
+	}
+	return results
+}
+
+// GetRecord returns the worker record by node name
+func (wr *WorkerRegistry) GetRecord(nodeName string) (*WorkerRecord, error) {
+	wr.mutex.RLock()
+	defer wr.mutex.RUnlock()
+	nodeName = strings.TrimPrefix(nodeName, "/")
+	for _, record := range wr.Records {
+		if record.NodeName == nodeName {
+			thisRecord := *record
+			return &thisRecord, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// Add register a new worker, start it and save it to the registry file
+func (wr *WorkerRegistry) Add(record *WorkerRecord) error {
+	if err := wr.validateRecord(record); err != nil {
+		return err
+	}
+
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+	for _, existingRecord := range wr.Records {
+		if existingRecord.NodeName == record.NodeName {
+			return errors.New("worker with the same node name already exists")
+		}
+	}
+
+	err := wr.startWorker(record)
+	if err != nil {
+		return err
+	}
+
+	wr.Records = append(wr.Records, record)
+	return wr.saveToFile()
+}
+
+// Edit replace the setting of an existing worker and restart it
+func (wr *WorkerRegistry) Edit(nodeName string, record *WorkerRecord) error {
+	nodeName = strings.TrimPrefix(nodeName, "/")
+	if err := wr.validateRecord(record); err != nil {
+		return err
+	}
+
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+	targetIndex := -1
+	for i, existingRecord := range wr.Records {
+		if existingRecord.NodeName == nodeName {
+			targetIndex = i
+		} else if existingRecord.NodeName == record.NodeName {
+			return errors.New("worker with the same node name already exists")
+		}
+	}
+
+	if targetIndex < 0 {
+		return os.ErrNotExist
+	}
+
+	//Stop the old worker and start it with the new settings
+	wr.server.RemoveWorker(nodeName)
+	err := wr.startWorker(record)
+	if err != nil {
+		//Restore the old worker
+		restoreErr := wr.startWorker(wr.Records[targetIndex])
+		if restoreErr != nil {
+			log.Println("[bokofs] Unable to restore worker " + nodeName + ": " + restoreErr.Error())
+		}
+		return err
+	}
+
+	wr.Records[targetIndex] = record
+	return wr.saveToFile()
+}
+
+// Remove unregister a worker from the server and the registry file
+func (wr *WorkerRegistry) Remove(nodeName string) error {
+	nodeName = strings.TrimPrefix(nodeName, "/")
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+	for i, existingRecord := range wr.Records {
+		if existingRecord.NodeName == nodeName {
+			wr.server.RemoveWorker(nodeName)
+			wr.Records = append(wr.Records[:i], wr.Records[i+1:]...)
+			return wr.saveToFile()
+		}
+	}
+	return os.ErrNotExist
+}
+
+// validateRecord checks and fill in the default values of a worker record
+func (wr *WorkerRegistry) validateRecord(record *WorkerRecord) error {
+	record.NodeName = strings.TrimSpace(strings.TrimPrefix(record.NodeName, "/"))
+	if record.NodeName == "" {
+		return errors.New("node name cannot be empty")
+	}
+
+	if strings.ContainsAny(record.NodeName, "/\\ ") || record.NodeName == "." || record.NodeName == ".." {
+		return errors.New("node name cannot contain slashes or spaces")
+	}
+
+	if !utils.IsDir(record.ServePath) {
+		return errors.New("serve path does not exist or is not a directory")
+	}
+
+	if record.ThumbnailStore == "" {
+		record.ThumbnailStore = filepath.Join(wr.ThumbnailRoot, record.NodeName)
+	}
+	return nil
+}
+
+// startWorker creates a worker from record and add it to the server
+func (wr *WorkerRegistry) startWorker(record *WorkerRecord) error {
+	thumbnailStore := record.ThumbnailStore
+	if thumbnailStore == "" {
+		thumbnailStore = filepath.Join(wr.ThumbnailRoot, record.NodeName)
+	}
+
+	worker, err := bokoworker.NewFSWorker(&bokoworker.Options{
+		NodeName:       record.NodeName,
+		ServePath:      record.ServePath,
+		ThumbnailStore: thumbnailStore,
+		ReadOnly:       record.ReadOnly,
+	})
+	if err != nil {
+		return err
+	}
+
+	return wr.server.AddWorker(worker)
+}
+
+// saveToFile writes the registry to the config file
+func (wr *WorkerRegistry) saveToFile() error {
+	js, err := json.MarshalIndent(wr.Records, "", " ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(wr.ConfigFile, js, 0644)
+}
+
+/*
+	Handlers
+*/
+
+// HandleListWorkers list all the registered workers
+func (wr *WorkerRegistry) HandleListWorkers(w http.ResponseWriter, r *http.Request) {
+	js, _ := json.Marshal(wr.List())
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleAddWorker add a new worker, require nodeName and servePath,
+// thumbStore (Optional) and readonly (Optional, bool)
+func (wr *WorkerRegistry) HandleAddWorker(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	record, err := getWorkerRecordFromRequest(r)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	err = wr.Add(record)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	log.Println("[bokofs] Worker " + record.NodeName + " added")
+	utils.SendOK(w)
+}
+
+// HandleEditWorker edit an existing worker, require target (the node name to edit)
+// and the same parameters as HandleAddWorker
+func (wr *WorkerRegistry) HandleEditWorker(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	target, err := utils.PostPara(r, "target")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid target worker given")
+		return
+	}
+
+	record, err := getWorkerRecordFromRequest(r)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	err = wr.Edit(target, record)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	log.Println("[bokofs] Worker " + target + " updated")
+	utils.SendOK(w)
+}
+
+// HandleRemoveWorker remove a worker, require nodeName
+func (wr *WorkerRegistry) HandleRemoveWorker(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	nodeName, err := utils.PostPara(r, "nodeName")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid node name given")
+		return
+	}
+
+	err = wr.Remove(nodeName)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	log.Println("[bokofs] Worker " + nodeName + " removed")
+	utils.SendOK(w)
+}
+
+// getWorkerRecordFromRequest parse the worker record from POST parameters
+func getWorkerRecordFromRequest(r *http.Request) (*WorkerRecord, error) {
+	nodeName, err := utils.PostPara(r, "nodeName")
+	if err != nil {
+		return nil, errors.New("invalid node name given")
+	}
+
+	servePath, err := utils.PostPara(r, "servePath")
+	if err != nil {
+		return nil, errors.New("invalid serve path given")
+	}
+
+	//Optional fields
+	thumbStore, _ := utils.PostPara(r, "thumbStore")
+	readOnly, err := utils.PostBool(r, "readonly")
+	if err != nil {
+		readOnly = false
+	}
+
+	return &WorkerRecord{
+		NodeName:       nodeName,
+		ServePath:      servePath,
+		ThumbnailStore: thumbStore,
+		ReadOnly:       readOnly,
+	}, nil
+}
@@ -96,15 +96,78 @@ func (r *RootRouter) getFileSystemFromWorker(worker *bokoworker.Worker) (RouterD
 	return nil, errors.New("Invalid router type")
 }
 
+// getFileSystemByPath returns the file system of the worker that serves the given path
+func (r *RootRouter) getFileSystemByPath(name string) (RouterDirHandler, error) {
+	targetWorker, err := r.getWorkerByPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.getFileSystemFromWorker(targetWorker)
+}
+
+// isVirtualPath checks if the path points to the virtual root or
+// one of the worker root folders emulated by this router
+func (r *RootRouter) isVirtualPath(name string) bool {
+	name = filepath.ToSlash(filepath.Clean(name))
+	if name == "/" || name == "." {
+		return true
+	}
+	return !strings.Contains(strings.TrimPrefix(name, "/"), "/")
+}
+
+// isReadOnly returns true if this router does not accept write operations
+func (r *RootRouter) isReadOnly() bool {
+	return r.routerType == RouterType_Thumb
+}
+
+// checkAccess checks if the request context can access the given worker.
+// Workers that cannot be read are hidden from the requester
+func (r *RootRouter) checkAccess(ctx context.Context, worker *bokoworker.Worker, write bool) error {
+	if r.parent.accessChecker == nil {
+		return nil
+	}
+
+	nodeName := strings.TrimPrefix(worker.NodeName, "/")
+	if !r.parent.accessChecker(ctx, nodeName, false) {
+		return os.ErrNotExist
+	}
+
+	if write && !r.parent.accessChecker(ctx, nodeName, true) {
+		return webdav.ErrForbidden
+	}
+	return nil
+}
+
 /*
 	WebDAV FileSystem Interface Implementation
 */
 
 func (r *RootRouter) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
-	// Implement the Mkdir method
 	name = r.fixpath(name)
 	fmt.Println("Mkdir called to " + name)
-	return nil
+	if r.isReadOnly() {
+		return webdav.ErrForbidden
+	}
+
+	if r.isVirtualPath(name) {
+		//Worker root folders can only be created by registering a new worker
+		return webdav.ErrForbidden
+	}
+
+	targetWorker, err := r.getWorkerByPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := r.checkAccess(ctx, targetWorker, true); err != nil {
+		return err
+	}
+
+	targetFileSystem, err := r.getFileSystemFromWorker(targetWorker)
+	if err != nil {
+		return err
+	}
+	return targetFileSystem.Mkdir(ctx, name, perm)
 }
 
 func (r *RootRouter) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
@@ -120,6 +183,7 @@ func (r *RootRouter) OpenFile(ctx context.Context, name string, flag int, perm o
 			modTime: time.Now(),
 			isDir:   true,
 		})
+		thisVirtualObject.ctx = ctx
 
 		return thisVirtualObject, nil
 	}
@@ -129,26 +193,107 @@ func (r *RootRouter) OpenFile(ctx context.Context, name string, flag int, perm o
 		return nil, err
 	}
 
+	isWrite := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+	if err := r.checkAccess(ctx, targetWorker, isWrite); err != nil {
+		return nil, err
+	}
+
 	targetFileSystem, err := r.getFileSystemFromWorker(targetWorker)
 	if err != nil {
 		return nil, err
 	}
-	return targetFileSystem.OpenFile(ctx, name, flag, perm)
+
+	f, err := targetFileSystem.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.isVirtualPath(name) {
+		//Worker root folder, advertise the worker properties in PROPFIND
+		return r.newWorkerRootFile(ctx, f, targetWorker), nil
+	}
+	return f, nil
 }
 
 func (r *RootRouter) RemoveAll(ctx context.Context, name string) error {
-	// Implement the RemoveAll method
 	name = r.fixpath(name)
 	fmt.Println("RemoveAll called to " + name)
-	return nil
+	if r.isReadOnly() {
+		return webdav.ErrForbidden
+	}
+
+	if r.isVirtualPath(name) {
+		//Do not allow removing the root or the worker root folders
+		return webdav.ErrForbidden
+	}
+
+	targetWorker, err := r.getWorkerByPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := r.checkAccess(ctx, targetWorker, true); err != nil {
+		return err
+	}
+
+	targetFileSystem, err := r.getFileSystemFromWorker(targetWorker)
+	if err != nil {
+		return err
+	}
+	return targetFileSystem.RemoveAll(ctx, name)
 }
 
 func (r *RootRouter) Rename(ctx context.Context, oldName, newName string) error {
-	// Implement the Rename method
 	oldName = r.fixpath(oldName)
 	newName = r.fixpath(newName)
 	fmt.Println("Rename called from " + oldName + " to " + newName)
-	return nil
+	if r.isReadOnly() {
+		return webdav.ErrForbidden
+	}
+
+	if r.isVirtualPath(oldName) || r.isVirtualPath(newName) {
+		//Worker root folders cannot be renamed or overwritten
+		return webdav.ErrForbidden
+	}
+
+	srcWorker, err := r.getWorkerByPath(oldName)
+	if err != nil {
+		return err
+	}
+
+	destWorker, err := r.getWorkerByPath(newName)
+	if err != nil {
+		return err
+	}
+
+	if r.routerType == RouterType_FS && (srcWorker.ReadOnly || destWorker.ReadOnly) {
+		return webdav.ErrForbidden
+	}
+
+	if err := r.checkAccess(ctx, srcWorker, true); err != nil {
+		return err
+	}
+
+	if err := r.checkAccess(ctx, destWorker, true); err != nil {
+		return err
+	}
+
+	srcFileSystem, err := r.getFileSystemFromWorker(srcWorker)
+	if err != nil {
+		return err
+	}
+
+	if srcWorker != destWorker {
+		//Each worker only knows about its own directory tree
+		//stream the data across and remove the source afterward
+		destFileSystem, err := r.getFileSystemFromWorker(destWorker)
+		if err != nil {
+			return err
+		}
+		return transferBetweenWorkers(ctx, srcFileSystem, destFileSystem, oldName, newName, -1, true)
+	}
+
+	return srcFileSystem.Rename(ctx, oldName, newName)
 }
 
 func (r *RootRouter) Stat(ctx context.Context, name string) (os.FileInfo, error) {
@@ -177,6 +322,10 @@ func (r *RootRouter) Stat(ctx context.Context, name string) (os.FileInfo, error)
 		return nil, err
 	}
 
+	if err := r.checkAccess(ctx, targetWorker, false); err != nil {
+		return nil, err
+	}
+
 	targetFileSystem, err := r.getFileSystemFromWorker(targetWorker)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,80 @@
+package bokofs
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+	stats.go
+
+	This file counts the WebDAV requests served by each worker
+*/
+
+// countedMethods are the HTTP and WebDAV methods with their own counter,
+// others are counted as "other" so clients cannot create unlimited counters
+var countedMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodDelete: true, http.MethodOptions: true, http.MethodPatch: true,
+	"PROPFIND": true, "PROPPATCH": true, "MKCOL": true, "COPY": true, "MOVE": true, "LOCK": true, "UNLOCK": true,
+}
+
+type RequestCount struct {
+	NodeName string //Node name of the worker, e.g. disk1
+	Method   string //WebDAV method, e.g. PROPFIND
+	Count    uint64
+}
+
+type requestCounterKey struct {
+	nodeName string
+	method   string
+}
+
+// countRequest increase the request counter of the worker serving the request
+func (s *Server) countRequest(router *RootRouter, r *http.Request) {
+	name := strings.TrimPrefix(router.fixpath(r.URL.Path), "/")
+	nodeName, _, _ := strings.Cut(name, "/")
+	if nodeName == "" {
+		return
+	}
+
+	//Only count loaded workers so random paths will not create new counters
+	if _, ok := s.LoadedWorkers.Load("/" + nodeName); !ok {
+		return
+	}
+
+	method := r.Method
+	if !countedMethods[method] {
+		method = "other"
+	}
+	key := requestCounterKey{nodeName: nodeName, method: method}
+	counter, ok := s.requestCounts.Load(key)
+	if !ok {
+		counter, _ = s.requestCounts.LoadOrStore(key, new(uint64))
+	}
+	atomic.AddUint64(counter.(*uint64), 1)
+}
+
+// GetRequestCounts returns the no. of WebDAV requests served by each worker since startup
+func (s *Server) GetRequestCounts() []*RequestCount {
+	results := []*RequestCount{}
+	s.requestCounts.Range(func(key, value interface{}) bool {
+		k := key.(requestCounterKey)
+		results = append(results, &RequestCount{
+			NodeName: k.nodeName,
+			Method:   k.method,
+			Count:    atomic.LoadUint64(value.(*uint64)),
+		})
+		return true
+	})
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].NodeName == results[j].NodeName {
+			return results[i].Method < results[j].Method
+		}
+		return results[i].NodeName < results[j].NodeName
+	})
+	return results
+}
@@ -0,0 +1,26 @@
+package bokofs
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCountRequestUnknownMethod(t *testing.T) {
+	server := &Server{}
+	server.LoadedWorkers.Store("/disk1", nil)
+	router := &RootRouter{pathPrefix: "/disk", parent: server}
+
+	for _, method := range []string{"PROPFIND", "PROPFIND", "BREW", "X-RANDOM-1"} {
+		server.countRequest(router, httptest.NewRequest(method, "/disk/disk1/a.txt", nil))
+	}
+	//Requests to unknown workers are not counted
+	server.countRequest(router, httptest.NewRequest("GET", "/disk/disk9/a.txt", nil))
+
+	counts := map[string]uint64{}
+	for _, count := range server.GetRequestCounts() {
+		counts[count.NodeName+" "+count.Method] = count.Count
+	}
+	if len(counts) != 2 || counts["disk1 PROPFIND"] != 2 || counts["disk1 other"] != 2 {
+		t.Errorf("expected unknown methods to be counted as other, got %v", counts)
+	}
+}
@@ -0,0 +1,255 @@
+package bokofs
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+/*
+	transfer.go
+
+	This file handle MOVE and COPY requests that have their source and
+	destination in different workers. As each worker only knows about its
+	own directory tree, the data is streamed from one worker file system
+	to the other instead of calling rename on disk.
+*/
+
+// timeSetter is implemented by worker file systems that can restore
+// the modification time of a transferred file
+type timeSetter interface {
+	Chtimes(ctx context.Context, name string, atime time.Time, mtime time.Time) error
+}
+
+// ctxReader stops the transfer when the request context is cancelled
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// transferBetweenWorkers copy src in srcFs to dst in destFs. If isMove is set,
+// the source will be removed after the whole tree is copied successfully.
+// If the transfer failed, the partly written copy is removed from destFs.
+func transferBetweenWorkers(ctx context.Context, srcFs RouterDirHandler, destFs RouterDirHandler, src string, dst string, depth int, isMove bool) error {
+	err := copyTree(ctx, srcFs, destFs, src, dst, depth)
+	if err != nil {
+		//Clean up the partly written copy
+		if cleanupErr := destFs.RemoveAll(ctx, dst); cleanupErr != nil && !os.IsNotExist(cleanupErr) {
+			log.Println("[bokofs] Unable to clean up failed transfer at "+dst+": ", cleanupErr)
+		}
+		return err
+	}
+
+	if isMove {
+		//Only remove the source after everything is copied
+		return srcFs.RemoveAll(ctx, src)
+	}
+	return nil
+}
+
+// copyTree recursively copy a file or folder from srcFs to destFs, keeping the mtimes
+// set depth to 0 to only copy the folder itself without its children
+func copyTree(ctx context.Context, srcFs RouterDirHandler, destFs RouterDirHandler, src string, dst string, depth int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	srcFile, err := srcFs.OpenFile(ctx, src, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	srcStat, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+	srcPerm := srcStat.Mode() & os.ModePerm
+
+	if srcStat.IsDir() {
+		if err := destFs.Mkdir(ctx, dst, srcPerm); err != nil {
+			return err
+		}
+
+		if depth != 0 {
+			children, err := srcFile.Readdir(-1)
+			if err != nil {
+				return err
+			}
+
+			for _, child := range children {
+				err = copyTree(ctx, srcFs, destFs, path.Join(src, child.Name()), path.Join(dst, child.Name()), depth)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		destFile, err := destFs.OpenFile(ctx, dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, srcPerm)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(destFile, &ctxReader{ctx: ctx, r: srcFile})
+		if err != nil {
+			destFile.Close()
+			return err
+		}
+
+		if err := destFile.Close(); err != nil {
+			return err
+		}
+	}
+
+	//Restore the modification time after the content (and children) are written
+	if ts, ok := destFs.(timeSetter); ok {
+		if err := ts.Chtimes(ctx, dst, time.Now(), srcStat.ModTime()); err != nil {
+			log.Println("[bokofs] Unable to restore mtime of "+dst+": ", err)
+		}
+	}
+	return nil
+}
+
+// serveCrossWorkerCopy handle a WebDAV COPY request if its source and destination
+// are in different workers. Return false if the request should be handled by the
+// default webdav handler instead.
+func (r *RootRouter) serveCrossWorkerCopy(w http.ResponseWriter, req *http.Request, ls webdav.LockSystem) bool {
+	if req.Method != "COPY" {
+		return false
+	}
+
+	hdr := req.Header.Get("Destination")
+	if hdr == "" {
+		return false
+	}
+	u, err := url.Parse(hdr)
+	if err != nil || (u.Host != "" && u.Host != req.Host) {
+		return false
+	}
+
+	if req.Header.Get("If") != "" {
+		//Requests holding their own locks are left to the webdav handler
+		return false
+	}
+
+	src := r.fixpath(req.URL.Path)
+	dst := r.fixpath(u.Path)
+	if r.isVirtualPath(src) || r.isVirtualPath(dst) {
+		//Let the webdav handler reject it
+		return false
+	}
+
+	srcWorker, err := r.getWorkerByPath(src)
+	if err != nil {
+		return false
+	}
+	destWorker, err := r.getWorkerByPath(dst)
+	if err != nil || srcWorker == destWorker {
+		return false
+	}
+
+	//From here on, this is a cross worker copy
+	ctx := req.Context()
+	if r.checkAccess(ctx, srcWorker, false) != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return true
+	}
+
+	if err := r.checkAccess(ctx, destWorker, true); err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Conflict", http.StatusConflict)
+		} else {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		}
+		return true
+	}
+
+	if r.isReadOnly() || destWorker.ReadOnly {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return true
+	}
+
+	depth := -1
+	switch req.Header.Get("Depth") {
+	case "", "infinity":
+		depth = -1
+	case "0":
+		depth = 0
+	default:
+		http.Error(w, "Bad Request - Invalid depth", http.StatusBadRequest)
+		return true
+	}
+	overwrite := req.Header.Get("Overwrite") != "F"
+
+	//COPY only needs to lock the destination. Hold a temporary lock like
+	//the webdav handler does so it conflicts with locks of other clients
+	now := time.Now()
+	lockToken, err := ls.Create(now, webdav.LockDetails{
+		Root:      u.Path,
+		Duration:  -1,
+		ZeroDepth: true,
+	})
+	if err != nil {
+		http.Error(w, "Locked", http.StatusLocked)
+		return true
+	}
+	defer ls.Unlock(now, lockToken)
+
+	srcFs, err := r.getFileSystemFromWorker(srcWorker)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return true
+	}
+	destFs, err := r.getFileSystemFromWorker(destWorker)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return true
+	}
+
+	if _, err := srcFs.Stat(ctx, src); err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return true
+	}
+
+	created := true
+	if _, err := destFs.Stat(ctx, dst); err == nil {
+		if !overwrite {
+			http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+			return true
+		}
+		if err := destFs.RemoveAll(ctx, dst); err != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return true
+		}
+		created = false
+	}
+
+	err = transferBetweenWorkers(ctx, srcFs, destFs, src, dst, depth, false)
+	if err != nil {
+		log.Printf("WEBDAV [COPY]: %s -> %s, ERROR: %s\n", src, dst, err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return true
+	}
+
+	log.Printf("WEBDAV [COPY]: %s -> %s \n", src, dst)
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package bokofs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+	"imuslab.com/bokofs/bokofsd/mod/bokofs/bokofile"
+)
+
+// failingDir is a worker file system that fails to create the given file
+type failingDir struct {
+	*bokofile.RouterDir
+	failOn string
+}
+
+func (f *failingDir) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if name == f.failOn && flag&os.O_CREATE != 0 {
+		return nil, errors.New("disk full")
+	}
+	return f.RouterDir.OpenFile(ctx, name, flag, perm)
+}
+
+// createTestWorkers creates the file systems of two workers, disk1 with a test tree
+func createTestWorkers(t *testing.T) (*bokofile.RouterDir, *bokofile.RouterDir, string, string) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	files := map[string]string{
+		"photos/a.jpg":         "aaaa",
+		"photos/2020/b.jpg":    "bbbbbbbb",
+		"photos/2020/notes.md": "hello",
+	}
+	for name, content := range files {
+		realPath := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(realPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(realPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(realPath, mtime, mtime)
+	}
+	os.Chtimes(filepath.Join(srcDir, "photos", "2020"), mtime, mtime)
+	os.Chtimes(filepath.Join(srcDir, "photos"), mtime, mtime)
+
+	srcFs, err := bokofile.CreateRouterFromDir(srcDir, "/disk1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	destFs, err := bokofile.CreateRouterFromDir(destDir, "/disk2", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srcFs, destFs, srcDir, destDir
+}
+
+func TestTransferBetweenWorkersCopy(t *testing.T) {
+	srcFs, destFs, srcDir, destDir := createTestWorkers(t)
+
+	err := transferBetweenWorkers(context.Background(), srcFs, destFs, "/disk1/photos", "/disk2/backup", -1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", "a.jpg", "2020", "2020/b.jpg", "2020/notes.md"} {
+		srcInfo, err := os.Stat(filepath.Join(srcDir, "photos", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		destInfo, err := os.Stat(filepath.Join(destDir, "backup", name))
+		if err != nil {
+			t.Errorf("%s: not copied: %v", name, err)
+			continue
+		}
+		if destInfo.Size() != srcInfo.Size() && !srcInfo.IsDir() {
+			t.Errorf("%s: expected size %d, got %d", name, srcInfo.Size(), destInfo.Size())
+		}
+		if !destInfo.ModTime().Equal(srcInfo.ModTime()) {
+			t.Errorf("%s: expected mtime %v, got %v", name, srcInfo.ModTime(), destInfo.ModTime())
+		}
+	}
+
+	content, _ := os.ReadFile(filepath.Join(destDir, "backup", "2020", "b.jpg"))
+	if string(content) != "bbbbbbbb" {
+		t.Errorf("unexpected content %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(srcDir, "photos")); err != nil {
+		t.Errorf("expected the source to be kept after copy: %v", err)
+	}
+}
+
+func TestTransferBetweenWorkersZeroDepth(t *testing.T) {
+	srcFs, destFs, _, destDir := createTestWorkers(t)
+
+	err := transferBetweenWorkers(context.Background(), srcFs, destFs, "/disk1/photos", "/disk2/photos", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(filepath.Join(destDir, "photos"))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected an empty folder, got %v (%v)", entries, err)
+	}
+}
+
+func TestTransferBetweenWorkersMove(t *testing.T) {
+	srcFs, destFs, srcDir, destDir := createTestWorkers(t)
+
+	err := transferBetweenWorkers(context.Background(), srcFs, destFs, "/disk1/photos/2020", "/disk2/2020", -1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(srcDir, "photos", "2020")); !os.IsNotExist(err) {
+		t.Errorf("expected the source to be removed after move, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "2020", "notes.md")); err != nil {
+		t.Errorf("expected the moved file at destination: %v", err)
+	}
+}
+
+func TestTransferBetweenWorkersCleanup(t *testing.T) {
+	srcFs, destFs, srcDir, destDir := createTestWorkers(t)
+
+	//Fail in the middle of the tree after some files are written
+	failing := &failingDir{RouterDir: destFs, failOn: "/disk2/photos/2020/notes.md"}
+	err := transferBetweenWorkers(context.Background(), srcFs, failing, "/disk1/photos", "/disk2/photos", -1, true)
+	if err == nil {
+		t.Fatal("expected the transfer to fail")
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "photos")); !os.IsNotExist(err) {
+		t.Errorf("expected the partial copy to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(srcDir, "photos", "2020", "notes.md")); err != nil {
+		t.Errorf("expected the source to be kept after a failed move: %v", err)
+	}
+
+	//A cancelled request also removes the partial copy
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = transferBetweenWorkers(ctx, srcFs, destFs, "/disk1/photos", "/disk2/photos", -1, false)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context cancelled error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "photos")); !os.IsNotExist(err) {
+		t.Errorf("expected no copy after cancel, got %v", err)
+	}
+}
@@ -19,3 +19,11 @@ type FlowRouter interface {
 	Rename(ctx context.Context, oldName, newName string) error
 	Stat(ctx context.Context, name string) (os.FileInfo, error)
 }
+
+/*
+AccessChecker
+
+This function is used to check if the request context is allowed
+to access a worker. Set write to true to check for write access
+*/
+type AccessChecker func(ctx context.Context, nodeName string, write bool) bool
@@ -1,6 +1,11 @@
 package bokofs
 
-import "imuslab.com/bokofs/bokofsd/mod/bokofs/bokoworker"
+import (
+	"context"
+	"os"
+
+	"imuslab.com/bokofs/bokofsd/mod/bokofs/bokoworker"
+)
 
 // GetRegisteredRootFolders returns all the registered root folders
 // by loaded bokoFS workers. This will be shown when the client
@@ -14,3 +19,29 @@ func (s *Server) GetRegisteredRootFolders() ([]string, error) {
 	})
 	return rootFolders, nil
 }
+
+// ResolvePath returns the path on disk of a file served by the workers,
+// e.g. /disk1/photos/a.jpg. Files in workers that cannot be read by the
+// requester of ctx are reported as not exist
+func (s *Server) ResolvePath(ctx context.Context, name string) (string, error) {
+	rootRouter, ok := s.FsRouter.(*RootRouter)
+	if !ok {
+		return "", os.ErrInvalid
+	}
+
+	name = rootRouter.fixpath(name)
+	if name == "/" {
+		return "", os.ErrNotExist
+	}
+
+	targetWorker, err := rootRouter.getWorkerByPath(name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := rootRouter.checkAccess(ctx, targetWorker, false); err != nil {
+		return "", os.ErrNotExist
+	}
+
+	return targetWorker.Filesystem.ResolvePath(name), nil
+}
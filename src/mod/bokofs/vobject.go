@@ -12,11 +12,22 @@ package bokofs
 */
 
 import (
+	"context"
+	"encoding/xml"
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/net/webdav"
+	"imuslab.com/bokofs/bokofsd/mod/bokofs/bokoworker"
+)
+
+const (
+	PROP_NAMESPACE_BOKOFS    = "http://imuslab.com/bokofs/"
+	PROP_NAMESPACE_MICROSOFT = "urn:schemas-microsoft-com:"
 )
 
 type vObjectProperties struct {
@@ -35,6 +46,7 @@ type vObjectFileInfo struct {
 type vObject struct {
 	properties *vObjectProperties
 	parent     *RootRouter
+	ctx        context.Context //Context of the request that opened this object, for access checking
 }
 
 // newVirtualObject creates a new virtual object
@@ -101,6 +113,11 @@ func (r *vObject) Readdir(count int) ([]os.FileInfo, error) {
 	// Generate the folder structure
 	var folderList []os.FileInfo
 	for _, folder := range rootFolders {
+		if !r.canList(folder) {
+			//Hide the workers that the requester has no access to
+			continue
+		}
+
 		thisVirtualObject := r.parent.newVirtualObject(&vObjectProperties{
 			name:    folder,
 			size:    0,
@@ -114,6 +131,19 @@ func (r *vObject) Readdir(count int) ([]os.FileInfo, error) {
 	return folderList, nil
 }
 
+// canList checks if the worker root folder should be listed to the requester
+func (r *vObject) canList(nodeName string) bool {
+	checker := r.parent.parent.accessChecker
+	if checker == nil {
+		return true
+	}
+
+	if r.ctx == nil {
+		return false
+	}
+	return checker(r.ctx, strings.TrimPrefix(nodeName, "/"), false)
+}
+
 func (r *vObject) Seek(offset int64, whence int) (int64, error) {
 	return 0, nil
 }
@@ -128,3 +158,60 @@ func (r *vObject) Stat() (os.FileInfo, error) {
 
 // Ensure vObject implements the File interface
 var _ webdav.File = (*vObject)(nil)
+
+/*
+	Worker Root File
+
+	The worker root file wraps the root folder of a worker so the worker
+	properties (e.g. read only) can be advertised to the WebDAV clients
+	when they PROPFIND the virtual root
+*/
+
+type workerRootFile struct {
+	webdav.File
+	readOnly bool
+}
+
+// newWorkerRootFile wraps the root folder file of a worker. The folder is
+// shown as read only if the requester has no write access to the worker
+func (p *RootRouter) newWorkerRootFile(ctx context.Context, f webdav.File, worker *bokoworker.Worker) *workerRootFile {
+	return &workerRootFile{
+		File:     f,
+		readOnly: worker.ReadOnly || p.isReadOnly() || p.checkAccess(ctx, worker, true) != nil,
+	}
+}
+
+func (r *workerRootFile) DeadProps() (map[xml.Name]webdav.Property, error) {
+	//Windows uses Win32FileAttributes to show the read only flag, 0x10 is directory and 0x01 is read only
+	win32Attr := 0x10
+	if r.readOnly {
+		win32Attr = win32Attr | 0x01
+	}
+
+	readOnlyName := xml.Name{Space: PROP_NAMESPACE_BOKOFS, Local: "readonly"}
+	win32AttrName := xml.Name{Space: PROP_NAMESPACE_MICROSOFT, Local: "Win32FileAttributes"}
+	return map[xml.Name]webdav.Property{
+		readOnlyName: {
+			XMLName:  readOnlyName,
+			InnerXML: []byte(strconv.FormatBool(r.readOnly)),
+		},
+		win32AttrName: {
+			XMLName:  win32AttrName,
+			InnerXML: []byte(fmt.Sprintf("%08x", win32Attr)),
+		},
+	}, nil
+}
+
+func (r *workerRootFile) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	//Worker properties can only be changed from the worker settings
+	propstat := webdav.Propstat{Status: http.StatusForbidden}
+	for _, patch := range patches {
+		for _, prop := range patch.Props {
+			propstat.Props = append(propstat.Props, webdav.Property{XMLName: prop.XMLName})
+		}
+	}
+	return []webdav.Propstat{propstat}, nil
+}
+
+// Ensure workerRootFile implements the DeadPropsHolder interface
+var _ webdav.DeadPropsHolder = (*workerRootFile)(nil)
@@ -116,3 +116,28 @@ func GetBlockStat(blockName string) (*BlockStat, error) {
 		TimeInQueue:  values[10],
 	}, nil
 }
+
+// ListBlockDevices returns the name of all disks and md devices in /sys/block,
+// virtual devices like loop, ram and zram are excluded
+func ListBlockDevices() ([]string, error) {
+	entries, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return nil, err
+	}
+
+	excludedPrefixes := []string{"loop", "ram", "zram", "sr", "fd"}
+	results := []string{}
+	for _, entry := range entries {
+		excluded := false
+		for _, prefix := range excludedPrefixes {
+			if strings.HasPrefix(entry.Name(), prefix) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			results = append(results, entry.Name())
+		}
+	}
+	return results, nil
+}
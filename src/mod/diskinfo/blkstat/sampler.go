@@ -0,0 +1,205 @@
+//go:build linux
+// +build linux
+
+package blkstat
+
+/*
+	sampler.go
+
+	The sampler reads the block statistics of all disks and md devices
+	periodically, and turns the accumulated counters into rates by
+	diffing the successive samples
+*/
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const sectorSize = 512 //Sectors in /sys/block/<dev>/stat are always 512 bytes
+
+type IOStat struct {
+	DeviceName       string  //e.g. sda or md0
+	ReadBytesPerSec  float64 //Read throughput in bytes per second
+	WriteBytesPerSec float64 //Write throughput in bytes per second
+	ReadIOPS         float64 //Completed read requests per second
+	WriteIOPS        float64 //Completed write requests per second
+	ReadLatency      float64 //Average time per read request in ms
+	WriteLatency     float64 //Average time per write request in ms
+	QueueDepth       float64 //Average no. of requests in queue
+	InFlight         uint64  //No. of requests in flight at the time of sampling
+	Utilization      float64 //Percentage of time the device was busy, 0 - 100
+	Timestamp        int64   //Unix timestamp of the sample
+}
+
+type Sampler struct {
+	Interval time.Duration
+	OnSample func(stats []*IOStat) //Optional, called after each sampling
+
+	/* Private Properties */
+	stats      map[string]*IOStat
+	previous   map[string]*BlockStat
+	lastSample time.Time
+	mutex      sync.RWMutex
+	stopChan   chan bool
+}
+
+// NewSampler creates a new block device sampler with the given sampling interval
+func NewSampler(interval time.Duration) *Sampler {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &Sampler{
+		Interval: interval,
+		stats:    map[string]*IOStat{},
+		previous: map[string]*BlockStat{},
+		stopChan: make(chan bool),
+	}
+}
+
+// Start starts sampling in the background
+func (s *Sampler) Start() {
+	s.sample()
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopChan:
+				return
+			case <-ticker.C:
+				s.sample()
+			}
+		}
+	}()
+}
+
+// Stop stops the background sampling
+func (s *Sampler) Stop() {
+	s.stopChan <- true
+}
+
+// Get returns the latest I/O statistic of a device
+func (s *Sampler) Get(deviceName string) (*IOStat, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	stat, ok := s.stats[deviceName]
+	if !ok {
+		return nil, errors.New("device not found or not sampled yet")
+	}
+	thisStat := *stat
+	return &thisStat, nil
+}
+
+// GetAll returns the latest I/O statistics of all devices, sorted by device name
+func (s *Sampler) GetAll() []*IOStat {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	results := []*IOStat{}
+	for _, stat := range s.stats {
+		thisStat := *stat
+		results = append(results, &thisStat)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].DeviceName < results[j].DeviceName
+	})
+	return results
+}
+
+// sample reads the block statistics of all devices and update the rates
+func (s *Sampler) sample() {
+	devices, err := ListBlockDevices()
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	s.mutex.Lock()
+	elapsed := now.Sub(s.lastSample)
+	s.lastSample = now
+
+	current := map[string]*BlockStat{}
+	for _, dev := range devices {
+		stat, err := GetBlockStat(dev)
+		if err != nil {
+			continue
+		}
+		current[dev] = stat
+
+		previous, ok := s.previous[dev]
+		if !ok || elapsed <= 0 {
+			//First sample of this device, rates can only be calculated on the next sample
+			continue
+		}
+		s.stats[dev] = calculateIOStat(dev, previous, stat, elapsed, now)
+	}
+
+	//Remove devices that are unplugged
+	for dev := range s.stats {
+		if _, ok := current[dev]; !ok {
+			delete(s.stats, dev)
+		}
+	}
+	s.previous = current
+
+	results := []*IOStat{}
+	for _, stat := range s.stats {
+		thisStat := *stat
+		results = append(results, &thisStat)
+	}
+	s.mutex.Unlock()
+
+	if s.OnSample != nil && len(results) > 0 {
+		s.OnSample(results)
+	}
+}
+
+// calculateIOStat calculates the rates between two samples
+func calculateIOStat(dev string, previous *BlockStat, current *BlockStat, elapsed time.Duration, now time.Time) *IOStat {
+	seconds := elapsed.Seconds()
+	elapsedMs := float64(elapsed.Milliseconds())
+
+	readIOs := counterDelta(previous.ReadIOs, current.ReadIOs)
+	writeIOs := counterDelta(previous.WriteIOs, current.WriteIOs)
+	readTicks := counterDelta(previous.ReadTicks, current.ReadTicks)
+	writeTicks := counterDelta(previous.WriteTicks, current.WriteTicks)
+
+	result := IOStat{
+		DeviceName:       dev,
+		ReadBytesPerSec:  float64(counterDelta(previous.ReadSectors, current.ReadSectors)*sectorSize) / seconds,
+		WriteBytesPerSec: float64(counterDelta(previous.WriteSectors, current.WriteSectors)*sectorSize) / seconds,
+		ReadIOPS:         float64(readIOs) / seconds,
+		WriteIOPS:        float64(writeIOs) / seconds,
+		InFlight:         current.InFlight,
+		Timestamp:        now.Unix(),
+	}
+
+	if readIOs > 0 {
+		result.ReadLatency = float64(readTicks) / float64(readIOs)
+	}
+
+	if writeIOs > 0 {
+		result.WriteLatency = float64(writeTicks) / float64(writeIOs)
+	}
+
+	if elapsedMs > 0 {
+		//Both io_ticks and time_in_queue are in ms
+		result.QueueDepth = float64(counterDelta(previous.TimeInQueue, current.TimeInQueue)) / elapsedMs
+		result.Utilization = float64(counterDelta(previous.IoTicks, current.IoTicks)) / elapsedMs * 100
+		if result.Utilization > 100 {
+			result.Utilization = 100
+		}
+	}
+
+	return &result
+}
+
+// counterDelta returns the difference of two counter values, 0 if the counter is reset
+func counterDelta(previous uint64, current uint64) uint64 {
+	if current < previous {
+		return 0
+	}
+	return current - previous
+}
@@ -5,8 +5,7 @@ import (
 	"os"
 	"strings"
 
-	"imuslab.com/bokofs/bokofsd/mod/diskinfo/blkid"
-	"imuslab.com/bokofs/bokofsd/mod/diskinfo/lsblk"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
 )
 
 // Get a disk by its device path, accept both /dev/sda and sda
@@ -36,7 +35,7 @@ func NewBlockFromDevicePath(devpath string) (*Block, error) {
 // UpdateProperties updates the properties of the disk.
 func (d *Block) UpdateProperties() error {
 	//Try to get the block device info
-	blockDeviceInfo, err := lsblk.GetBlockDeviceInfoFromDevicePath(d.Path)
+	blockDeviceInfo, err := inventory.Default().Get(d.Path)
 	if err != nil {
 		return err
 	}
@@ -45,23 +44,16 @@ func (d *Block) UpdateProperties() error {
 	d.Name = blockDeviceInfo.Name
 	d.Size = blockDeviceInfo.Size
 	d.BlockType = blockDeviceInfo.Type
-	//d.MountPoint = blockDeviceInfo.MountPoint
+	d.MountPoint = blockDeviceInfo.MountPoint()
 
 	if d.BlockType == "disk" {
 		//This block is a disk not a partition. There is no partition ID info
-		//So we can skip the blkid call
 		return nil
 	}
 
-	// Get the partition ID
-	diskIdInfo, err := blkid.GetPartitionIDFromDevicePath(d.Path)
-	if err != nil {
-		return err
-	}
-
 	// Update the disk properties with ID info
-	d.UUID = diskIdInfo.UUID
-	d.FsType = diskIdInfo.Type
-	d.BlockSize = diskIdInfo.BlockSize
+	d.UUID = blockDeviceInfo.UUID
+	d.FsType = blockDeviceInfo.FsType
+	d.BlockSize = blockDeviceInfo.BlockSize
 	return nil
 }
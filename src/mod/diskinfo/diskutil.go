@@ -2,20 +2,14 @@ package diskinfo
 
 import (
 	"errors"
-	"path/filepath"
 	"strings"
 
-	"log"
-
-	"imuslab.com/bokofs/bokofsd/mod/diskinfo/blkid"
-	"imuslab.com/bokofs/bokofsd/mod/diskinfo/df"
-	"imuslab.com/bokofs/bokofsd/mod/diskinfo/fdisk"
-	"imuslab.com/bokofs/bokofsd/mod/diskinfo/lsblk"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
 )
 
 // GetAllDisks retrieves all disks on the system.
 func GetAllDisks() ([]*Disk, error) {
-	allBlockDevices, err := lsblk.GetLSBLKOutput()
+	allBlockDevices, err := inventory.Default().Disks()
 	if err != nil {
 		return nil, err
 	}
@@ -37,58 +31,22 @@ func GetAllDisks() ([]*Disk, error) {
 
 // DevicePathIsValidDisk checks if the given device path is a disk.
 func DevicePathIsValidDisk(path string) bool {
-	//Make sure the path has a prefix and a trailing slash
-	if !strings.HasPrefix(path, "/dev/") {
-		path = "/dev/" + path
-	}
-
-	path = strings.TrimSuffix(path, "/")
-
-	allBlockDevices, err := lsblk.GetLSBLKOutput()
+	device, err := inventory.Default().Get(path)
 	if err != nil {
-		log.Println("Error getting block devices:", err)
 		return false
 	}
-
-	for _, blockDevice := range allBlockDevices {
-		if "/dev/"+blockDevice.Name == path {
-			return blockDevice.Type == "disk"
-		}
-	}
-
-	return false
+	return device.Type == "disk"
 }
 
 // DevicePathIsPartition checks if the given device path is a valid partition.
 func DevicePathIsValidPartition(path string) bool {
-	//Make sure the path has a prefix and a trailing slash
-	if !strings.HasPrefix(path, "/dev/") {
-		path = "/dev/" + path
-	}
-
-	path = strings.TrimSuffix(path, "/")
-
-	allBlockDevices, err := lsblk.GetLSBLKOutput()
+	device, err := inventory.Default().Get(path)
 	if err != nil {
 		return false
 	}
-
-	for _, blockDevice := range allBlockDevices {
-		if !strings.HasPrefix(path, "/dev/"+blockDevice.Name) {
-			//Skip this block device
-			//This is not a partition of this block device
-			continue
-		}
-		for _, child := range blockDevice.Children {
-			if "/dev/"+child.Name == path {
-				//As there are too many partition types
-				//We can only check if the block device is not a disk and exists
-				return true
-			}
-		}
-	}
-
-	return false
+	//As there are too many partition types
+	//We can only check if the block device is a partition of a disk
+	return device.Type == "part"
 }
 
 // GetDiskInfo retrieves the disk information for a given disk name.
@@ -101,100 +59,74 @@ func GetDiskInfo(diskname string) (*Disk, error) {
 	//Make sure the diskname is something like sda
 	diskname = strings.TrimPrefix(diskname, "/dev/")
 
+	device, err := inventory.Default().Get(diskname)
+	if err != nil {
+		return nil, err
+	}
+
 	//Create a new disk object
 	thisDisk := &Disk{
-		Name:       diskname,
-		Size:       0,
+		Name:       device.Name,
+		Identifier: device.PartTableUUID,
+		Model:      device.Model,
+		Size:       device.Size,
+		DiskLabel:  device.PartTableType,
 		BlockType:  "disk",
 		Partitions: []*Partition{},
 	}
 
-	//Try to get the disk model and identifier
-	diskInfo, err := fdisk.GetDiskModelAndIdentifier(diskname)
-	if err == nil {
-		thisDisk.Model = diskInfo.Model
-		thisDisk.Identifier = diskInfo.Identifier
-		thisDisk.DiskLabel = diskInfo.DiskLabel
-	}
-
-	//Calculation variables for total disk used space
-	totalDiskUseSpace := int64(0)
-
 	//Populate the partitions
-	allBlockDevices, err := lsblk.GetLSBLKOutput()
+	partitions, err := inventory.Default().Partitions(diskname)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, blockDevice := range allBlockDevices {
-		if blockDevice.Name == diskname {
-			thisDisk.Size = blockDevice.Size
-			for _, partition := range blockDevice.Children {
-				//Get the partition information from blkid
-				partition := &Partition{
-					Name:       partition.Name,
-					Size:       partition.Size,
-					Path:       filepath.Join("/dev", partition.Name),
-					BlockType:  partition.Type,
-					MountPoint: partition.MountPoint,
-				}
-
-				//Get the partition ID
-				blkInfo, err := blkid.GetPartitionIDFromDevicePath(partition.Name)
-				if err == nil {
-					partition.UUID = blkInfo.UUID
-					partition.PartUUID = blkInfo.PartUUID
-					partition.PartLabel = blkInfo.PartLabel
-					partition.BlockSize = blkInfo.BlockSize
-					partition.BlockType = blkInfo.Type
-					partition.FsType = blkInfo.Type
-				}
-
-				//Get the disk usage information
-				diskUsage, err := df.GetDiskUsageByPath(partition.Name)
-				if err == nil {
-					partition.Used = diskUsage.Used
-					partition.Free = diskUsage.Available
-				}
-
-				thisDisk.Partitions = append(thisDisk.Partitions, partition)
-			}
-
-		}
+	totalDiskUseSpace := int64(0)
+	for _, partDevice := range partitions {
+		partition := newPartition(partDevice)
+		totalDiskUseSpace += partition.Used
+		thisDisk.Partitions = append(thisDisk.Partitions, partition)
 	}
 
 	//Calculate the total disk used space
-	for _, partition := range thisDisk.Partitions {
-		totalDiskUseSpace += partition.Used
-	}
 	thisDisk.Used = totalDiskUseSpace
 	thisDisk.Free = thisDisk.Size - totalDiskUseSpace
 	return thisDisk, nil
 }
 
+// GetPartitionInfo retrieves the partition information for a given partition name, e.g. sda1
 func GetPartitionInfo(partitionName string) (*Partition, error) {
-	partition := &Partition{
-		Name: partitionName,
-	}
-	partInfo, err := blkid.GetPartitionIDFromDevicePath(partitionName)
-	if err == nil {
-		partition.UUID = partInfo.UUID
-		partition.PartUUID = partInfo.PartUUID
-		partition.PartLabel = partInfo.PartLabel
-		partition.BlockSize = partInfo.BlockSize
-		partition.BlockType = partInfo.Type
-		partition.FsType = partInfo.Type
+	device, err := inventory.Default().Get(partitionName)
+	if err != nil {
+		return nil, err
 	}
-	//Get the disk usage information
-	diskUsage, err := df.GetDiskUsageByPath(partitionName)
-	if err == nil {
-		partition.Used = diskUsage.Used
-		partition.Free = diskUsage.Available
-		partition.MountPoint = diskUsage.MountedOn
+	return newPartition(device), nil
+}
 
+// newPartition converts an inventory device to a partition and fills in the disk usage if mounted
+func newPartition(device *inventory.Device) *Partition {
+	partition := &Partition{
+		UUID:       device.UUID,
+		PartUUID:   device.PartUUID,
+		PartLabel:  device.PartLabel,
+		Name:       device.Name,
+		Path:       device.Path,
+		Size:       device.Size,
+		BlockSize:  device.BlockSize,
+		BlockType:  device.Type,
+		FsType:     device.FsType,
+		MountPoint: device.MountPoint(),
 	}
 
-	return partition, nil
+	//Get the disk usage information
+	if partition.MountPoint != "" {
+		used, free, err := inventory.GetUsage(partition.MountPoint)
+		if err == nil {
+			partition.Used = used
+			partition.Free = free
+		}
+	}
+	return partition
 }
 
 // GetDevicePathFromPartitionID retrieves the device path for a given partition ID.
@@ -203,20 +135,9 @@ func GetDevicePathFromPartitionID(diskID string) (string, error) {
 		return "", errors.New("disk ID is empty")
 	}
 
-	// Try to get the block device info
-	allBlockDevices, err := lsblk.GetLSBLKOutput()
-	if err != nil {
-		return "", err
+	device, err := inventory.Default().Get(diskID)
+	if err != nil || device.Type != "part" {
+		return "", errors.New("disk ID not found")
 	}
-
-	for _, blockDevice := range allBlockDevices {
-		//Check each of the children to see if there is a partition with the given ID
-		for _, child := range blockDevice.Children {
-			if child.Name == diskID {
-				return child.Name, nil
-			}
-		}
-	}
-
-	return "", errors.New("disk ID not found")
+	return device.Name, nil
 }
@@ -0,0 +1,237 @@
+package inventory
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+	Inventory
+
+	The inventory builds the tree of disks and partitions from /sys/class/block,
+	/run/udev/data, /dev/disk/by-* and /proc/mounts without forking lsblk, blkid
+	or fdisk. The result is cached until it is invalidated, either manually,
+	by a block device uevent from the kernel (see uevent_linux.go) or when
+	the content of /proc/mounts changed, as mounting does not raise uevents
+*/
+
+type Device struct {
+	Name            string   `json:"name"`            //e.g. sda, sda1, nvme0n1p1, md0
+	Path            string   `json:"path"`            //e.g. /dev/sda1
+	Type            string   `json:"type"`            //disk, part, loop, dm or the md level (e.g. raid1), same as lsblk
+	Parent          string   `json:"parent"`          //The disk of a partition, empty for disks
+	Major           int      `json:"major"`           //Device major number
+	Minor           int      `json:"minor"`           //Device minor number
+	Size            int64    `json:"size"`            //Size in bytes
+	BlockSize       int      `json:"blocksize"`       //Logical block size in bytes
+	PartitionNumber int      `json:"partitionnumber"` //Partition number, 0 for disks
+	Model           string   `json:"model"`           //Disk model, e.g. Samsung SSD 860 EVO 1TB
+	Serial          string   `json:"serial"`          //Disk serial number
+	PartTableType   string   `json:"parttabletype"`   //Partition table of a disk, gpt or dos
+	PartTableUUID   string   `json:"parttableuuid"`   //Disk identifier, e.g. 0x12345678 for dos
+	UUID            string   `json:"uuid"`            //UUID of the file system
+	Label           string   `json:"label"`           //Label of the file system
+	FsType          string   `json:"fstype"`          //File system type, e.g. ext4
+	PartUUID        string   `json:"partuuid"`        //Partition UUID
+	PartLabel       string   `json:"partlabel"`       //Partition label (GPT only)
+	MountPoints     []string `json:"mountpoints"`     //Where the device is mounted
+	Holders         []string `json:"holders"`         //Devices built on top of this device, e.g. md0
+	Transport       string   `json:"transport"`       //Bus of the disk, e.g. ata, usb, nvme, empty if unknown
+	Removable       bool     `json:"removable"`
+	ReadOnly        bool     `json:"readonly"`
+	Rotational      bool     `json:"rotational"`
+}
+
+// MountPoint returns the first mount point of the device, or empty string if not mounted
+func (d *Device) MountPoint() string {
+	if len(d.MountPoints) == 0 {
+		return ""
+	}
+	return d.MountPoints[0]
+}
+
+type Options struct {
+	SysClassBlock string //Default /sys/class/block
+	UdevData      string //Default /run/udev/data
+	DevDisk       string //Default /dev/disk
+	ProcMounts    string //Default /proc/mounts
+	DevRoot       string //Default /dev, used to probe file systems if udev data is not available
+}
+
+type Inventory struct {
+	options    *Options
+	devices    map[string]*Device
+	mountTable []byte //Content of /proc/mounts when the devices are scanned
+	valid      bool
+	mutex      sync.RWMutex
+	onChange   func(action string, devname string)
+	stopChan   chan bool
+}
+
+var defaultInventory = NewInventory(&Options{})
+
+// Default returns the shared inventory of this host
+func Default() *Inventory {
+	return defaultInventory
+}
+
+// NewInventory creates an inventory, leave the options empty to use the system paths
+func NewInventory(options *Options) *Inventory {
+	if options.SysClassBlock == "" {
+		options.SysClassBlock = "/sys/class/block"
+	}
+	if options.UdevData == "" {
+		options.UdevData = "/run/udev/data"
+	}
+	if options.DevDisk == "" {
+		options.DevDisk = "/dev/disk"
+	}
+	if options.ProcMounts == "" {
+		options.ProcMounts = "/proc/mounts"
+	}
+	if options.DevRoot == "" {
+		options.DevRoot = "/dev"
+	}
+	return &Inventory{
+		options: options,
+		devices: map[string]*Device{},
+	}
+}
+
+// Invalidate drops the cache, the next query will rescan the devices
+func (inv *Inventory) Invalidate() {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	inv.valid = false
+}
+
+// Refresh rescans the devices immediately
+func (inv *Inventory) Refresh() error {
+	devices, mountTable, err := inv.scan()
+	if err != nil {
+		return err
+	}
+
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	inv.devices = devices
+	inv.mountTable = mountTable
+	inv.valid = true
+	return nil
+}
+
+// snapshot returns the cached devices, rescan if the cache is invalidated
+func (inv *Inventory) snapshot() (map[string]*Device, error) {
+	mountTable, _ := os.ReadFile(inv.options.ProcMounts)
+	inv.mutex.RLock()
+	if inv.valid && bytes.Equal(inv.mountTable, mountTable) {
+		devices := inv.devices
+		inv.mutex.RUnlock()
+		return devices, nil
+	}
+	inv.mutex.RUnlock()
+
+	if err := inv.Refresh(); err != nil {
+		return nil, err
+	}
+
+	inv.mutex.RLock()
+	defer inv.mutex.RUnlock()
+	return inv.devices, nil
+}
+
+// Get returns a device by its name or path, accept both sda1 and /dev/sda1
+func (inv *Inventory) Get(name string) (*Device, error) {
+	devices, err := inv.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "/dev/"), "/")
+	device, ok := devices[name]
+	if !ok {
+		return nil, errors.New("device not found")
+	}
+	return device, nil
+}
+
+// GetByUUID returns the device with the given file system UUID
+func (inv *Inventory) GetByUUID(uuid string) (*Device, error) {
+	devices, err := inv.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, device := range sortedDevices(devices) {
+		if device.UUID != "" && strings.EqualFold(device.UUID, uuid) {
+			return device, nil
+		}
+	}
+	return nil, errors.New("device not found")
+}
+
+// List returns all devices sorted by name
+func (inv *Inventory) List() ([]*Device, error) {
+	devices, err := inv.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return sortedDevices(devices), nil
+}
+
+// Disks returns all devices that are not partitions, e.g. disks and md devices
+func (inv *Inventory) Disks() ([]*Device, error) {
+	devices, err := inv.List()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*Device{}
+	for _, device := range devices {
+		if device.Parent == "" {
+			results = append(results, device)
+		}
+	}
+	return results, nil
+}
+
+// Partitions returns the partitions of a disk sorted by the partition number
+func (inv *Inventory) Partitions(diskname string) ([]*Device, error) {
+	devices, err := inv.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	diskname = strings.TrimPrefix(diskname, "/dev/")
+	results := []*Device{}
+	for _, device := range devices {
+		if device.Parent == diskname {
+			results = append(results, device)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].PartitionNumber < results[j].PartitionNumber
+	})
+	return results, nil
+}
+
+func sortedDevices(devices map[string]*Device) []*Device {
+	results := []*Device{}
+	for _, device := range devices {
+		results = append(results, device)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// devicePath returns the path of a device under /dev
+func (inv *Inventory) devicePath(name string) string {
+	return filepath.Join(inv.options.DevRoot, name)
+}
@@ -0,0 +1,232 @@
+package inventory
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile creates a file and its parent folders for the fake system tree
+func writeFile(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestInventory creates an inventory on a fake system tree with
+// sda (gpt, sda1 ext4 mounted and sda2 without udev data), sdb (md member)
+// md0 (raid1 on sdb) and an unused loop device
+func newTestInventory(t *testing.T) *Inventory {
+	root := t.TempDir()
+	devices := filepath.Join(root, "sys/devices")
+	classBlock := filepath.Join(root, "sys/class/block")
+	os.MkdirAll(classBlock, 0755)
+
+	addDevice := func(sysPath string, name string, attributes map[string]string) {
+		for attribute, value := range attributes {
+			writeFile(t, filepath.Join(sysPath, attribute), value+"\n")
+		}
+		os.MkdirAll(filepath.Join(sysPath, "holders"), 0755)
+		if err := os.Symlink(sysPath, filepath.Join(classBlock, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sda := filepath.Join(devices, "pci0000:00/ata1/block/sda")
+	addDevice(sda, "sda", map[string]string{
+		"size": "2097152", "dev": "8:0", "removable": "0", "ro": "0",
+		"queue/logical_block_size": "512", "queue/rotational": "1",
+		"device/model": "WDC WD10EZEX",
+	})
+	addDevice(filepath.Join(sda, "sda1"), "sda1", map[string]string{"size": "1048576", "dev": "8:1", "partition": "1"})
+	addDevice(filepath.Join(sda, "sda2"), "sda2", map[string]string{"size": "1046528", "dev": "8:2", "partition": "2"})
+
+	sdb := filepath.Join(devices, "pci0000:00/usb2/2-1/host4/block/sdb")
+	addDevice(sdb, "sdb", map[string]string{"size": "2097152", "dev": "8:16", "queue/logical_block_size": "4096"})
+	os.MkdirAll(filepath.Join(sdb, "holders/md0"), 0755)
+
+	addDevice(filepath.Join(devices, "virtual/block/md0"), "md0", map[string]string{"size": "2095104", "dev": "9:0", "md/level": "raid1"})
+	addDevice(filepath.Join(devices, "virtual/block/loop0"), "loop0", map[string]string{"size": "0", "dev": "7:0"})
+	addDevice(filepath.Join(devices, "virtual/block/ram0"), "ram0", map[string]string{"size": "8192", "dev": "1:0"})
+
+	udevData := filepath.Join(root, "run/udev/data")
+	writeFile(t, filepath.Join(udevData, "b8:0"), "S:disk/by-id/ata-WDC\nE:ID_SERIAL_SHORT=WD-123456\nE:ID_PART_TABLE_TYPE=gpt\nE:ID_PART_TABLE_UUID=0a1b2c3d-0000-0000-0000-000000000001\n")
+	writeFile(t, filepath.Join(udevData, "b8:1"), "E:ID_FS_TYPE=ext4\nE:ID_FS_UUID=11111111-2222-3333-4444-555555555555\nE:ID_FS_LABEL=data\nE:ID_PART_ENTRY_UUID=aaaa-1\nE:ID_PART_ENTRY_NAME=my\\x20data\n")
+
+	devDisk := filepath.Join(root, "dev/disk")
+	os.MkdirAll(filepath.Join(devDisk, "by-uuid"), 0755)
+	os.MkdirAll(filepath.Join(devDisk, "by-partuuid"), 0755)
+	os.Symlink("../../sda2", filepath.Join(devDisk, "by-uuid", "99999999-8888-7777-6666-555555555555"))
+	os.Symlink("../../sda2", filepath.Join(devDisk, "by-partuuid", "aaaa-2"))
+
+	procMounts := filepath.Join(root, "proc/mounts")
+	writeFile(t, procMounts, "sysfs /sys sysfs rw 0 0\n/dev/sda1 /mnt/my\\040disk ext4 rw,relatime 0 0\n/dev/md0 /mnt/raid xfs rw 0 0\n")
+
+	return NewInventory(&Options{
+		SysClassBlock: classBlock,
+		UdevData:      udevData,
+		DevDisk:       devDisk,
+		ProcMounts:    procMounts,
+		DevRoot:       filepath.Join(root, "dev"),
+	})
+}
+
+func TestInventory(t *testing.T) {
+	inv := newTestInventory(t)
+
+	devices, err := inv.List()
+	if err != nil {
+		t.Fatalf("unable to list devices: %v", err)
+	}
+	names := []string{}
+	for _, device := range devices {
+		names = append(names, device.Name)
+	}
+	if len(names) != 5 || names[0] != "md0" || names[4] != "sdb" {
+		t.Errorf("unexpected devices: %v", names)
+	}
+
+	sda, err := inv.Get("/dev/sda")
+	if err != nil {
+		t.Fatalf("sda not found: %v", err)
+	}
+	if sda.Type != "disk" || sda.Size != 1073741824 || sda.Model != "WDC WD10EZEX" || sda.Serial != "WD-123456" || sda.PartTableType != "gpt" || !sda.Rotational {
+		t.Errorf("unexpected sda: %+v", sda)
+	}
+
+	sda1, _ := inv.Get("sda1")
+	if sda1.Type != "part" || sda1.Parent != "sda" || sda1.PartitionNumber != 1 || sda1.BlockSize != 512 || sda1.Transport != "ata" {
+		t.Errorf("unexpected sda1: %+v", sda1)
+	}
+	if sda1.FsType != "ext4" || sda1.Label != "data" || sda1.PartLabel != "my data" || sda1.MountPoint() != "/mnt/my disk" {
+		t.Errorf("unexpected sda1 identifiers: %+v", sda1)
+	}
+
+	sda2, _ := inv.Get("sda2")
+	if sda2.UUID != "99999999-8888-7777-6666-555555555555" || sda2.PartUUID != "aaaa-2" || sda2.MountPoint() != "" {
+		t.Errorf("unexpected sda2: %+v", sda2)
+	}
+
+	md0, _ := inv.Get("md0")
+	if md0.Type != "raid1" || md0.FsType != "xfs" || md0.MountPoint() != "/mnt/raid" {
+		t.Errorf("unexpected md0: %+v", md0)
+	}
+
+	sdb, _ := inv.Get("sdb")
+	if len(sdb.Holders) != 1 || sdb.Holders[0] != "md0" || sdb.BlockSize != 4096 || sdb.Transport != "usb" {
+		t.Errorf("unexpected sdb: %+v", sdb)
+	}
+
+	partitions, _ := inv.Partitions("sda")
+	if len(partitions) != 2 || partitions[0].Name != "sda1" || partitions[1].Name != "sda2" {
+		t.Errorf("unexpected partitions of sda: %v", partitions)
+	}
+
+	disks, _ := inv.Disks()
+	if len(disks) != 3 {
+		t.Errorf("expected 3 disks, got %d", len(disks))
+	}
+
+	if device, err := inv.GetByUUID("11111111-2222-3333-4444-555555555555"); err != nil || device.Name != "sda1" {
+		t.Errorf("unable to get device by uuid: %v", err)
+	}
+
+	if _, err := inv.Get("sdz"); err == nil {
+		t.Error("expected error for missing device")
+	}
+}
+
+func TestInventoryInvalidate(t *testing.T) {
+	inv := newTestInventory(t)
+	if _, err := inv.Get("sda1"); err != nil {
+		t.Fatal(err)
+	}
+
+	//Change the model of sda, the cache should not change until invalidated
+	os.WriteFile(filepath.Join(inv.options.SysClassBlock, "sda", "device/model"), []byte("ST2000DM008\n"), 0644)
+	sda, _ := inv.Get("sda")
+	if sda.Model != "WDC WD10EZEX" {
+		t.Error("cache is not used")
+	}
+
+	inv.Invalidate()
+	sda, _ = inv.Get("sda")
+	if sda.Model != "ST2000DM008" {
+		t.Errorf("cache is not invalidated, model %s", sda.Model)
+	}
+
+	//Unmount sda1, changes of the mount table are picked up without invalidation
+	os.WriteFile(inv.options.ProcMounts, []byte(""), 0644)
+	sda1, _ := inv.Get("sda1")
+	if sda1.MountPoint() != "" {
+		t.Errorf("mount table change is not detected, mount point %s", sda1.MountPoint())
+	}
+}
+
+func TestInventorySkipProbePartitionedDisk(t *testing.T) {
+	inv := newTestInventory(t)
+
+	//Without udev data, only sdb is probed as sda has partitions
+	os.RemoveAll(inv.options.UdevData)
+	for _, name := range []string{"sda", "sdb"} {
+		writeFile(t, inv.devicePath(name), "XFSB")
+	}
+
+	sda, _ := inv.Get("sda")
+	if sda.FsType != "" {
+		t.Errorf("expected the partitioned disk not to be probed, got %s", sda.FsType)
+	}
+	sdb, _ := inv.Get("sdb")
+	if sdb.FsType != "xfs" {
+		t.Errorf("expected sdb to be probed, got %q", sdb.FsType)
+	}
+}
+
+func TestProbeSuperblock(t *testing.T) {
+	uuid := []byte{0x0f, 0x3c, 0x1e, 0x2d, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc}
+
+	ext4 := make([]byte, probeReadSize)
+	copy(ext4[1024+56:], []byte{0x53, 0xEF})
+	binary.LittleEndian.PutUint32(ext4[1024+96:], 0x40)
+	copy(ext4[1024+104:], uuid)
+	copy(ext4[1024+120:], "backup")
+
+	xfs := make([]byte, 4096)
+	copy(xfs, "XFSB")
+	copy(xfs[32:], uuid)
+
+	vfat := make([]byte, 512)
+	copy(vfat[82:], "FAT32   ")
+	binary.LittleEndian.PutUint32(vfat[67:], 0x1A2B3C4D)
+	copy(vfat[71:], "NO NAME    ")
+
+	tests := []struct {
+		name   string
+		buf    []byte
+		fsType string
+		uuid   string
+		label  string
+	}{
+		{"ext4", ext4, "ext4", "0f3c1e2d-1122-3344-5566-778899aabbcc", "backup"},
+		{"xfs", xfs, "xfs", "0f3c1e2d-1122-3344-5566-778899aabbcc", ""},
+		{"vfat", vfat, "vfat", "1A2B-3C4D", ""},
+	}
+	for _, tt := range tests {
+		device := &Device{}
+		if !probeSuperblock(tt.buf, device) {
+			t.Errorf("%s: not detected", tt.name)
+			continue
+		}
+		if device.FsType != tt.fsType || device.UUID != tt.uuid || device.Label != tt.label {
+			t.Errorf("%s: got %s %s %q", tt.name, device.FsType, device.UUID, device.Label)
+		}
+	}
+
+	if probeSuperblock(make([]byte, 4096), &Device{}) {
+		t.Error("empty buffer should not be detected")
+	}
+}
@@ -0,0 +1,157 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/*
+	probe.go
+
+	Detect the file system of a device by reading its superblock, like blkid
+	does. This is only used when the udev database is not available, and
+	require read access to the device file
+*/
+
+const probeReadSize = 65536 + 4096 //Large enough to cover the btrfs superblock
+
+// Probe reads the superblock of the device and returns the detected file system type,
+// UUID and label, bypassing the cache and the udev database. Require read access to the device
+func Probe(devicePath string) (*Device, error) {
+	device := &Device{Path: devicePath}
+	if err := probeDevice(devicePath, device); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// probeDevice fills in the file system type, UUID and label of the device if detected
+func probeDevice(devicePath string, device *Device) error {
+	f, err := os.Open(devicePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := make([]byte, probeReadSize)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	probeSuperblock(buf[:n], device)
+	return nil
+}
+
+// probeSuperblock detects the file system from the head of the device
+func probeSuperblock(buf []byte, device *Device) bool {
+	match := func(offset int, magic []byte) bool {
+		return len(buf) >= offset+len(magic) && bytes.Equal(buf[offset:offset+len(magic)], magic)
+	}
+	field := func(offset int, length int) []byte {
+		if len(buf) < offset+length {
+			return make([]byte, length)
+		}
+		return buf[offset : offset+length]
+	}
+
+	switch {
+	case match(1024+56, []byte{0x53, 0xEF}):
+		//ext2 / ext3 / ext4
+		compat := binary.LittleEndian.Uint32(field(1024+92, 4))
+		incompat := binary.LittleEndian.Uint32(field(1024+96, 4))
+		device.FsType = "ext2"
+		if incompat&(0x40|0x80|0x200) != 0 {
+			//extents, 64bit or flex_bg
+			device.FsType = "ext4"
+		} else if compat&0x4 != 0 {
+			//has_journal
+			device.FsType = "ext3"
+		}
+		device.UUID = formatUUID(field(1024+104, 16))
+		device.Label = cString(field(1024+120, 16))
+	case match(0, []byte("XFSB")):
+		device.FsType = "xfs"
+		device.UUID = formatUUID(field(32, 16))
+		device.Label = cString(field(108, 12))
+	case match(65536+64, []byte("_BHRfS_M")):
+		device.FsType = "btrfs"
+		device.UUID = formatUUID(field(65536+32, 16))
+		device.Label = cString(field(65536+299, 256))
+	case match(1024, []byte{0x10, 0x20, 0xF5, 0xF2}):
+		device.FsType = "f2fs"
+		device.UUID = formatUUID(field(1024+108, 16))
+	case match(3, []byte("EXFAT   ")):
+		device.FsType = "exfat"
+		device.UUID = formatVolumeSerial(field(100, 4))
+	case match(3, []byte("NTFS    ")):
+		device.FsType = "ntfs"
+		serial := field(72, 8)
+		reversed := make([]byte, 8)
+		for i := range serial {
+			reversed[7-i] = serial[i]
+		}
+		device.UUID = strings.ToUpper(hex.EncodeToString(reversed))
+	case match(82, []byte("FAT32   ")):
+		device.FsType = "vfat"
+		device.UUID = formatVolumeSerial(field(67, 4))
+		device.Label = fatLabel(field(71, 11))
+	case match(54, []byte("FAT1")):
+		device.FsType = "vfat"
+		device.UUID = formatVolumeSerial(field(39, 4))
+		device.Label = fatLabel(field(43, 11))
+	case match(4096-10, []byte("SWAPSPACE2")):
+		device.FsType = "swap"
+		device.UUID = formatUUID(field(1024+12, 16))
+		device.Label = cString(field(1024+28, 16))
+	case match(4096, []byte{0xFC, 0x4E, 0x2B, 0xA9}):
+		//md superblock version 1.2
+		device.FsType = "linux_raid_member"
+		device.UUID = formatUUID(field(4096+16, 16))
+		device.Label = cString(field(4096+32, 32))
+	case match(0, []byte{0xFC, 0x4E, 0x2B, 0xA9}):
+		//md superblock version 1.1
+		device.FsType = "linux_raid_member"
+		device.UUID = formatUUID(field(16, 16))
+		device.Label = cString(field(32, 32))
+	default:
+		return false
+	}
+	return true
+}
+
+// formatUUID formats 16 bytes as a UUID string, e.g. 0f3c1e2d-...
+func formatUUID(b []byte) string {
+	if len(b) != 16 || bytes.Equal(b, make([]byte, 16)) {
+		return ""
+	}
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// formatVolumeSerial formats a little endian FAT / exFAT serial number, e.g. 1A2B-3C4D
+func formatVolumeSerial(b []byte) string {
+	serial := binary.LittleEndian.Uint32(b)
+	return fmt.Sprintf("%04X-%04X", serial>>16, serial&0xFFFF)
+}
+
+// fatLabel trims the padding of a FAT label, "NO NAME" means no label
+func fatLabel(b []byte) string {
+	label := strings.TrimRight(string(b), " \x00")
+	if label == "NO NAME" {
+		return ""
+	}
+	return label
+}
+
+// cString returns the string before the first null byte
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
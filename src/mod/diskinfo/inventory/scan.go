@@ -0,0 +1,347 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+	scan.go
+
+	Read the device tree from sysfs and fill in the identifiers
+	from udev, /dev/disk/by-* and /proc/mounts
+*/
+
+// Device name prefixes that are never real storage devices
+var ignoredDevicePrefixes = []string{"ram", "zram"}
+
+// scan reads all block devices from sysfs, return the devices and the mount table used
+func (inv *Inventory) scan() (map[string]*Device, []byte, error) {
+	entries, err := os.ReadDir(inv.options.SysClassBlock)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	devices := map[string]*Device{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if hasAnyPrefix(name, ignoredDevicePrefixes) {
+			continue
+		}
+
+		device := inv.readSysfsDevice(name)
+		if device == nil {
+			continue
+		}
+		devices[name] = device
+	}
+
+	//Partitions inherit the properties of their disk
+	for _, device := range devices {
+		if device.Parent == "" {
+			continue
+		}
+		if parent, ok := devices[device.Parent]; ok {
+			if device.BlockSize == 0 {
+				device.BlockSize = parent.BlockSize
+			}
+			device.Rotational = parent.Rotational
+			device.Removable = parent.Removable
+			device.Transport = parent.Transport
+			if device.Model == "" {
+				device.Model = parent.Model
+			}
+			if device.Serial == "" {
+				device.Serial = parent.Serial
+			}
+		}
+	}
+
+	inv.readDiskLinks(devices)
+	mountTable, _ := os.ReadFile(inv.options.ProcMounts)
+	readMounts(devices, mountTable)
+	hasPartitions := map[string]bool{}
+	for _, device := range devices {
+		if device.Parent != "" {
+			hasPartitions[device.Parent] = true
+		}
+	}
+	for _, device := range devices {
+		if device.PartTableType != "" || hasPartitions[device.Name] {
+			//Partitioned disks hold no file system, skip the read on every rescan
+			continue
+		}
+		if device.FsType == "" || device.UUID == "" {
+			//udev data is not available (e.g. in containers), read the superblock instead
+			probeDevice(inv.devicePath(device.Name), device)
+		}
+	}
+	return devices, mountTable, nil
+}
+
+// readSysfsDevice reads a block device from /sys/class/block/{name}, return nil if
+// the device should be skipped, e.g. unused loop devices
+func (inv *Inventory) readSysfsDevice(name string) *Device {
+	sysPath := filepath.Join(inv.options.SysClassBlock, name)
+	device := &Device{
+		Name:        name,
+		Path:        "/dev/" + name,
+		Type:        "disk",
+		MountPoints: []string{},
+		Holders:     []string{},
+	}
+
+	sectors, _ := strconv.ParseInt(readSysfsValue(sysPath, "size"), 10, 64)
+	device.Size = sectors * 512 //Always in 512 bytes sectors regardless of the block size
+	device.Major, device.Minor = parseMajorMinor(readSysfsValue(sysPath, "dev"))
+
+	if partNo := readSysfsValue(sysPath, "partition"); partNo != "" {
+		//Partitions are placed under their disk in the real sysfs path
+		device.Type = "part"
+		device.PartitionNumber, _ = strconv.Atoi(partNo)
+		if realPath, err := filepath.EvalSymlinks(sysPath); err == nil {
+			device.Parent = filepath.Base(filepath.Dir(realPath))
+		}
+	} else {
+		device.BlockSize, _ = strconv.Atoi(readSysfsValue(sysPath, "queue/logical_block_size"))
+		device.Rotational = readSysfsValue(sysPath, "queue/rotational") == "1"
+		device.Removable = readSysfsValue(sysPath, "removable") == "1"
+		device.Model = readSysfsValue(sysPath, "device/model")
+		device.Serial = readSysfsValue(sysPath, "device/serial")
+		if realPath, err := filepath.EvalSymlinks(sysPath); err == nil {
+			device.Transport = detectTransport(name, realPath)
+		}
+
+		switch {
+		case strings.HasPrefix(name, "loop"):
+			if device.Size == 0 {
+				//Loop device without backing file
+				return nil
+			}
+			device.Type = "loop"
+		case strings.HasPrefix(name, "md"):
+			if level := readSysfsValue(sysPath, "md/level"); level != "" {
+				device.Type = level
+			} else {
+				device.Type = "md"
+			}
+		case strings.HasPrefix(name, "dm-"):
+			device.Type = "dm"
+		}
+	}
+	device.ReadOnly = readSysfsValue(sysPath, "ro") == "1"
+
+	if holders, err := os.ReadDir(filepath.Join(sysPath, "holders")); err == nil {
+		for _, holder := range holders {
+			device.Holders = append(device.Holders, holder.Name())
+		}
+	}
+
+	inv.readUdevData(device)
+	return device
+}
+
+// detectTransport returns the bus a disk is connected to from its real sysfs path,
+// e.g. /sys/devices/pci0000:00/0000:00:14.0/usb2/2-1/2-1:1.0/host4/.../block/sdb
+func detectTransport(name string, realPath string) string {
+	switch {
+	case strings.Contains(realPath, "/usb"):
+		return "usb"
+	case strings.HasPrefix(name, "nvme"):
+		return "nvme"
+	case strings.HasPrefix(name, "mmcblk"):
+		return "mmc"
+	case strings.Contains(realPath, "/ata"):
+		return "ata"
+	case strings.HasPrefix(name, "vd"):
+		return "virtio"
+	}
+	return ""
+}
+
+// readUdevData fills in the identifiers from the udev database, e.g. /run/udev/data/b8:1
+func (inv *Inventory) readUdevData(device *Device) {
+	f, err := os.Open(filepath.Join(inv.options.UdevData, "b"+strconv.Itoa(device.Major)+":"+strconv.Itoa(device.Minor)))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "E:") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "E:"), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "ID_FS_TYPE":
+			device.FsType = value
+		case "ID_FS_UUID":
+			device.UUID = value
+		case "ID_FS_LABEL":
+			device.Label = value
+		case "ID_PART_ENTRY_UUID":
+			device.PartUUID = value
+		case "ID_PART_ENTRY_NAME":
+			device.PartLabel = unescapeUdev(value)
+		case "ID_PART_TABLE_TYPE":
+			device.PartTableType = value
+		case "ID_PART_TABLE_UUID":
+			device.PartTableUUID = value
+		case "ID_MODEL":
+			if device.Model == "" {
+				device.Model = strings.ReplaceAll(value, "_", " ")
+			}
+		case "ID_SERIAL_SHORT":
+			device.Serial = value
+		case "ID_BUS":
+			if device.Transport == "" {
+				device.Transport = value
+			}
+		}
+	}
+
+	if device.PartTableType == "dos" && device.PartTableUUID != "" && !strings.HasPrefix(device.PartTableUUID, "0x") {
+		//Same format as fdisk
+		device.PartTableUUID = "0x" + device.PartTableUUID
+	}
+}
+
+// readDiskLinks fills in the missing identifiers from the symlinks in /dev/disk/by-*
+func (inv *Inventory) readDiskLinks(devices map[string]*Device) {
+	linkTypes := map[string]func(device *Device, value string){
+		"by-uuid": func(device *Device, value string) {
+			if device.UUID == "" {
+				device.UUID = value
+			}
+		},
+		"by-label": func(device *Device, value string) {
+			if device.Label == "" {
+				device.Label = unescapeUdev(value)
+			}
+		},
+		"by-partuuid": func(device *Device, value string) {
+			if device.PartUUID == "" {
+				device.PartUUID = value
+			}
+		},
+		"by-partlabel": func(device *Device, value string) {
+			if device.PartLabel == "" {
+				device.PartLabel = unescapeUdev(value)
+			}
+		},
+	}
+
+	for folder, setter := range linkTypes {
+		entries, err := os.ReadDir(filepath.Join(inv.options.DevDisk, folder))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			target, err := os.Readlink(filepath.Join(inv.options.DevDisk, folder, entry.Name()))
+			if err != nil {
+				continue
+			}
+			if device, ok := devices[filepath.Base(target)]; ok {
+				setter(device, entry.Name())
+			}
+		}
+	}
+}
+
+// readMounts fills in the mount points from the content of /proc/mounts
+func readMounts(devices map[string]*Device, mountTable []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(mountTable))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+
+		//The source can be a symlink, e.g. /dev/disk/by-uuid/xxx or /dev/mapper/xxx
+		source := fields[0]
+		if resolved, err := filepath.EvalSymlinks(source); err == nil {
+			source = resolved
+		}
+
+		device, ok := devices[filepath.Base(source)]
+		if !ok {
+			continue
+		}
+		device.MountPoints = append(device.MountPoints, UnescapeMountPath(fields[1]))
+		if device.FsType == "" {
+			device.FsType = fields[2]
+		}
+	}
+}
+
+// readSysfsValue reads a sysfs attribute, return empty string if it does not exist
+func readSysfsValue(sysPath string, attribute string) string {
+	content, err := os.ReadFile(filepath.Join(sysPath, attribute))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// parseMajorMinor parses the content of the dev attribute, e.g. 8:1
+func parseMajorMinor(value string) (int, int) {
+	majorStr, minorStr, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, 0
+	}
+	major, _ := strconv.Atoi(majorStr)
+	minor, _ := strconv.Atoi(minorStr)
+	return major, minor
+}
+
+// UnescapeMountPath decodes the octal escapes in /proc/mounts, e.g. \040 for space,
+// \011 for tab, \012 for new line and \134 for backslash
+func UnescapeMountPath(path string) string {
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if b, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(b))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(path[i])
+	}
+	return sb.String()
+}
+
+// unescapeUdev decodes the hex escapes in udev values, e.g. \x20 for space
+func unescapeUdev(value string) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) && value[i+1] == 'x' {
+			if b, err := strconv.ParseUint(value[i+2:i+4], 16, 8); err == nil {
+				sb.WriteByte(byte(b))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(value[i])
+	}
+	return sb.String()
+}
+
+func hasAnyPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
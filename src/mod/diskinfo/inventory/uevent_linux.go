@@ -0,0 +1,129 @@
+//go:build linux
+// +build linux
+
+package inventory
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/*
+	uevent_linux.go
+
+	Listen to the kernel uevents of block devices via netlink and invalidate
+	the inventory when a device is added, removed or changed (e.g. partition
+	table rewritten or a file system created)
+*/
+
+const (
+	ueventBufferSize = 64 * 1024
+	udevSettleDelay  = time.Second //Time for udev to update its database after the kernel event
+)
+
+// Watch starts listening to block device uevents. onChange is called with the
+// action (add, remove, change) and the device name after the cache is invalidated,
+// it can be nil
+func (inv *Inventory) Watch(onChange func(action string, devname string)) error {
+	if inv.stopChan != nil {
+		return errors.New("inventory is already watching uevents")
+	}
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return err
+	}
+
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: 1, //Kernel events
+	})
+	if err != nil {
+		syscall.Close(fd)
+		return err
+	}
+
+	stopChan := make(chan bool)
+	inv.onChange = onChange
+	inv.stopChan = stopChan
+	go func() {
+		<-stopChan
+		//Unblock the Recvfrom below
+		syscall.Close(fd)
+	}()
+
+	go func() {
+		buf := make([]byte, ueventBufferSize)
+		for {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.ENOBUFS) {
+					//Interrupted or events dropped, rescan to be safe
+					inv.Invalidate()
+					continue
+				}
+				select {
+				case <-stopChan:
+				default:
+					log.Println("[Inventory] Uevent listener stopped: " + err.Error())
+				}
+				return
+			}
+
+			action, devname, ok := parseBlockUevent(buf[:n])
+			if !ok {
+				continue
+			}
+			inv.handleUevent(action, devname)
+		}
+	}()
+	return nil
+}
+
+// Stop stops listening to uevents
+func (inv *Inventory) Stop() {
+	if inv.stopChan != nil {
+		close(inv.stopChan)
+		inv.stopChan = nil
+	}
+}
+
+func (inv *Inventory) handleUevent(action string, devname string) {
+	inv.Invalidate()
+
+	//udev updates /run/udev/data and /dev/disk/by-* after the kernel event,
+	//invalidate again after it settled so the identifiers are picked up
+	time.AfterFunc(udevSettleDelay, func() {
+		inv.Invalidate()
+		if inv.onChange != nil {
+			inv.onChange(action, devname)
+		}
+	})
+}
+
+// parseBlockUevent parses a kernel uevent message, e.g. "add@/devices/...\0ACTION=add\0SUBSYSTEM=block\0DEVNAME=sdb\0..."
+// and returns the action and device name if it is about a block device
+func parseBlockUevent(msg []byte) (string, string, bool) {
+	fields := bytes.Split(msg, []byte{0})
+	if len(fields) < 2 || !bytes.Contains(fields[0], []byte("@")) {
+		//Not a kernel uevent, e.g. libudev messages
+		return "", "", false
+	}
+
+	values := map[string]string{}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(string(field), "=")
+		if ok {
+			values[key] = value
+		}
+	}
+
+	if values["SUBSYSTEM"] != "block" || values["DEVNAME"] == "" {
+		return "", "", false
+	}
+	return values["ACTION"], strings.TrimPrefix(values["DEVNAME"], "/dev/"), true
+}
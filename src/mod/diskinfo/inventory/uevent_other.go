@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package inventory
+
+import "errors"
+
+// Watch starts listening to block device uevents, only supported on Linux
+func (inv *Inventory) Watch(onChange func(action string, devname string)) error {
+	return errors.New("platform not supported")
+}
+
+// Stop stops listening to uevents
+func (inv *Inventory) Stop() {}
@@ -0,0 +1,19 @@
+//go:build linux
+// +build linux
+
+package inventory
+
+import "syscall"
+
+// GetUsage returns the used and available bytes of the file system mounted at the mount point
+func GetUsage(mountPoint string) (int64, int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(mountPoint, &stat); err != nil {
+		return 0, 0, err
+	}
+
+	blockSize := int64(stat.Bsize)
+	used := (int64(stat.Blocks) - int64(stat.Bfree)) * blockSize
+	available := int64(stat.Bavail) * blockSize
+	return used, available, nil
+}
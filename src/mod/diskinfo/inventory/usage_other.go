@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package inventory
+
+import "errors"
+
+// GetUsage returns the used and available bytes of the file system mounted at the mount point
+func GetUsage(mountPoint string) (int64, int64, error) {
+	return 0, 0, errors.New("platform not supported")
+}
@@ -0,0 +1,291 @@
+package smart
+
+/*
+	devicetype.go
+
+	Detect how a disk is attached to the system and which smartctl
+	device type (-d) is needed to read its SMART data.
+
+	smartctl --scan-open probes the disks and finds the pass-through
+	of USB bridges and the disks behind hardware RAID controllers,
+	which have no block device of their own. The bus the block device
+	is installed on tells the transport when the scan cannot.
+*/
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/blkstat"
+)
+
+type Transport string
+
+const (
+	Transport_Unknown Transport = "unknown"
+	Transport_SATA    Transport = "sata"
+	Transport_SAS     Transport = "sas"
+	Transport_NVMe    Transport = "nvme"
+	Transport_USB     Transport = "usb"
+	Transport_RAID    Transport = "raid"   //Behind a hardware RAID controller, e.g. megaraid or 3ware
+	Transport_Virtio  Transport = "virtio" //Virtual disk, SMART is not available
+)
+
+// SmartDevice is a disk that smartctl can read, with the device type to use
+type SmartDevice struct {
+	Name      string    //e.g. sda, or bus0-megaraid-3 for a disk behind a RAID controller
+	Path      string    //Device path passed to smartctl, e.g. /dev/sda or /dev/bus/0
+	Type      string    //smartctl device type, e.g. sat, scsi, nvme, usbjmicron, megaraid,3
+	Protocol  string    //ATA, SCSI or NVMe, empty if unknown
+	Transport Transport //How the disk is attached to the system
+}
+
+const (
+	scanCacheTTL      = 5 * time.Minute  //smartctl --scan-open wakes up the disks, so the result is kept for a while
+	scanRetryInterval = 10 * time.Second //Minimum interval of rescans when a disk is not found, e.g. after hotplug
+)
+
+// raidControllerTypes are the smartctl device types of disks behind a RAID controller
+var raidControllerTypes = []string{"megaraid", "3ware", "areca", "cciss", "aacraid", "hpt", "sssraid", "jmb39x"}
+
+// nvmeNamespace matches the namespace suffix of a NVMe block device, e.g. n1 of nvme0n1
+var nvmeNamespace = regexp.MustCompile(`n[0-9]+$`)
+
+var scanCache struct {
+	sync.Mutex
+	devices []DeviceIdentity
+	err     error
+	updated time.Time
+}
+
+// DiskType returns the disk type by the protocol smartctl uses to talk to the disk
+func (d *SmartDevice) DiskType() DiskType {
+	switch d.Protocol {
+	case "ATA":
+		return DiskType_SATA
+	case "NVMe":
+		return DiskType_NVMe
+	case "SCSI":
+		return DiskType_SAS
+	}
+	return DiskType_Unknown
+}
+
+// smartctlArgs returns the device arguments of smartctl
+func (d *SmartDevice) smartctlArgs() []string {
+	return []string{"-d", d.Type, d.Path}
+}
+
+// ResolveDevice detects the smartctl device type and the transport of a disk,
+// the disk is a block device name (e.g. sda) or a disk behind a RAID controller
+// listed by ListDevices (e.g. bus0-megaraid-3)
+func ResolveDevice(disk string) (*SmartDevice, error) {
+	name := strings.TrimPrefix(disk, "/dev/")
+	if name == "" {
+		return nil, errors.New("disk name is empty")
+	}
+
+	if strings.Contains(name, "-") {
+		//Disks behind a RAID controller are only known by the scan
+		scanned := findScannedDevice(func(d DeviceIdentity) bool {
+			return isRAIDControllerType(d.Type) && scannedDeviceName(d) == name
+		})
+		if scanned == nil {
+			return nil, errors.New("disk is not a valid disk")
+		}
+		return scannedDevice(scanned), nil
+	}
+
+	//Make sure the target is a disk
+	if !diskinfo.DevicePathIsValidDisk("/dev/" + name) {
+		return nil, errors.New("disk is not a valid disk")
+	}
+
+	//smartctl lists NVMe disks by the controller, e.g. /dev/nvme0 for nvme0n1
+	paths := []string{"/dev/" + name}
+	if strings.HasPrefix(name, "nvme") {
+		paths = append(paths, "/dev/"+nvmeNamespace.ReplaceAllString(name, ""))
+	}
+	scanned := findScannedDevice(func(d DeviceIdentity) bool {
+		return !isRAIDControllerType(d.Type) && (d.Name == paths[0] || d.Name == paths[len(paths)-1])
+	})
+
+	//The bus is not available for some virtual disks, the scan result is used instead
+	bus, _ := blkstat.GetInstalledBus(name)
+	device := detectDevice(name, bus, scanned)
+	if device.Transport == Transport_Virtio {
+		return nil, errors.New("SMART is not supported on virtio disks")
+	}
+	return device, nil
+}
+
+// ListDevices returns all disks with SMART support, including the disks
+// behind RAID controllers that have no block device of their own
+func ListDevices() ([]*SmartDevice, error) {
+	disks, err := diskinfo.GetAllDisks()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []*SmartDevice{}
+	for _, disk := range disks {
+		device, err := ResolveDevice(disk.Name)
+		if err != nil {
+			continue
+		}
+		devices = append(devices, device)
+	}
+
+	scanned, err := scanDevices(false)
+	if err != nil {
+		//smartctl might be too old to scan, the block devices are still usable
+		return devices, nil
+	}
+	for i := range scanned {
+		if isRAIDControllerType(scanned[i].Type) && scanned[i].OpenError == "" {
+			devices = append(devices, scannedDevice(&scanned[i]))
+		}
+	}
+	return devices, nil
+}
+
+// detectDevice picks the smartctl device type and the transport of a block device
+// from the bus it is installed on and the result of smartctl --scan-open, both are optional
+func detectDevice(name string, bus *blkstat.InstallPosition, scanned *DeviceIdentity) *SmartDevice {
+	device := &SmartDevice{
+		Name:      name,
+		Path:      "/dev/" + name,
+		Type:      "auto",
+		Transport: Transport_Unknown,
+	}
+	if scanned != nil && scanned.OpenError == "" {
+		device.Type = scanned.Type
+		device.Protocol = scanned.Protocol
+	}
+
+	switch {
+	case strings.HasPrefix(name, "vd"):
+		device.Transport = Transport_Virtio
+	case strings.HasPrefix(name, "nvme") || (bus != nil && bus.NVMESlot != ""):
+		device.Transport = Transport_NVMe
+		setDefaultType(device, "nvme", "NVMe")
+	case (bus != nil && bus.USBPort != "") || strings.HasPrefix(baseDeviceType(device.Type), "usb"):
+		//Most USB to SATA bridges support the SCSI to ATA translation pass-through
+		device.Transport = Transport_USB
+		setDefaultType(device, "sat", "ATA")
+	case isRAIDControllerType(device.Type):
+		device.Transport = Transport_RAID
+	case bus != nil && bus.SATAPort != "":
+		device.Transport = Transport_SATA
+		setDefaultType(device, "sat", "ATA")
+	case device.Protocol == "ATA":
+		//SATA disk on a SAS HBA
+		device.Transport = Transport_SATA
+	case device.Protocol == "SCSI":
+		device.Transport = Transport_SAS
+	}
+	return device
+}
+
+// setDefaultType sets the device type and protocol if the scan did not find them
+func setDefaultType(device *SmartDevice, deviceType string, protocol string) {
+	if device.Type == "auto" {
+		device.Type = deviceType
+	}
+	if device.Protocol == "" {
+		device.Protocol = protocol
+	}
+}
+
+// scannedDevice converts a disk behind a RAID controller in the scan result
+func scannedDevice(scanned *DeviceIdentity) *SmartDevice {
+	return &SmartDevice{
+		Name:      scannedDeviceName(*scanned),
+		Path:      scanned.Name,
+		Type:      scanned.Type,
+		Protocol:  scanned.Protocol,
+		Transport: Transport_RAID,
+	}
+}
+
+// scannedDeviceName names a disk in the scan result, the disks behind a RAID
+// controller share the same path so the device type is added, e.g. bus0-megaraid-3
+func scannedDeviceName(scanned DeviceIdentity) string {
+	name := strings.ReplaceAll(strings.TrimPrefix(scanned.Name, "/dev/"), "/", "")
+	if strings.Contains(scanned.Type, ",") {
+		name += "-" + strings.ReplaceAll(baseDeviceType(scanned.Type), ",", "-")
+	}
+	return name
+}
+
+// baseDeviceType removes the protocol of a combined device type, e.g. sat+megaraid,3 is megaraid,3
+func baseDeviceType(deviceType string) string {
+	if i := strings.LastIndex(deviceType, "+"); i >= 0 {
+		return deviceType[i+1:]
+	}
+	return deviceType
+}
+
+// isRAIDControllerType checks if the smartctl device type is a disk behind a RAID controller
+func isRAIDControllerType(deviceType string) bool {
+	controller, _, _ := strings.Cut(baseDeviceType(deviceType), ",")
+	for _, raidType := range raidControllerTypes {
+		if controller == raidType {
+			return true
+		}
+	}
+	return false
+}
+
+// findScannedDevice returns the first device in the scan result that matches, the disks
+// are rescanned if none matches as the scan result might be outdated
+func findScannedDevice(match func(DeviceIdentity) bool) *DeviceIdentity {
+	for _, refresh := range []bool{false, true} {
+		devices, err := scanDevices(refresh)
+		if err != nil {
+			return nil
+		}
+		for i := range devices {
+			if match(devices[i]) {
+				return &devices[i]
+			}
+		}
+	}
+	return nil
+}
+
+// scanDevices lists the disks found by smartctl --scan-open, the result is cached.
+// A refresh rescans the disks unless the last scan is newer than scanRetryInterval
+func scanDevices(refresh bool) ([]DeviceIdentity, error) {
+	scanCache.Lock()
+	defer scanCache.Unlock()
+
+	age := time.Since(scanCache.updated)
+	if age < scanCacheTTL && (!refresh || age < scanRetryInterval) {
+		return scanCache.devices, scanCache.err
+	}
+
+	//Failures are cached as well, so a missing smartctl is not retried on every call
+	scanCache.devices, scanCache.err = nil, nil
+	report, err := runSmartctl(smartctlExitCommandLine, "--scan-open")
+	if err != nil {
+		scanCache.err = errors.New("unable to scan disks: " + err.Error())
+	} else {
+		scanCache.devices = report.Devices
+	}
+	scanCache.updated = time.Now()
+	return scanCache.devices, scanCache.err
+}
+
+// runSmartctlOnDevice resolves the disk and runs smartctl with its device type
+func runSmartctlOnDevice(disk string, failedBits int, args ...string) (*SMARTReport, error) {
+	device, err := ResolveDevice(disk)
+	if err != nil {
+		return nil, err
+	}
+	return runSmartctl(failedBits, append(args, device.smartctlArgs()...)...)
+}
@@ -0,0 +1,90 @@
+package smart
+
+import (
+	"testing"
+	"time"
+
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/blkstat"
+)
+
+func TestDetectDevice(t *testing.T) {
+	scan := loadTestReport(t, "scan.json").Devices
+	if len(scan) != 8 {
+		t.Fatalf("expected 8 scanned devices, got %d", len(scan))
+	}
+
+	sataBus := &blkstat.InstallPosition{PCIEBusAddress: "pci0000:00", SATAPort: "ata1"}
+	usbBus := &blkstat.InstallPosition{PCIEBusAddress: "pci0000:00", USBPort: "usb2"}
+	sasBus := &blkstat.InstallPosition{PCIEBusAddress: "pci0000:00"}
+	nvmeBus := &blkstat.InstallPosition{PCIEBusAddress: "pci0000:00", NVMESlot: "nvme0"}
+
+	tests := []struct {
+		name     string
+		disk     string
+		bus      *blkstat.InstallPosition
+		scanned  *DeviceIdentity
+		expected SmartDevice
+	}{
+		{"sata", "sda", sataBus, &scan[0], SmartDevice{"sda", "/dev/sda", "sat", "ATA", Transport_SATA}},
+		{"usb bridge", "sdb", usbBus, &scan[1], SmartDevice{"sdb", "/dev/sdb", "usbjmicron", "ATA", Transport_USB}},
+		{"usb without scan", "sdb", usbBus, nil, SmartDevice{"sdb", "/dev/sdb", "sat", "ATA", Transport_USB}},
+		{"sas", "sdc", sasBus, &scan[2], SmartDevice{"sdc", "/dev/sdc", "scsi", "SCSI", Transport_SAS}},
+		{"open failed", "sdd", sasBus, &scan[3], SmartDevice{"sdd", "/dev/sdd", "auto", "", Transport_Unknown}},
+		{"nvme", "nvme0n1", nvmeBus, &scan[7], SmartDevice{"nvme0n1", "/dev/nvme0n1", "nvme", "NVMe", Transport_NVMe}},
+		{"nvme without scan", "nvme0n1", nil, nil, SmartDevice{"nvme0n1", "/dev/nvme0n1", "nvme", "NVMe", Transport_NVMe}},
+		{"sata without scan", "sde", sataBus, nil, SmartDevice{"sde", "/dev/sde", "sat", "ATA", Transport_SATA}},
+		{"virtio", "vda", sasBus, nil, SmartDevice{"vda", "/dev/vda", "auto", "", Transport_Virtio}},
+	}
+	for _, test := range tests {
+		device := detectDevice(test.disk, test.bus, test.scanned)
+		if *device != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, *device)
+		}
+	}
+
+	if dt := detectDevice("sdc", sasBus, &scan[2]).DiskType(); dt != DiskType_SAS {
+		t.Errorf("expected SAS disk type, got %d", dt)
+	}
+	if dt := detectDevice("sdd", sasBus, &scan[3]).DiskType(); dt != DiskType_Unknown {
+		t.Errorf("expected unknown disk type, got %d", dt)
+	}
+}
+
+func TestResolveRAIDControllerDevice(t *testing.T) {
+	scanCache.Lock()
+	scanCache.devices = loadTestReport(t, "scan.json").Devices
+	scanCache.err = nil
+	scanCache.updated = time.Now()
+	scanCache.Unlock()
+	defer func() {
+		scanCache.Lock()
+		scanCache.devices, scanCache.updated = nil, time.Time{}
+		scanCache.Unlock()
+	}()
+
+	tests := []struct {
+		disk     string
+		expected SmartDevice
+	}{
+		{"bus0-megaraid-0", SmartDevice{"bus0-megaraid-0", "/dev/bus/0", "megaraid,0", "SCSI", Transport_RAID}},
+		{"bus0-megaraid-3", SmartDevice{"bus0-megaraid-3", "/dev/bus/0", "sat+megaraid,3", "ATA", Transport_RAID}},
+		{"twa0-3ware-1", SmartDevice{"twa0-3ware-1", "/dev/twa0", "3ware,1", "ATA", Transport_RAID}},
+	}
+	for _, test := range tests {
+		device, err := ResolveDevice(test.disk)
+		if err != nil {
+			t.Errorf("%s: %v", test.disk, err)
+			continue
+		}
+		if *device != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.disk, test.expected, *device)
+		}
+		if args := device.smartctlArgs(); args[1] != test.expected.Type || args[2] != test.expected.Path {
+			t.Errorf("%s: unexpected smartctl arguments %v", test.disk, args)
+		}
+	}
+
+	if _, err := ResolveDevice("bus1-megaraid-0"); err == nil {
+		t.Error("expected error for a disk not in the scan result")
+	}
+}
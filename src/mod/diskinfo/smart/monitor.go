@@ -0,0 +1,222 @@
+package smart
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+	monitor.go
+
+	The health monitor poll the SMART health of all disks in the background
+	and compare each reading with the last snapshot of the same disk. Alerts
+	are raised on a FAILED self-assessment, rising error counters or a
+	temperature over the threshold
+*/
+
+const (
+	DEFAULT_MONITOR_INTERVAL  = 5 * time.Minute
+	DEFAULT_TEMPERATURE_LIMIT = 55 //In Celsius
+)
+
+type AlertType string
+
+const (
+	Alert_HealthFailed        AlertType = "health_failed"
+	Alert_ReallocatedSectors  AlertType = "reallocated_sectors"
+	Alert_PendingSectors      AlertType = "pending_sectors"
+	Alert_UncorrectableErrors AlertType = "uncorrectable_errors"
+	Alert_HighTemperature     AlertType = "high_temperature"
+)
+
+type Alert struct {
+	Type          AlertType
+	DeviceName    string
+	Message       string
+	PreviousValue uint64
+	CurrentValue  uint64
+	Critical      bool //Critical alerts mean the disk should be replaced
+	Health        *DriveHealthInfo
+}
+
+type MonitorOptions struct {
+	Interval         time.Duration               //Poll interval, default 5 minutes
+	TemperatureLimit int                         //Alert if temperature goes above this value, default 55
+	ListDevices      func() ([]string, error)    //Returns the disks to poll, e.g. sda, nvme0n1
+	OnAlert          func(alert *Alert)          //Called for each alert raised
+	OnUpdate         func(info *DriveHealthInfo) //Called after a disk is polled, can be nil
+}
+
+type HealthMonitor struct {
+	options    *MonitorOptions
+	snapshots  map[string]*DriveHealthInfo
+	mutex      sync.RWMutex
+	stopChan   chan bool
+	readHealth func(diskname string) (*DriveHealthInfo, error)
+}
+
+// NewHealthMonitor creates a SMART health monitor, call Start to begin polling
+func NewHealthMonitor(options *MonitorOptions) *HealthMonitor {
+	if options.Interval <= 0 {
+		options.Interval = DEFAULT_MONITOR_INTERVAL
+	}
+	if options.TemperatureLimit <= 0 {
+		options.TemperatureLimit = DEFAULT_TEMPERATURE_LIMIT
+	}
+	return &HealthMonitor{
+		options:    options,
+		snapshots:  map[string]*DriveHealthInfo{},
+		stopChan:   make(chan bool),
+		readHealth: GetDiskSMARTHealthSummary,
+	}
+}
+
+// Start polls all disks immediately and then at every interval
+func (m *HealthMonitor) Start() {
+	go func() {
+		ticker := time.NewTicker(m.options.Interval)
+		defer ticker.Stop()
+		m.Poll()
+		for {
+			select {
+			case <-m.stopChan:
+				return
+			case <-ticker.C:
+				m.Poll()
+			}
+		}
+	}()
+}
+
+// Stop stops the background polling
+func (m *HealthMonitor) Stop() {
+	close(m.stopChan)
+}
+
+// Poll reads the SMART health of all disks once and raise alerts if needed
+func (m *HealthMonitor) Poll() {
+	devices, err := m.options.ListDevices()
+	if err != nil {
+		log.Println("[SMART] Unable to list disks for health monitoring: " + err.Error())
+		return
+	}
+
+	for _, dev := range devices {
+		dt, err := GetDiskType(dev)
+		if err != nil || dt == DiskType_Unknown {
+			continue
+		}
+
+		healthInfo, err := m.readHealth(dev)
+		if err != nil {
+			log.Println("[SMART] Unable to read SMART health of " + dev + ": " + err.Error())
+			continue
+		}
+		m.update(healthInfo)
+	}
+}
+
+// update stores the new snapshot of a disk and raise alerts by comparing it with the previous one
+func (m *HealthMonitor) update(healthInfo *DriveHealthInfo) {
+	m.mutex.Lock()
+	previous := m.snapshots[healthInfo.DeviceName]
+	m.snapshots[healthInfo.DeviceName] = healthInfo
+	m.mutex.Unlock()
+
+	if m.options.OnUpdate != nil {
+		m.options.OnUpdate(healthInfo)
+	}
+
+	if m.options.OnAlert == nil {
+		return
+	}
+	for _, alert := range CompareHealth(previous, healthInfo, m.options.TemperatureLimit) {
+		m.options.OnAlert(alert)
+	}
+}
+
+// GetSnapshot returns the latest SMART health of a disk, or nil if it is not polled yet
+func (m *HealthMonitor) GetSnapshot(diskname string) *DriveHealthInfo {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.snapshots[diskname]
+}
+
+// GetSnapshots returns the latest SMART health of all polled disks
+func (m *HealthMonitor) GetSnapshots() []*DriveHealthInfo {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	results := []*DriveHealthInfo{}
+	for _, info := range m.snapshots {
+		results = append(results, info)
+	}
+	return results
+}
+
+// CompareHealth returns the alerts raised by the current reading of a disk.
+// previous is nil for the first reading since startup, which is taken as the
+// baseline of the error counters so they are not reported again after every
+// restart. Alerts on state changes (failed, high temperature) are only raised
+// once until the disk recovers
+func CompareHealth(previous *DriveHealthInfo, current *DriveHealthInfo, temperatureLimit int) []*Alert {
+	alerts := []*Alert{}
+	dev := current.DeviceName
+
+	if !current.IsHealthy && (previous == nil || previous.IsHealthy) {
+		message := dev + " (" + current.DeviceModel + ", S/N " + current.SerialNumber + ") reported a FAILED SMART overall-health self-assessment"
+		if SelfTestFailed(current.LastSelfTest) {
+			message = dev + " (" + current.DeviceModel + ", S/N " + current.SerialNumber + ") failed the latest " + current.LastSelfTest.Description + " self-test: " + current.LastSelfTest.Status
+		}
+		alerts = append(alerts, &Alert{
+			Type:       Alert_HealthFailed,
+			DeviceName: dev,
+			Message:    message,
+			Critical:   true,
+			Health:     current,
+		})
+	}
+
+	counters := []struct {
+		alertType AlertType
+		name      string
+		value     func(*DriveHealthInfo) uint64
+	}{
+		{Alert_ReallocatedSectors, "reallocated sector", func(h *DriveHealthInfo) uint64 { return h.ReallocatedSectors + h.ReallocateNANDBlocks }},
+		{Alert_PendingSectors, "pending sector", func(h *DriveHealthInfo) uint64 { return h.PendingSectors }},
+		{Alert_UncorrectableErrors, "uncorrectable error", func(h *DriveHealthInfo) uint64 { return h.UncorrectableErrors }},
+	}
+	for _, counter := range counters {
+		if previous == nil {
+			break
+		}
+		currentValue := counter.value(current)
+		previousValue := counter.value(previous)
+		if currentValue <= previousValue {
+			continue
+		}
+		alerts = append(alerts, &Alert{
+			Type:          counter.alertType,
+			DeviceName:    dev,
+			Message:       dev + " " + counter.name + " count increased from " + strconv.FormatUint(previousValue, 10) + " to " + strconv.FormatUint(currentValue, 10),
+			PreviousValue: previousValue,
+			CurrentValue:  currentValue,
+			Health:        current,
+		})
+	}
+
+	if temperatureLimit > 0 && current.Temperature > temperatureLimit {
+		if previous == nil || previous.Temperature <= temperatureLimit {
+			alerts = append(alerts, &Alert{
+				Type:         Alert_HighTemperature,
+				DeviceName:   dev,
+				Message:      dev + " temperature is " + strconv.Itoa(current.Temperature) + "°C, above the limit of " + strconv.Itoa(temperatureLimit) + "°C",
+				CurrentValue: uint64(current.Temperature),
+				Health:       current,
+			})
+		}
+	}
+
+	return alerts
+}
@@ -0,0 +1,102 @@
+package smart
+
+import "testing"
+
+func alertTypes(alerts []*Alert) []AlertType {
+	types := []AlertType{}
+	for _, alert := range alerts {
+		types = append(types, alert.Type)
+	}
+	return types
+}
+
+func TestCompareHealth(t *testing.T) {
+	healthy := &DriveHealthInfo{DeviceName: "sda", IsHealthy: true, Temperature: 40}
+
+	tests := []struct {
+		name     string
+		previous *DriveHealthInfo
+		current  *DriveHealthInfo
+		want     []AlertType
+	}{
+		{"first healthy reading", nil, healthy, []AlertType{}},
+		{"unchanged", healthy, healthy, []AlertType{}},
+		{
+			"failed",
+			healthy,
+			&DriveHealthInfo{DeviceName: "sda", IsHealthy: false, Temperature: 40},
+			[]AlertType{Alert_HealthFailed},
+		},
+		{
+			"still failed",
+			&DriveHealthInfo{DeviceName: "sda", IsHealthy: false},
+			&DriveHealthInfo{DeviceName: "sda", IsHealthy: false},
+			[]AlertType{},
+		},
+		{
+			"rising counters",
+			&DriveHealthInfo{DeviceName: "sda", IsHealthy: true, ReallocatedSectors: 8, PendingSectors: 2},
+			&DriveHealthInfo{DeviceName: "sda", IsHealthy: true, ReallocatedSectors: 16, PendingSectors: 1, UncorrectableErrors: 1},
+			[]AlertType{Alert_ReallocatedSectors, Alert_UncorrectableErrors},
+		},
+		{
+			"existing counters on first reading",
+			nil,
+			&DriveHealthInfo{DeviceName: "sda", IsHealthy: true, ReallocateNANDBlocks: 3, PendingSectors: 2},
+			[]AlertType{},
+		},
+		{
+			"failed with counters on first reading",
+			nil,
+			&DriveHealthInfo{DeviceName: "sda", IsHealthy: false, PendingSectors: 2, Temperature: 60},
+			[]AlertType{Alert_HealthFailed, Alert_HighTemperature},
+		},
+		{
+			"over temperature",
+			healthy,
+			&DriveHealthInfo{DeviceName: "sda", IsHealthy: true, Temperature: 60},
+			[]AlertType{Alert_HighTemperature},
+		},
+		{
+			"still over temperature",
+			&DriveHealthInfo{DeviceName: "sda", IsHealthy: true, Temperature: 58},
+			&DriveHealthInfo{DeviceName: "sda", IsHealthy: true, Temperature: 60},
+			[]AlertType{},
+		},
+	}
+
+	for _, tt := range tests {
+		got := alertTypes(CompareHealth(tt.previous, tt.current, 55))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got alerts %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got alerts %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestHealthMonitorUpdate(t *testing.T) {
+	alerts := []*Alert{}
+	m := NewHealthMonitor(&MonitorOptions{
+		ListDevices: func() ([]string, error) { return []string{}, nil },
+		OnAlert:     func(alert *Alert) { alerts = append(alerts, alert) },
+	})
+
+	m.update(&DriveHealthInfo{DeviceName: "sda", IsHealthy: true, PendingSectors: 0})
+	m.update(&DriveHealthInfo{DeviceName: "sda", IsHealthy: true, PendingSectors: 4})
+
+	if len(alerts) != 1 || alerts[0].Type != Alert_PendingSectors || alerts[0].CurrentValue != 4 {
+		t.Errorf("unexpected alerts: %+v", alerts)
+	}
+	if snapshot := m.GetSnapshot("sda"); snapshot == nil || snapshot.PendingSectors != 4 {
+		t.Errorf("snapshot not updated: %+v", snapshot)
+	}
+	if len(m.GetSnapshots()) != 1 {
+		t.Errorf("expected 1 snapshot, got %d", len(m.GetSnapshots()))
+	}
+}
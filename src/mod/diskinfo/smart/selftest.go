@@ -0,0 +1,232 @@
+package smart
+
+/*
+	selftest.go
+
+	Start and abort the drive self-tests and read the self-test
+	and error logs of SATA and NVMe disks with smartctl.
+
+	A short test takes a few minutes, a long (extended) test reads
+	the whole surface and can take many hours on large disks
+*/
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// smartctl exit status bits that mean an action or log read failed
+const smartctlActionFailedBits = smartctlExitCommandLine | smartctlExitOpenFailed | smartctlExitCommandFailed
+
+// StartSelfTest starts a self-test on the disk, the test runs in the disk firmware
+// and its result is written to the self-test log
+func StartSelfTest(disk string, testType SelfTestType) error {
+	dt, err := GetDiskType(disk)
+	if err != nil {
+		return err
+	}
+	switch testType {
+	case SelfTest_Short, SelfTest_Long:
+	case SelfTest_Conveyance:
+		if dt != DiskType_SATA {
+			return errors.New("conveyance test is only supported on SATA disks")
+		}
+	default:
+		return errors.New("invalid self-test type, must be short, long or conveyance")
+	}
+
+	//e.g. fails if another test is running
+	if _, err := runSmartctlOnDevice(disk, smartctlActionFailedBits, "-t", string(testType)); err != nil {
+		return errors.New("unable to start self-test: " + err.Error())
+	}
+	return nil
+}
+
+// AbortSelfTest aborts the running self-test on the disk
+func AbortSelfTest(disk string) error {
+	if _, err := runSmartctlOnDevice(disk, smartctlActionFailedBits, "-X"); err != nil {
+		return errors.New("unable to abort self-test: " + err.Error())
+	}
+	return nil
+}
+
+// GetSelfTestProgress checks if a self-test is running on the disk
+func GetSelfTestProgress(disk string) (*SelfTestProgress, error) {
+	// SATA disks report the running test in the capabilities, NVMe disks in the self-test log
+	report, err := runSmartctlOnDevice(disk, smartctlActionFailedBits, "-c", "-l", "selftest")
+	if err != nil {
+		return nil, errors.New("unable to read self-test status: " + err.Error())
+	}
+	return selfTestProgressFromReport(report), nil
+}
+
+// GetSelfTestLog reads the self-test log of the disk, newest first
+func GetSelfTestLog(disk string) ([]*SelfTestLogEntry, error) {
+	report, err := runSmartctlOnDevice(disk, smartctlActionFailedBits, "-l", "selftest")
+	if err != nil {
+		return nil, errors.New("unable to read self-test log: " + err.Error())
+	}
+	return selfTestLogFromReport(report), nil
+}
+
+// GetErrorLog reads the error log of the disk
+func GetErrorLog(disk string) (*ErrorLog, error) {
+	report, err := runSmartctlOnDevice(disk, smartctlActionFailedBits, "-l", "error")
+	if err != nil {
+		return nil, errors.New("unable to read error log: " + err.Error())
+	}
+	return errorLogFromReport(report), nil
+}
+
+// LatestFinishedSelfTest returns the newest self-test that is not in progress, or nil if none
+func LatestFinishedSelfTest(entries []*SelfTestLogEntry) *SelfTestLogEntry {
+	for _, entry := range entries {
+		if !entry.InProgress {
+			return entry
+		}
+	}
+	return nil
+}
+
+// SelfTestFailed checks if the self-test failed. Aborted tests are not failures of the disk
+func SelfTestFailed(entry *SelfTestLogEntry) bool {
+	return entry != nil && !entry.InProgress && !entry.Aborted && !entry.Passed
+}
+
+// selfTestLogFromReport converts the ATA or NVMe self-test log in the report, newest first
+func selfTestLogFromReport(report *SMARTReport) []*SelfTestLogEntry {
+	entries := []*SelfTestLogEntry{}
+	if ataLog := report.ATASmartSelfTestLog; ataLog != nil {
+		table := ataLog.Standard
+		if ataLog.Extended != nil && len(ataLog.Extended.Table) > 0 {
+			table = ataLog.Extended
+		}
+		if table == nil {
+			return entries
+		}
+		for i, row := range table.Table {
+			//The upper 4 bits of the status are the result, the lower 4 bits the remaining 10% steps
+			result := row.Status.Value >> 4
+			entry := &SelfTestLogEntry{
+				Number:           i + 1,
+				Description:      row.Type.String,
+				Status:           row.Status.String,
+				RemainingPercent: (row.Status.Value & 0x0f) * 10,
+				LifetimeHours:    row.LifetimeHours,
+				FirstErrorLBA:    formatLBA(row.LBA),
+				InProgress:       result == 0x0f,
+				Aborted:          result == 0x01 || result == 0x02,
+				Passed:           result == 0x00,
+			}
+			if row.Status.RemainingPercent != nil {
+				entry.RemainingPercent = *row.Status.RemainingPercent
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	if nvmeLog := report.NVMeSelfTestLog; nvmeLog != nil {
+		for i, row := range nvmeLog.Table {
+			result := row.SelfTestResult.Value
+			if result == 0x0f {
+				//Entry not used
+				continue
+			}
+			entries = append(entries, &SelfTestLogEntry{
+				Number:        i,
+				Description:   row.SelfTestCode.String,
+				Status:        row.SelfTestResult.String,
+				LifetimeHours: row.PowerOnHours,
+				FirstErrorLBA: formatLBA(row.LBA),
+				Aborted:       (result >= 0x01 && result <= 0x04) || result == 0x08 || result == 0x09,
+				Passed:        result == 0x00,
+			})
+		}
+	}
+	return entries
+}
+
+// selfTestProgressFromReport reads the self-test execution status (ATA) or the current
+// self-test operation (NVMe) in the report
+func selfTestProgressFromReport(report *SMARTReport) *SelfTestProgress {
+	progress := &SelfTestProgress{}
+	if report.ATASmartData != nil && report.ATASmartData.SelfTest != nil {
+		status := report.ATASmartData.SelfTest.Status
+		if status.Value>>4 == 0x0f {
+			progress.InProgress = true
+			remaining := (status.Value & 0x0f) * 10
+			if status.RemainingPercent != nil {
+				remaining = *status.RemainingPercent
+			}
+			progress.PercentComplete = 100 - remaining
+		}
+	}
+	if nvmeLog := report.NVMeSelfTestLog; nvmeLog != nil && nvmeLog.CurrentSelfTestOperation.Value != 0 {
+		progress.InProgress = true
+		if nvmeLog.CurrentSelfTestCompletionPercent != nil {
+			progress.PercentComplete = *nvmeLog.CurrentSelfTestCompletionPercent
+		}
+	}
+	return progress
+}
+
+// errorLogFromReport converts the ATA or NVMe error log in the report
+func errorLogFromReport(report *SMARTReport) *ErrorLog {
+	errorLog := &ErrorLog{
+		Entries: []*ErrorLogEntry{},
+	}
+	if ataLog := report.ATASmartErrorLog; ataLog != nil {
+		table := ataLog.Summary
+		if ataLog.Extended != nil {
+			table = ataLog.Extended
+		}
+		if table == nil {
+			return errorLog
+		}
+		errorLog.ErrorCount = table.Count
+		for _, row := range table.Table {
+			entry := &ErrorLogEntry{
+				Number:        row.ErrorNumber,
+				LifetimeHours: row.LifetimeHours,
+				Message:       strings.TrimSpace(strings.TrimPrefix(row.ErrorDescription, "Error:")),
+			}
+			if row.DeviceState != nil {
+				entry.State = row.DeviceState.String
+			}
+			errorLog.Entries = append(errorLog.Entries, entry)
+		}
+	}
+
+	if nvmeLog := report.NVMeErrorInformationLog; nvmeLog != nil {
+		for _, row := range nvmeLog.Table {
+			entry := &ErrorLogEntry{
+				Number:  int(row.ErrorCount),
+				Message: row.StatusField.String,
+			}
+			if entry.Message == "" {
+				entry.Message = fmt.Sprintf("status 0x%04x", row.StatusField.Value)
+			}
+			if row.LBA != nil {
+				entry.Message += " at LBA " + strconv.FormatUint(row.LBA.Value, 10)
+			}
+			errorLog.Entries = append(errorLog.Entries, entry)
+			if entry.Number > errorLog.ErrorCount {
+				errorLog.ErrorCount = entry.Number
+			}
+		}
+		if health := report.NVMeSmartHealthLog; health != nil && int(health.NumErrLogEntries) > errorLog.ErrorCount {
+			errorLog.ErrorCount = int(health.NumErrLogEntries)
+		}
+	}
+	return errorLog
+}
+
+// formatLBA returns the LBA as a string, or "-" if not set
+func formatLBA(lba *uint64) string {
+	if lba == nil {
+		return "-"
+	}
+	return strconv.FormatUint(*lba, 10)
+}
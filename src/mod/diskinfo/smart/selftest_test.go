@@ -0,0 +1,281 @@
+package smart
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// loadTestReport decodes a recorded smartctl -x output in testdata
+func loadTestReport(t *testing.T, name string) *SMARTReport {
+	t.Helper()
+	output, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := parseSMARTReport(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestSelfTestLogFromReport(t *testing.T) {
+	entries := selfTestLogFromReport(loadTestReport(t, "sata_ssd.json"))
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 SATA entries, got %d", len(entries))
+	}
+	if !entries[0].InProgress || entries[0].RemainingPercent != 90 {
+		t.Errorf("expected first entry in progress with 90%% remaining, got %+v", entries[0])
+	}
+	latest := LatestFinishedSelfTest(entries)
+	if latest != entries[1] || latest.Description != "Extended offline" || latest.Status != "Completed: read failure" {
+		t.Fatalf("unexpected latest finished test: %+v", latest)
+	}
+	if latest.FirstErrorLBA != "123456789" || latest.LifetimeHours != 21000 || !SelfTestFailed(latest) {
+		t.Errorf("expected failed test at 21000 hours and LBA 123456789, got %+v", latest)
+	}
+	if !entries[2].Aborted || SelfTestFailed(entries[2]) {
+		t.Errorf("expected aborted test not to be a failure, got %+v", entries[2])
+	}
+	if !entries[3].Passed || entries[3].FirstErrorLBA != "-" {
+		t.Errorf("expected last test passed, got %+v", entries[3])
+	}
+
+	entries = selfTestLogFromReport(loadTestReport(t, "nvme.json"))
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 NVMe entries, got %d", len(entries))
+	}
+	if entries[0].Number != 0 || entries[0].Description != "Short" || !entries[0].Passed || entries[0].LifetimeHours != 3400 {
+		t.Errorf("unexpected NVMe entry: %+v", entries[0])
+	}
+	if !entries[1].Aborted {
+		t.Errorf("expected NVMe entry aborted, got %+v", entries[1])
+	}
+
+	if entries := selfTestLogFromReport(loadTestReport(t, "sas.json")); len(entries) != 0 {
+		t.Errorf("expected no entries for SAS disk, got %d", len(entries))
+	}
+}
+
+func TestSelfTestProgressFromReport(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		expected SelfTestProgress
+	}{
+		{"sata_ssd.json", SelfTestProgress{InProgress: true, PercentComplete: 10}},
+		{"nvme.json", SelfTestProgress{InProgress: true, PercentComplete: 12}},
+		{"sata_hdd.json", SelfTestProgress{}},
+	}
+	for _, test := range tests {
+		progress := selfTestProgressFromReport(loadTestReport(t, test.fixture))
+		if *progress != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.fixture, test.expected, *progress)
+		}
+	}
+}
+
+func TestErrorLogFromReport(t *testing.T) {
+	errorLog := errorLogFromReport(loadTestReport(t, "sata_ssd.json"))
+	if errorLog.ErrorCount != 12 || len(errorLog.Entries) != 2 {
+		t.Fatalf("expected 12 errors with 2 entries, got %d with %d", errorLog.ErrorCount, len(errorLog.Entries))
+	}
+	first := errorLog.Entries[0]
+	if first.Number != 12 || first.LifetimeHours != 20999 || first.State != "active or idle" || first.Message != "UNC at LBA = 0x0fffffff = 268435455" {
+		t.Errorf("unexpected SATA error entry: %+v", first)
+	}
+	if errorLog.Entries[1].Message != "ABRT" {
+		t.Errorf("unexpected SATA error message: %q", errorLog.Entries[1].Message)
+	}
+
+	errorLog = errorLogFromReport(loadTestReport(t, "nvme.json"))
+	if errorLog.ErrorCount != 3 || len(errorLog.Entries) != 2 {
+		t.Fatalf("expected 3 errors with 2 entries, got %d with %d", errorLog.ErrorCount, len(errorLog.Entries))
+	}
+	if errorLog.Entries[0].Message != "Invalid Field in Command" {
+		t.Errorf("unexpected NVMe error message: %q", errorLog.Entries[0].Message)
+	}
+	if errorLog.Entries[1].Message != "status 0x4281 at LBA 1234567" {
+		t.Errorf("unexpected NVMe error message: %q", errorLog.Entries[1].Message)
+	}
+
+	if errorLog := errorLogFromReport(loadTestReport(t, "sata_hdd.json")); errorLog.ErrorCount != 0 || len(errorLog.Entries) != 0 {
+		t.Errorf("expected empty error log, got %+v", errorLog)
+	}
+}
+
+// fakeSelfTestDriver simulates a SATA disk that runs one test at a time
+type fakeSelfTestDriver struct {
+	running    bool
+	progress   int
+	hours      uint64
+	log        []*SelfTestLogEntry
+	onStart    func() //Called while the test is started, e.g. to start another test at the same time
+	onProgress func() //Called while the progress is read, e.g. to abort the test at the same time
+}
+
+func (d *fakeSelfTestDriver) DiskType(disk string) (DiskType, error) {
+	if disk != "sda" {
+		return DiskType_Unknown, errors.New("disk is not a valid disk")
+	}
+	return DiskType_SATA, nil
+}
+
+func (d *fakeSelfTestDriver) PowerOnHours(disk string) (uint64, error) {
+	return d.hours, nil
+}
+
+func (d *fakeSelfTestDriver) Start(disk string, testType SelfTestType) error {
+	if d.onStart != nil {
+		d.onStart()
+	}
+	d.running = true
+	return nil
+}
+
+func (d *fakeSelfTestDriver) Abort(disk string) error {
+	d.running = false
+	return nil
+}
+
+func (d *fakeSelfTestDriver) Progress(disk string) (*SelfTestProgress, error) {
+	if d.onProgress != nil {
+		d.onProgress()
+	}
+	return &SelfTestProgress{InProgress: d.running, PercentComplete: d.progress}, nil
+}
+
+func (d *fakeSelfTestDriver) Log(disk string) ([]*SelfTestLogEntry, error) {
+	return d.log, nil
+}
+
+func TestSelfTestRunner(t *testing.T) {
+	driver := &fakeSelfTestDriver{}
+	runner, err := NewSelfTestRunner(filepath.Join(t.TempDir(), "selftest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.driver = driver
+
+	if _, err := runner.StartTest("sdz", SelfTest_Short, SELFTEST_TRIGGER_MANUAL); err == nil {
+		t.Error("expected error for unknown disk")
+	}
+	if _, err := runner.StartTest("sda", "quick", SELFTEST_TRIGGER_MANUAL); err == nil {
+		t.Error("expected error for invalid test type")
+	}
+
+	record, err := runner.StartTest("/dev/sda", SelfTest_Long, SELFTEST_TRIGGER_MANUAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.StartTest("sda", SelfTest_Short, SELFTEST_TRIGGER_MANUAL); err == nil {
+		t.Error("expected error when a test is already running")
+	}
+
+	driver.progress = 40
+	runner.poll(time.Now())
+	if history := runner.History("sda"); history[0].Progress != 40 {
+		t.Errorf("expected progress 40, got %d", history[0].Progress)
+	}
+
+	//Test finished with a read failure
+	driver.running = false
+	driver.log = selfTestLogFromReport(loadTestReport(t, "sata_ssd.json"))[1:]
+	runner.poll(time.Now())
+	history := runner.History("sda")
+	if len(history) != 1 || history[0].ID != record.ID {
+		t.Fatalf("expected 1 record in history, got %d", len(history))
+	}
+	if history[0].Status != SELFTEST_STATUS_FAILED || history[0].FirstErrorLBA != "123456789" {
+		t.Errorf("expected failed at LBA 123456789, got %+v", history[0])
+	}
+
+	//Schedule a short test, which is then aborted
+	if err := runner.SetSchedule(&SelfTestSchedule{DeviceName: "sda", Type: SelfTest_Short, Cron: "@weekly", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	nextRun := time.Unix(runner.ListSchedules()[0].NextRun, 0)
+	runner.poll(nextRun)
+	history = runner.History("sda")
+	if len(history) != 2 || history[0].Trigger != SELFTEST_TRIGGER_SCHEDULE || history[0].Status != SELFTEST_STATUS_RUNNING {
+		t.Fatalf("expected a running scheduled test, got %+v", history[0])
+	}
+	if _, err := runner.AbortTest("sda"); err != nil {
+		t.Fatal(err)
+	}
+	if history := runner.History(""); history[0].Status != SELFTEST_STATUS_ABORTED {
+		t.Errorf("expected aborted, got %s", history[0].Status)
+	}
+
+	//History and schedules are kept in the state file
+	reloaded, err := NewSelfTestRunner(runner.stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.History("")) != 2 || len(reloaded.ListSchedules()) != 1 {
+		t.Error("expected history and schedules to be loaded from the state file")
+	}
+}
+
+func TestSelfTestRunnerAbortDuringPoll(t *testing.T) {
+	driver := &fakeSelfTestDriver{}
+	runner, err := NewSelfTestRunner(filepath.Join(t.TempDir(), "selftest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.driver = driver
+
+	if _, err := runner.StartTest("sda", SelfTest_Short, SELFTEST_TRIGGER_MANUAL); err != nil {
+		t.Fatal(err)
+	}
+
+	//smartctl runs without the mutex, so the API still works while the progress is read
+	driver.onProgress = func() {
+		driver.onProgress = nil
+		if _, err := runner.AbortTest("sda"); err != nil {
+			t.Error(err)
+		}
+	}
+	runner.poll(time.Now())
+
+	history := runner.History("sda")
+	if len(history) != 1 || history[0].Status != SELFTEST_STATUS_ABORTED {
+		t.Errorf("expected the aborted test to be kept, got %+v", history[0])
+	}
+}
+
+func TestSelfTestRunnerStartWithoutLock(t *testing.T) {
+	driver := &fakeSelfTestDriver{hours: 21001}
+	runner, err := NewSelfTestRunner(filepath.Join(t.TempDir(), "selftest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.driver = driver
+
+	//smartctl runs without the mutex, a second test on the same disk is refused while starting
+	driver.onStart = func() {
+		driver.onStart = nil
+		runner.History("")
+		if _, err := runner.StartTest("sda", SelfTest_Short, SELFTEST_TRIGGER_MANUAL); err == nil {
+			t.Error("expected error when a test is being started")
+		}
+	}
+	record, err := runner.StartTest("sda", SelfTest_Long, SELFTEST_TRIGGER_MANUAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.StartHours != 21001 {
+		t.Errorf("expected start hours 21001, got %d", record.StartHours)
+	}
+
+	//The latest extended test in the log ran at 21000 hours, before this test started
+	driver.running = false
+	driver.log = selfTestLogFromReport(loadTestReport(t, "sata_ssd.json"))[1:]
+	runner.poll(time.Now())
+	history := runner.History("sda")
+	if len(history) != 1 || history[0].Status != SELFTEST_STATUS_ERROR || history[0].FirstErrorLBA != "" {
+		t.Errorf("expected the older log entry not to be the result, got %+v", history[0])
+	}
+}
@@ -0,0 +1,577 @@
+package smart
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"imuslab.com/bokofs/bokofsd/mod/scheduler"
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	selftestrunner.go
+
+	Run self-tests on demand or on a cron schedule per disk, poll
+	their progress and keep the results in a history. The result
+	of a test is read from the self-test log of the disk after the
+	disk reports the test is no longer in progress.
+
+	Failed tests are picked up by the health monitor, which marks
+	the disk unhealthy and raises the alert
+*/
+
+const (
+	SELFTEST_STATUS_RUNNING = "running"
+	SELFTEST_STATUS_PASSED  = "passed"
+	SELFTEST_STATUS_FAILED  = "failed"
+	SELFTEST_STATUS_ABORTED = "aborted"
+	SELFTEST_STATUS_ERROR   = "error" //Unable to start the test or read its result
+
+	SELFTEST_TRIGGER_SCHEDULE = "schedule"
+	SELFTEST_TRIGGER_MANUAL   = "manual"
+
+	selfTestPollInterval = time.Minute
+	maxSelfTestRecords   = 200 //No. of finished tests to keep in the history
+)
+
+type SelfTestRecord struct {
+	ID            string       `json:"id"`
+	DeviceName    string       `json:"device_name"` //e.g. sda
+	Type          SelfTestType `json:"type"`
+	Trigger       string       `json:"trigger"` //schedule or manual
+	Status        string       `json:"status"`
+	Progress      int          `json:"progress"` //Progress in percent
+	Result        string       `json:"result"`   //Status in the self-test log, e.g. Completed: read failure
+	LifetimeHours uint64       `json:"lifetime_hours"`
+	StartHours    uint64       `json:"start_hours"` //Power on hours when the test started, older log entries are not its result
+	FirstErrorLBA string       `json:"first_error_lba"`
+	Error         string       `json:"error"`
+	StartTime     int64        `json:"start_time"`
+	EndTime       int64        `json:"end_time"`
+}
+
+type SelfTestSchedule struct {
+	DeviceName string       `json:"device_name"` //e.g. sda
+	Type       SelfTestType `json:"type"`
+	Cron       string       `json:"cron"` //e.g. 0 2 * * 6 for 02:00 every Saturday
+	Enabled    bool         `json:"enabled"`
+	NextRun    int64        `json:"next_run"` //Unix time of the next test, 0 if disabled
+}
+
+type selfTestState struct {
+	Schedules []*SelfTestSchedule `json:"schedules"`
+	History   []*SelfTestRecord   `json:"history"`
+}
+
+// selfTestDriver runs the smartctl commands, replaced in tests
+type selfTestDriver interface {
+	DiskType(disk string) (DiskType, error)
+	PowerOnHours(disk string) (uint64, error)
+	Start(disk string, testType SelfTestType) error
+	Abort(disk string) error
+	Progress(disk string) (*SelfTestProgress, error)
+	Log(disk string) ([]*SelfTestLogEntry, error)
+}
+
+type smartctlDriver struct{}
+
+func (smartctlDriver) DiskType(disk string) (DiskType, error) {
+	return GetDiskType(disk)
+}
+
+func (smartctlDriver) PowerOnHours(disk string) (uint64, error) {
+	healthInfo, err := GetDiskSMARTHealthSummary(disk)
+	if err != nil {
+		return 0, err
+	}
+	return healthInfo.PowerOnHours, nil
+}
+
+func (smartctlDriver) Start(disk string, testType SelfTestType) error {
+	return StartSelfTest(disk, testType)
+}
+
+func (smartctlDriver) Abort(disk string) error {
+	return AbortSelfTest(disk)
+}
+
+func (smartctlDriver) Progress(disk string) (*SelfTestProgress, error) {
+	return GetSelfTestProgress(disk)
+}
+
+func (smartctlDriver) Log(disk string) ([]*SelfTestLogEntry, error) {
+	return GetSelfTestLog(disk)
+}
+
+type SelfTestRunner struct {
+	OnProgress func(record *SelfTestRecord) //Optional, called when the status or progress of a test changed
+	stateFile  string
+	driver     selfTestDriver
+	schedules  []*SelfTestSchedule
+	history    []*SelfTestRecord
+	starting   map[string]bool //Disks with a test being started, which is not in the history yet
+	stop       chan bool
+	mutex      sync.Mutex
+}
+
+// NewSelfTestRunner creates a self-test runner and loads the schedules and history
+// from the state file, call Start to run the schedules and track the running tests
+func NewSelfTestRunner(stateFile string) (*SelfTestRunner, error) {
+	runner := &SelfTestRunner{
+		stateFile: stateFile,
+		driver:    smartctlDriver{},
+		schedules: []*SelfTestSchedule{},
+		history:   []*SelfTestRecord{},
+		starting:  map[string]bool{},
+	}
+	if !utils.FileExists(stateFile) {
+		return runner, nil
+	}
+	content, err := os.ReadFile(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	state := selfTestState{}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, errors.New("unable to parse self-test state: " + err.Error())
+	}
+	if state.Schedules != nil {
+		runner.schedules = state.Schedules
+	}
+	if state.History != nil {
+		runner.history = state.History
+	}
+	return runner, nil
+}
+
+// Start runs the schedules in the background. Tests missed while the service was
+// stopped are skipped, tests still running in the disks are tracked again
+func (r *SelfTestRunner) Start() error {
+	r.mutex.Lock()
+	if r.stop != nil {
+		r.mutex.Unlock()
+		return errors.New("self-test runner already started")
+	}
+	r.stop = make(chan bool)
+	now := time.Now()
+	for _, schedule := range r.schedules {
+		updateSelfTestNextRun(schedule, now)
+	}
+	stop := r.stop
+	r.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(selfTestPollInterval)
+		defer ticker.Stop()
+		r.poll(time.Now())
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				r.poll(time.Now())
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops running the schedules, running tests are not aborted
+func (r *SelfTestRunner) Stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// StartTest starts a self-test on the disk, e.g. sda
+func (r *SelfTestRunner) StartTest(disk string, testType SelfTestType, trigger string) (*SelfTestRecord, error) {
+	record, err := r.startTest(strings.TrimPrefix(disk, "/dev/"), testType, trigger)
+	if err != nil {
+		return nil, err
+	}
+	r.notify(record)
+	return record, nil
+}
+
+// AbortTest aborts the running self-test on the disk
+func (r *SelfTestRunner) AbortTest(disk string) (*SelfTestRecord, error) {
+	disk = strings.TrimPrefix(disk, "/dev/")
+	r.mutex.Lock()
+	record := r.runningRecord(disk)
+	if record == nil {
+		r.mutex.Unlock()
+		return nil, errors.New("no self-test is running on " + disk)
+	}
+	if err := r.driver.Abort(disk); err != nil {
+		r.mutex.Unlock()
+		return nil, err
+	}
+	log.Println("[SMART] Self-test on " + disk + " aborted")
+	record.Status = SELFTEST_STATUS_ABORTED
+	record.EndTime = time.Now().Unix()
+	if err := r.saveToFile(); err != nil {
+		log.Println("[SMART] Unable to save self-test state: " + err.Error())
+	}
+	thisRecord := *record
+	r.mutex.Unlock()
+
+	r.notify(&thisRecord)
+	return &thisRecord, nil
+}
+
+// History returns the self-tests of the disk from the newest to the oldest, or of all disks if disk is empty
+func (r *SelfTestRunner) History(disk string) []*SelfTestRecord {
+	disk = strings.TrimPrefix(disk, "/dev/")
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	results := []*SelfTestRecord{}
+	for i := len(r.history) - 1; i >= 0; i-- {
+		if disk == "" || r.history[i].DeviceName == disk {
+			thisRecord := *r.history[i]
+			results = append(results, &thisRecord)
+		}
+	}
+	return results
+}
+
+// ListSchedules returns the self-test schedules of all disks
+func (r *SelfTestRunner) ListSchedules() []*SelfTestSchedule {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	results := []*SelfTestSchedule{}
+	for _, schedule := range r.schedules {
+		thisSchedule := *schedule
+		results = append(results, &thisSchedule)
+	}
+	return results
+}
+
+// SetSchedule validates the schedule and adds it, or replaces the schedule of the same disk and test type
+func (r *SelfTestRunner) SetSchedule(schedule *SelfTestSchedule) error {
+	schedule.DeviceName = strings.TrimPrefix(schedule.DeviceName, "/dev/")
+	if _, err := scheduler.Parse(schedule.Cron); err != nil {
+		return err
+	}
+	if err := r.checkTestType(schedule.DeviceName, schedule.Type); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	updateSelfTestNextRun(schedule, time.Now())
+	newSchedule := *schedule
+	replaced := false
+	for i, thisSchedule := range r.schedules {
+		if thisSchedule.DeviceName == schedule.DeviceName && thisSchedule.Type == schedule.Type {
+			r.schedules[i] = &newSchedule
+			replaced = true
+		}
+	}
+	if !replaced {
+		r.schedules = append(r.schedules, &newSchedule)
+	}
+	return r.saveToFile()
+}
+
+// RemoveSchedule removes the schedule of the test type on the disk
+func (r *SelfTestRunner) RemoveSchedule(disk string, testType SelfTestType) error {
+	disk = strings.TrimPrefix(disk, "/dev/")
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	results := []*SelfTestSchedule{}
+	for _, schedule := range r.schedules {
+		if schedule.DeviceName != disk || schedule.Type != testType {
+			results = append(results, schedule)
+		}
+	}
+	if len(results) == len(r.schedules) {
+		return errors.New("no " + string(testType) + " self-test schedule found for " + disk)
+	}
+	r.schedules = results
+	return r.saveToFile()
+}
+
+// poll updates the running tests and starts the tests that are due
+func (r *SelfTestRunner) poll(now time.Time) {
+	//Read the running tests with smartctl without holding the mutex,
+	//so the API is not blocked by a busy or slow disk
+	r.mutex.Lock()
+	running := []SelfTestRecord{}
+	for _, record := range r.history {
+		if record.Status == SELFTEST_STATUS_RUNNING {
+			running = append(running, *record)
+		}
+	}
+	r.mutex.Unlock()
+
+	updated := []*SelfTestRecord{}
+	for i := range running {
+		if r.updateRunningTest(&running[i]) {
+			updated = append(updated, &running[i])
+		}
+	}
+
+	r.mutex.Lock()
+	changed := []*SelfTestRecord{}
+	for _, update := range updated {
+		for _, record := range r.history {
+			//Skip the test if it is aborted while reading its progress
+			if record.ID == update.ID && record.Status == SELFTEST_STATUS_RUNNING {
+				*record = *update
+				thisRecord := *record
+				changed = append(changed, &thisRecord)
+			}
+		}
+	}
+
+	due := []SelfTestSchedule{}
+	for _, schedule := range r.schedules {
+		if !schedule.Enabled || schedule.NextRun == 0 || now.Unix() < schedule.NextRun {
+			continue
+		}
+		updateSelfTestNextRun(schedule, now)
+		due = append(due, *schedule)
+	}
+	if len(due) > 0 || len(changed) > 0 {
+		if err := r.saveToFile(); err != nil {
+			log.Println("[SMART] Unable to save self-test state: " + err.Error())
+		}
+	}
+	r.mutex.Unlock()
+
+	//Start the due tests with smartctl without holding the mutex
+	for _, schedule := range due {
+		record, err := r.startTest(schedule.DeviceName, schedule.Type, SELFTEST_TRIGGER_SCHEDULE)
+		if err != nil {
+			//Keep the skipped test in the history so it does not go unnoticed
+			log.Println("[SMART] Scheduled " + string(schedule.Type) + " self-test on " + schedule.DeviceName + " skipped: " + err.Error())
+			record = &SelfTestRecord{
+				ID:         uuid.New().String(),
+				DeviceName: schedule.DeviceName,
+				Type:       schedule.Type,
+				Trigger:    SELFTEST_TRIGGER_SCHEDULE,
+				Status:     SELFTEST_STATUS_ERROR,
+				Error:      err.Error(),
+				StartTime:  now.Unix(),
+				EndTime:    now.Unix(),
+			}
+			r.mutex.Lock()
+			r.history = append(r.history, record)
+			r.pruneHistory()
+			if err := r.saveToFile(); err != nil {
+				log.Println("[SMART] Unable to save self-test state: " + err.Error())
+			}
+			thisRecord := *record
+			record = &thisRecord
+			r.mutex.Unlock()
+		}
+		changed = append(changed, record)
+	}
+
+	for _, record := range changed {
+		r.notify(record)
+	}
+}
+
+// updateRunningTest updates the progress of the test and reads its result from the
+// self-test log when finished, returns true if changed. It runs smartctl so the record
+// must be a copy, which is applied to the history by the caller with the mutex locked
+func (r *SelfTestRunner) updateRunningTest(record *SelfTestRecord) bool {
+	progress, err := r.driver.Progress(record.DeviceName)
+	if err != nil {
+		//The disk might be busy or unplugged, try again on the next poll
+		return false
+	}
+	if progress.InProgress {
+		if progress.PercentComplete == record.Progress {
+			return false
+		}
+		record.Progress = progress.PercentComplete
+		return true
+	}
+
+	record.EndTime = time.Now().Unix()
+	entries, err := r.driver.Log(record.DeviceName)
+	if err != nil {
+		record.Status = SELFTEST_STATUS_ERROR
+		record.Error = err.Error()
+		return true
+	}
+	result := LatestFinishedSelfTest(entries)
+	if result == nil || !selfTestTypeMatches(result.Description, record.Type) || result.LifetimeHours < record.StartHours {
+		//An older test is not the result, e.g. the test is not logged if aborted by a reset
+		record.Status = SELFTEST_STATUS_ERROR
+		record.Error = "result not found in the self-test log"
+		return true
+	}
+
+	record.Result = result.Status
+	record.LifetimeHours = result.LifetimeHours
+	record.FirstErrorLBA = result.FirstErrorLBA
+	switch {
+	case result.Passed:
+		record.Status = SELFTEST_STATUS_PASSED
+		record.Progress = 100
+	case result.Aborted:
+		record.Status = SELFTEST_STATUS_ABORTED
+	default:
+		record.Status = SELFTEST_STATUS_FAILED
+	}
+	log.Println("[SMART] " + string(record.Type) + " self-test on " + record.DeviceName + " finished: " + result.Status)
+	return true
+}
+
+// startTest starts the test and adds it to the history. It runs smartctl so the
+// mutex must not be locked, the disk is reserved while the test is being started
+func (r *SelfTestRunner) startTest(disk string, testType SelfTestType, trigger string) (*SelfTestRecord, error) {
+	if err := r.checkTestType(disk, testType); err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	if r.runningRecord(disk) != nil || r.starting[disk] {
+		r.mutex.Unlock()
+		return nil, errors.New("a self-test is already running on " + disk)
+	}
+	r.starting[disk] = true
+	r.mutex.Unlock()
+
+	//Not all disks report the power on hours, 0 accepts any entry in the log
+	startHours, _ := r.driver.PowerOnHours(disk)
+	err := r.driver.Start(disk, testType)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.starting, disk)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("[SMART] " + string(testType) + " self-test started on " + disk)
+	record := &SelfTestRecord{
+		ID:         uuid.New().String(),
+		DeviceName: disk,
+		Type:       testType,
+		Trigger:    trigger,
+		Status:     SELFTEST_STATUS_RUNNING,
+		StartHours: startHours,
+		StartTime:  time.Now().Unix(),
+	}
+	r.history = append(r.history, record)
+	r.pruneHistory()
+	if err := r.saveToFile(); err != nil {
+		log.Println("[SMART] Unable to save self-test state: " + err.Error())
+	}
+	thisRecord := *record
+	return &thisRecord, nil
+}
+
+// checkTestType checks the disk exists and supports the test type
+func (r *SelfTestRunner) checkTestType(disk string, testType SelfTestType) error {
+	dt, err := r.driver.DiskType(disk)
+	if err != nil {
+		return err
+	}
+	switch testType {
+	case SelfTest_Short, SelfTest_Long:
+		return nil
+	case SelfTest_Conveyance:
+		if dt != DiskType_SATA {
+			return errors.New("conveyance test is only supported on SATA disks")
+		}
+		return nil
+	}
+	return errors.New("invalid self-test type, must be short, long or conveyance")
+}
+
+// runningRecord returns the running test of the disk, require the mutex to be locked
+func (r *SelfTestRunner) runningRecord(disk string) *SelfTestRecord {
+	for _, record := range r.history {
+		if record.DeviceName == disk && record.Status == SELFTEST_STATUS_RUNNING {
+			return record
+		}
+	}
+	return nil
+}
+
+// pruneHistory removes the oldest finished tests, require the mutex to be locked
+func (r *SelfTestRunner) pruneHistory() {
+	finished := 0
+	for _, record := range r.history {
+		if record.Status != SELFTEST_STATUS_RUNNING {
+			finished++
+		}
+	}
+
+	results := []*SelfTestRecord{}
+	for _, record := range r.history {
+		if record.Status != SELFTEST_STATUS_RUNNING && finished > maxSelfTestRecords {
+			finished--
+			continue
+		}
+		results = append(results, record)
+	}
+	r.history = results
+}
+
+// saveToFile writes the schedules and history to the state file, require the mutex to be locked
+func (r *SelfTestRunner) saveToFile() error {
+	js, err := json.MarshalIndent(selfTestState{
+		Schedules: r.schedules,
+		History:   r.history,
+	}, "", " ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.stateFile), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.stateFile, js, 0644)
+}
+
+func (r *SelfTestRunner) notify(record *SelfTestRecord) {
+	if r.OnProgress != nil {
+		r.OnProgress(record)
+	}
+}
+
+// updateSelfTestNextRun calculates the next run of the schedule after now
+func updateSelfTestNextRun(schedule *SelfTestSchedule, now time.Time) {
+	schedule.NextRun = 0
+	if !schedule.Enabled {
+		return
+	}
+	cron, err := scheduler.Parse(schedule.Cron)
+	if err != nil {
+		log.Println("[SMART] Invalid self-test schedule for " + schedule.DeviceName + ": " + err.Error())
+		return
+	}
+	if next := cron.Next(now); !next.IsZero() {
+		schedule.NextRun = next.Unix()
+	}
+}
+
+// selfTestTypeMatches checks if the description in the self-test log is of the test type,
+// e.g. "Extended offline" (SATA) or "Extended" (NVMe) for a long test
+func selfTestTypeMatches(description string, testType SelfTestType) bool {
+	description = strings.ToLower(description)
+	switch testType {
+	case SelfTest_Short:
+		return strings.HasPrefix(description, "short")
+	case SelfTest_Long:
+		return strings.HasPrefix(description, "extended")
+	case SelfTest_Conveyance:
+		return strings.HasPrefix(description, "conveyance")
+	}
+	return false
+}
@@ -4,339 +4,416 @@ package smart
 	SMART.go
 
 	This script uses the smartctl command to retrieve information about the disk.
-	It supports both NVMe and SATA disks on Linux systems only.
+	The JSON output of smartctl is decoded into a SMARTReport, the summaries
+	below are derived from it. It supports NVMe, SATA and SAS disks, including the ones
+	behind USB bridges and RAID controllers (see devicetype.go), on Linux systems only.
 */
 
 import (
-	"bufio"
 	"errors"
-	"os/exec"
+	"fmt"
 	"strconv"
 	"strings"
-
-	"imuslab.com/bokofs/bokofsd/mod/diskinfo"
 )
 
-// GetDiskType checks if the disk is NVMe or SATA
+// GetDiskType checks if the disk is NVMe, SATA or SAS, see ResolveDevice for how the disk is detected
 func GetDiskType(disk string) (DiskType, error) {
-	if !strings.HasPrefix(disk, "/dev/") {
-		disk = "/dev/" + disk
-	}
-
-	//Make sure the target is a disk
-	if !diskinfo.DevicePathIsValidDisk(disk) {
-		return DiskType_Unknown, errors.New("disk is not a valid disk")
+	device, err := ResolveDevice(disk)
+	if err != nil {
+		return DiskType_Unknown, err
 	}
-
-	//Check if the disk is a NVMe or SATA disk
-	if strings.HasPrefix(disk, "/dev/nvme") {
-		return DiskType_NVMe, nil
-	} else if strings.HasPrefix(disk, "/dev/sd") {
-		return DiskType_SATA, nil
+	dt := device.DiskType()
+	if dt == DiskType_Unknown {
+		return DiskType_Unknown, errors.New("unable to detect the type of the disk")
 	}
-	return DiskType_Unknown, errors.New("disk is not NVMe or SATA")
+	return dt, nil
 }
 
 // GetNVMEInfo retrieves NVMe disk information using smartctl
 func GetNVMEInfo(disk string) (*NVMEInfo, error) {
-	if !strings.HasPrefix(disk, "/dev/") {
-		disk = "/dev/" + disk
+	report, err := runSmartctlOnDevice(disk, smartctlExitCommandLine|smartctlExitOpenFailed, "-i")
+	if err != nil {
+		return nil, err
 	}
+	return nvmeInfoFromReport(report), nil
+}
 
-	cmd := exec.Command("smartctl", "-i", disk)
-	output, err := cmd.Output()
+// GetSATADiskInfo retrieves SATA disk information using smartctl
+func GetSATAInfo(disk string) (*SATADiskInfo, error) {
+	report, err := runSmartctlOnDevice(disk, smartctlExitCommandLine|smartctlExitOpenFailed, "-i")
 	if err != nil {
 		return nil, err
 	}
+	return sataInfoFromReport(report), nil
+}
 
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	info := &NVMEInfo{}
+// SetSMARTEnableOnDisk enables or disables SMART on the specified disk
+func SetSMARTEnableOnDisk(disk string, isEnabled bool) error {
+	enableCmd := "off"
+	if isEnabled {
+		enableCmd = "on"
+	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "Model Number:") {
-			info.ModelNumber = strings.TrimSpace(strings.TrimPrefix(line, "Model Number:"))
-		} else if strings.HasPrefix(line, "Serial Number:") {
-			info.SerialNumber = strings.TrimSpace(strings.TrimPrefix(line, "Serial Number:"))
-		} else if strings.HasPrefix(line, "Firmware Version:") {
-			info.FirmwareVersion = strings.TrimSpace(strings.TrimPrefix(line, "Firmware Version:"))
-		} else if strings.HasPrefix(line, "PCI Vendor/Subsystem ID:") {
-			info.PCIVendorSubsystemID = strings.TrimSpace(strings.TrimPrefix(line, "PCI Vendor/Subsystem ID:"))
-		} else if strings.HasPrefix(line, "IEEE OUI Identifier:") {
-			info.IEEEOUIIdentifier = strings.TrimSpace(strings.TrimPrefix(line, "IEEE OUI Identifier:"))
-		} else if strings.HasPrefix(line, "Total NVM Capacity:") {
-			info.TotalNVMeCapacity = strings.TrimSpace(strings.TrimPrefix(line, "Total NVM Capacity:"))
-		} else if strings.HasPrefix(line, "Unallocated NVM Capacity:") {
-			info.UnallocatedNVMeCapacity = strings.TrimSpace(strings.TrimPrefix(line, "Unallocated NVM Capacity:"))
-		} else if strings.HasPrefix(line, "Controller ID:") {
-			info.ControllerID = strings.TrimSpace(strings.TrimPrefix(line, "Controller ID:"))
-		} else if strings.HasPrefix(line, "NVMe Version:") {
-			info.NVMeVersion = strings.TrimSpace(strings.TrimPrefix(line, "NVMe Version:"))
-		} else if strings.HasPrefix(line, "Number of Namespaces:") {
-			info.NumberOfNamespaces = strings.TrimSpace(strings.TrimPrefix(line, "Number of Namespaces:"))
-		} else if strings.HasPrefix(line, "Namespace 1 Size/Capacity:") {
-			info.NamespaceSizeCapacity = strings.TrimSpace(strings.TrimPrefix(line, "Namespace 1 Size/Capacity:"))
-		} else if strings.HasPrefix(line, "Namespace 1 Utilization:") {
-			info.NamespaceUtilization = strings.TrimSpace(strings.TrimPrefix(line, "Namespace 1 Utilization:"))
-		} else if strings.HasPrefix(line, "Namespace 1 Formatted LBA Size:") {
-			info.NamespaceFormattedLBASize = strings.TrimSpace(strings.TrimPrefix(line, "Namespace 1 Formatted LBA Size:"))
-		} else if strings.HasPrefix(line, "Namespace 1 IEEE EUI-64:") {
-			info.NamespaceIEEE_EUI_64 = strings.TrimSpace(strings.TrimPrefix(line, "Namespace 1 IEEE EUI-64:"))
-		}
+	if _, err := runSmartctlOnDevice(disk, smartctlActionFailedBits, "-s", enableCmd); err != nil {
+		return errors.New("failed to set SMART on disk: " + err.Error())
 	}
+	return nil
+}
 
-	if err := scanner.Err(); err != nil {
+// GetDiskSMARTCheck retrieves the SMART health status of the specified disk
+// Usually only returns "PASSED" or "FAILED"
+func GetDiskSMARTCheck(diskname string) (*SMARTTestResult, error) {
+	// Exit status of a failing disk are not errors, the result is in the report
+	report, err := runSmartctlOnDevice(diskname, smartctlExitCommandLine|smartctlExitOpenFailed, "-H", "-A")
+	if err != nil {
 		return nil, err
 	}
 
-	return info, nil
-}
-
-// GetSATADiskInfo retrieves SATA disk information using smartctl
-func GetSATAInfo(disk string) (*SATADiskInfo, error) {
-	if !strings.HasPrefix(disk, "/dev/") {
-		disk = "/dev/" + disk
+	result := smartCheckFromReport(report)
+	if result.TestResult == "Unknown" {
+		return nil, errors.New("unable to determine SMART health status")
 	}
+	return result, nil
+}
 
-	cmd := exec.Command("smartctl", "-i", disk)
-	output, err := cmd.Output()
+// GetDiskSMARTHealthSummary reads the SMART report of the disk and summarize its health
+func GetDiskSMARTHealthSummary(diskname string) (*DriveHealthInfo, error) {
+	//Only disks with a known type are supported
+	device, err := ResolveDevice(diskname)
 	if err != nil {
 		return nil, err
 	}
-
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	info := &SATADiskInfo{}
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "Model Family:") {
-			info.ModelFamily = strings.TrimSpace(strings.TrimPrefix(line, "Model Family:"))
-		} else if strings.HasPrefix(line, "Device Model:") {
-			info.DeviceModel = strings.TrimSpace(strings.TrimPrefix(line, "Device Model:"))
-		} else if strings.HasPrefix(line, "Serial Number:") {
-			info.SerialNumber = strings.TrimSpace(strings.TrimPrefix(line, "Serial Number:"))
-		} else if strings.HasPrefix(line, "Firmware Version:") {
-			info.Firmware = strings.TrimSpace(strings.TrimPrefix(line, "Firmware Version:"))
-		} else if strings.HasPrefix(line, "User Capacity:") {
-			info.UserCapacity = strings.TrimSpace(strings.TrimPrefix(line, "User Capacity:"))
-		} else if strings.HasPrefix(line, "Sector Size:") {
-			info.SectorSize = strings.TrimSpace(strings.TrimPrefix(line, "Sector Size:"))
-		} else if strings.HasPrefix(line, "Rotation Rate:") {
-			info.RotationRate = strings.TrimSpace(strings.TrimPrefix(line, "Rotation Rate:"))
-		} else if strings.HasPrefix(line, "Form Factor:") {
-			info.FormFactor = strings.TrimSpace(strings.TrimPrefix(line, "Form Factor:"))
-		} else if strings.HasPrefix(line, "SMART support is:") {
-			info.SmartSupport = strings.TrimSpace(strings.TrimPrefix(line, "SMART support is:")) == "Enabled"
-		}
+	if device.DiskType() == DiskType_Unknown {
+		return nil, errors.New("unable to detect the type of the disk")
 	}
 
-	if err := scanner.Err(); err != nil {
+	report, err := runSmartctl(smartctlExitCommandLine|smartctlExitOpenFailed, append([]string{"-x"}, device.smartctlArgs()...)...)
+	if err != nil {
 		return nil, err
 	}
-
-	return info, nil
+	if report.SmartStatus == nil {
+		return nil, errors.New("unable to determine SMART health status")
+	}
+	healthInfo := healthFromReport(device.Name, report)
+	healthInfo.Transport = device.Transport
+	healthInfo.DeviceType = device.Type
+	return healthInfo, nil
 }
 
-// SetSMARTEnableOnDisk enables or disables SMART on the specified disk
-func SetSMARTEnableOnDisk(disk string, isEnabled bool) error {
-	if !strings.HasPrefix(disk, "/dev/") {
-		disk = "/dev/" + disk
+// sataInfoFromReport converts the information section of a SATA (or SAS) disk
+func sataInfoFromReport(report *SMARTReport) *SATADiskInfo {
+	info := &SATADiskInfo{
+		ModelFamily:  report.ModelFamily,
+		DeviceModel:  report.ModelName,
+		SerialNumber: report.SerialNumber,
+		Firmware:     report.FirmwareVersion,
 	}
-
-	enableCmd := "off"
-	if isEnabled {
-		enableCmd = "on"
+	if info.DeviceModel == "" {
+		info.DeviceModel = strings.TrimSpace(report.SCSIVendor + " " + report.SCSIProduct)
 	}
-
-	cmd := exec.Command("smartctl", "-s", enableCmd, disk)
-	output, err := cmd.Output()
-	if err != nil {
-		return err
+	if info.Firmware == "" {
+		info.Firmware = report.SCSIRevision
 	}
-
-	if strings.Contains(string(output), "SMART Enabled") {
-		return nil
-	} else {
-		// Print the command output to STDOUT if enabling SMART failed
-		println(string(output))
-		return errors.New("failed to enable SMART on disk")
+	if report.UserCapacity != nil {
+		info.UserCapacity = formatCapacity(report.UserCapacity.Bytes)
+	}
+	if report.LogicalBlockSize > 0 {
+		if report.PhysicalBlockSize > 0 && report.PhysicalBlockSize != report.LogicalBlockSize {
+			info.SectorSize = fmt.Sprintf("%d bytes logical, %d bytes physical", report.LogicalBlockSize, report.PhysicalBlockSize)
+		} else {
+			info.SectorSize = fmt.Sprintf("%d bytes logical/physical", report.LogicalBlockSize)
+		}
+	}
+	if report.RotationRate != nil {
+		info.RotationRate = "Solid State Device"
+		if *report.RotationRate > 0 {
+			info.RotationRate = strconv.Itoa(*report.RotationRate) + " rpm"
+		}
+	}
+	if report.FormFactor != nil {
+		info.FormFactor = report.FormFactor.Name
 	}
+	if report.SmartSupport != nil {
+		info.SmartSupport = report.SmartSupport.Enabled
+	}
+	return info
 }
 
-// GetDiskSMARTCheck retrieves the SMART health status of the specified disk
-// Usually only returns "PASSED" or "FAILED"
-func GetDiskSMARTCheck(diskname string) (*SMARTTestResult, error) {
-	if !strings.HasPrefix(diskname, "/dev/") {
-		diskname = "/dev/" + diskname
+// nvmeInfoFromReport converts the information section of a NVMe disk
+func nvmeInfoFromReport(report *SMARTReport) *NVMEInfo {
+	info := &NVMEInfo{
+		ModelNumber:     report.ModelName,
+		SerialNumber:    report.SerialNumber,
+		FirmwareVersion: report.FirmwareVersion,
 	}
-
-	cmd := exec.Command("smartctl", "-H", "-A", diskname)
-	output, err := cmd.Output()
-	if err != nil {
-		// Check if the error is due to exit code 32 (non-critical error for some disks)
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 32 {
-			// Ignore the error and proceed
-		} else {
-			// Print the command output to STDOUT if the command fails
-			println(string(output))
-			return nil, err
+	if vendor := report.NVMePCIVendor; vendor != nil {
+		info.PCIVendorSubsystemID = fmt.Sprintf("0x%04x", vendor.ID)
+		if vendor.SubsystemID != vendor.ID {
+			info.PCIVendorSubsystemID += fmt.Sprintf("/0x%04x", vendor.SubsystemID)
+		}
+	}
+	if report.NVMeIEEEOUIIdentifier != nil {
+		info.IEEEOUIIdentifier = fmt.Sprintf("0x%06x", *report.NVMeIEEEOUIIdentifier)
+	}
+	if report.NVMeTotalCapacity != nil {
+		info.TotalNVMeCapacity = formatCapacity(*report.NVMeTotalCapacity)
+	}
+	if report.NVMeUnallocatedCapacity != nil {
+		info.UnallocatedNVMeCapacity = formatCapacity(*report.NVMeUnallocatedCapacity)
+	}
+	if report.NVMeControllerID != nil {
+		info.ControllerID = strconv.Itoa(*report.NVMeControllerID)
+	}
+	if report.NVMeVersion != nil {
+		info.NVMeVersion = report.NVMeVersion.String
+	}
+	if report.NVMeNumberOfNamespaces != nil {
+		info.NumberOfNamespaces = strconv.Itoa(*report.NVMeNumberOfNamespaces)
+	}
+	for _, namespace := range report.NVMeNamespaces {
+		if namespace.ID != 1 {
+			continue
+		}
+		if namespace.Size != nil {
+			info.NamespaceSizeCapacity = formatCapacity(namespace.Size.Bytes)
+		}
+		if namespace.Utilization != nil {
+			info.NamespaceUtilization = formatCapacity(namespace.Utilization.Bytes)
+		}
+		info.NamespaceFormattedLBASize = strconv.Itoa(namespace.FormattedLBASize)
+		if namespace.EUI64 != nil {
+			info.NamespaceIEEE_EUI_64 = fmt.Sprintf("%06x %010x", namespace.EUI64.OUI, namespace.EUI64.ExtID)
 		}
 	}
+	return info
+}
 
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+// smartCheckFromReport converts the health status and the ATA attributes in the report
+func smartCheckFromReport(report *SMARTReport) *SMARTTestResult {
 	result := &SMARTTestResult{
 		TestResult:         "Unknown",
 		MarginalAttributes: make([]SMARTAttribute, 0),
 	}
-	var inAttributesSection bool = false
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		//fmt.Println(line)
-		// Check for overall health result
-		if strings.HasPrefix(line, "SMART overall-health self-assessment test result:") {
-			result.TestResult = strings.TrimSpace(strings.TrimPrefix(line, "SMART overall-health self-assessment test result:"))
+	if report.SmartStatus != nil {
+		result.TestResult = "FAILED"
+		if report.SmartStatus.Passed {
+			result.TestResult = "PASSED"
 		}
+	}
 
-		// Detect the start of the attributes section
-		if strings.HasPrefix(line, "ID# ATTRIBUTE_NAME") {
-			inAttributesSection = true
-			continue
-		}
-
-		// Parse marginal attributes
-		if inAttributesSection {
-			fields := strings.Fields(line)
-			if len(fields) >= 10 {
-				id, err := strconv.Atoi(fields[0])
-				if err != nil {
-					continue
-				}
-				value, err := strconv.Atoi(fields[3])
-				if err != nil {
-					continue
-				}
-				worst, err := strconv.Atoi(fields[4])
-				if err != nil {
-					continue
-				}
-				threshold, err := strconv.Atoi(fields[5])
-				if err != nil {
-					continue
-				}
-
-				attribute := SMARTAttribute{
-					ID:         id,
-					Name:       fields[1],
-					Flag:       fields[2],
-					Value:      value,
-					Worst:      worst,
-					Threshold:  threshold,
-					Type:       fields[6],
-					Updated:    fields[7],
-					WhenFailed: fields[8],
-					RawValue:   strings.Join(fields[9:], " "),
-				}
-				result.MarginalAttributes = append(result.MarginalAttributes, attribute)
+	// NVMe drives report temperature outside of the attributes table
+	if report.NVMeSmartHealthLog != nil {
+		result.MarginalAttributes = append(result.MarginalAttributes, SMARTAttribute{
+			Name:     "Temperature",
+			RawValue: strconv.Itoa(report.NVMeSmartHealthLog.Temperature) + " Celsius",
+			Raw:      int64(report.NVMeSmartHealthLog.Temperature),
+		})
+	}
 
-			}
+	if report.ATASmartAttributes == nil {
+		return result
+	}
+	for _, attr := range report.ATASmartAttributes.Table {
+		attribute := SMARTAttribute{
+			ID:         attr.ID,
+			Name:       attr.Name,
+			Flag:       fmt.Sprintf("0x%04x", attr.Flags.Value),
+			Value:      attr.Value,
+			Worst:      attr.Worst,
+			Threshold:  attr.Thresh,
+			Type:       "Old_age",
+			Updated:    "Offline",
+			WhenFailed: attr.WhenFailed,
+			RawValue:   attr.Raw.String,
+			Raw:        attr.Raw.Value,
+		}
+		if attr.Flags.Prefailure {
+			attribute.Type = "Pre-fail"
+		}
+		if attr.Flags.UpdatedOnline {
+			attribute.Updated = "Always"
 		}
+		if attribute.WhenFailed == "" {
+			attribute.WhenFailed = "-"
+		}
+		result.MarginalAttributes = append(result.MarginalAttributes, attribute)
 	}
+	return result
+}
 
-	if err := scanner.Err(); err != nil {
-		// Print the command output to STDOUT if parsing failed
-		println(string(output))
-		return nil, err
+// healthFromReport summarize the health values of an ATA, NVMe or SCSI disk in the report
+func healthFromReport(diskname string, report *SMARTReport) *DriveHealthInfo {
+	healthInfo := &DriveHealthInfo{
+		DeviceName:   diskname,
+		DeviceModel:  report.ModelName,
+		SerialNumber: report.SerialNumber,
+		IsHealthy:    report.SmartStatus != nil && report.SmartStatus.Passed,
+		IsSSD:        report.RotationRate != nil && *report.RotationRate == 0,
+	}
+	if healthInfo.DeviceModel == "" {
+		healthInfo.DeviceModel = strings.TrimSpace(report.SCSIVendor + " " + report.SCSIProduct)
+	}
+	if report.PowerOnTime != nil {
+		healthInfo.PowerOnHours = report.PowerOnTime.Hours
+	}
+	if report.PowerCycleCount != nil {
+		healthInfo.PowerCycleCount = *report.PowerCycleCount
+	}
+	if report.Temperature != nil {
+		healthInfo.Temperature = report.Temperature.Current
 	}
 
-	if result.TestResult == "" {
-		return nil, errors.New("unable to determine SMART health status")
+	switch report.Device.Protocol {
+	case "NVMe":
+		fillNVMeHealth(healthInfo, report)
+	case "ATA":
+		fillATAHealth(healthInfo, report)
+	case "SCSI":
+		fillSCSIHealth(healthInfo, report)
 	}
 
-	return result, nil
+	// A failed self-test means the disk is failing even if the overall assessment passed
+	healthInfo.LastSelfTest = LatestFinishedSelfTest(selfTestLogFromReport(report))
+	if SelfTestFailed(healthInfo.LastSelfTest) {
+		healthInfo.IsHealthy = false
+	}
+	return healthInfo
 }
 
-func GetDiskSMARTHealthSummary(diskname string) (*DriveHealthInfo, error) {
-	smartCheck, err := GetDiskSMARTCheck(diskname)
-	if err != nil {
-		return nil, err
+func fillNVMeHealth(healthInfo *DriveHealthInfo, report *SMARTReport) {
+	healthInfo.IsNVMe = true
+	healthInfo.IsSSD = true
+	healthLog := report.NVMeSmartHealthLog
+	if healthLog == nil {
+		return
 	}
-
-	healthInfo := &DriveHealthInfo{
-		DeviceName: diskname,
-		IsHealthy:  strings.ToUpper(smartCheck.TestResult) == "PASSED",
+	healthInfo.WearLevelingCount = uint64(healthLog.PercentageUsed)
+	healthInfo.UncorrectableErrors = healthLog.MediaErrors
+	healthInfo.AvailableSpare = healthLog.AvailableSpare
+	healthInfo.CriticalWarning = healthLog.CriticalWarning
+	healthInfo.UnsafeShutdowns = healthLog.UnsafeShutdowns
+	// Data units are 1000 * 512 bytes
+	healthInfo.TotalLBAWritten = healthLog.DataUnitsWritten * 1000
+	healthInfo.TotalLBARead = healthLog.DataUnitsRead * 1000
+	if healthInfo.PowerOnHours == 0 {
+		healthInfo.PowerOnHours = healthLog.PowerOnHours
 	}
-
-	//Populate the device model and serial number from SMARTInfo
-	dt, err := GetDiskType(diskname)
-	if err != nil {
-		return nil, err
+	if healthInfo.PowerCycleCount == 0 {
+		healthInfo.PowerCycleCount = healthLog.PowerCycles
 	}
-
-	if dt == DiskType_SATA {
-		sataInfo, err := GetSATAInfo(diskname)
-		if err != nil {
-			return nil, err
-		}
-		healthInfo.DeviceModel = sataInfo.DeviceModel
-		healthInfo.SerialNumber = sataInfo.SerialNumber
-		healthInfo.IsSSD = strings.Contains(sataInfo.RotationRate, "Solid State")
-	} else if dt == DiskType_NVMe {
-		nvmeInfo, err := GetNVMEInfo(diskname)
-		if err != nil {
-			return nil, err
-		}
-		healthInfo.DeviceModel = nvmeInfo.ModelNumber
-		healthInfo.SerialNumber = nvmeInfo.SerialNumber
-		healthInfo.IsNVMe = true
-	} else {
-		return nil, errors.New("unsupported disk type")
+	if healthInfo.Temperature == 0 {
+		healthInfo.Temperature = healthLog.Temperature
 	}
+}
 
-	for _, attr := range smartCheck.MarginalAttributes {
+func fillATAHealth(healthInfo *DriveHealthInfo, report *SMARTReport) {
+	if report.ATASmartAttributes == nil {
+		return
+	}
+	for _, attr := range report.ATASmartAttributes.Table {
+		raw := uint64(attr.Raw.Value)
 		switch attr.Name {
 		case "Power_On_Hours":
-			if value, err := strconv.ParseUint(attr.RawValue, 10, 64); err == nil {
-				healthInfo.PowerOnHours = value
+			if healthInfo.PowerOnHours == 0 {
+				healthInfo.PowerOnHours = raw
 			}
 		case "Power_Cycle_Count":
-			if value, err := strconv.ParseUint(attr.RawValue, 10, 64); err == nil {
-				healthInfo.PowerCycleCount = value
+			if healthInfo.PowerCycleCount == 0 {
+				healthInfo.PowerCycleCount = raw
 			}
 		case "Reallocated_Sector_Ct":
-			if value, err := strconv.ParseUint(attr.RawValue, 10, 64); err == nil {
-				healthInfo.ReallocatedSectors = value
-			}
+			healthInfo.ReallocatedSectors = raw
+		case "Reallocate_NAND_Blk_Cnt", "Runtime_Bad_Block":
+			healthInfo.ReallocateNANDBlocks = max(healthInfo.ReallocateNANDBlocks, raw)
 		case "Wear_Leveling_Count":
-			if value, err := strconv.ParseUint(attr.RawValue, 10, 64); err == nil {
-				healthInfo.WearLevelingCount = value
-			}
-		case "Uncorrectable_Error_Cnt":
-			if value, err := strconv.ParseUint(attr.RawValue, 10, 64); err == nil {
-				healthInfo.UncorrectableErrors = value
-			}
+			healthInfo.WearLevelingCount = raw
+		case "Uncorrectable_Error_Cnt", "Reported_Uncorrect":
+			healthInfo.UncorrectableErrors = max(healthInfo.UncorrectableErrors, raw)
 		case "Current_Pending_Sector":
-			if value, err := strconv.ParseUint(attr.RawValue, 10, 64); err == nil {
-				healthInfo.PendingSectors = value
-			}
-		case "ECC_Recovered":
-			if value, err := strconv.ParseUint(attr.RawValue, 10, 64); err == nil {
-				healthInfo.ECCRecovered = value
-			}
+			healthInfo.PendingSectors = raw
+		case "ECC_Recovered", "Hardware_ECC_Recovered":
+			healthInfo.ECCRecovered = raw
 		case "UDMA_CRC_Error_Count":
-			if value, err := strconv.ParseUint(attr.RawValue, 10, 64); err == nil {
-				healthInfo.UDMACRCErrors = value
-			}
+			healthInfo.UDMACRCErrors = raw
 		case "Total_LBAs_Written":
-			if value, err := strconv.ParseUint(attr.RawValue, 10, 64); err == nil {
-				healthInfo.TotalLBAWritten = value
-			}
+			healthInfo.TotalLBAWritten = raw
 		case "Total_LBAs_Read":
-			if value, err := strconv.ParseUint(attr.RawValue, 10, 64); err == nil {
-				healthInfo.TotalLBARead = value
+			healthInfo.TotalLBARead = raw
+		case "Temperature_Celsius":
+			if healthInfo.Temperature == 0 {
+				// Only the lowest byte is the current temperature
+				healthInfo.Temperature = int(raw & 0xff)
 			}
 		}
 	}
 
-	return healthInfo, nil
+	// Disks without the LBA attributes might report them in the device statistics
+	if report.ATADeviceStatistics == nil {
+		return
+	}
+	for _, page := range report.ATADeviceStatistics.Pages {
+		for _, stat := range page.Table {
+			if !stat.Flags.Valid {
+				continue
+			}
+			switch stat.Name {
+			case "Logical Sectors Written":
+				if healthInfo.TotalLBAWritten == 0 {
+					healthInfo.TotalLBAWritten = uint64(stat.Value)
+				}
+			case "Logical Sectors Read":
+				if healthInfo.TotalLBARead == 0 {
+					healthInfo.TotalLBARead = uint64(stat.Value)
+				}
+			}
+		}
+	}
+}
+
+func fillSCSIHealth(healthInfo *DriveHealthInfo, report *SMARTReport) {
+	if report.SCSIGrownDefectList != nil {
+		healthInfo.ReallocatedSectors = *report.SCSIGrownDefectList
+	}
+	if report.SCSIPercentageUsedEndurance != nil {
+		healthInfo.WearLevelingCount = uint64(*report.SCSIPercentageUsedEndurance)
+	}
+	if counter := report.SCSIStartStopCycleCounter; counter != nil && healthInfo.PowerCycleCount == 0 {
+		healthInfo.PowerCycleCount = counter.AccumulatedStartStopCycles
+	}
+	if errorLog := report.SCSIErrorCounterLog; errorLog != nil {
+		for _, counter := range []*SCSIErrorCounter{errorLog.Read, errorLog.Write, errorLog.Verify} {
+			if counter == nil {
+				continue
+			}
+			healthInfo.UncorrectableErrors += counter.TotalUncorrectedErrors
+			healthInfo.ECCRecovered += counter.TotalErrorsCorrected
+		}
+	}
+}
+
+// formatCapacity formats the size in bytes the same way as smartctl, e.g. 500,107,862,016 bytes [500 GB]
+func formatCapacity(bytes uint64) string {
+	digits := strconv.FormatUint(bytes, 10)
+	grouped := ""
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped += ","
+		}
+		grouped += string(digit)
+	}
+
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+	value := float64(bytes)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	precision := 0
+	if value < 10 && unit > 0 {
+		precision = 2
+	} else if value < 100 && unit > 0 {
+		precision = 1
+	}
+	return fmt.Sprintf("%s bytes [%.*f %s]", grouped, precision, value, units[unit])
 }
@@ -0,0 +1,155 @@
+package smart
+
+import (
+	"testing"
+)
+
+func TestHealthFromReport(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		expected DriveHealthInfo
+	}{
+		{"sata_hdd.json", DriveHealthInfo{
+			DeviceName:         "sda",
+			DeviceModel:        "WDC WD40EFRX-68N32N0",
+			SerialNumber:       "WD-WCC7K1234567",
+			PowerOnHours:       28771,
+			PowerCycleCount:    109,
+			ReallocatedSectors: 8,
+			PendingSectors:     2,
+			UDMACRCErrors:      3,
+			Temperature:        35,
+			IsHealthy:          true,
+		}},
+		{"sata_ssd.json", DriveHealthInfo{
+			DeviceName:           "sdb",
+			DeviceModel:          "Samsung SSD 860 EVO 500GB",
+			SerialNumber:         "S3Z2NB0K123456A",
+			PowerOnHours:         21040,
+			PowerCycleCount:      213,
+			ReallocatedSectors:   4,
+			ReallocateNANDBlocks: 6,
+			WearLevelingCount:    117,
+			UncorrectableErrors:  12,
+			ECCRecovered:         12,
+			TotalLBAWritten:      98765432109,
+			TotalLBARead:         45678901234,
+			Temperature:          31,
+			IsSSD:                true,
+			IsHealthy:            false, //The latest extended self-test failed
+		}},
+		{"nvme.json", DriveHealthInfo{
+			DeviceName:        "nvme0n1",
+			DeviceModel:       "Samsung SSD 970 EVO Plus 1TB",
+			SerialNumber:      "S4EWNX0R123456B",
+			PowerOnHours:      3421,
+			PowerCycleCount:   512,
+			WearLevelingCount: 3,
+			TotalLBAWritten:   41234567000,
+			TotalLBARead:      28376549000,
+			Temperature:       41,
+			AvailableSpare:    100,
+			UnsafeShutdowns:   27,
+			IsSSD:             true,
+			IsNVMe:            true,
+			IsHealthy:         true,
+		}},
+		{"sas.json", DriveHealthInfo{
+			DeviceName:          "sdc",
+			DeviceModel:         "SEAGATE ST4000NM0023",
+			SerialNumber:        "Z1Z0ABCD0000C4401234",
+			PowerOnHours:        45012,
+			PowerCycleCount:     84,
+			ReallocatedSectors:  16,
+			UncorrectableErrors: 3,
+			ECCRecovered:        1234600,
+			Temperature:         33,
+			IsHealthy:           true,
+		}},
+	}
+
+	for _, test := range tests {
+		health := healthFromReport(test.expected.DeviceName, loadTestReport(t, test.fixture))
+		lastSelfTest := health.LastSelfTest
+		health.LastSelfTest = nil
+		if *health != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.fixture, test.expected, *health)
+		}
+		if test.fixture == "sata_ssd.json" && (lastSelfTest == nil || lastSelfTest.FirstErrorLBA != "123456789") {
+			t.Errorf("%s: expected the failed self-test as the last self-test, got %+v", test.fixture, lastSelfTest)
+		}
+	}
+}
+
+func TestSmartCheckFromReport(t *testing.T) {
+	result := smartCheckFromReport(loadTestReport(t, "sata_hdd.json"))
+	if result.TestResult != "PASSED" || len(result.MarginalAttributes) != 17 {
+		t.Fatalf("expected PASSED with 17 attributes, got %s with %d", result.TestResult, len(result.MarginalAttributes))
+	}
+	expected := SMARTAttribute{
+		ID:         194,
+		Name:       "Temperature_Celsius",
+		Flag:       "0x0022",
+		Value:      115,
+		Worst:      100,
+		Threshold:  0,
+		Type:       "Old_age",
+		Updated:    "Always",
+		WhenFailed: "-",
+		RawValue:   "35 (Min/Max 19/37)",
+		Raw:        158915035171,
+	}
+	if result.MarginalAttributes[11] != expected {
+		t.Errorf("expected %+v, got %+v", expected, result.MarginalAttributes[11])
+	}
+	if attr := result.MarginalAttributes[0]; attr.Type != "Pre-fail" {
+		t.Errorf("expected Raw_Read_Error_Rate to be Pre-fail, got %+v", attr)
+	}
+
+	result = smartCheckFromReport(loadTestReport(t, "nvme.json"))
+	if result.TestResult != "PASSED" || len(result.MarginalAttributes) != 1 || result.MarginalAttributes[0].RawValue != "41 Celsius" {
+		t.Errorf("unexpected NVMe result: %+v", result)
+	}
+}
+
+func TestInfoFromReport(t *testing.T) {
+	sata := sataInfoFromReport(loadTestReport(t, "sata_hdd.json"))
+	expectedSATA := SATADiskInfo{
+		ModelFamily:  "Western Digital Red",
+		DeviceModel:  "WDC WD40EFRX-68N32N0",
+		SerialNumber: "WD-WCC7K1234567",
+		Firmware:     "82.00A82",
+		UserCapacity: "4,000,787,030,016 bytes [4.00 TB]",
+		SectorSize:   "512 bytes logical, 4096 bytes physical",
+		RotationRate: "5400 rpm",
+		FormFactor:   "3.5 inches",
+		SmartSupport: true,
+	}
+	if *sata != expectedSATA {
+		t.Errorf("expected %+v, got %+v", expectedSATA, *sata)
+	}
+	if ssd := sataInfoFromReport(loadTestReport(t, "sata_ssd.json")); ssd.RotationRate != "Solid State Device" || ssd.UserCapacity != "500,107,862,016 bytes [500 GB]" {
+		t.Errorf("unexpected SSD info: %+v", ssd)
+	}
+
+	nvme := nvmeInfoFromReport(loadTestReport(t, "nvme.json"))
+	expectedNVMe := NVMEInfo{
+		ModelNumber:               "Samsung SSD 970 EVO Plus 1TB",
+		SerialNumber:              "S4EWNX0R123456B",
+		FirmwareVersion:           "2B2QEXM7",
+		PCIVendorSubsystemID:      "0x144d",
+		IEEEOUIIdentifier:         "0x002538",
+		TotalNVMeCapacity:         "1,000,204,886,016 bytes [1.00 TB]",
+		UnallocatedNVMeCapacity:   "0 bytes [0 B]",
+		ControllerID:              "4",
+		NVMeVersion:               "1.3",
+		NumberOfNamespaces:        "1",
+		NamespaceSizeCapacity:     "1,000,204,886,016 bytes [1.00 TB]",
+		NamespaceUtilization:      "211,401,310,208 bytes [211 GB]",
+		NamespaceFormattedLBASize: "512",
+		NamespaceIEEE_EUI_64:      "002538 7771eb2b4e",
+	}
+	if *nvme != expectedNVMe {
+		t.Errorf("expected %+v, got %+v", expectedNVMe, *nvme)
+	}
+}
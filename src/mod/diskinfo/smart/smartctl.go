@@ -0,0 +1,418 @@
+package smart
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+/*
+	smartctl.go
+
+	Typed structures of the JSON output of smartctl (smartmontools 7.0
+	or above). The structures follow the key names of smartctl so the
+	report can be exposed as is, only the sections used by bokofs are
+	decoded. See https://www.smartmontools.org/wiki/JSON for details
+*/
+
+// smartctl exit status bits, the lower bits mean the command failed
+// and the higher bits only report the health of the disk
+const (
+	smartctlExitCommandLine   = 0x01 //Command line did not parse
+	smartctlExitOpenFailed    = 0x02 //Device open failed or in low power mode
+	smartctlExitCommandFailed = 0x04 //Some SMART or other command to the disk failed
+)
+
+type SMARTReport struct {
+	Smartctl SmartctlStatus `json:"smartctl"`
+	Device   DeviceIdentity `json:"device"`
+
+	/* Information section */
+	ModelFamily       string        `json:"model_family,omitempty"`
+	ModelName         string        `json:"model_name,omitempty"`
+	SerialNumber      string        `json:"serial_number,omitempty"`
+	FirmwareVersion   string        `json:"firmware_version,omitempty"`
+	UserCapacity      *Capacity     `json:"user_capacity,omitempty"`
+	LogicalBlockSize  int           `json:"logical_block_size,omitempty"`
+	PhysicalBlockSize int           `json:"physical_block_size,omitempty"`
+	RotationRate      *int          `json:"rotation_rate,omitempty"` //In rpm, 0 for solid state devices
+	FormFactor        *NamedValue   `json:"form_factor,omitempty"`
+	SmartSupport      *SmartSupport `json:"smart_support,omitempty"`
+
+	/* Common health values */
+	SmartStatus     *SmartStatus     `json:"smart_status,omitempty"`
+	Temperature     *TemperatureInfo `json:"temperature,omitempty"`
+	PowerOnTime     *PowerOnTime     `json:"power_on_time,omitempty"`
+	PowerCycleCount *uint64          `json:"power_cycle_count,omitempty"`
+
+	/* ATA */
+	ATASmartData        *ATASmartData        `json:"ata_smart_data,omitempty"`
+	ATASmartAttributes  *ATASmartAttributes  `json:"ata_smart_attributes,omitempty"`
+	ATADeviceStatistics *ATADeviceStatistics `json:"ata_device_statistics,omitempty"`
+	ATASmartSelfTestLog *ATASmartSelfTestLog `json:"ata_smart_self_test_log,omitempty"`
+	ATASmartErrorLog    *ATASmartErrorLog    `json:"ata_smart_error_log,omitempty"`
+
+	/* NVMe */
+	NVMePCIVendor           *NVMePCIVendor           `json:"nvme_pci_vendor,omitempty"`
+	NVMeIEEEOUIIdentifier   *uint64                  `json:"nvme_ieee_oui_identifier,omitempty"`
+	NVMeTotalCapacity       *uint64                  `json:"nvme_total_capacity,omitempty"`
+	NVMeUnallocatedCapacity *uint64                  `json:"nvme_unallocated_capacity,omitempty"`
+	NVMeControllerID        *int                     `json:"nvme_controller_id,omitempty"`
+	NVMeVersion             *NVMeVersion             `json:"nvme_version,omitempty"`
+	NVMeNumberOfNamespaces  *int                     `json:"nvme_number_of_namespaces,omitempty"`
+	NVMeNamespaces          []NVMeNamespace          `json:"nvme_namespaces,omitempty"`
+	NVMeSmartHealthLog      *NVMeSmartHealthLog      `json:"nvme_smart_health_information_log,omitempty"`
+	NVMeSelfTestLog         *NVMeSelfTestLog         `json:"nvme_self_test_log,omitempty"`
+	NVMeErrorInformationLog *NVMeErrorInformationLog `json:"nvme_error_information_log,omitempty"`
+
+	/* SCSI / SAS */
+	SCSIVendor                  string                     `json:"scsi_vendor,omitempty"`
+	SCSIProduct                 string                     `json:"scsi_product,omitempty"`
+	SCSIRevision                string                     `json:"scsi_revision,omitempty"`
+	SCSIGrownDefectList         *uint64                    `json:"scsi_grown_defect_list,omitempty"`
+	SCSIStartStopCycleCounter   *SCSIStartStopCycleCounter `json:"scsi_start_stop_cycle_counter,omitempty"`
+	SCSIErrorCounterLog         *SCSIErrorCounterLog       `json:"scsi_error_counter_log,omitempty"`
+	SCSIPercentageUsedEndurance *int                       `json:"scsi_percentage_used_endurance_indicator,omitempty"`
+
+	/* --scan-open */
+	Devices []DeviceIdentity `json:"devices,omitempty"`
+}
+
+type SmartctlStatus struct {
+	Version    []int             `json:"version"`
+	ExitStatus int               `json:"exit_status"`
+	Messages   []SmartctlMessage `json:"messages,omitempty"`
+}
+
+type SmartctlMessage struct {
+	String   string `json:"string"`
+	Severity string `json:"severity"` //information, warning or error
+}
+
+type DeviceIdentity struct {
+	Name     string `json:"name"`      //e.g. /dev/sda
+	InfoName string `json:"info_name"` //e.g. /dev/sda [SAT]
+	Type     string `json:"type"`      //e.g. sat, nvme, scsi
+	Protocol string `json:"protocol"`  //ATA, NVMe or SCSI
+
+	OpenError string `json:"open_error,omitempty"` //--scan-open only, set if the device cannot be opened
+}
+
+type Capacity struct {
+	Blocks uint64 `json:"blocks"`
+	Bytes  uint64 `json:"bytes"`
+}
+
+type NamedValue struct {
+	AtaValue int    `json:"ata_value,omitempty"`
+	Name     string `json:"name"`
+}
+
+type SmartSupport struct {
+	Available bool `json:"available"`
+	Enabled   bool `json:"enabled"`
+}
+
+type SmartStatus struct {
+	Passed bool `json:"passed"`
+}
+
+type TemperatureInfo struct {
+	Current   int `json:"current"`
+	DriveTrip int `json:"drive_trip,omitempty"` //SCSI only
+}
+
+type PowerOnTime struct {
+	Hours   uint64 `json:"hours"`
+	Minutes uint64 `json:"minutes,omitempty"`
+}
+
+type ValueString struct {
+	Value  int64  `json:"value"`
+	String string `json:"string"`
+}
+
+/* ATA */
+
+type ATASmartData struct {
+	SelfTest *ATASelfTestData `json:"self_test,omitempty"`
+}
+
+type ATASelfTestData struct {
+	Status         ATASelfTestStatus `json:"status"`
+	PollingMinutes map[string]int    `json:"polling_minutes,omitempty"` //Expected duration of short, extended and conveyance tests
+}
+
+type ATASelfTestStatus struct {
+	Value            int    `json:"value"`
+	String           string `json:"string"`
+	RemainingPercent *int   `json:"remaining_percent,omitempty"` //Only if a test is in progress
+	Passed           *bool  `json:"passed,omitempty"`
+}
+
+type ATASmartAttributes struct {
+	Revision int                 `json:"revision"`
+	Table    []ATASmartAttribute `json:"table"`
+}
+
+type ATASmartAttribute struct {
+	ID         int                    `json:"id"`
+	Name       string                 `json:"name"`
+	Value      int                    `json:"value"` //Normalized value
+	Worst      int                    `json:"worst"`
+	Thresh     int                    `json:"thresh"`
+	WhenFailed string                 `json:"when_failed"` //FAILING_NOW, In_the_past or empty
+	Flags      ATASmartAttributeFlags `json:"flags"`
+	Raw        ValueString            `json:"raw"`
+}
+
+type ATASmartAttributeFlags struct {
+	Value         int    `json:"value"`
+	String        string `json:"string"` //e.g. POSR-K
+	Prefailure    bool   `json:"prefailure"`
+	UpdatedOnline bool   `json:"updated_online"`
+	Performance   bool   `json:"performance"`
+	ErrorRate     bool   `json:"error_rate"`
+	EventCount    bool   `json:"event_count"`
+	AutoKeep      bool   `json:"auto_keep"`
+}
+
+type ATADeviceStatistics struct {
+	Pages []ATADeviceStatisticsPage `json:"pages"`
+}
+
+type ATADeviceStatisticsPage struct {
+	Number   int                  `json:"number"`
+	Name     string               `json:"name"` //e.g. General Statistics
+	Revision int                  `json:"revision"`
+	Table    []ATADeviceStatistic `json:"table"`
+}
+
+type ATADeviceStatistic struct {
+	Offset int    `json:"offset"`
+	Name   string `json:"name"` //e.g. Lifetime Power-On Resets
+	Size   int    `json:"size"`
+	Value  int64  `json:"value"`
+	Flags  struct {
+		Value                 int    `json:"value"`
+		String                string `json:"string"`
+		Valid                 bool   `json:"valid"`
+		Normalized            bool   `json:"normalized"`
+		SupportsDSN           bool   `json:"supports_dsn"`
+		MonitoredConditionMet bool   `json:"monitored_condition_met"`
+	} `json:"flags"`
+}
+
+type ATASmartSelfTestLog struct {
+	Standard *ATASelfTestLogTable `json:"standard,omitempty"` //-l selftest
+	Extended *ATASelfTestLogTable `json:"extended,omitempty"` //-l xselftest, used by -x
+}
+
+type ATASelfTestLogTable struct {
+	Revision int                   `json:"revision"`
+	Count    int                   `json:"count"`
+	Table    []ATASelfTestLogEntry `json:"table"`
+}
+
+type ATASelfTestLogEntry struct {
+	Type          ValueString       `json:"type"` //e.g. Short offline
+	Status        ATASelfTestStatus `json:"status"`
+	LifetimeHours uint64            `json:"lifetime_hours"`
+	LBA           *uint64           `json:"lba,omitempty"` //First error LBA
+}
+
+type ATASmartErrorLog struct {
+	Summary  *ATAErrorLogTable `json:"summary,omitempty"`  //-l error
+	Extended *ATAErrorLogTable `json:"extended,omitempty"` //-l xerror, used by -x
+}
+
+type ATAErrorLogTable struct {
+	Revision    int                `json:"revision"`
+	Count       int                `json:"count"`
+	LoggedCount int                `json:"logged_count"`
+	Table       []ATAErrorLogEntry `json:"table"`
+}
+
+type ATAErrorLogEntry struct {
+	ErrorNumber      int          `json:"error_number"`
+	LifetimeHours    uint64       `json:"lifetime_hours"`
+	DeviceState      *ValueString `json:"device_state,omitempty"`
+	ErrorDescription string       `json:"error_description"` //e.g. Error: UNC at LBA = 0x0fffffff = 268435455
+}
+
+/* NVMe */
+
+type NVMePCIVendor struct {
+	ID          int `json:"id"`
+	SubsystemID int `json:"subsystem_id"`
+}
+
+type NVMeVersion struct {
+	String string `json:"string"`
+	Value  int    `json:"value"`
+}
+
+type NVMeNamespace struct {
+	ID               int       `json:"id"`
+	Size             *Capacity `json:"size,omitempty"`
+	Capacity         *Capacity `json:"capacity,omitempty"`
+	Utilization      *Capacity `json:"utilization,omitempty"`
+	FormattedLBASize int       `json:"formatted_lba_size"`
+	EUI64            *struct {
+		OUI   uint64 `json:"oui"`
+		ExtID uint64 `json:"ext_id"`
+	} `json:"eui64,omitempty"`
+}
+
+type NVMeSmartHealthLog struct {
+	CriticalWarning         int    `json:"critical_warning"`
+	Temperature             int    `json:"temperature"`
+	AvailableSpare          int    `json:"available_spare"` //In percent
+	AvailableSpareThreshold int    `json:"available_spare_threshold"`
+	PercentageUsed          int    `json:"percentage_used"` //Estimated life used, can exceed 100
+	DataUnitsRead           uint64 `json:"data_units_read"` //In 1000 * 512 bytes
+	DataUnitsWritten        uint64 `json:"data_units_written"`
+	HostReads               uint64 `json:"host_reads"`
+	HostWrites              uint64 `json:"host_writes"`
+	ControllerBusyTime      uint64 `json:"controller_busy_time"` //In minutes
+	PowerCycles             uint64 `json:"power_cycles"`
+	PowerOnHours            uint64 `json:"power_on_hours"`
+	UnsafeShutdowns         uint64 `json:"unsafe_shutdowns"`
+	MediaErrors             uint64 `json:"media_errors"`
+	NumErrLogEntries        uint64 `json:"num_err_log_entries"`
+	WarningTempTime         uint64 `json:"warning_temp_time"`  //In minutes
+	CriticalCompTime        uint64 `json:"critical_comp_time"` //In minutes
+	TemperatureSensors      []int  `json:"temperature_sensors,omitempty"`
+}
+
+type NVMeSelfTestLog struct {
+	CurrentSelfTestOperation         ValueString            `json:"current_self_test_operation"`
+	CurrentSelfTestCompletionPercent *int                   `json:"current_self_test_completion_percent,omitempty"`
+	Table                            []NVMeSelfTestLogEntry `json:"table,omitempty"`
+}
+
+type NVMeSelfTestLogEntry struct {
+	SelfTestCode   ValueString `json:"self_test_code"`   //e.g. Short, Extended
+	SelfTestResult ValueString `json:"self_test_result"` //e.g. Completed without error
+	PowerOnHours   uint64      `json:"power_on_hours"`
+	LBA            *uint64     `json:"lba,omitempty"` //Failing LBA
+}
+
+type NVMeErrorInformationLog struct {
+	Size   int                         `json:"size"`
+	Read   int                         `json:"read"`
+	Unread int                         `json:"unread"`
+	Table  []NVMeErrorInformationEntry `json:"table,omitempty"`
+}
+
+type NVMeErrorInformationEntry struct {
+	ErrorCount        uint64 `json:"error_count"`
+	SubmissionQueueID int    `json:"submission_queue_id"`
+	CommandID         int    `json:"command_id"`
+	StatusField       struct {
+		Value          int    `json:"value"`
+		DoNotRetry     bool   `json:"do_not_retry"`
+		StatusCodeType int    `json:"status_code_type"`
+		StatusCode     int    `json:"status_code"`
+		String         string `json:"string"`
+	} `json:"status_field"`
+	LBA *struct {
+		Value uint64 `json:"value"`
+	} `json:"lba,omitempty"`
+	NSID *int `json:"nsid,omitempty"`
+}
+
+/* SCSI / SAS */
+
+type SCSIStartStopCycleCounter struct {
+	YearOfManufacture                          string `json:"year_of_manufacture,omitempty"`
+	WeekOfManufacture                          string `json:"week_of_manufacture,omitempty"`
+	SpecifiedCycleCountOverDeviceLifetime      uint64 `json:"specified_cycle_count_over_device_lifetime"`
+	AccumulatedStartStopCycles                 uint64 `json:"accumulated_start_stop_cycles"`
+	SpecifiedLoadUnloadCountOverDeviceLifetime uint64 `json:"specified_load_unload_count_over_device_lifetime"`
+	AccumulatedLoadUnloadCycles                uint64 `json:"accumulated_load_unload_cycles"`
+}
+
+type SCSIErrorCounterLog struct {
+	Read   *SCSIErrorCounter `json:"read,omitempty"`
+	Write  *SCSIErrorCounter `json:"write,omitempty"`
+	Verify *SCSIErrorCounter `json:"verify,omitempty"`
+}
+
+type SCSIErrorCounter struct {
+	ErrorsCorrectedByECCFast         uint64 `json:"errors_corrected_by_eccfast"`
+	ErrorsCorrectedByECCDelayed      uint64 `json:"errors_corrected_by_eccdelayed"`
+	ErrorsCorrectedByRereadsRewrites uint64 `json:"errors_corrected_by_rereads_rewrites"`
+	TotalErrorsCorrected             uint64 `json:"total_errors_corrected"`
+	CorrectionAlgorithmInvocations   uint64 `json:"correction_algorithm_invocations"`
+	GigabytesProcessed               string `json:"gigabytes_processed"` //e.g. 1234.567
+	TotalUncorrectedErrors           uint64 `json:"total_uncorrected_errors"`
+}
+
+// GetSMARTReport reads all SMART information, health values and logs of the disk
+func GetSMARTReport(disk string) (*SMARTReport, error) {
+	return runSmartctlOnDevice(disk, smartctlExitCommandLine|smartctlExitOpenFailed, "-x")
+}
+
+// Error returns the error messages reported by smartctl
+func (s *SmartctlStatus) Error() error {
+	messages := []string{}
+	for _, message := range s.Messages {
+		if message.Severity == "error" {
+			messages = append(messages, message.String)
+		}
+	}
+	if len(messages) == 0 {
+		for _, message := range s.Messages {
+			messages = append(messages, message.String)
+		}
+	}
+	if len(messages) == 0 {
+		return errors.New("smartctl exited with status " + strconv.Itoa(s.ExitStatus))
+	}
+	return errors.New(strings.Join(messages, ", "))
+}
+
+// FindATAAttribute returns the ATA attribute with the given name, or nil if the disk does not report it
+func (r *SMARTReport) FindATAAttribute(name string) *ATASmartAttribute {
+	if r.ATASmartAttributes == nil {
+		return nil
+	}
+	for i := range r.ATASmartAttributes.Table {
+		if r.ATASmartAttributes.Table[i].Name == name {
+			return &r.ATASmartAttributes.Table[i]
+		}
+	}
+	return nil
+}
+
+// runSmartctl runs smartctl with JSON output and decodes it. An error is returned
+// if any of the failedBits is set in the exit status, e.g. the disk cannot be opened
+func runSmartctl(failedBits int, args ...string) (*SMARTReport, error) {
+	output, err := exec.Command("smartctl", append([]string{"--json=c"}, args...)...).Output()
+	report, parseErr := parseSMARTReport(output)
+	if parseErr != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, parseErr
+	}
+	if report.Smartctl.ExitStatus&failedBits != 0 {
+		return report, report.Smartctl.Error()
+	}
+	return report, nil
+}
+
+// parseSMARTReport decodes the JSON output of smartctl
+func parseSMARTReport(output []byte) (*SMARTReport, error) {
+	report := &SMARTReport{}
+	if err := json.Unmarshal(output, report); err != nil {
+		return nil, errors.New("unable to parse smartctl output: " + err.Error())
+	}
+	if len(report.Smartctl.Version) == 0 {
+		return nil, errors.New("unable to parse smartctl output: smartctl 7.0 or above is required")
+	}
+	return report, nil
+}
@@ -35,6 +35,7 @@ const (
 	DiskType_Unknown DiskType = iota
 	DiskType_NVMe
 	DiskType_SATA
+	DiskType_SAS //SCSI protocol, e.g. SAS disks and USB bridges without ATA pass-through
 )
 
 type SMARTTestResult struct {
@@ -53,10 +54,13 @@ type SMARTAttribute struct {
 	Updated    string
 	WhenFailed string
 	RawValue   string
+	Raw        int64 //Raw value as a number, e.g. for values with extra details in RawValue
 }
 
 type DriveHealthInfo struct {
-	DeviceName           string // e.g., sda
+	DeviceName           string    // e.g., sda
+	Transport            Transport // e.g., sata, usb or raid
+	DeviceType           string    // smartctl device type, e.g., sat or megaraid,3
 	DeviceModel          string
 	SerialNumber         string
 	PowerOnHours         uint64
@@ -70,7 +74,52 @@ type DriveHealthInfo struct {
 	UDMACRCErrors        uint64
 	TotalLBAWritten      uint64
 	TotalLBARead         uint64
+	Temperature          int    // In Celsius, 0 if not reported
+	AvailableSpare       int    // NVMe, in percent
+	CriticalWarning      int    // NVMe, bit field of the critical warnings, 0 if none
+	UnsafeShutdowns      uint64 // NVMe
 	IsSSD                bool
 	IsNVMe               bool
-	IsHealthy            bool //true if the test Passed
+	IsHealthy            bool              //true if the test Passed and the latest self-test did not fail
+	LastSelfTest         *SelfTestLogEntry // Latest finished self-test, nil if none
+}
+
+type SelfTestType string
+
+const (
+	SelfTest_Short      SelfTestType = "short"
+	SelfTest_Long       SelfTestType = "long"
+	SelfTest_Conveyance SelfTestType = "conveyance" //SATA only
+)
+
+// SelfTestLogEntry is a row of the self-test log (smartctl -l selftest), newest first
+type SelfTestLogEntry struct {
+	Number           int    // e.g., 1 for the newest test of SATA disks, 0 for NVMe
+	Description      string // e.g., Short offline, Extended offline
+	Status           string // e.g., Completed without error, Completed: read failure
+	RemainingPercent int    // Only for SATA tests in progress or aborted
+	LifetimeHours    uint64 // Power on hours when the test ran
+	FirstErrorLBA    string // "-" if no error
+	InProgress       bool
+	Aborted          bool // Aborted or interrupted, not a failure of the disk
+	Passed           bool
+}
+
+// SelfTestProgress is the state of the running self-test
+type SelfTestProgress struct {
+	InProgress      bool
+	PercentComplete int
+}
+
+// ErrorLog is the ATA or NVMe error log (smartctl -l error)
+type ErrorLog struct {
+	ErrorCount int // Total errors reported by the disk, the log only keeps the latest
+	Entries    []*ErrorLogEntry
+}
+
+type ErrorLogEntry struct {
+	Number        int    // Error number, the newest has the highest number
+	LifetimeHours uint64 // Power on hours when the error occurred, SATA only
+	State         string // e.g., active or idle, SATA only
+	Message       string // e.g., UNC at LBA = 0x0fffffff = 268435455
 }
@@ -0,0 +1,328 @@
+package automount
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"imuslab.com/bokofs/bokofsd/mod/bokofs"
+	"imuslab.com/bokofs/bokofsd/mod/bokofs/bokoworker"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
+	"imuslab.com/bokofs/bokofsd/mod/disktool/diskfs"
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	automount.go
+
+	The auto mounter mounts file systems that match a mount rule (by UUID)
+	or removable drives (e.g. USB backup drives) when they are plugged in,
+	and serve them as bokoFS workers under /disk/. When the drive is removed,
+	the worker is unregistered and the stale mount is lazily unmounted.
+
+	Call Sync after every block device hotplug event, it compares the
+	devices in the inventory with the mounted ones and apply the difference
+*/
+
+// Rule mounts the file system with the given UUID at the mount point
+type Rule struct {
+	UUID       string `json:"uuid"`          //File system UUID, e.g. 0f3c1e2d-1122-3344-5566-778899aabbcc
+	MountPoint string `json:"mount_point"`   //Where to mount the file system, e.g. /mnt/backup
+	NodeName   string `json:"node_name"`     //Worker node name, leave empty to use the base name of the mount point
+	Options    string `json:"mount_options"` //Options passed to mount -o, e.g. noatime
+	ReadOnly   bool   `json:"read_only"`     //Serve the worker as read only
+}
+
+// Mount is a file system mounted (or served) by the auto mounter
+type Mount struct {
+	Device      string `json:"device"`        //e.g. sdb1
+	UUID        string `json:"uuid"`          //File system UUID
+	FsType      string `json:"fstype"`        //File system type, e.g. exfat
+	MountPoint  string `json:"mount_point"`   //e.g. /media/bokofs/backup
+	NodeName    string `json:"node_name"`     //e.g. backup, served at /disk/backup
+	ReadOnly    bool   `json:"read_only"`     //Worker is read only
+	MountedByUs bool   `json:"mounted_by_us"` //False if the device was already mounted by someone else
+}
+
+type Options struct {
+	Rules          []*Rule                                                      //Mount rules by file system UUID
+	MountRemovable bool                                                         //Mount removable and USB drives that do not match any rule
+	RemovableRoot  string                                                       //Where removable drives are mounted, e.g. /media/bokofs
+	ThumbnailRoot  string                                                       //Root folder of the thumbnail stores of auto mounted workers
+	Server         *bokofs.Server                                               //The server to register the workers to
+	Inventory      *inventory.Inventory                                         //Leave empty to use inventory.Default()
+	MountFunc      func(device string, mountPoint string, options string) error //Leave empty to use diskfs.MountDevice
+	UnmountFunc    func(mountPoint string) error                                //Leave empty to use diskfs.UnmountDevice
+	OnMount        func(mount *Mount)                                           //Optional, called after a worker is registered
+	OnUnmount      func(mount *Mount)                                           //Optional, called after a worker is unregistered
+	IsNameReserved func(nodeName string) bool                                   //Optional, check if a node name is kept for another worker, e.g. a saved worker
+}
+
+type Manager struct {
+	options *Options
+	mounts  map[string]*Mount //Mounted devices, key is the device name
+	mutex   sync.Mutex
+}
+
+// File systems that can be mounted and served as worker
+var mountableFsTypes = []string{"ext2", "ext3", "ext4", "xfs", "btrfs", "f2fs", "exfat", "ntfs", "vfat"}
+
+var invalidNodeNameChars = regexp.MustCompile(`[^A-Za-z0-9_\-.]+`)
+
+// NewManager creates an auto mounter, call Sync to mount the devices that are already attached
+func NewManager(options *Options) (*Manager, error) {
+	if options.Server == nil {
+		return nil, errors.New("server is required")
+	}
+	if options.Inventory == nil {
+		options.Inventory = inventory.Default()
+	}
+	if options.MountFunc == nil {
+		options.MountFunc = func(device string, mountPoint string, mountOptions string) error {
+			return diskfs.MountDevice(device, mountPoint, mountOptions)
+		}
+	}
+	if options.UnmountFunc == nil {
+		options.UnmountFunc = diskfs.UnmountDevice
+	}
+
+	for _, rule := range options.Rules {
+		if rule.UUID == "" || rule.MountPoint == "" {
+			return nil, errors.New("mount rule requires uuid and mount_point")
+		}
+		if rule.NodeName == "" {
+			rule.NodeName = filepath.Base(filepath.Clean(rule.MountPoint))
+		}
+		rule.NodeName = sanitizeNodeName(rule.NodeName)
+	}
+
+	return &Manager{
+		options: options,
+		mounts:  map[string]*Mount{},
+	}, nil
+}
+
+// Sync unregister the workers of removed devices and mount the newly attached ones
+func (m *Manager) Sync() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	devices, err := m.options.Inventory.List()
+	if err != nil {
+		log.Println("[Automount] Unable to list block devices: " + err.Error())
+		return
+	}
+
+	attached := map[string]*inventory.Device{}
+	for _, device := range devices {
+		attached[device.Name] = device
+	}
+
+	//Remove the workers of devices that are gone or reformatted
+	for name, mount := range m.mounts {
+		device, ok := attached[name]
+		if ok && device.UUID == mount.UUID {
+			continue
+		}
+		m.unmount(mount)
+		delete(m.mounts, name)
+	}
+
+	//Mount the devices that match a rule or are removable
+	for _, device := range devices {
+		if _, ok := m.mounts[device.Name]; ok {
+			continue
+		}
+
+		mount := m.matchDevice(device)
+		if mount == nil {
+			continue
+		}
+
+		if err := m.mount(device, mount); err != nil {
+			log.Println("[Automount] Unable to mount " + device.Name + ": " + err.Error())
+			continue
+		}
+		m.mounts[device.Name] = mount
+	}
+}
+
+// List returns the mounted devices sorted by node name
+func (m *Manager) List() []*Mount {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	results := []*Mount{}
+	for _, mount := range m.mounts {
+		thisMount := *mount
+		results = append(results, &thisMount)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].NodeName < results[j].NodeName
+	})
+	return results
+}
+
+// HandleListMounts list the drives mounted by the auto mounter and their workers
+func (m *Manager) HandleListMounts(w http.ResponseWriter, r *http.Request) {
+	js, _ := json.Marshal(m.List())
+	utils.SendJSONResponse(w, string(js))
+}
+
+// UnmountAll unregister all workers and unmount the devices mounted by the auto mounter
+func (m *Manager) UnmountAll() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for name, mount := range m.mounts {
+		m.unmount(mount)
+		delete(m.mounts, name)
+	}
+}
+
+// matchDevice returns the mount setting of the device, or nil if it should not be mounted
+func (m *Manager) matchDevice(device *inventory.Device) *Mount {
+	if device.UUID == "" {
+		return nil
+	}
+
+	for _, rule := range m.options.Rules {
+		if strings.EqualFold(rule.UUID, device.UUID) {
+			return &Mount{
+				Device:     device.Name,
+				UUID:       device.UUID,
+				FsType:     device.FsType,
+				MountPoint: rule.MountPoint,
+				NodeName:   rule.NodeName,
+				ReadOnly:   rule.ReadOnly,
+			}
+		}
+	}
+
+	if !m.options.MountRemovable || !(device.Removable || device.Transport == "usb") {
+		return nil
+	}
+	if !isMountable(device.FsType) || len(device.Holders) > 0 {
+		//Unknown file system, or a member of RAID / LVM
+		return nil
+	}
+	if device.MountPoint() != "" {
+		//Mounted by the system or the desktop, e.g. the root of a host booted from USB
+		return nil
+	}
+
+	nodeName := sanitizeNodeName(device.Label)
+	if nodeName == "" {
+		nodeName = "usb-" + sanitizeNodeName(strings.SplitN(device.UUID, "-", 2)[0])
+	}
+	nodeName = m.uniqueNodeName(nodeName)
+	return &Mount{
+		Device:     device.Name,
+		UUID:       device.UUID,
+		FsType:     device.FsType,
+		MountPoint: filepath.Join(m.options.RemovableRoot, nodeName),
+		NodeName:   nodeName,
+	}
+}
+
+// mount mounts the device (if not mounted yet) and register the worker
+func (m *Manager) mount(device *inventory.Device, mount *Mount) error {
+	//Only devices matching a rule are served if they are already mounted, e.g. by fstab
+	existingMountPoint := device.MountPoint()
+	if existingMountPoint != "" {
+		mount.MountPoint = existingMountPoint
+	}
+	if diskfs.IsSystemMountPoint(mount.MountPoint) {
+		return errors.New(mount.MountPoint + " is a system folder and cannot be served")
+	}
+
+	if existingMountPoint == "" {
+		options := ""
+		for _, rule := range m.options.Rules {
+			if strings.EqualFold(rule.UUID, device.UUID) {
+				options = rule.Options
+			}
+		}
+		if err := m.options.MountFunc(device.Path, mount.MountPoint, options); err != nil {
+			return err
+		}
+		mount.MountedByUs = true
+		m.options.Inventory.Invalidate()
+	}
+
+	worker, err := bokoworker.NewFSWorker(&bokoworker.Options{
+		NodeName:       mount.NodeName,
+		ServePath:      mount.MountPoint,
+		ThumbnailStore: filepath.Join(m.options.ThumbnailRoot, mount.NodeName),
+		ReadOnly:       mount.ReadOnly,
+	})
+	if err == nil {
+		err = m.options.Server.AddWorker(worker)
+	}
+	if err != nil {
+		if mount.MountedByUs {
+			m.options.UnmountFunc(mount.MountPoint)
+			m.options.Inventory.Invalidate()
+		}
+		return errors.New("unable to register worker " + mount.NodeName + ": " + err.Error())
+	}
+
+	log.Println("[Automount] " + device.Name + " (" + mount.FsType + ") mounted at " + mount.MountPoint + " and served as /" + mount.NodeName)
+	if m.options.OnMount != nil {
+		m.options.OnMount(mount)
+	}
+	return nil
+}
+
+// unmount unregister the worker and unmount the device if it is mounted by the auto mounter
+func (m *Manager) unmount(mount *Mount) {
+	m.options.Server.RemoveWorker(mount.NodeName)
+	if mount.MountedByUs {
+		//The device might be gone already, lazy unmount releases the mount point anyway
+		if err := m.options.UnmountFunc(mount.MountPoint); err != nil {
+			log.Println("[Automount] Unable to unmount " + mount.MountPoint + ": " + err.Error())
+		}
+		m.options.Inventory.Invalidate()
+	}
+
+	log.Println("[Automount] Worker /" + mount.NodeName + " of " + mount.Device + " removed")
+	if m.options.OnUnmount != nil {
+		m.options.OnUnmount(mount)
+	}
+}
+
+// uniqueNodeName appends a number to the node name if it is used by another worker,
+// e.g. two drives both labeled "backup", or reserved for a saved worker
+func (m *Manager) uniqueNodeName(nodeName string) string {
+	candidate := nodeName
+	for i := 2; ; i++ {
+		_, err := m.options.Server.GetWorker(candidate)
+		if err != nil && (m.options.IsNameReserved == nil || !m.options.IsNameReserved(candidate)) {
+			return candidate
+		}
+		candidate = nodeName + "-" + strconv.Itoa(i)
+	}
+}
+
+func isMountable(fsType string) bool {
+	for _, mountableFsType := range mountableFsTypes {
+		if fsType == mountableFsType {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeNodeName turns a label into a valid worker node name, e.g. "My Backup" to "My_Backup"
+func sanitizeNodeName(name string) string {
+	name = invalidNodeNameChars.ReplaceAllString(strings.TrimSpace(name), "_")
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,238 @@
+package automount
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"imuslab.com/bokofs/bokofsd/mod/bokofs"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
+	"imuslab.com/bokofs/bokofsd/mod/disktool/diskfs"
+)
+
+// fakeSystem is a fake sysfs and udev tree for the inventory
+type fakeSystem struct {
+	root       string
+	classBlock string
+	udevData   string
+	procMounts string
+}
+
+func newFakeSystem(t *testing.T) *fakeSystem {
+	root := t.TempDir()
+	system := &fakeSystem{
+		root:       root,
+		classBlock: filepath.Join(root, "sys/class/block"),
+		udevData:   filepath.Join(root, "run/udev/data"),
+		procMounts: filepath.Join(root, "proc/mounts"),
+	}
+	os.MkdirAll(system.classBlock, 0755)
+	os.MkdirAll(system.udevData, 0755)
+	os.MkdirAll(filepath.Dir(system.procMounts), 0755)
+	os.WriteFile(system.procMounts, []byte(""), 0644)
+	return system
+}
+
+// addPartition adds a disk with a single partition holding a file system
+func (s *fakeSystem) addPartition(t *testing.T, disk string, minor int, busPath string, fsType string, uuid string, label string) {
+	diskPath := filepath.Join(s.root, "sys/devices", busPath, "block", disk)
+	partPath := filepath.Join(diskPath, disk+"1")
+	files := map[string]string{
+		filepath.Join(diskPath, "size"):                        "2048",
+		filepath.Join(diskPath, "dev"):                         "8:" + strconv.Itoa(minor),
+		filepath.Join(partPath, "size"):                        "2000",
+		filepath.Join(partPath, "dev"):                         "8:" + strconv.Itoa(minor+1),
+		filepath.Join(partPath, "partition"):                   "1",
+		filepath.Join(s.udevData, "b8:"+strconv.Itoa(minor+1)): "E:ID_FS_TYPE=" + fsType + "\nE:ID_FS_UUID=" + uuid + "\nE:ID_FS_LABEL=" + label + "\n",
+	}
+	for path, content := range files {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Symlink(diskPath, filepath.Join(s.classBlock, disk))
+	os.Symlink(partPath, filepath.Join(s.classBlock, disk+"1"))
+}
+
+// removeDisk removes a disk and its partition
+func (s *fakeSystem) removeDisk(disk string) {
+	os.Remove(filepath.Join(s.classBlock, disk))
+	os.Remove(filepath.Join(s.classBlock, disk+"1"))
+}
+
+func TestAutoMount(t *testing.T) {
+	system := newFakeSystem(t)
+	inv := inventory.NewInventory(&inventory.Options{
+		SysClassBlock: system.classBlock,
+		UdevData:      system.udevData,
+		DevDisk:       filepath.Join(system.root, "dev/disk"),
+		ProcMounts:    system.procMounts,
+		DevRoot:       filepath.Join(system.root, "dev"),
+	})
+
+	server, err := bokofs.NewWebdavInterfaceServer("/disk/", "/thumb/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mounted := map[string]string{}
+	mountRoot := t.TempDir()
+	manager, err := NewManager(&Options{
+		Rules: []*Rule{
+			{UUID: "AAAA-0001", MountPoint: filepath.Join(mountRoot, "backup"), ReadOnly: true},
+		},
+		MountRemovable: true,
+		RemovableRoot:  filepath.Join(mountRoot, "media"),
+		ThumbnailRoot:  t.TempDir(),
+		Server:         server,
+		Inventory:      inv,
+		MountFunc: func(device string, mountPoint string, options string) error {
+			mounted[mountPoint] = device
+			return os.MkdirAll(mountPoint, 0755)
+		},
+		UnmountFunc: func(mountPoint string) error {
+			delete(mounted, mountPoint)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Internal disk that match a rule, internal disk without rule and two USB drives with the same label
+	system.addPartition(t, "sda", 0, "pci0000:00/ata1", "ext4", "aaaa-0001", "")
+	system.addPartition(t, "sdb", 16, "pci0000:00/ata2", "ext4", "bbbb-0002", "data")
+	system.addPartition(t, "sdc", 32, "pci0000:00/usb1/1-1", "exfat", "CCCC-0003", "My Drive")
+	system.addPartition(t, "sdd", 48, "pci0000:00/usb1/1-2", "exfat", "DDDD-0004", "My Drive")
+	manager.Sync()
+
+	mounts := manager.List()
+	if len(mounts) != 3 {
+		t.Fatalf("expected 3 mounts, got %d", len(mounts))
+	}
+	expectedNodes := map[string]string{"backup": "sda1", "My_Drive": "sdc1", "My_Drive-2": "sdd1"}
+	for _, mount := range mounts {
+		if expectedNodes[mount.NodeName] != mount.Device || !mount.MountedByUs {
+			t.Errorf("unexpected mount %+v", mount)
+		}
+		worker, err := server.GetWorker(mount.NodeName)
+		if err != nil {
+			t.Errorf("worker %s not registered", mount.NodeName)
+			continue
+		}
+		if worker.ReadOnly != (mount.NodeName == "backup") {
+			t.Errorf("unexpected read only state of worker %s", mount.NodeName)
+		}
+	}
+	if mounted[filepath.Join(mountRoot, "media", "My_Drive")] != "/dev/sdc1" {
+		t.Errorf("sdc1 is not mounted at the removable root: %v", mounted)
+	}
+
+	//Unplug a USB drive, the worker should be removed
+	system.removeDisk("sdc")
+	inv.Invalidate()
+	manager.Sync()
+	if _, err := server.GetWorker("My_Drive"); err == nil {
+		t.Error("worker of removed drive is still registered")
+	}
+	if _, ok := mounted[filepath.Join(mountRoot, "media", "My_Drive")]; ok {
+		t.Error("mount point of removed drive is not unmounted")
+	}
+	if len(manager.List()) != 2 {
+		t.Errorf("expected 2 mounts after removal, got %d", len(manager.List()))
+	}
+
+	manager.UnmountAll()
+	if len(mounted) != 0 || len(manager.List()) != 0 {
+		t.Errorf("devices still mounted after UnmountAll: %v", mounted)
+	}
+}
+
+func TestSanitizeNodeName(t *testing.T) {
+	tests := map[string]string{
+		"My Backup":   "My_Backup",
+		" USB/Disk ":  "USB_Disk",
+		"..":          "",
+		"photos-2024": "photos-2024",
+	}
+	for input, expected := range tests {
+		if got := sanitizeNodeName(input); got != expected {
+			t.Errorf("sanitizeNodeName(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestAutoMountSkipsSystemMounts(t *testing.T) {
+	system := newFakeSystem(t)
+	inv := inventory.NewInventory(&inventory.Options{
+		SysClassBlock: system.classBlock,
+		UdevData:      system.udevData,
+		DevDisk:       filepath.Join(system.root, "dev/disk"),
+		ProcMounts:    system.procMounts,
+		DevRoot:       filepath.Join(system.root, "dev"),
+	})
+
+	server, err := bokofs.NewWebdavInterfaceServer("/disk/", "/thumb/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mountRoot := t.TempDir()
+	manager, err := NewManager(&Options{
+		Rules: []*Rule{
+			{UUID: "FFFF-0006", MountPoint: "/boot/firmware"},
+		},
+		MountRemovable: true,
+		RemovableRoot:  filepath.Join(mountRoot, "media"),
+		ThumbnailRoot:  t.TempDir(),
+		Server:         server,
+		Inventory:      inv,
+		MountFunc: func(device string, mountPoint string, options string) error {
+			return os.MkdirAll(mountPoint, 0755)
+		},
+		UnmountFunc: func(mountPoint string) error { return nil },
+		IsNameReserved: func(nodeName string) bool {
+			return nodeName == "backup"
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Host booted from a USB drive, a rule pointing to a system folder and a USB drive
+	//labeled with the name of a saved worker
+	system.addPartition(t, "sda", 0, "pci0000:00/usb1/1-1", "ext4", "aaaa-0001", "rootfs")
+	system.addPartition(t, "sdb", 16, "pci0000:00/ata1", "vfat", "FFFF-0006", "firmware")
+	system.addPartition(t, "sdc", 32, "pci0000:00/usb1/1-2", "exfat", "CCCC-0003", "backup")
+	os.WriteFile(system.procMounts, []byte("/dev/sda1 / ext4 rw,relatime 0 0\n"), 0644)
+	manager.Sync()
+
+	mounts := manager.List()
+	if len(mounts) != 1 || mounts[0].Device != "sdc1" || mounts[0].NodeName != "backup-2" {
+		t.Fatalf("expected only sdc1 served as backup-2, got %+v", mounts)
+	}
+	if _, err := server.GetWorker("rootfs"); err == nil {
+		t.Error("root file system of the host is served")
+	}
+}
+
+func TestIsSystemMountPoint(t *testing.T) {
+	tests := map[string]bool{
+		"/":                 true,
+		"/boot/firmware":    true,
+		"/usr/local":        true,
+		"/var/lib/../lib":   true,
+		"/home":             true,
+		"/media/bokofs/usb": false,
+		"/mnt/backup":       false,
+		"/run/media/usb":    false,
+		"/bootstrap":        false,
+	}
+	for path, expected := range tests {
+		if got := diskfs.IsSystemMountPoint(path); got != expected {
+			t.Errorf("IsSystemMountPoint(%q) = %v, expected %v", path, got, expected)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package diskfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+	busy.go
+
+	Find the processes that keep a mount point busy by reading
+	the working directory, root, executable and open file
+	descriptors of every process in /proc
+*/
+
+// OpenHandle is a file or directory under a mount point opened by a process
+type OpenHandle struct {
+	PID     int    `json:"pid"`
+	Command string `json:"command"` //Process name from /proc/{pid}/comm
+	Path    string `json:"path"`    //The opened path, e.g. /mnt/storage/photos/a.jpg
+}
+
+// BusyError is returned by Unmount if processes are still using the mount point
+type BusyError struct {
+	MountPoint string
+	Handles    []*OpenHandle
+}
+
+func (e *BusyError) Error() string {
+	processes := []string{}
+	seen := map[int]bool{}
+	for _, handle := range e.Handles {
+		if !seen[handle.PID] {
+			seen[handle.PID] = true
+			processes = append(processes, handle.Command+" ("+strconv.Itoa(handle.PID)+")")
+		}
+	}
+	return fmt.Sprintf("%s is busy, used by %s", e.MountPoint, strings.Join(processes, ", "))
+}
+
+// ListOpenHandles returns the files and directories under the mount point that are used by processes
+func ListOpenHandles(mountPoint string) ([]*OpenHandle, error) {
+	return listOpenHandles("/proc", mountPoint)
+}
+
+func listOpenHandles(procRoot string, mountPoint string) ([]*OpenHandle, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", procRoot, err)
+	}
+
+	mountPoint = filepath.Clean(mountPoint)
+	isUnderMountPoint := func(path string) bool {
+		path = strings.TrimSuffix(path, " (deleted)")
+		return path == mountPoint || strings.HasPrefix(path, mountPoint+"/")
+	}
+
+	handles := []*OpenHandle{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			//Not a process folder
+			continue
+		}
+
+		processFolder := filepath.Join(procRoot, entry.Name())
+		paths := []string{}
+		for _, link := range []string{"cwd", "root", "exe"} {
+			if target, err := os.Readlink(filepath.Join(processFolder, link)); err == nil {
+				paths = append(paths, target)
+			}
+		}
+
+		//The process might exit or the fd folder is not readable, skip the errors
+		fds, _ := os.ReadDir(filepath.Join(processFolder, "fd"))
+		for _, fd := range fds {
+			if target, err := os.Readlink(filepath.Join(processFolder, "fd", fd.Name())); err == nil {
+				paths = append(paths, target)
+			}
+		}
+
+		command := ""
+		for _, path := range paths {
+			if !isUnderMountPoint(path) {
+				continue
+			}
+			if command == "" {
+				comm, _ := os.ReadFile(filepath.Join(processFolder, "comm"))
+				command = strings.TrimSpace(string(comm))
+			}
+			handles = append(handles, &OpenHandle{
+				PID:     pid,
+				Command: command,
+				Path:    strings.TrimSuffix(path, " (deleted)"),
+			})
+		}
+	}
+
+	sort.SliceStable(handles, func(i, j int) bool {
+		return handles[i].PID < handles[j].PID
+	})
+	return handles, nil
+}
@@ -0,0 +1,44 @@
+package diskfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListOpenHandles(t *testing.T) {
+	procRoot := t.TempDir()
+	addProcess := func(pid string, comm string, cwd string, fds ...string) {
+		processFolder := filepath.Join(procRoot, pid)
+		os.MkdirAll(filepath.Join(processFolder, "fd"), 0755)
+		os.WriteFile(filepath.Join(processFolder, "comm"), []byte(comm+"\n"), 0644)
+		os.Symlink(cwd, filepath.Join(processFolder, "cwd"))
+		for i, fd := range fds {
+			os.Symlink(fd, filepath.Join(processFolder, "fd", string(rune('0'+i))))
+		}
+	}
+
+	addProcess("100", "bash", "/mnt/storage/photos")
+	addProcess("200", "rsync", "/root", "/dev/null", "/mnt/storage/backup.tar (deleted)", "socket:[1234]")
+	addProcess("300", "vim", "/mnt/storage2", "/mnt/storage2/notes.txt")
+	os.MkdirAll(filepath.Join(procRoot, "sys"), 0755)
+
+	handles, err := listOpenHandles(procRoot, "/mnt/storage/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handles) != 2 {
+		t.Fatalf("expected 2 handles, got %d", len(handles))
+	}
+	if handles[0].PID != 100 || handles[0].Command != "bash" || handles[0].Path != "/mnt/storage/photos" {
+		t.Errorf("unexpected handle %+v", handles[0])
+	}
+	if handles[1].PID != 200 || handles[1].Path != "/mnt/storage/backup.tar" {
+		t.Errorf("unexpected handle %+v", handles[1])
+	}
+
+	busyErr := &BusyError{MountPoint: "/mnt/storage", Handles: handles}
+	if busyErr.Error() != "/mnt/storage is busy, used by bash (100), rsync (200)" {
+		t.Errorf("unexpected error message: %s", busyErr.Error())
+	}
+}
@@ -12,8 +12,6 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
-
-	"imuslab.com/bokofs/bokofsd/mod/utils"
 )
 
 /*
@@ -51,58 +49,6 @@ type StorageDevicesMeta struct {
 	Blockdevices []BlockDeviceMeta `json:"blockdevices"`
 }
 
-// Check if the file format driver is installed on this host
-// if a format is supported, mkfs.(format) should be symlinked under /sbin
-func FormatPackageInstalled(fsType string) bool {
-	return utils.FileExists("/sbin/mkfs." + fsType)
-}
-
-// Create file system, support ntfs, ext4 and fat32 only
-func FormatStorageDevice(fsType string, devicePath string) error {
-	// Check if the filesystem type is supported
-	switch fsType {
-	case "ext4":
-		// Format the device with the specified filesystem type
-		cmd := exec.Command("sudo", "mkfs."+fsType, devicePath)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return errors.New("unable to format device: " + string(output))
-		}
-		return nil
-
-	case "vfat", "fat", "fat32":
-		//Check if mkfs.fat exists
-		if !FormatPackageInstalled("vfat") {
-			return errors.New("unable to format device as fat (vfat). dosfstools not installed?")
-		}
-
-		// Format the device with the specified filesystem type
-		cmd := exec.Command("sudo", "mkfs.vfat", devicePath)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return errors.New("unable to format device: " + string(output))
-		}
-		return nil
-
-	case "ntfs":
-		//Check if ntfs-3g exists
-		if !FormatPackageInstalled("ntfs") {
-			return errors.New("unable to format device as ntfs: ntfs-3g not installed?")
-		}
-
-		//Format the drive
-		cmd := exec.Command("sudo", "mkfs.ntfs", devicePath)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return errors.New("unable to format device: " + string(output))
-		}
-		return nil
-
-	default:
-		return fmt.Errorf("unsupported filesystem type: %s", fsType)
-	}
-}
-
 // List all the storage device in the system, set minSize to 0 for no filter
 func ListAllStorageDevices() (*StorageDevicesMeta, error) {
 	cmd := exec.Command("sudo", "lsblk", "-b", "--json")
@@ -220,6 +166,26 @@ func DeviceIsMounted(devicePath string) (bool, error) {
 	return false, nil
 }
 
+// MountDevice mounts the device (e.g. /dev/sdb1) at the mount point, the mount point
+// will be created if it does not exist. Leave options empty to use the defaults
+func MountDevice(devicePath string, mountPoint string, options string) error {
+	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+		return fmt.Errorf("error creating mount point: %v", err)
+	}
+
+	args := []string{"mount"}
+	if options != "" {
+		args = append(args, "-o", options)
+	}
+	args = append(args, devicePath, mountPoint)
+	cmd := exec.Command("sudo", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error mounting device: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
 // UnmountDevice unmounts the specified device.
 // Remember to use full path (e.g. /dev/md0) in the devicePath
 func UnmountDevice(devicePath string) error {
@@ -236,18 +202,20 @@ func UnmountDevice(devicePath string) error {
 	return nil
 }
 
-// Force Version of Unmount (dangerous)
+// Force Version of Unmount (dangerous), processes using the device will get I/O errors
+// Fallback to lazy unmount if the file system does not support force unmount
 // Remember to use full path (e.g. /dev/md0) in the devicePath
 func ForceUnmountDevice(devicePath string) error {
-	// Construct the bash command to unmount the device
-	cmd := exec.Command("sudo", "bash", "-c", fmt.Sprintf("umount -l %s", devicePath))
+	output, err := exec.Command("sudo", "umount", "-f", devicePath).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	log.Println("[diskfs] Force unmount failed, trying lazy unmount: " + strings.TrimSpace(string(output)))
 
-	// Run the command
-	err := cmd.Run()
+	output, err = exec.Command("sudo", "umount", "-l", devicePath).CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("error unmounting device: %v", err)
+		return fmt.Errorf("error unmounting device: %s", strings.TrimSpace(string(output)))
 	}
-
 	return nil
 }
 
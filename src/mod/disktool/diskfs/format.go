@@ -0,0 +1,399 @@
+package diskfs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	format.go
+
+	Create file systems with mkfs. Progress is parsed from the
+	mkfs output if the tool reports it (mke2fs and mkntfs)
+*/
+
+// FormatOptions defines the file system to create, zero values use the defaults of mkfs
+type FormatOptions struct {
+	FsType          string //ext4, xfs, btrfs, exfat, f2fs, vfat or ntfs
+	Label           string //Volume label
+	BlockSize       int    //Block size (cluster size for vfat, exfat and ntfs) in bytes
+	ReservedPercent *int   //ext4 only, percentage of blocks reserved for root, nil to use the default (5)
+	InodeRatio      int    //ext4 only, bytes per inode
+	DataProfile     string //btrfs only, e.g. single, dup, raid1
+	MetadataProfile string //btrfs only, e.g. dup, raid1
+	FullFormat      bool   //Overwrite the whole device with zeros before creating the file system
+}
+
+// FormatProgressHandler is called when the format moves to a new stage or the progress
+// of the stage changed, progress is in percent or -1 if the stage does not report progress
+type FormatProgressHandler func(stage string, progress float64)
+
+const (
+	FORMAT_STAGE_ZEROING    = "zeroing"
+	FORMAT_STAGE_FORMATTING = "formatting"
+)
+
+type fileSystemSpec struct {
+	Mkfs           string //Name of the mkfs tool
+	MaxLabelLength int
+}
+
+// Supported file systems
+var fileSystemSpecs = map[string]*fileSystemSpec{
+	"ext4":  {Mkfs: "mkfs.ext4", MaxLabelLength: 16},
+	"xfs":   {Mkfs: "mkfs.xfs", MaxLabelLength: 12},
+	"btrfs": {Mkfs: "mkfs.btrfs", MaxLabelLength: 255},
+	"exfat": {Mkfs: "mkfs.exfat", MaxLabelLength: 15},
+	"f2fs":  {Mkfs: "mkfs.f2fs", MaxLabelLength: 512},
+	"vfat":  {Mkfs: "mkfs.vfat", MaxLabelLength: 11},
+	"ntfs":  {Mkfs: "mkfs.ntfs", MaxLabelLength: 128},
+}
+
+var btrfsProfiles = []string{"single", "dup", "raid0", "raid1", "raid1c3", "raid1c4", "raid10", "raid5", "raid6"}
+
+// Paths to look for the mkfs tools, /sbin might not be in the PATH of a normal user
+var mkfsSearchPaths = []string{"/sbin", "/usr/sbin", "/bin", "/usr/bin", "/usr/local/sbin"}
+
+// normalizeFsType converts the aliases (e.g. fat32) to the file system type used by mkfs
+func normalizeFsType(fsType string) string {
+	fsType = strings.ToLower(strings.TrimSpace(fsType))
+	switch fsType {
+	case "fat", "fat32":
+		return "vfat"
+	case "ext":
+		return "ext4"
+	}
+	return fsType
+}
+
+// Check if the file format driver is installed on this host
+// if a format is supported, mkfs.(format) should be found under /sbin or in PATH
+func FormatPackageInstalled(fsType string) bool {
+	spec, ok := fileSystemSpecs[normalizeFsType(fsType)]
+	if !ok {
+		return false
+	}
+	for _, searchPath := range mkfsSearchPaths {
+		if utils.FileExists(searchPath + "/" + spec.Mkfs) {
+			return true
+		}
+	}
+	_, err := exec.LookPath(spec.Mkfs)
+	return err == nil
+}
+
+// GetSupportedFormats returns the file systems that can be created on this host
+func GetSupportedFormats() []string {
+	results := []string{}
+	for _, fsType := range []string{"ext4", "xfs", "btrfs", "f2fs", "exfat", "vfat", "ntfs"} {
+		if FormatPackageInstalled(fsType) {
+			results = append(results, fsType)
+		}
+	}
+	return results
+}
+
+// Create file system with the default options
+func FormatStorageDevice(fsType string, devicePath string) error {
+	_, err := Format(devicePath, &FormatOptions{FsType: fsType}, nil)
+	return err
+}
+
+// Format creates the file system on the device and returns the UUID of the new file system.
+// onProgress is optional
+func Format(devicePath string, options *FormatOptions, onProgress FormatProgressHandler) (string, error) {
+	if onProgress == nil {
+		onProgress = func(stage string, progress float64) {}
+	}
+
+	device, err := checkDeviceFormatable(devicePath)
+	if err != nil {
+		return "", err
+	}
+
+	args, err := buildMkfsArgs(device.Path, options)
+	if err != nil {
+		return "", err
+	}
+	if !FormatPackageInstalled(options.FsType) {
+		return "", errors.New("unable to format device as " + options.FsType + ": " + args[0] + " not found")
+	}
+
+	//ntfs zeros the device by itself on full format
+	if options.FullFormat && normalizeFsType(options.FsType) != "ntfs" {
+		onProgress(FORMAT_STAGE_ZEROING, 0)
+		err = zeroDevice(device.Path, device.Size, func(progress float64) {
+			onProgress(FORMAT_STAGE_ZEROING, progress)
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	onProgress(FORMAT_STAGE_FORMATTING, -1)
+	defer inventory.Default().Invalidate()
+	err = runWithProgress(exec.Command("sudo", args...), func(line string) {
+		if progress, ok := parseMkfsProgress(options.FsType, line); ok {
+			onProgress(FORMAT_STAGE_FORMATTING, progress)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	//Read the UUID from the new superblock, udev might not have updated its database yet
+	newDevice, err := inventory.Probe(device.Path)
+	if err == nil && newDevice.UUID != "" {
+		return newDevice.UUID, nil
+	}
+	return GetDiskUUID(device.Path)
+}
+
+// checkDeviceFormatable checks if the device exists and is not in use
+func checkDeviceFormatable(devicePath string) (*inventory.Device, error) {
+	device, err := inventory.Default().Get(devicePath)
+	if err != nil {
+		return nil, errors.New("target device not found")
+	}
+	if mountPoint := device.MountPoint(); mountPoint != "" {
+		return nil, errors.New("device is mounted at " + mountPoint + ", unmount it first")
+	}
+	if len(device.Holders) > 0 {
+		return nil, errors.New("device is in use by " + strings.Join(device.Holders, ", "))
+	}
+	if device.ReadOnly {
+		return nil, errors.New("device is read only")
+	}
+
+	partitions, err := inventory.Default().Partitions(device.Name)
+	if err == nil && len(partitions) > 0 {
+		return nil, errors.New("device has partitions, format the partitions or create a new partition table instead")
+	}
+	return device, nil
+}
+
+// buildMkfsArgs returns the mkfs command line (without sudo) for the options
+func buildMkfsArgs(devicePath string, options *FormatOptions) ([]string, error) {
+	fsType := normalizeFsType(options.FsType)
+	spec, ok := fileSystemSpecs[fsType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported filesystem type: %s", options.FsType)
+	}
+
+	if len(options.Label) > spec.MaxLabelLength {
+		return nil, fmt.Errorf("label is too long, %s supports up to %d characters", fsType, spec.MaxLabelLength)
+	}
+	if options.BlockSize < 0 || (options.BlockSize > 0 && options.BlockSize&(options.BlockSize-1) != 0) {
+		return nil, errors.New("block size must be a power of 2")
+	}
+	if fsType != "ext4" && (options.ReservedPercent != nil || options.InodeRatio > 0) {
+		return nil, errors.New("reserved percentage and inode ratio are only supported by ext4")
+	}
+	if fsType != "btrfs" && (options.DataProfile != "" || options.MetadataProfile != "") {
+		return nil, errors.New("data and metadata profiles are only supported by btrfs")
+	}
+
+	args := []string{spec.Mkfs}
+	switch fsType {
+	case "ext4":
+		args = append(args, "-F")
+		if options.Label != "" {
+			args = append(args, "-L", options.Label)
+		}
+		if options.BlockSize > 0 {
+			if options.BlockSize < 1024 || options.BlockSize > 65536 {
+				return nil, errors.New("ext4 block size must be between 1024 and 65536")
+			}
+			args = append(args, "-b", strconv.Itoa(options.BlockSize))
+		}
+		if options.ReservedPercent != nil {
+			if *options.ReservedPercent < 0 || *options.ReservedPercent > 50 {
+				return nil, errors.New("reserved percentage must be between 0 and 50")
+			}
+			args = append(args, "-m", strconv.Itoa(*options.ReservedPercent))
+		}
+		if options.InodeRatio > 0 {
+			if options.InodeRatio < 1024 {
+				return nil, errors.New("inode ratio must be at least 1024")
+			}
+			args = append(args, "-i", strconv.Itoa(options.InodeRatio))
+		}
+		if options.FullFormat {
+			//Initialize the inode tables now instead of in the background after mount
+			args = append(args, "-E", "lazy_itable_init=0,lazy_journal_init=0")
+		}
+	case "xfs":
+		args = append(args, "-f")
+		if options.Label != "" {
+			args = append(args, "-L", options.Label)
+		}
+		if options.BlockSize > 0 {
+			args = append(args, "-b", "size="+strconv.Itoa(options.BlockSize))
+		}
+	case "btrfs":
+		args = append(args, "-f")
+		if options.Label != "" {
+			args = append(args, "-L", options.Label)
+		}
+		if options.BlockSize > 0 {
+			args = append(args, "--sectorsize", strconv.Itoa(options.BlockSize))
+		}
+		if options.DataProfile != "" {
+			if !utils.StringInArray(btrfsProfiles, options.DataProfile) {
+				return nil, errors.New("invalid btrfs data profile " + options.DataProfile)
+			}
+			args = append(args, "-d", options.DataProfile)
+		}
+		if options.MetadataProfile != "" {
+			if !utils.StringInArray(btrfsProfiles, options.MetadataProfile) {
+				return nil, errors.New("invalid btrfs metadata profile " + options.MetadataProfile)
+			}
+			args = append(args, "-m", options.MetadataProfile)
+		}
+	case "exfat":
+		if options.Label != "" {
+			args = append(args, "-L", options.Label)
+		}
+		if options.BlockSize > 0 {
+			args = append(args, "-c", strconv.Itoa(options.BlockSize))
+		}
+	case "f2fs":
+		args = append(args, "-f")
+		if options.Label != "" {
+			args = append(args, "-l", options.Label)
+		}
+		if options.BlockSize > 0 && options.BlockSize != 4096 {
+			return nil, errors.New("f2fs only supports 4096 bytes blocks")
+		}
+	case "vfat":
+		if options.Label != "" {
+			args = append(args, "-n", strings.ToUpper(options.Label))
+		}
+		if options.BlockSize > 0 {
+			if options.BlockSize < 512 || options.BlockSize > 65536 {
+				return nil, errors.New("vfat cluster size must be between 512 and 65536")
+			}
+			//mkfs.vfat takes sectors per cluster
+			args = append(args, "-s", strconv.Itoa(options.BlockSize/512))
+		}
+	case "ntfs":
+		if !options.FullFormat {
+			args = append(args, "-Q")
+		}
+		if options.Label != "" {
+			args = append(args, "-L", options.Label)
+		}
+		if options.BlockSize > 0 {
+			args = append(args, "-c", strconv.Itoa(options.BlockSize))
+		}
+	}
+	return append(args, devicePath), nil
+}
+
+var (
+	mke2fsProgressRegex  = regexp.MustCompile(`(\d+)/(\d+)\s*$`)
+	percentProgressRegex = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*%`)
+)
+
+// parseMkfsProgress parses a line of mkfs output, e.g. "Writing inode tables: 12/80"
+// from mke2fs or "Initializing device with zeroes:  45%" from mkntfs.
+// Other mkfs tools do not report progress
+func parseMkfsProgress(fsType string, line string) (float64, bool) {
+	switch normalizeFsType(fsType) {
+	case "ext4":
+		if matches := mke2fsProgressRegex.FindStringSubmatch(line); matches != nil {
+			done, _ := strconv.ParseFloat(matches[1], 64)
+			total, _ := strconv.ParseFloat(matches[2], 64)
+			if total > 0 && done <= total {
+				return done / total * 100, true
+			}
+		}
+	case "ntfs":
+		if matches := percentProgressRegex.FindStringSubmatch(line); matches != nil {
+			progress, err := strconv.ParseFloat(matches[1], 64)
+			if err == nil && progress <= 100 {
+				return progress, true
+			}
+		}
+	}
+	return 0, false
+}
+
+var ddProgressRegex = regexp.MustCompile(`^(\d+) bytes`)
+
+// zeroDevice overwrites the whole device with zeros using dd
+func zeroDevice(devicePath string, size int64, onProgress func(progress float64)) error {
+	if size <= 0 {
+		return errors.New("unable to get the size of " + devicePath)
+	}
+
+	cmd := exec.Command("sudo", "dd", "if=/dev/zero", "of="+devicePath, "bs=4M",
+		"count="+strconv.FormatInt(size, 10), "iflag=count_bytes", "oflag=direct", "conv=fsync", "status=progress")
+	return runWithProgress(cmd, func(line string) {
+		if matches := ddProgressRegex.FindStringSubmatch(line); matches != nil {
+			written, _ := strconv.ParseInt(matches[1], 10, 64)
+			onProgress(float64(written) / float64(size) * 100)
+		}
+	})
+}
+
+// runWithProgress runs the command and calls onLine for each line of its output.
+// Progress is usually updated in place with \r or \b, they are treated as line breaks
+func runWithProgress(cmd *exec.Cmd, onLine func(line string)) error {
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	lastLines := []string{}
+	done := make(chan bool)
+	go func() {
+		scanner := bufio.NewScanner(reader)
+		scanner.Split(scanProgressLines)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			onLine(line)
+			lastLines = append(lastLines, line)
+			if len(lastLines) > 5 {
+				lastLines = lastLines[1:]
+			}
+		}
+		//Drain the pipe if the scanner stopped on a long line
+		io.Copy(io.Discard, reader)
+		close(done)
+	}()
+
+	err := cmd.Run()
+	writer.Close()
+	<-done
+	if err != nil {
+		return fmt.Errorf("unable to format device: %s", strings.Join(lastLines, "\n"))
+	}
+	return nil
+}
+
+// scanProgressLines is a bufio.SplitFunc that splits on \n, \r and \b
+func scanProgressLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\n\r\b"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,97 @@
+package diskfs
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildMkfsArgs(t *testing.T) {
+	zero := 0
+	tests := []struct {
+		options  *FormatOptions
+		expected string
+	}{
+		{&FormatOptions{FsType: "ext4"}, "mkfs.ext4 -F /dev/sdb1"},
+		{&FormatOptions{FsType: "ext4", Label: "data", BlockSize: 4096, ReservedPercent: &zero, InodeRatio: 65536, FullFormat: true},
+			"mkfs.ext4 -F -L data -b 4096 -m 0 -i 65536 -E lazy_itable_init=0,lazy_journal_init=0 /dev/sdb1"},
+		{&FormatOptions{FsType: "xfs", Label: "data", BlockSize: 4096}, "mkfs.xfs -f -L data -b size=4096 /dev/sdb1"},
+		{&FormatOptions{FsType: "btrfs", DataProfile: "single", MetadataProfile: "dup"}, "mkfs.btrfs -f -d single -m dup /dev/sdb1"},
+		{&FormatOptions{FsType: "exfat", Label: "usb", BlockSize: 131072}, "mkfs.exfat -L usb -c 131072 /dev/sdb1"},
+		{&FormatOptions{FsType: "f2fs", Label: "flash"}, "mkfs.f2fs -f -l flash /dev/sdb1"},
+		{&FormatOptions{FsType: "fat32", Label: "boot", BlockSize: 4096}, "mkfs.vfat -n BOOT -s 8 /dev/sdb1"},
+		{&FormatOptions{FsType: "ntfs", Label: "win"}, "mkfs.ntfs -Q -L win /dev/sdb1"},
+		{&FormatOptions{FsType: "ntfs", FullFormat: true}, "mkfs.ntfs /dev/sdb1"},
+	}
+	for _, test := range tests {
+		args, err := buildMkfsArgs("/dev/sdb1", test.options)
+		if err != nil {
+			t.Errorf("%+v: unexpected error %v", test.options, err)
+			continue
+		}
+		if strings.Join(args, " ") != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, strings.Join(args, " "))
+		}
+	}
+
+	invalid := []*FormatOptions{
+		{FsType: "zfs"},
+		{FsType: "vfat", Label: "label is too long"},
+		{FsType: "ext4", BlockSize: 3000},
+		{FsType: "xfs", ReservedPercent: &zero},
+		{FsType: "ext4", DataProfile: "raid1"},
+		{FsType: "btrfs", DataProfile: "raid7"},
+		{FsType: "f2fs", BlockSize: 8192},
+	}
+	for _, options := range invalid {
+		if _, err := buildMkfsArgs("/dev/sdb1", options); err == nil {
+			t.Errorf("%+v: expected error", options)
+		}
+	}
+}
+
+func TestParseMkfsProgress(t *testing.T) {
+	tests := []struct {
+		fsType   string
+		line     string
+		progress float64
+		ok       bool
+	}{
+		{"ext4", "Writing inode tables: 20/80", 25, true},
+		{"ext4", "40/80", 50, true},
+		{"ext4", "13107 blocks (5.00%) reserved for the super user", 0, false},
+		{"ntfs", "Initializing device with zeroes:  45%", 45, true},
+		{"xfs", "meta-data=/dev/sdb1 isize=512 agcount=4, agsize=65536 blks", 0, false},
+	}
+	for _, test := range tests {
+		progress, ok := parseMkfsProgress(test.fsType, test.line)
+		if ok != test.ok || progress != test.progress {
+			t.Errorf("%s %q: expected %v %v, got %v %v", test.fsType, test.line, test.progress, test.ok, progress, ok)
+		}
+	}
+}
+
+func TestRunWithProgress(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+
+	//mke2fs updates the progress in place with backspaces
+	lines := []string{}
+	err := runWithProgress(exec.Command("sh", "-c", `printf 'Writing inode tables: 1/4\b\b\b2/4\b\b\b4/4done\r\nok\n'`), func(line string) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Writing inode tables: 1/4", "2/4", "4/4done", "ok"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %q, got %q", expected, lines)
+	}
+
+	err = runWithProgress(exec.Command("sh", "-c", "echo 'no space left'; exit 1"), func(line string) {})
+	if err == nil || !strings.Contains(err.Error(), "no space left") {
+		t.Errorf("expected error with the command output, got %v", err)
+	}
+}
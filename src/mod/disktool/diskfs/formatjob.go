@@ -0,0 +1,274 @@
+package diskfs
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	formatjob.go
+
+	Formatting a large device (especially a full format) takes a long
+	time, the formatter runs mkfs in the background and tracks the
+	progress of each device as a job
+*/
+
+const (
+	FORMAT_JOB_RUNNING = "running"
+	FORMAT_JOB_DONE    = "done"
+	FORMAT_JOB_FAILED  = "failed"
+
+	maxFinishedFormatJobs = 20 //No. of finished jobs to keep
+)
+
+type FormatJob struct {
+	ID         string  `json:"id"`
+	Device     string  `json:"device"` //e.g. /dev/md0
+	FsType     string  `json:"fstype"`
+	Label      string  `json:"label"`
+	FullFormat bool    `json:"full_format"`
+	Status     string  `json:"status"`   //running, done or failed
+	Stage      string  `json:"stage"`    //zeroing or formatting
+	Progress   float64 `json:"progress"` //Progress of the stage in percent, -1 if unknown
+	UUID       string  `json:"uuid"`     //UUID of the new file system when done
+	Error      string  `json:"error"`
+	StartTime  int64   `json:"start_time"`
+	EndTime    int64   `json:"end_time"`
+}
+
+type Formatter struct {
+	OnProgress func(job *FormatJob) //Optional, called when the status, stage or progress of a job changed
+	jobs       []*FormatJob
+	mutex      sync.Mutex
+}
+
+func NewFormatter() *Formatter {
+	return &Formatter{
+		jobs: []*FormatJob{},
+	}
+}
+
+// Start validates the options and formats the device in the background
+func (f *Formatter) Start(devicePath string, options *FormatOptions) (*FormatJob, error) {
+	device, err := checkDeviceFormatable(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := buildMkfsArgs(device.Path, options); err != nil {
+		return nil, err
+	}
+	if !FormatPackageInstalled(options.FsType) {
+		return nil, errors.New("unable to format device as " + options.FsType + ": mkfs tool not installed")
+	}
+
+	f.mutex.Lock()
+	for _, job := range f.jobs {
+		if job.Device == device.Path && job.Status == FORMAT_JOB_RUNNING {
+			f.mutex.Unlock()
+			return nil, errors.New(device.Path + " is being formatted")
+		}
+	}
+	job := &FormatJob{
+		ID:         uuid.New().String(),
+		Device:     device.Path,
+		FsType:     normalizeFsType(options.FsType),
+		Label:      options.Label,
+		FullFormat: options.FullFormat,
+		Status:     FORMAT_JOB_RUNNING,
+		Progress:   -1,
+		StartTime:  time.Now().Unix(),
+	}
+	f.jobs = append(f.jobs, job)
+	f.pruneJobs()
+	f.mutex.Unlock()
+
+	log.Println("[diskfs] Formatting " + device.Path + " as " + job.FsType)
+	go func() {
+		newUUID, err := Format(device.Path, options, func(stage string, progress float64) {
+			f.updateJob(job, func() bool {
+				//Only report whole percent changes
+				if job.Stage == stage && math.Floor(job.Progress) == math.Floor(progress) {
+					return false
+				}
+				job.Stage = stage
+				job.Progress = progress
+				return true
+			})
+		})
+
+		f.updateJob(job, func() bool {
+			job.EndTime = time.Now().Unix()
+			if err != nil {
+				job.Status = FORMAT_JOB_FAILED
+				job.Error = err.Error()
+				log.Println("[diskfs] Format of " + job.Device + " failed: " + job.Error)
+				return true
+			}
+			job.Status = FORMAT_JOB_DONE
+			job.Progress = 100
+			job.UUID = newUUID
+			log.Println("[diskfs] " + job.Device + " formatted as " + job.FsType + ", UUID " + newUUID)
+			return true
+		})
+	}()
+
+	return f.copyJob(job), nil
+}
+
+// Get returns the job by ID
+func (f *Formatter) Get(id string) (*FormatJob, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, job := range f.jobs {
+		if job.ID == id {
+			thisJob := *job
+			return &thisJob, nil
+		}
+	}
+	return nil, errors.New("format job not found")
+}
+
+// List returns all running jobs and the recently finished jobs
+func (f *Formatter) List() []*FormatJob {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	results := []*FormatJob{}
+	for _, job := range f.jobs {
+		thisJob := *job
+		results = append(results, &thisJob)
+	}
+	return results
+}
+
+// updateJob applies the change to the job and notify the progress handler if changed
+func (f *Formatter) updateJob(job *FormatJob, change func() bool) {
+	f.mutex.Lock()
+	changed := change()
+	thisJob := *job
+	f.mutex.Unlock()
+
+	if changed && f.OnProgress != nil {
+		f.OnProgress(&thisJob)
+	}
+}
+
+func (f *Formatter) copyJob(job *FormatJob) *FormatJob {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	thisJob := *job
+	return &thisJob
+}
+
+// pruneJobs removes the oldest finished jobs, require the mutex to be locked
+func (f *Formatter) pruneJobs() {
+	finished := 0
+	for _, job := range f.jobs {
+		if job.Status != FORMAT_JOB_RUNNING {
+			finished++
+		}
+	}
+
+	results := []*FormatJob{}
+	for _, job := range f.jobs {
+		if job.Status != FORMAT_JOB_RUNNING && finished > maxFinishedFormatJobs {
+			finished--
+			continue
+		}
+		results = append(results, job)
+	}
+	f.jobs = results
+}
+
+/*
+	Handlers
+*/
+
+// HandleFormat formats a device in the background and returns the job, require dev and fstype,
+// label, blocksize, reserved (ext4), inoderatio (ext4), dataprofile (btrfs),
+// metadataprofile (btrfs) and full (bool) are optional
+func (f *Formatter) HandleFormat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	devName, err := utils.PostPara(r, "dev")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid device given")
+		return
+	}
+
+	fsType, err := utils.PostPara(r, "fstype")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid file system type given")
+		return
+	}
+
+	options := &FormatOptions{FsType: fsType}
+	options.Label, _ = utils.PostPara(r, "label")
+	options.DataProfile, _ = utils.PostPara(r, "dataprofile")
+	options.MetadataProfile, _ = utils.PostPara(r, "metadataprofile")
+	options.FullFormat, _ = utils.PostBool(r, "full")
+
+	for key, target := range map[string]*int{"blocksize": &options.BlockSize, "inoderatio": &options.InodeRatio} {
+		value, err := utils.PostPara(r, key)
+		if err != nil || value == "" {
+			continue
+		}
+		*target, err = strconv.Atoi(value)
+		if err != nil {
+			utils.SendErrorResponse(w, "invalid "+key+" given")
+			return
+		}
+	}
+	if value, err := utils.PostPara(r, "reserved"); err == nil && value != "" {
+		reserved, err := strconv.Atoi(value)
+		if err != nil {
+			utils.SendErrorResponse(w, "invalid reserved percentage given")
+			return
+		}
+		options.ReservedPercent = &reserved
+	}
+
+	job, err := f.Start(devName, options)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	js, _ := json.Marshal(job)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleListFormatJobs lists the format jobs, or returns a single job if id is given as a query parameter
+func (f *Formatter) HandleListFormatJobs(w http.ResponseWriter, r *http.Request) {
+	id, _ := utils.GetPara(r, "id")
+	if id != "" {
+		job, err := f.Get(id)
+		if err != nil {
+			utils.SendErrorResponse(w, err.Error())
+			return
+		}
+		js, _ := json.Marshal(job)
+		utils.SendJSONResponse(w, string(js))
+		return
+	}
+
+	js, _ := json.Marshal(f.List())
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleListSupportedFormats lists the file systems that can be created on this host
+func (f *Formatter) HandleListSupportedFormats(w http.ResponseWriter, r *http.Request) {
+	js, _ := json.Marshal(GetSupportedFormats())
+	utils.SendJSONResponse(w, string(js))
+}
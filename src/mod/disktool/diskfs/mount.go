@@ -0,0 +1,279 @@
+package diskfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	mount.go
+
+	Mount file systems by UUID or device path with options that
+	suit the file system, and unmount them after checking no process
+	is still using the mount point
+*/
+
+type MountOptions struct {
+	Device     string //Device name or path, e.g. md0 or /dev/sdb1, either Device or UUID is required
+	UUID       string //File system UUID, preferred over Device as device names can change after reboot
+	MountPoint string //Absolute path to mount to, e.g. /mnt/storage
+	FsType     string //Leave empty to use the file system detected on the device
+	Options    string //Options passed to mount -o, leave empty to use the defaults of the file system
+	ReadOnly   bool   //Mount as read only
+}
+
+// Paths that should never be used as mount point
+var protectedMountPoints = []string{"/", "/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/lib64", "/opt", "/proc", "/root", "/run", "/sbin", "/srv", "/sys", "/tmp", "/usr", "/var"}
+
+// System folders that should not be used as mount point, including the folders under them, e.g. /boot/firmware
+var protectedMountRoots = []string{"/bin", "/boot", "/dev", "/etc", "/lib", "/lib32", "/lib64", "/proc", "/root", "/sbin", "/sys", "/usr", "/var"}
+
+// GetDefaultMountOptions returns the mount options for the file system type.
+// vfat, exfat and ntfs have no unix permissions, the files are owned by this process
+// so the workers can write to them
+func GetDefaultMountOptions(fsType string) string {
+	switch fsType {
+	case "ext2", "ext3", "ext4", "xfs", "btrfs", "f2fs":
+		return "noatime"
+	case "vfat", "exfat":
+		return "uid=" + strconv.Itoa(os.Getuid()) + ",gid=" + strconv.Itoa(os.Getgid()) + ",umask=0002"
+	case "ntfs":
+		return "uid=" + strconv.Itoa(os.Getuid()) + ",gid=" + strconv.Itoa(os.Getgid()) + ",umask=0002,windows_names"
+	}
+	return ""
+}
+
+// Mount mounts the file system on the device given by UUID or device path
+func Mount(options *MountOptions) error {
+	var device *inventory.Device
+	var err error
+	if options.UUID != "" {
+		device, err = inventory.Default().GetByUUID(options.UUID)
+	} else if options.Device != "" {
+		device, err = inventory.Default().Get(options.Device)
+	} else {
+		return errors.New("device or uuid is required")
+	}
+	if err != nil {
+		return errors.New("target device not found")
+	}
+
+	if mountPoint := device.MountPoint(); mountPoint != "" {
+		return errors.New("device is already mounted at " + mountPoint)
+	}
+	if len(device.Holders) > 0 {
+		return errors.New("device is in use by " + strings.Join(device.Holders, ", "))
+	}
+
+	fsType := options.FsType
+	if fsType == "" {
+		fsType = device.FsType
+	}
+	if fsType == "" {
+		return errors.New("no file system found on device, format it first")
+	}
+
+	mountPoint, err := validateMountPoint(options.MountPoint)
+	if err != nil {
+		return err
+	}
+
+	mountOptions := options.Options
+	if mountOptions == "" {
+		mountOptions = GetDefaultMountOptions(fsType)
+	}
+	if options.ReadOnly {
+		mountOptions = strings.TrimSuffix("ro,"+mountOptions, ",")
+	}
+
+	if fsType == "ntfs" {
+		//Prefer the kernel driver if ntfs-3g is not installed
+		if utils.FileExists("/sbin/mount.ntfs-3g") || utils.FileExists("/usr/bin/ntfs-3g") {
+			fsType = "ntfs-3g"
+		} else {
+			fsType = "ntfs3"
+		}
+	}
+
+	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+		return fmt.Errorf("error creating mount point: %v", err)
+	}
+
+	args := []string{"mount", "-t", fsType}
+	if mountOptions != "" {
+		args = append(args, "-o", mountOptions)
+	}
+	args = append(args, device.Path, mountPoint)
+	output, err := exec.Command("sudo", args...).CombinedOutput()
+	inventory.Default().Invalidate()
+	if err != nil {
+		return fmt.Errorf("error mounting device: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Unmount unmounts the mount point (or device) after checking that no process is using it.
+// If force is set, the busy check is skipped and the file system is force unmounted
+func Unmount(target string, force bool) error {
+	mountPoint, err := ResolveMountPoint(target)
+	if err != nil {
+		return err
+	}
+	if err := checkUnmountable(mountPoint); err != nil {
+		return err
+	}
+
+	if !force {
+		handles, err := ListOpenHandles(mountPoint)
+		if err != nil {
+			return err
+		}
+		if len(handles) > 0 {
+			return &BusyError{MountPoint: mountPoint, Handles: handles}
+		}
+	}
+
+	defer inventory.Default().Invalidate()
+	if force {
+		return ForceUnmountDevice(mountPoint)
+	}
+
+	output, err := exec.Command("sudo", "umount", mountPoint).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error unmounting device: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// ResolveMountPoint returns the mount point of a device (e.g. md0, /dev/sdb1 or
+// the file system UUID) or the target itself if it is a mount point
+func ResolveMountPoint(target string) (string, error) {
+	if target == "" {
+		return "", errors.New("target is empty")
+	}
+
+	if !filepath.IsAbs(target) || strings.HasPrefix(target, "/dev/") {
+		//Device name, path or file system UUID
+		device, err := inventory.Default().Get(target)
+		if err != nil {
+			device, err = inventory.Default().GetByUUID(target)
+		}
+		if err != nil {
+			return "", errors.New("target device not found")
+		}
+		if device.MountPoint() == "" {
+			return "", errors.New("device is not mounted")
+		}
+		return device.MountPoint(), nil
+	}
+
+	mountPoints, err := getMountPoints()
+	if err != nil {
+		return "", err
+	}
+	target = filepath.Clean(target)
+	if _, ok := mountPoints[target]; !ok {
+		return "", errors.New("target is not a mount point")
+	}
+	return target, nil
+}
+
+// IsSystemMountPoint checks if the path is a system folder (e.g. / or /boot/firmware)
+// that must not be used as mount point or served to users
+func IsSystemMountPoint(mountPoint string) bool {
+	mountPoint = filepath.Clean(mountPoint)
+	if utils.StringInArray(protectedMountPoints, mountPoint) {
+		return true
+	}
+	for _, root := range protectedMountRoots {
+		if strings.HasPrefix(mountPoint, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUnmountable refuses to unmount system folders (e.g. / or /boot) and
+// file systems that are not on a block device, e.g. proc, sysfs or tmpfs
+func checkUnmountable(mountPoint string) error {
+	if IsSystemMountPoint(mountPoint) {
+		return errors.New(mountPoint + " is a system folder and cannot be unmounted")
+	}
+	mountPoints, err := getMountPoints()
+	if err != nil {
+		return err
+	}
+	if source, ok := mountPoints[mountPoint]; ok && !strings.HasPrefix(source, "/dev/") {
+		return errors.New(mountPoint + " is not mounted from a block device")
+	}
+	return nil
+}
+
+// validateMountPoint checks if the path can be used as a new mount point and returns the cleaned path
+func validateMountPoint(mountPoint string) (string, error) {
+	if mountPoint == "" || !filepath.IsAbs(mountPoint) {
+		return "", errors.New("mount point must be an absolute path")
+	}
+
+	mountPoint = filepath.Clean(mountPoint)
+	if utils.StringInArray(protectedMountPoints, mountPoint) {
+		return "", errors.New("mount point " + mountPoint + " is a system folder")
+	}
+
+	mountPoints, err := getMountPoints()
+	if err != nil {
+		return "", err
+	}
+	if source, ok := mountPoints[mountPoint]; ok {
+		return "", errors.New("mount point is already used by " + source)
+	}
+
+	if utils.FileExists(mountPoint) {
+		if !utils.IsDir(mountPoint) {
+			return "", errors.New("mount point is not a directory")
+		}
+		entries, err := os.ReadDir(mountPoint)
+		if err != nil {
+			return "", err
+		}
+		if len(entries) > 0 {
+			//Mounting on top of the files will hide them
+			return "", errors.New("mount point is not empty")
+		}
+	}
+	return mountPoint, nil
+}
+
+// getMountPoints returns the mount points in /proc/mounts and their sources
+func getMountPoints() (map[string]string, error) {
+	f, err := os.Open("/proc/mounts")
+	if err != nil {
+		return nil, fmt.Errorf("error opening /proc/mounts: %v", err)
+	}
+	defer f.Close()
+	return parseMountPoints(f), nil
+}
+
+// parseMountPoints parses the content of /proc/mounts to mount points and their sources
+func parseMountPoints(r io.Reader) map[string]string {
+	mountPoints := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		mountPoints[inventory.UnescapeMountPath(fields[1])] = inventory.UnescapeMountPath(fields[0])
+	}
+	return mountPoints
+}
@@ -0,0 +1,39 @@
+package diskfs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMountPoints(t *testing.T) {
+	content := "/dev/sda2 / ext4 rw,relatime 0 0\n" +
+		"proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0\n" +
+		"/dev/sdb1 /mnt/My\\040Photos exfat rw 0 0\n" +
+		"/dev/sdc1 /mnt/tab\\011new\\012line\\134slash ext4 rw 0 0\n" +
+		"tmpfs /mnt/ramdisk tmpfs rw 0 0\n"
+
+	mountPoints := parseMountPoints(strings.NewReader(content))
+	expected := map[string]string{
+		"/":                          "/dev/sda2",
+		"/proc":                      "proc",
+		"/mnt/My Photos":             "/dev/sdb1",
+		"/mnt/tab\tnew\nline\\slash": "/dev/sdc1",
+		"/mnt/ramdisk":               "tmpfs",
+	}
+	if len(mountPoints) != len(expected) {
+		t.Errorf("expected %d mount points, got %v", len(expected), mountPoints)
+	}
+	for mountPoint, source := range expected {
+		if mountPoints[mountPoint] != source {
+			t.Errorf("%q: expected source %s, got %q", mountPoint, source, mountPoints[mountPoint])
+		}
+	}
+}
+
+func TestCheckUnmountable(t *testing.T) {
+	for _, mountPoint := range []string{"/", "/boot", "/boot/efi", "/proc", "/sys", "/var/lib/docker"} {
+		if err := checkUnmountable(mountPoint); err == nil {
+			t.Errorf("expected %s to be refused", mountPoint)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package diskfs
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	mounttable.go
+
+	The mount table keeps the mounts made via bokoFS in a json file
+	under the config folder, so they are mounted again on startup
+	without touching /etc/fstab
+*/
+
+// MountEntry is a persistent mount in the mount table
+type MountEntry struct {
+	UUID       string `json:"uuid"`        //File system UUID, used to find the device on startup
+	Device     string `json:"device"`      //Device name when it was mounted, used if the UUID is empty
+	MountPoint string `json:"mount_point"` //e.g. /mnt/storage
+	FsType     string `json:"fstype"`      //e.g. ext4
+	Options    string `json:"options"`     //Options passed to mount -o, empty for defaults
+	ReadOnly   bool   `json:"read_only"`
+}
+
+// MountStatus is a mount entry with its current state
+type MountStatus struct {
+	*MountEntry
+	Mounted bool  `json:"mounted"`
+	Used    int64 `json:"used"`
+	Free    int64 `json:"free"`
+}
+
+type MountTable struct {
+	TableFile      string        //Path to the mount table, e.g. ./config/mounts.json
+	Entries        []*MountEntry //Persistent mounts
+	unmountChecker func(mountPoint string) error
+	mutex          sync.Mutex
+}
+
+// NewMountTable loads the mount table from file, an empty table is created if it does not exist
+func NewMountTable(tableFile string) (*MountTable, error) {
+	thisTable := MountTable{
+		TableFile: tableFile,
+		Entries:   []*MountEntry{},
+	}
+
+	if !utils.FileExists(tableFile) {
+		return &thisTable, thisTable.saveToFile()
+	}
+
+	content, err := os.ReadFile(tableFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &thisTable.Entries); err != nil {
+		return nil, errors.New("unable to parse mount table: " + err.Error())
+	}
+	return &thisTable, nil
+}
+
+// SetUnmountChecker sets a function to check if a mount point can be unmounted,
+// e.g. it is not served by a worker. It is skipped on force unmount
+func (t *MountTable) SetUnmountChecker(checker func(mountPoint string) error) {
+	t.unmountChecker = checker
+}
+
+// RestoreAll mounts all entries that are not mounted yet, failed entries are skipped with an error log
+func (t *MountTable) RestoreAll() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, entry := range t.Entries {
+		if isMountedAt(entry.MountPoint) {
+			continue
+		}
+
+		err := Mount(entry.mountOptions())
+		if err != nil {
+			log.Println("[diskfs] Unable to mount " + entry.MountPoint + ": " + err.Error())
+			continue
+		}
+		log.Println("[diskfs] Mounted " + entry.MountPoint)
+	}
+}
+
+// Mount mounts the device and add it to the mount table if persist is set
+func (t *MountTable) Mount(options *MountOptions, persist bool) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	err := Mount(options)
+	if err != nil {
+		return err
+	}
+	if !persist {
+		return nil
+	}
+
+	//Record the UUID so the entry still works if the device name changed
+	mountPoint := filepath.Clean(options.MountPoint)
+	entry := &MountEntry{
+		UUID:       options.UUID,
+		Device:     strings.TrimPrefix(options.Device, "/dev/"),
+		MountPoint: mountPoint,
+		FsType:     options.FsType,
+		Options:    options.Options,
+		ReadOnly:   options.ReadOnly,
+	}
+	for _, device := range listDevicesMountedAt(mountPoint) {
+		entry.UUID = device.UUID
+		entry.Device = device.Name
+		entry.FsType = device.FsType
+	}
+
+	t.removeEntry(mountPoint)
+	t.Entries = append(t.Entries, entry)
+	return t.saveToFile()
+}
+
+// Unmount unmounts the target (mount point, device or UUID) and remove it from the mount table
+func (t *MountTable) Unmount(target string, force bool) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	mountPoint, err := ResolveMountPoint(target)
+	if err != nil {
+		return err
+	}
+	if err := checkUnmountable(mountPoint); err != nil {
+		return err
+	}
+
+	if !force && t.unmountChecker != nil {
+		if err := t.unmountChecker(mountPoint); err != nil {
+			return err
+		}
+	}
+
+	if err := Unmount(mountPoint, force); err != nil {
+		return err
+	}
+
+	if t.removeEntry(mountPoint) {
+		return t.saveToFile()
+	}
+	return nil
+}
+
+// List returns the mount table entries and their current state
+func (t *MountTable) List() []*MountStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	results := []*MountStatus{}
+	for _, entry := range t.Entries {
+		thisEntry := *entry
+		status := &MountStatus{
+			MountEntry: &thisEntry,
+			Mounted:    isMountedAt(entry.MountPoint),
+		}
+		if status.Mounted {
+			status.Used, status.Free, _ = inventory.GetUsage(entry.MountPoint)
+		}
+		results = append(results, status)
+	}
+	return results
+}
+
+// removeEntry removes the entry of the mount point, return true if found
+func (t *MountTable) removeEntry(mountPoint string) bool {
+	for i, entry := range t.Entries {
+		if entry.MountPoint == mountPoint {
+			t.Entries = append(t.Entries[:i], t.Entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *MountTable) saveToFile() error {
+	js, err := json.MarshalIndent(t.Entries, "", " ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.TableFile, js, 0644)
+}
+
+func (entry *MountEntry) mountOptions() *MountOptions {
+	options := &MountOptions{
+		UUID:       entry.UUID,
+		MountPoint: entry.MountPoint,
+		FsType:     entry.FsType,
+		Options:    entry.Options,
+		ReadOnly:   entry.ReadOnly,
+	}
+	if options.UUID == "" {
+		options.Device = entry.Device
+	}
+	return options
+}
+
+// isMountedAt checks if a file system is mounted at the mount point
+func isMountedAt(mountPoint string) bool {
+	mountPoints, err := getMountPoints()
+	if err != nil {
+		return false
+	}
+	_, ok := mountPoints[filepath.Clean(mountPoint)]
+	return ok
+}
+
+// listDevicesMountedAt returns the block devices mounted at the mount point
+func listDevicesMountedAt(mountPoint string) []*inventory.Device {
+	devices, err := inventory.Default().List()
+	if err != nil {
+		return nil
+	}
+
+	results := []*inventory.Device{}
+	for _, device := range devices {
+		if utils.StringInArray(device.MountPoints, mountPoint) {
+			results = append(results, device)
+		}
+	}
+	return results
+}
+
+/*
+	Handlers
+*/
+
+// HandleListMounts list the mount table entries and their current state
+func (t *MountTable) HandleListMounts(w http.ResponseWriter, r *http.Request) {
+	js, _ := json.Marshal(t.List())
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleMount mount a device, require mountpoint and either dev (e.g. md0) or uuid,
+// fstype (Optional), options (Optional, mount -o options), readonly (Optional, bool)
+// and persist (Optional, bool, default true) to mount it again on startup
+func (t *MountTable) HandleMount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	devName, _ := utils.PostPara(r, "dev")
+	uuid, _ := utils.PostPara(r, "uuid")
+	if devName == "" && uuid == "" {
+		utils.SendErrorResponse(w, "dev or uuid is required")
+		return
+	}
+
+	mountPoint, err := utils.PostPara(r, "mountpoint")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid mount point given")
+		return
+	}
+
+	//Optional fields
+	fsType, _ := utils.PostPara(r, "fstype")
+	options, _ := utils.PostPara(r, "options")
+	readOnly, err := utils.PostBool(r, "readonly")
+	if err != nil {
+		readOnly = false
+	}
+	persist, err := utils.PostBool(r, "persist")
+	if err != nil {
+		persist = true
+	}
+
+	if strings.ContainsAny(options, " \t\n") {
+		utils.SendErrorResponse(w, "invalid mount options given")
+		return
+	}
+
+	err = t.Mount(&MountOptions{
+		Device:     devName,
+		UUID:       uuid,
+		MountPoint: mountPoint,
+		FsType:     fsType,
+		Options:    options,
+		ReadOnly:   readOnly,
+	}, persist)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	log.Println("[diskfs] " + devName + uuid + " mounted at " + mountPoint)
+	utils.SendOK(w)
+}
+
+// HandleUnmount unmount a device, require target (mount point, device or UUID)
+// and force (Optional, bool) to skip the busy check
+func (t *MountTable) HandleUnmount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	target, err := utils.PostPara(r, "target")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid target given")
+		return
+	}
+
+	force, err := utils.PostBool(r, "force")
+	if err != nil {
+		force = false
+	}
+
+	err = t.Unmount(target, force)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	log.Println("[diskfs] " + target + " unmounted")
+	utils.SendOK(w)
+}
+
+// HandleListOpenHandles list the processes using a mount point, require target (mount point, device or UUID)
+func (t *MountTable) HandleListOpenHandles(w http.ResponseWriter, r *http.Request) {
+	target, err := utils.GetPara(r, "target")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid target given")
+		return
+	}
+
+	mountPoint, err := ResolveMountPoint(target)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	handles, err := ListOpenHandles(mountPoint)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	js, _ := json.Marshal(handles)
+	utils.SendJSONResponse(w, string(js))
+}
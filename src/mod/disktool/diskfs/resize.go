@@ -0,0 +1,85 @@
+package diskfs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
+)
+
+/*
+	resize.go
+
+	Grow the file system to fill its device after the device
+	is expanded, e.g. a RAID array reshaped with more disks
+*/
+
+// ExpandFileSystem grows the file system on the device to the size of the device.
+// ext4 can be grown online or offline, xfs and btrfs must be mounted and f2fs must not
+func ExpandFileSystem(devicePath string) error {
+	inventory.Default().Invalidate()
+	device, err := inventory.Default().Get(devicePath)
+	if err != nil {
+		return errors.New("target device not found")
+	}
+
+	//udev might not have probed the device after it is resized
+	fsType := device.FsType
+	if probed, err := inventory.Probe(device.Path); err == nil && probed.FsType != "" {
+		fsType = probed.FsType
+	}
+
+	mountPoint := device.MountPoint()
+	args, err := buildExpandArgs(fsType, device.Path, mountPoint)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "resize2fs" && mountPoint == "" {
+		//resize2fs refuse to grow an unmounted file system that is not freshly checked
+		output, err := exec.Command("sudo", "e2fsck", "-f", "-p", device.Path).CombinedOutput()
+		var exitErr *exec.ExitError
+		if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+			//Exit code 1 means errors are corrected
+			return fmt.Errorf("file system check failed: %s", strings.TrimSpace(string(output)))
+		}
+	}
+
+	output, err := exec.Command("sudo", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("unable to expand file system: %s", strings.TrimSpace(string(output)))
+	}
+
+	log.Println("[diskfs] Expanded " + fsType + " file system on " + device.Path)
+	inventory.Default().Invalidate()
+	return nil
+}
+
+// buildExpandArgs returns the command line (without sudo) that grows the file system to fill its device
+func buildExpandArgs(fsType string, devicePath string, mountPoint string) ([]string, error) {
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		return []string{"resize2fs", devicePath}, nil
+	case "xfs":
+		if mountPoint == "" {
+			return nil, errors.New("xfs can only be expanded when mounted")
+		}
+		return []string{"xfs_growfs", mountPoint}, nil
+	case "btrfs":
+		if mountPoint == "" {
+			return nil, errors.New("btrfs can only be expanded when mounted")
+		}
+		return []string{"btrfs", "filesystem", "resize", "max", mountPoint}, nil
+	case "f2fs":
+		if mountPoint != "" {
+			return nil, errors.New("f2fs can only be expanded when unmounted")
+		}
+		return []string{"resize.f2fs", devicePath}, nil
+	case "":
+		return nil, errors.New("no file system found on device")
+	}
+	return nil, fmt.Errorf("expanding %s is not supported", fsType)
+}
@@ -0,0 +1,34 @@
+//go:build linux
+// +build linux
+
+package partition
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	ioctlBLKRRPART = 0x125F //Re-read partition table
+	ioctlBLKSSZGET = 0x1268 //Get logical sector size
+)
+
+// getSectorSize returns the logical sector size of the block device
+func getSectorSize(f *os.File) (int, error) {
+	var size int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ioctlBLKSSZGET, uintptr(unsafe.Pointer(&size)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(size), nil
+}
+
+// rereadPartitionTable asks the kernel to reload the partition table of the block device
+func rereadPartitionTable(f *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ioctlBLKRRPART, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package partition
+
+import (
+	"errors"
+	"os"
+)
+
+// getSectorSize returns the logical sector size of the block device
+func getSectorSize(f *os.File) (int, error) {
+	return 0, errors.New("platform not supported")
+}
+
+// rereadPartitionTable asks the kernel to reload the partition table of the block device
+func rereadPartitionTable(f *os.File) error {
+	return errors.New("platform not supported")
+}
@@ -0,0 +1,265 @@
+package partition
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+/*
+	disk.go
+
+	Open a block device or disk image and read or write
+	its partition table
+*/
+
+type disk struct {
+	path          string
+	file          *os.File
+	sectorSize    int
+	totalSectors  uint64
+	isBlockDevice bool
+}
+
+// openDisk opens the block device or image file, writable if readWrite is set
+func openDisk(path string, readWrite bool) (*disk, error) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/dev/" + path
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, errors.New(path + " is a directory")
+	}
+
+	flag := os.O_RDONLY
+	if readWrite {
+		flag = os.O_RDWR
+	}
+	f, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &disk{
+		path:          path,
+		file:          f,
+		sectorSize:    512,
+		isBlockDevice: info.Mode()&os.ModeDevice != 0,
+	}
+	if d.isBlockDevice {
+		if sectorSize, err := getSectorSize(f); err == nil && sectorSize >= 512 {
+			d.sectorSize = sectorSize
+		}
+	}
+
+	//Seek to the end works for both block devices and files
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	d.totalSectors = uint64(size) / uint64(d.sectorSize)
+
+	//Needs room for the GPT and at least one aligned partition
+	if uint64(size) < 2*ALIGNMENT_BYTES {
+		f.Close()
+		return nil, errors.New("disk is too small to be partitioned")
+	}
+	return d, nil
+}
+
+func (d *disk) readSectors(lba uint64, count int) ([]byte, error) {
+	buf := make([]byte, count*d.sectorSize)
+	_, err := d.file.ReadAt(buf, int64(lba)*int64(d.sectorSize))
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (d *disk) writeSectors(lba uint64, data []byte) error {
+	_, err := d.file.WriteAt(data, int64(lba)*int64(d.sectorSize))
+	return err
+}
+
+// readTable reads the GPT or MBR partition table
+func (d *disk) readTable() (*Table, error) {
+	sector, err := d.readSectors(0, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasBootSignature(sector) && !isProtectiveMBR(sector) {
+		return readMBR(d, sector)
+	}
+
+	//Protective MBR, or the MBR is missing / damaged but the GPT might still be valid
+	table, err := readGPT(d)
+	if err != nil && !hasBootSignature(sector) {
+		return nil, ErrNoPartitionTable
+	}
+	return table, err
+}
+
+// writeTable writes the table to disk and asks the kernel to reload it,
+// ErrRebootRequired is returned if the kernel cannot reload it
+func (d *disk) writeTable(table *Table) error {
+	var err error
+	switch table.Type {
+	case Table_GPT:
+		err = writeGPT(d, table)
+	case Table_MBR:
+		err = writeMBR(d, table)
+	default:
+		return errors.New("unsupported partition table type " + table.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+
+	if d.isBlockDevice {
+		if err := rereadPartitionTable(d.file); err != nil {
+			//The table is written, the kernel will pick it up after reboot
+			log.Println("[Partition] Unable to reload partition table of " + d.path + ": " + err.Error())
+			return fmt.Errorf("%w (%s)", ErrRebootRequired, err.Error())
+		}
+	}
+	return nil
+}
+
+// wipeTables clears the MBR and both GPT areas, so the old table cannot be detected
+func (d *disk) wipeTables() error {
+	entriesSectors := gptEntriesSectors(d.sectorSize)
+	empty := make([]byte, (2+entriesSectors)*uint64(d.sectorSize))
+
+	//Keep the boot code in the first sector
+	sector, err := d.readSectors(0, 1)
+	if err != nil {
+		return err
+	}
+	copy(empty, sector[:MBR_SIGNATURE_OFFSET])
+
+	if err := d.writeSectors(0, empty); err != nil {
+		return err
+	}
+	return d.writeSectors(d.totalSectors-1-entriesSectors, make([]byte, (1+entriesSectors)*uint64(d.sectorSize)))
+}
+
+func (d *disk) Close() error {
+	return d.file.Close()
+}
+
+/*
+	Public functions
+*/
+
+// ReadTable reads the partition table of the disk, e.g. sdb, /dev/sdb or an image file path
+func ReadTable(path string) (*Table, error) {
+	d, err := openDisk(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	return d.readTable()
+}
+
+// NewLabel creates an empty partition table of the type (gpt or dos) on the disk.
+// All existing partitions are removed
+func NewLabel(path string, tableType string) (*Table, error) {
+	if tableType == "mbr" || tableType == "msdos" {
+		tableType = Table_MBR
+	}
+
+	d, err := openDisk(path, true)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	var table *Table
+	switch tableType {
+	case Table_GPT:
+		table = newGPTTable(d)
+	case Table_MBR:
+		table = newMBRTable(d)
+	default:
+		return nil, errors.New("unsupported partition table type " + tableType)
+	}
+
+	if err := d.wipeTables(); err != nil {
+		return nil, err
+	}
+	if err := d.writeTable(table); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// AddPartition adds a partition to the disk and returns the new partition
+func AddPartition(path string, options *PartitionOptions) (*Partition, error) {
+	var partition *Partition
+	err := editTable(path, func(table *Table) error {
+		var err error
+		partition, err = table.Add(options)
+		return err
+	})
+	return partition, err
+}
+
+// DeletePartition removes the partition from the disk, the data is not erased
+func DeletePartition(path string, number int) error {
+	return editTable(path, func(table *Table) error {
+		return table.Delete(number)
+	})
+}
+
+// ResizePartition changes the size of the partition, 0 to grow it to the end of the free space
+func ResizePartition(path string, number int, size uint64) (*Partition, error) {
+	var partition *Partition
+	err := editTable(path, func(table *Table) error {
+		if err := table.Resize(number, size); err != nil {
+			return err
+		}
+		partition, _ = table.GetPartition(number)
+		return nil
+	})
+	return partition, err
+}
+
+// editTable reads the partition table, applies the change and writes it back
+func editTable(path string, change func(table *Table) error) error {
+	d, err := openDisk(path, true)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	table, err := d.readTable()
+	if err != nil {
+		return err
+	}
+
+	if table.Type == Table_GPT {
+		//The disk might be enlarged (e.g. a virtual disk), move the backup GPT to the end
+		lastUsable := newGPTTable(d).LastUsable
+		if lastUsable > table.LastUsable {
+			table.LastUsable = lastUsable
+		}
+	}
+
+	if err := change(table); err != nil {
+		return err
+	}
+	return d.writeTable(table)
+}
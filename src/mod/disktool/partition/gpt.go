@@ -0,0 +1,317 @@
+package partition
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+)
+
+/*
+	gpt.go
+
+	GUID Partition Table, see UEFI specification chapter 5.3
+
+	LBA 0                 Protective MBR
+	LBA 1                 Primary GPT header
+	LBA 2 - 33            Primary partition entries (for 512 bytes sectors)
+	...                   Partitions
+	LBA -33 - -2          Backup partition entries
+	LBA -1                Backup GPT header
+*/
+
+const (
+	GPT_ENTRY_COUNT = 128 //No. of partition entries
+	GPT_ENTRY_SIZE  = 128 //Size of a partition entry in bytes
+	GPT_NAME_LENGTH = 36  //Max length of the partition name in UTF-16 code units
+
+	gptSignature  = "EFI PART"
+	gptRevision   = 0x00010000
+	gptHeaderSize = 92
+)
+
+type gptHeader struct {
+	CurrentLBA  uint64
+	BackupLBA   uint64
+	FirstUsable uint64
+	LastUsable  uint64
+	DiskGUID    string
+	EntriesLBA  uint64
+	EntryCount  uint32
+	EntrySize   uint32
+	EntriesCRC  uint32
+}
+
+// readGPT reads the primary GPT, or the backup GPT if the primary one is corrupted
+func readGPT(d *disk) (*Table, error) {
+	header, err := readGPTHeader(d, 1)
+	if err != nil {
+		//Try the backup header at the end of the disk
+		backupHeader, backupErr := readGPTHeader(d, d.totalSectors-1)
+		if backupErr != nil {
+			return nil, err
+		}
+		header = backupHeader
+	}
+
+	table := &Table{
+		Type:         Table_GPT,
+		UUID:         header.DiskGUID,
+		SectorSize:   d.sectorSize,
+		TotalSectors: d.totalSectors,
+		FirstUsable:  header.FirstUsable,
+		LastUsable:   header.LastUsable,
+		Partitions:   []*Partition{},
+	}
+
+	entries, err := readGPTEntries(d, header)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(header.EntryCount); i++ {
+		entry := entries[i*int(header.EntrySize) : (i+1)*int(header.EntrySize)]
+		typeGUID := decodeGUID(entry[0:16])
+		if typeGUID == uuid.Nil.String() {
+			//Unused entry
+			continue
+		}
+
+		table.Partitions = append(table.Partitions, &Partition{
+			Number:     i + 1,
+			Type:       strings.ToUpper(typeGUID),
+			UUID:       decodeGUID(entry[16:32]),
+			Start:      binary.LittleEndian.Uint64(entry[32:40]),
+			End:        binary.LittleEndian.Uint64(entry[40:48]),
+			Attributes: binary.LittleEndian.Uint64(entry[48:56]),
+			Name:       decodeUTF16Name(entry[56:128]),
+		})
+	}
+	table.normalize()
+	return table, nil
+}
+
+// readGPTHeader reads and validates the GPT header at the given LBA
+func readGPTHeader(d *disk, lba uint64) (*gptHeader, error) {
+	buf, err := d.readSectors(lba, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(buf[0:8]) != gptSignature {
+		return nil, ErrNoPartitionTable
+	}
+
+	headerSize := binary.LittleEndian.Uint32(buf[12:16])
+	if headerSize < gptHeaderSize || int(headerSize) > len(buf) {
+		return nil, errors.New("invalid GPT header size")
+	}
+
+	//The CRC is calculated with the CRC field set to 0
+	headerCRC := binary.LittleEndian.Uint32(buf[16:20])
+	headerBytes := append([]byte{}, buf[:headerSize]...)
+	binary.LittleEndian.PutUint32(headerBytes[16:20], 0)
+	if crc32.ChecksumIEEE(headerBytes) != headerCRC {
+		return nil, errors.New("GPT header checksum mismatch")
+	}
+
+	header := &gptHeader{
+		CurrentLBA:  binary.LittleEndian.Uint64(buf[24:32]),
+		BackupLBA:   binary.LittleEndian.Uint64(buf[32:40]),
+		FirstUsable: binary.LittleEndian.Uint64(buf[40:48]),
+		LastUsable:  binary.LittleEndian.Uint64(buf[48:56]),
+		DiskGUID:    strings.ToUpper(decodeGUID(buf[56:72])),
+		EntriesLBA:  binary.LittleEndian.Uint64(buf[72:80]),
+		EntryCount:  binary.LittleEndian.Uint32(buf[80:84]),
+		EntrySize:   binary.LittleEndian.Uint32(buf[84:88]),
+		EntriesCRC:  binary.LittleEndian.Uint32(buf[88:92]),
+	}
+
+	if header.EntrySize < GPT_ENTRY_SIZE || header.EntrySize%8 != 0 || header.EntryCount == 0 || uint64(header.EntryCount)*uint64(header.EntrySize) > 1024*1024 {
+		return nil, errors.New("invalid GPT partition entry size or count")
+	}
+	if header.LastUsable >= d.totalSectors || header.FirstUsable > header.LastUsable {
+		return nil, errors.New("GPT usable area is out of the disk, the disk might be resized")
+	}
+	return header, nil
+}
+
+// readGPTEntries reads and validates the partition entries of the header
+func readGPTEntries(d *disk, header *gptHeader) ([]byte, error) {
+	entriesSize := int(header.EntryCount) * int(header.EntrySize)
+	sectors := (entriesSize + d.sectorSize - 1) / d.sectorSize
+	buf, err := d.readSectors(header.EntriesLBA, sectors)
+	if err != nil {
+		return nil, err
+	}
+	buf = buf[:entriesSize]
+	if crc32.ChecksumIEEE(buf) != header.EntriesCRC {
+		return nil, errors.New("GPT partition entries checksum mismatch")
+	}
+	return buf, nil
+}
+
+// newGPTTable creates an empty GPT covering the whole disk
+func newGPTTable(d *disk) *Table {
+	entriesSectors := gptEntriesSectors(d.sectorSize)
+	return &Table{
+		Type:         Table_GPT,
+		UUID:         newGUID(),
+		SectorSize:   d.sectorSize,
+		TotalSectors: d.totalSectors,
+		FirstUsable:  2 + entriesSectors,
+		LastUsable:   d.totalSectors - 2 - entriesSectors,
+		Partitions:   []*Partition{},
+	}
+}
+
+// writeGPT writes the protective MBR, primary and backup GPT
+func writeGPT(d *disk, table *Table) error {
+	entriesSectors := gptEntriesSectors(d.sectorSize)
+	if table.FirstUsable < 2+entriesSectors || table.LastUsable > d.totalSectors-2-entriesSectors {
+		return errors.New("GPT usable area overlaps with the partition entries")
+	}
+
+	//Partition entries
+	entries := make([]byte, entriesSectors*uint64(d.sectorSize))
+	for _, partition := range table.Partitions {
+		if partition.Number < 1 || partition.Number > GPT_ENTRY_COUNT {
+			return errors.New("invalid partition number")
+		}
+		entry := entries[(partition.Number-1)*GPT_ENTRY_SIZE : partition.Number*GPT_ENTRY_SIZE]
+		if err := encodeGUID(entry[0:16], partition.Type); err != nil {
+			return err
+		}
+		if err := encodeGUID(entry[16:32], partition.UUID); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(entry[32:40], partition.Start)
+		binary.LittleEndian.PutUint64(entry[40:48], partition.End)
+		binary.LittleEndian.PutUint64(entry[48:56], partition.Attributes)
+		name := encodeUTF16Name(partition.Name)
+		for i, c := range name {
+			if i >= GPT_NAME_LENGTH {
+				break
+			}
+			binary.LittleEndian.PutUint16(entry[56+i*2:], c)
+		}
+	}
+	entriesCRC := crc32.ChecksumIEEE(entries[:GPT_ENTRY_COUNT*GPT_ENTRY_SIZE])
+
+	lastLBA := d.totalSectors - 1
+	primary, err := encodeGPTHeader(d, table, 1, lastLBA, 2, entriesCRC)
+	if err != nil {
+		return err
+	}
+	backup, err := encodeGPTHeader(d, table, lastLBA, 1, lastLBA-entriesSectors, entriesCRC)
+	if err != nil {
+		return err
+	}
+
+	//Write the backup first, so an interrupted write still leaves a valid table
+	writes := []struct {
+		lba  uint64
+		data []byte
+	}{
+		{lastLBA - entriesSectors, entries},
+		{lastLBA, backup},
+		{0, encodeProtectiveMBR(d)},
+		{2, entries},
+		{1, primary},
+	}
+	for _, w := range writes {
+		if err := d.writeSectors(w.lba, w.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeGPTHeader(d *disk, table *Table, currentLBA uint64, backupLBA uint64, entriesLBA uint64, entriesCRC uint32) ([]byte, error) {
+	buf := make([]byte, d.sectorSize)
+	copy(buf[0:8], gptSignature)
+	binary.LittleEndian.PutUint32(buf[8:12], gptRevision)
+	binary.LittleEndian.PutUint32(buf[12:16], gptHeaderSize)
+	binary.LittleEndian.PutUint64(buf[24:32], currentLBA)
+	binary.LittleEndian.PutUint64(buf[32:40], backupLBA)
+	binary.LittleEndian.PutUint64(buf[40:48], table.FirstUsable)
+	binary.LittleEndian.PutUint64(buf[48:56], table.LastUsable)
+	if err := encodeGUID(buf[56:72], table.UUID); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint64(buf[72:80], entriesLBA)
+	binary.LittleEndian.PutUint32(buf[80:84], GPT_ENTRY_COUNT)
+	binary.LittleEndian.PutUint32(buf[84:88], GPT_ENTRY_SIZE)
+	binary.LittleEndian.PutUint32(buf[88:92], entriesCRC)
+	binary.LittleEndian.PutUint32(buf[16:20], crc32.ChecksumIEEE(buf[:gptHeaderSize]))
+	return buf, nil
+}
+
+// encodeProtectiveMBR returns the MBR with a single 0xEE partition covering the disk
+func encodeProtectiveMBR(d *disk) []byte {
+	buf := make([]byte, d.sectorSize)
+	size := d.totalSectors - 1
+	if size > MBR_MAX_SECTORS {
+		size = MBR_MAX_SECTORS
+	}
+	entry := buf[MBR_PARTITION_OFFSET : MBR_PARTITION_OFFSET+16]
+	copy(entry[1:4], []byte{0x00, 0x02, 0x00}) //CHS of LBA 1
+	entry[4] = 0xEE
+	copy(entry[5:8], []byte{0xFF, 0xFF, 0xFF})
+	binary.LittleEndian.PutUint32(entry[8:12], 1)
+	binary.LittleEndian.PutUint32(entry[12:16], uint32(size))
+	buf[510] = 0x55
+	buf[511] = 0xAA
+	return buf
+}
+
+// gptEntriesSectors returns the no. of sectors used by the partition entries
+func gptEntriesSectors(sectorSize int) uint64 {
+	return uint64((GPT_ENTRY_COUNT*GPT_ENTRY_SIZE + sectorSize - 1) / sectorSize)
+}
+
+// decodeGUID converts the mixed endian GUID on disk to string
+func decodeGUID(b []byte) string {
+	var guid uuid.UUID
+	guid[0], guid[1], guid[2], guid[3] = b[3], b[2], b[1], b[0]
+	guid[4], guid[5] = b[5], b[4]
+	guid[6], guid[7] = b[7], b[6]
+	copy(guid[8:], b[8:16])
+	return strings.ToUpper(guid.String())
+}
+
+// encodeGUID writes the GUID string to b in the mixed endian format
+func encodeGUID(b []byte, value string) error {
+	guid, err := uuid.Parse(value)
+	if err != nil {
+		return errors.New("invalid GUID " + value)
+	}
+	b[0], b[1], b[2], b[3] = guid[3], guid[2], guid[1], guid[0]
+	b[4], b[5] = guid[5], guid[4]
+	b[6], b[7] = guid[7], guid[6]
+	copy(b[8:16], guid[8:])
+	return nil
+}
+
+func newGUID() string {
+	return strings.ToUpper(uuid.New().String())
+}
+
+func encodeUTF16Name(name string) []uint16 {
+	return utf16.Encode([]rune(name))
+}
+
+func decodeUTF16Name(b []byte) string {
+	name := []uint16{}
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		name = append(name, c)
+	}
+	return string(bytes.TrimRight([]byte(string(utf16.Decode(name))), "\x00"))
+}
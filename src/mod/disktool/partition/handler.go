@@ -0,0 +1,336 @@
+package partition
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	handler.go
+
+	REST handlers of the partition editor. Only whole disks
+	(and loop devices) can be edited, and none of their partitions
+	can be mounted, used as swap or used by a RAID array while editing
+*/
+
+const procSwaps = "/proc/swaps"
+
+// TableInfo is the partition table with the free spaces on the disk
+type TableInfo struct {
+	Device     string       `json:"device"`
+	Table      *Table       `json:"table"`
+	FreeSpaces []*FreeSpace `json:"freespaces"`
+}
+
+// HandleListPartitions returns the partition table of a disk, require dev (e.g. sdb) as a query parameter
+func HandleListPartitions(w http.ResponseWriter, r *http.Request) {
+	devName, err := utils.GetPara(r, "dev")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid device given")
+		return
+	}
+
+	device, err := getEditableDisk(devName)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	table, err := ReadTable(device.Path)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	js, _ := json.Marshal(TableInfo{
+		Device:     device.Name,
+		Table:      table,
+		FreeSpaces: table.FreeSpaces(),
+	})
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleCreateLabel creates a new partition table, require dev and type (gpt or dos).
+// All partitions on the disk are removed
+func HandleCreateLabel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	device, ok := getUnusedDiskFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tableType, err := utils.PostPara(r, "type")
+	if err != nil {
+		tableType = Table_GPT
+	}
+
+	table, err := NewLabel(device.Path, tableType)
+	inventory.Default().Invalidate()
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	log.Println("[Partition] Created " + table.Type + " partition table on " + device.Path)
+	js, _ := json.Marshal(table)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleAddPartition adds a partition, require dev, size (Optional, bytes, default all free space),
+// start (Optional, bytes), type (Optional, e.g. linux, raid or a type GUID) and name (Optional, GPT only)
+func HandleAddPartition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	device, ok := getUnusedDiskFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	size, err := postBytes(r, "size")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid size given")
+		return
+	}
+	start, err := postBytes(r, "start")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid start given")
+		return
+	}
+	partitionType, _ := utils.PostPara(r, "type")
+	name, _ := utils.PostPara(r, "name")
+
+	partition, err := AddPartition(device.Path, &PartitionOptions{
+		Start: start,
+		Size:  size,
+		Type:  partitionType,
+		Name:  name,
+	})
+	inventory.Default().Invalidate()
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	log.Println("[Partition] Added partition " + strconv.Itoa(partition.Number) + " to " + device.Path)
+	js, _ := json.Marshal(partition)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleDeletePartition removes a partition, require dev and number
+func HandleDeletePartition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	device, ok := getUnusedDiskFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	number, err := utils.PostInt(r, "number")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid partition number given")
+		return
+	}
+
+	err = DeletePartition(device.Path, number)
+	inventory.Default().Invalidate()
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	log.Println("[Partition] Deleted partition " + strconv.Itoa(number) + " from " + device.Path)
+	utils.SendOK(w)
+}
+
+// HandleResizePartition changes the end of a partition, require dev, number,
+// size (Optional, bytes, default grow to the end of the free space after it) and
+// force (Optional, bool) to shrink a partition that holds a file system.
+// The file system on the partition is not resized
+func HandleResizePartition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	device, ok := getUnusedDiskFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	number, err := utils.PostInt(r, "number")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid partition number given")
+		return
+	}
+	size, err := postBytes(r, "size")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid size given")
+		return
+	}
+	force, err := utils.PostBool(r, "force")
+	if err != nil {
+		force = false
+	}
+
+	if !force {
+		if err := checkNotShrinkingFileSystem(device, number, size); err != nil {
+			utils.SendErrorResponse(w, err.Error())
+			return
+		}
+	}
+
+	partition, err := ResizePartition(device.Path, number, size)
+	inventory.Default().Invalidate()
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	log.Println("[Partition] Resized partition " + strconv.Itoa(number) + " on " + device.Path)
+	js, _ := json.Marshal(partition)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// getUnusedDiskFromRequest returns the disk in the dev post parameter, an error is
+// sent if it is not a disk or it is in use
+func getUnusedDiskFromRequest(w http.ResponseWriter, r *http.Request) (*inventory.Device, bool) {
+	devName, err := utils.PostPara(r, "dev")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid device given")
+		return nil, false
+	}
+
+	device, err := getEditableDisk(devName)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return nil, false
+	}
+
+	if err := checkDiskNotInUse(device); err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return nil, false
+	}
+	return device, true
+}
+
+// getEditableDisk returns the device if it is a disk or loop device
+func getEditableDisk(devName string) (*inventory.Device, error) {
+	device, err := inventory.Default().Get(devName)
+	if err != nil {
+		return nil, errors.New("device not found")
+	}
+	if device.Type != "disk" && device.Type != "loop" {
+		return nil, errors.New(device.Name + " is not a disk")
+	}
+	return device, nil
+}
+
+// checkDiskNotInUse checks that the disk and its partitions are not mounted, used as swap or used by other devices
+func checkDiskNotInUse(device *inventory.Device) error {
+	partitions, err := inventory.Default().Partitions(device.Name)
+	if err != nil {
+		return err
+	}
+	swaps, err := readSwapDevices(procSwaps)
+	if err != nil {
+		return err
+	}
+
+	for _, thisDevice := range append([]*inventory.Device{device}, partitions...) {
+		if thisDevice.MountPoint() != "" {
+			return errors.New(thisDevice.Name + " is mounted at " + thisDevice.MountPoint() + ", unmount it first")
+		}
+		if swaps[thisDevice.Name] {
+			return errors.New(thisDevice.Name + " is used as swap, run swapoff first")
+		}
+		if len(thisDevice.Holders) > 0 {
+			return errors.New(thisDevice.Name + " is in use by " + strings.Join(thisDevice.Holders, ", "))
+		}
+	}
+	if device.ReadOnly {
+		return errors.New(device.Name + " is read only")
+	}
+	return nil
+}
+
+// checkNotShrinkingFileSystem refuses to shrink a partition holding a file system,
+// as the file system is not resized and the data at its end will be cut off
+func checkNotShrinkingFileSystem(device *inventory.Device, number int, size uint64) error {
+	if size == 0 {
+		//Grow only
+		return nil
+	}
+	table, err := ReadTable(device.Path)
+	if err != nil {
+		return err
+	}
+	partition, err := table.GetPartition(number)
+	if err != nil {
+		return err
+	}
+	if size >= partition.Size {
+		return nil
+	}
+
+	partitions, err := inventory.Default().Partitions(device.Name)
+	if err != nil {
+		return err
+	}
+	for _, thisPartition := range partitions {
+		if thisPartition.PartitionNumber == number && thisPartition.FsType != "" {
+			return errors.New(thisPartition.Name + " has a " + thisPartition.FsType + " file system, shrink the file system first or set force to shrink the partition")
+		}
+	}
+	return nil
+}
+
+// readSwapDevices returns the name of the block devices (e.g. sda2) that are active
+// swap areas in /proc/swaps. Swap files are skipped as their file system is mounted
+func readSwapDevices(swapsFile string) (map[string]bool, error) {
+	content, err := os.ReadFile(swapsFile)
+	if os.IsNotExist(err) {
+		//Kernel without swap support
+		return map[string]bool{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	devices := map[string]bool{}
+	for i, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 2 || fields[1] != "partition" {
+			//Skip the header and swap files
+			continue
+		}
+		devices[filepath.Base(fields[0])] = true
+	}
+	return devices, nil
+}
+
+// postBytes reads an optional size in bytes from the post parameters, 0 if not given
+func postBytes(r *http.Request, key string) (uint64, error) {
+	value, err := utils.PostPara(r, key)
+	if err != nil || value == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
@@ -0,0 +1,176 @@
+package partition
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+	mbr.go
+
+	Master Boot Record, the first sector of the disk
+
+	0   - 439    Boot code
+	440 - 443    Disk signature
+	446 - 509    4 partition entries, 16 bytes each
+	510 - 511    Boot signature 0x55 0xAA
+*/
+
+const (
+	MBR_SIGNATURE_OFFSET = 440
+	MBR_PARTITION_OFFSET = 446
+	MBR_MAX_SECTORS      = 0xFFFFFFFF //LBA and size are 32 bits, 2 TiB for 512 bytes sectors
+
+	mbrTypeProtective = 0xEE
+)
+
+// hasBootSignature checks if the sector ends with 0x55AA and the partition entries look valid
+func hasBootSignature(sector []byte) bool {
+	if len(sector) < 512 || sector[510] != 0x55 || sector[511] != 0xAA {
+		return false
+	}
+
+	//A file system boot sector (e.g. FAT) also ends with 0x55AA, check the active flags
+	for i := 0; i < 4; i++ {
+		status := sector[MBR_PARTITION_OFFSET+i*16]
+		if status != 0x00 && status != 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// isProtectiveMBR checks if the MBR contains a GPT protective partition
+func isProtectiveMBR(sector []byte) bool {
+	for i := 0; i < 4; i++ {
+		if sector[MBR_PARTITION_OFFSET+i*16+4] == mbrTypeProtective {
+			return true
+		}
+	}
+	return false
+}
+
+// readMBR parses the MBR partition table in the first sector
+func readMBR(d *disk, sector []byte) (*Table, error) {
+	if !hasBootSignature(sector) {
+		return nil, ErrNoPartitionTable
+	}
+
+	table := newMBRTable(d)
+	table.UUID = fmt.Sprintf("0x%08x", binary.LittleEndian.Uint32(sector[MBR_SIGNATURE_OFFSET:]))
+	for i := 0; i < 4; i++ {
+		entry := sector[MBR_PARTITION_OFFSET+i*16 : MBR_PARTITION_OFFSET+(i+1)*16]
+		start := uint64(binary.LittleEndian.Uint32(entry[8:12]))
+		size := uint64(binary.LittleEndian.Uint32(entry[12:16]))
+		if entry[4] == 0 || size == 0 {
+			//Unused entry
+			continue
+		}
+
+		table.Partitions = append(table.Partitions, &Partition{
+			Number:   i + 1,
+			Start:    start,
+			End:      start + size - 1,
+			Type:     formatMBRType(entry[4]),
+			Bootable: entry[0] == 0x80,
+		})
+	}
+	table.normalize()
+	return table, nil
+}
+
+// newMBRTable creates an empty MBR table with a random disk signature
+func newMBRTable(d *disk) *Table {
+	lastUsable := d.totalSectors - 1
+	if lastUsable > MBR_MAX_SECTORS {
+		lastUsable = MBR_MAX_SECTORS
+	}
+
+	signature := make([]byte, 4)
+	rand.Read(signature)
+	return &Table{
+		Type:         Table_MBR,
+		UUID:         fmt.Sprintf("0x%08x", binary.LittleEndian.Uint32(signature)),
+		SectorSize:   d.sectorSize,
+		TotalSectors: d.totalSectors,
+		FirstUsable:  1,
+		LastUsable:   lastUsable,
+		Partitions:   []*Partition{},
+	}
+}
+
+// writeMBR writes the partition table to the first sector, the boot code is kept
+func writeMBR(d *disk, table *Table) error {
+	sector, err := d.readSectors(0, 1)
+	if err != nil {
+		return err
+	}
+
+	signature, err := strconv.ParseUint(strings.TrimPrefix(table.UUID, "0x"), 16, 32)
+	if err != nil {
+		return errors.New("invalid disk signature " + table.UUID)
+	}
+	binary.LittleEndian.PutUint32(sector[MBR_SIGNATURE_OFFSET:], uint32(signature))
+
+	//Clear all entries, then write the partitions to their slots
+	for i := MBR_PARTITION_OFFSET; i < 510; i++ {
+		sector[i] = 0
+	}
+	for _, partition := range table.Partitions {
+		if partition.Number < 1 || partition.Number > 4 {
+			return errors.New("invalid partition number")
+		}
+		if partition.End > MBR_MAX_SECTORS {
+			return errors.New("partition exceeds the 2 TiB limit of MBR, use GPT instead")
+		}
+		typeID, err := strconv.ParseUint(strings.TrimPrefix(partition.Type, "0x"), 16, 8)
+		if err != nil {
+			return errors.New("invalid partition type " + partition.Type)
+		}
+
+		entry := sector[MBR_PARTITION_OFFSET+(partition.Number-1)*16 : MBR_PARTITION_OFFSET+partition.Number*16]
+		if partition.Bootable {
+			entry[0] = 0x80
+		}
+		copy(entry[1:4], encodeCHS(partition.Start))
+		entry[4] = byte(typeID)
+		copy(entry[5:8], encodeCHS(partition.End))
+		binary.LittleEndian.PutUint32(entry[8:12], uint32(partition.Start))
+		binary.LittleEndian.PutUint32(entry[12:16], uint32(partition.End-partition.Start+1))
+	}
+	sector[510] = 0x55
+	sector[511] = 0xAA
+
+	return d.writeSectors(0, sector)
+}
+
+// encodeCHS converts the LBA to the legacy cylinder-head-sector address,
+// assuming 255 heads and 63 sectors per track. Addresses beyond the CHS limit are set to the max value
+func encodeCHS(lba uint64) []byte {
+	const heads, sectors = 255, 63
+	cylinder := lba / (heads * sectors)
+	if cylinder > 1023 {
+		return []byte{0xFE, 0xFF, 0xFF}
+	}
+	head := (lba / sectors) % heads
+	sector := lba%sectors + 1
+	return []byte{byte(head), byte(sector) | byte((cylinder>>2)&0xC0), byte(cylinder)}
+}
+
+// mbrPartitionUUID returns the PARTUUID of an MBR partition, e.g. 12345678-01
+func mbrPartitionUUID(diskSignature string, number int) string {
+	return fmt.Sprintf("%s-%02d", strings.TrimPrefix(diskSignature, "0x"), number)
+}
+
+// isExtendedType checks if the MBR type id is an extended partition
+func isExtendedType(typeID string) bool {
+	switch typeID {
+	case "0x05", "0x0f", "0x85":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,324 @@
+package partition
+
+import (
+	"errors"
+	"sort"
+)
+
+/*
+	Partition
+
+	Read and write GPT and MBR partition tables natively, without fdisk or parted.
+	The disk can be a block device (e.g. /dev/sdb) or a disk image file.
+
+	Partitions are aligned to 1 MiB. For MBR, only the 4 primary partitions
+	are supported, logical partitions inside an extended partition are
+	listed as the extended partition itself and cannot be edited
+*/
+
+const (
+	Table_GPT = "gpt"
+	Table_MBR = "dos" //Same name as udev ID_PART_TABLE_TYPE and lsblk
+
+	ALIGNMENT_BYTES = 1024 * 1024 //Partitions start and end on 1 MiB boundaries
+)
+
+var (
+	ErrNoPartitionTable   = errors.New("no partition table found")
+	ErrPartitionNotFound  = errors.New("partition not found")
+	ErrNoFreeSlot         = errors.New("partition table is full")
+	ErrNotEnoughFreeSpace = errors.New("not enough free space")
+	ErrExtendedPartition  = errors.New("extended partitions cannot be edited, the logical partitions inside would be lost")
+	ErrRebootRequired     = errors.New("partition table is written but the kernel is still using the old one, reboot to apply the change")
+)
+
+type Partition struct {
+	Number     int    `json:"number"`     //Partition number, e.g. 1 for sda1
+	Start      uint64 `json:"start"`      //First sector
+	End        uint64 `json:"end"`        //Last sector (inclusive)
+	Size       uint64 `json:"size"`       //Size in bytes
+	Type       string `json:"type"`       //Type GUID for GPT, hex type id for MBR, e.g. 0x83
+	TypeName   string `json:"typename"`   //Alias of the type if known, e.g. linux
+	UUID       string `json:"uuid"`       //Partition UUID (PARTUUID)
+	Name       string `json:"name"`       //Partition name, GPT only
+	Attributes uint64 `json:"attributes"` //GPT attribute flags
+	Bootable   bool   `json:"bootable"`   //MBR active flag
+}
+
+type Table struct {
+	Type         string       `json:"type"`         //gpt or dos
+	UUID         string       `json:"uuid"`         //Disk GUID for GPT, disk signature for MBR, e.g. 0x12345678
+	SectorSize   int          `json:"sectorsize"`   //Logical sector size in bytes
+	TotalSectors uint64       `json:"totalsectors"` //Size of the disk in sectors
+	FirstUsable  uint64       `json:"firstusable"`  //First sector that can be used by partitions
+	LastUsable   uint64       `json:"lastusable"`   //Last sector that can be used by partitions
+	Partitions   []*Partition `json:"partitions"`   //Sorted by partition number
+}
+
+type FreeSpace struct {
+	Start uint64 `json:"start"` //First sector, aligned
+	End   uint64 `json:"end"`   //Last sector
+	Size  uint64 `json:"size"`  //Size in bytes
+}
+
+// PartitionOptions defines the partition to add
+type PartitionOptions struct {
+	Start uint64 //Offset in bytes, 0 to use the first free space that fits
+	Size  uint64 //Size in bytes, rounded up to 1 MiB. 0 to use the largest free space
+	Type  string //Alias (e.g. linux, raid, efi), type GUID for GPT or hex type id for MBR. Default linux
+	Name  string //Partition name, GPT only
+}
+
+// MaxPartitions returns the number of partition slots in the table
+func (t *Table) MaxPartitions() int {
+	if t.Type == Table_GPT {
+		return GPT_ENTRY_COUNT
+	}
+	return 4
+}
+
+// GetPartition returns the partition by its number
+func (t *Table) GetPartition(number int) (*Partition, error) {
+	for _, partition := range t.Partitions {
+		if partition.Number == number {
+			return partition, nil
+		}
+	}
+	return nil, ErrPartitionNotFound
+}
+
+// alignment returns the alignment in sectors
+func (t *Table) alignment() uint64 {
+	alignment := uint64(ALIGNMENT_BYTES / t.SectorSize)
+	if alignment == 0 {
+		return 1
+	}
+	return alignment
+}
+
+func (t *Table) alignUp(sector uint64) uint64 {
+	alignment := t.alignment()
+	return (sector + alignment - 1) / alignment * alignment
+}
+
+func (t *Table) alignDown(sector uint64) uint64 {
+	alignment := t.alignment()
+	return sector / alignment * alignment
+}
+
+// FreeSpaces returns the unallocated regions of the disk, starting on aligned sectors
+func (t *Table) FreeSpaces() []*FreeSpace {
+	partitions := append([]*Partition{}, t.Partitions...)
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].Start < partitions[j].Start
+	})
+
+	results := []*FreeSpace{}
+	addRegion := func(start uint64, end uint64) {
+		start = t.alignUp(start)
+		if start > end || end-start+1 < t.alignment() {
+			//Too small to hold an aligned partition
+			return
+		}
+		results = append(results, &FreeSpace{
+			Start: start,
+			End:   end,
+			Size:  (end - start + 1) * uint64(t.SectorSize),
+		})
+	}
+
+	next := t.FirstUsable
+	for _, partition := range partitions {
+		if partition.Start > next {
+			addRegion(next, partition.Start-1)
+		}
+		if partition.End+1 > next {
+			next = partition.End + 1
+		}
+	}
+	if next <= t.LastUsable {
+		addRegion(next, t.LastUsable)
+	}
+	return results
+}
+
+// Add adds a partition to the table, the table has to be written to disk with Write
+func (t *Table) Add(options *PartitionOptions) (*Partition, error) {
+	number := t.nextFreeNumber()
+	if number == 0 {
+		return nil, ErrNoFreeSlot
+	}
+
+	typeID, err := resolveType(t.Type, options.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	sectorSize := uint64(t.SectorSize)
+	sectors := t.alignUp((options.Size + sectorSize - 1) / sectorSize)
+
+	//Find the free space to place the partition
+	var target *FreeSpace
+	var start uint64
+	spaces := t.FreeSpaces()
+	if options.Start > 0 {
+		start = t.alignUp(options.Start / sectorSize)
+		for _, space := range spaces {
+			if start >= space.Start && start <= space.End {
+				target = space
+				break
+			}
+		}
+	} else if sectors == 0 {
+		//Use the largest free space
+		for _, space := range spaces {
+			if target == nil || space.Size > target.Size {
+				target = space
+			}
+		}
+	} else {
+		//Use the first free space that fits
+		for _, space := range spaces {
+			if space.End-space.Start+1 >= sectors {
+				target = space
+				break
+			}
+		}
+	}
+	if target == nil {
+		return nil, ErrNotEnoughFreeSpace
+	}
+	if options.Start == 0 {
+		start = target.Start
+	}
+
+	var end uint64
+	if sectors == 0 {
+		end = t.partitionEnd(start, target.End)
+	} else {
+		end = start + sectors - 1
+	}
+	if end < start || end > target.End {
+		return nil, ErrNotEnoughFreeSpace
+	}
+
+	partition := &Partition{
+		Number: number,
+		Start:  start,
+		End:    end,
+		Type:   typeID,
+	}
+
+	if t.Type == Table_GPT {
+		if len(encodeUTF16Name(options.Name)) > GPT_NAME_LENGTH {
+			return nil, errors.New("partition name is too long")
+		}
+		partition.Name = options.Name
+		partition.UUID = newGUID()
+	}
+
+	t.Partitions = append(t.Partitions, partition)
+	t.normalize()
+	return partition, nil
+}
+
+// Delete removes a partition from the table
+func (t *Table) Delete(number int) error {
+	for i, partition := range t.Partitions {
+		if partition.Number == number {
+			if t.isExtended(partition) {
+				return ErrExtendedPartition
+			}
+			t.Partitions = append(t.Partitions[:i], t.Partitions[i+1:]...)
+			return nil
+		}
+	}
+	return ErrPartitionNotFound
+}
+
+// Resize changes the end of a partition, the start is not changed.
+// Set size to 0 to grow the partition to the end of the free space after it.
+// The file system on the partition is not resized
+func (t *Table) Resize(number int, size uint64) error {
+	partition, err := t.GetPartition(number)
+	if err != nil {
+		return err
+	}
+	if t.isExtended(partition) {
+		return ErrExtendedPartition
+	}
+
+	//The partition can grow until the next partition or the end of the usable area
+	limit := t.LastUsable
+	for _, other := range t.Partitions {
+		if other.Start > partition.Start && other.Start-1 < limit {
+			limit = other.Start - 1
+		}
+	}
+
+	var end uint64
+	if size == 0 {
+		end = t.partitionEnd(partition.Start, limit)
+		if end < partition.End {
+			//Already larger than the aligned size
+			end = partition.End
+		}
+	} else {
+		sectorSize := uint64(t.SectorSize)
+		sectors := t.alignUp((size + sectorSize - 1) / sectorSize)
+		end = partition.Start + sectors - 1
+		if end > limit {
+			return ErrNotEnoughFreeSpace
+		}
+	}
+
+	partition.End = end
+	t.normalize()
+	return nil
+}
+
+// isExtended checks if the partition is a MBR extended partition holding logical partitions
+func (t *Table) isExtended(partition *Partition) bool {
+	return t.Type == Table_MBR && isExtendedType(partition.Type)
+}
+
+// partitionEnd returns the last sector of a partition starting at start that fills
+// the space until limit, the end is aligned unless it is at the end of the disk
+func (t *Table) partitionEnd(start uint64, limit uint64) uint64 {
+	if limit == t.LastUsable {
+		return limit
+	}
+	alignedEnd := t.alignDown(limit + 1)
+	if alignedEnd <= start {
+		return limit
+	}
+	return alignedEnd - 1
+}
+
+// nextFreeNumber returns the smallest unused partition number, 0 if the table is full
+func (t *Table) nextFreeNumber() int {
+	used := map[int]bool{}
+	for _, partition := range t.Partitions {
+		used[partition.Number] = true
+	}
+	for number := 1; number <= t.MaxPartitions(); number++ {
+		if !used[number] {
+			return number
+		}
+	}
+	return 0
+}
+
+// normalize sorts the partitions and fill in the derived fields
+func (t *Table) normalize() {
+	sort.Slice(t.Partitions, func(i, j int) bool {
+		return t.Partitions[i].Number < t.Partitions[j].Number
+	})
+	for _, partition := range t.Partitions {
+		partition.Size = (partition.End - partition.Start + 1) * uint64(t.SectorSize)
+		partition.TypeName = typeName(t.Type, partition.Type)
+		if t.Type == Table_MBR {
+			partition.UUID = mbrPartitionUUID(t.UUID, partition.Number)
+		}
+	}
+}
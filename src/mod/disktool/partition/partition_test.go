@@ -0,0 +1,279 @@
+package partition
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testImageSize = 64 * 1024 * 1024
+
+func newTestImage(t *testing.T) string {
+	t.Helper()
+	imagePath := filepath.Join(t.TempDir(), "disk.img")
+	f, err := os.Create(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Truncate(testImageSize); err != nil {
+		t.Fatal(err)
+	}
+	return imagePath
+}
+
+func TestNoPartitionTable(t *testing.T) {
+	imagePath := newTestImage(t)
+	if _, err := ReadTable(imagePath); err != ErrNoPartitionTable {
+		t.Fatalf("expected ErrNoPartitionTable, got %v", err)
+	}
+}
+
+func TestGPT(t *testing.T) {
+	imagePath := newTestImage(t)
+	label, err := NewLabel(imagePath, Table_GPT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totalSectors := uint64(testImageSize / 512)
+	if label.FirstUsable != 34 || label.LastUsable != totalSectors-34 {
+		t.Errorf("unexpected usable area %d - %d", label.FirstUsable, label.LastUsable)
+	}
+
+	first, err := AddPartition(imagePath, &PartitionOptions{Size: 16 * 1024 * 1024, Type: "efi", Name: "EFI system"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Number != 1 || first.Start != 2048 || first.End != 2048+32768-1 {
+		t.Errorf("unexpected partition 1: %+v", first)
+	}
+
+	//Not a multiple of 1 MiB, rounded up
+	second, err := AddPartition(imagePath, &PartitionOptions{Size: 10*1024*1024 + 1, Type: "raid", Name: "data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Start != first.End+1 || second.Size != 11*1024*1024 {
+		t.Errorf("unexpected partition 2: %+v", second)
+	}
+
+	table, err := ReadTable(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Type != Table_GPT || table.UUID != label.UUID || len(table.Partitions) != 2 {
+		t.Fatalf("unexpected table: %+v", table)
+	}
+	partition, _ := table.GetPartition(1)
+	if partition.Type != "C12A7328-F81F-11D2-BA4B-00A0C93EC93B" || partition.TypeName != "efi" || partition.Name != "EFI system" || partition.UUID != first.UUID {
+		t.Errorf("unexpected partition read back: %+v", partition)
+	}
+	partition, _ = table.GetPartition(2)
+	if partition.TypeName != "raid" || partition.Name != "data" {
+		t.Errorf("unexpected partition read back: %+v", partition)
+	}
+
+	//The rest of the disk, ending at the last usable sector
+	third, err := AddPartition(imagePath, &PartitionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Number != 3 || third.Start != second.End+1 || third.End != totalSectors-34 {
+		t.Errorf("unexpected partition 3: %+v", third)
+	}
+	if _, err := AddPartition(imagePath, &PartitionOptions{}); err != ErrNotEnoughFreeSpace {
+		t.Errorf("expected ErrNotEnoughFreeSpace, got %v", err)
+	}
+
+	//Delete the middle partition, the number is reused
+	if err := DeletePartition(imagePath, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeletePartition(imagePath, 2); err != ErrPartitionNotFound {
+		t.Errorf("expected ErrPartitionNotFound, got %v", err)
+	}
+	table, _ = ReadTable(imagePath)
+	spaces := table.FreeSpaces()
+	if len(spaces) != 1 || spaces[0].Start != second.Start || spaces[0].End != second.End {
+		t.Fatalf("unexpected free spaces: %+v", spaces)
+	}
+
+	small, err := AddPartition(imagePath, &PartitionOptions{Size: 4 * 1024 * 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if small.Number != 2 || small.Start != second.Start || small.TypeName != "linux" {
+		t.Errorf("unexpected partition: %+v", small)
+	}
+}
+
+func TestResize(t *testing.T) {
+	imagePath := newTestImage(t)
+	if _, err := NewLabel(imagePath, Table_GPT); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := AddPartition(imagePath, &PartitionOptions{Size: 8 * 1024 * 1024})
+	second, _ := AddPartition(imagePath, &PartitionOptions{Start: 32 * 1024 * 1024, Size: 8 * 1024 * 1024})
+	if second.Start != 65536 {
+		t.Fatalf("unexpected partition 2: %+v", second)
+	}
+
+	//Grow until the next partition
+	resized, err := ResizePartition(imagePath, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resized.Start != first.Start || resized.End != second.Start-1 {
+		t.Errorf("unexpected resized partition: %+v", resized)
+	}
+
+	if _, err := ResizePartition(imagePath, 1, 64*1024*1024); err != ErrNotEnoughFreeSpace {
+		t.Errorf("expected ErrNotEnoughFreeSpace, got %v", err)
+	}
+
+	resized, err = ResizePartition(imagePath, 1, 4*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resized.Size != 4*1024*1024 {
+		t.Errorf("unexpected resized partition: %+v", resized)
+	}
+}
+
+func TestGPTBackupRecovery(t *testing.T) {
+	imagePath := newTestImage(t)
+	if _, err := NewLabel(imagePath, Table_GPT); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddPartition(imagePath, &PartitionOptions{Size: 8 * 1024 * 1024, Name: "keep"}); err != nil {
+		t.Fatal(err)
+	}
+
+	//Corrupt the primary GPT header
+	f, err := os.OpenFile(imagePath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt(make([]byte, 512), 512)
+	f.Close()
+
+	table, err := ReadTable(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.Partitions) != 1 || table.Partitions[0].Name != "keep" {
+		t.Fatalf("unexpected table from backup header: %+v", table)
+	}
+
+	//Writing the table restores the primary header
+	if _, err := AddPartition(imagePath, &PartitionOptions{Size: 8 * 1024 * 1024}); err != nil {
+		t.Fatal(err)
+	}
+	d, _ := openDisk(imagePath, false)
+	defer d.Close()
+	if _, err := readGPTHeader(d, 1); err != nil {
+		t.Errorf("primary header not restored: %v", err)
+	}
+}
+
+func TestMBR(t *testing.T) {
+	imagePath := newTestImage(t)
+	label, err := NewLabel(imagePath, "msdos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label.Type != Table_MBR {
+		t.Fatalf("unexpected table type %s", label.Type)
+	}
+
+	if _, err := AddPartition(imagePath, &PartitionOptions{Size: 8 * 1024 * 1024, Type: "bios"}); err == nil {
+		t.Errorf("expected bios boot partition to be rejected on MBR")
+	}
+	for i := 0; i < 4; i++ {
+		partition, err := AddPartition(imagePath, &PartitionOptions{Size: 8 * 1024 * 1024, Type: "0xfd"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if partition.Start != uint64(2048+i*16384) {
+			t.Errorf("unexpected partition %d: %+v", i+1, partition)
+		}
+	}
+	if _, err := AddPartition(imagePath, &PartitionOptions{Size: 8 * 1024 * 1024}); err != ErrNoFreeSlot {
+		t.Errorf("expected ErrNoFreeSlot, got %v", err)
+	}
+
+	table, err := ReadTable(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Type != Table_MBR || table.UUID != label.UUID || len(table.Partitions) != 4 {
+		t.Fatalf("unexpected table: %+v", table)
+	}
+	partition := table.Partitions[2]
+	if partition.Number != 3 || partition.Type != "0xfd" || partition.TypeName != "raid" || partition.UUID != label.UUID[2:]+"-03" {
+		t.Errorf("unexpected partition: %+v", partition)
+	}
+
+	//Relabel as GPT, the MBR partitions are gone
+	if _, err := NewLabel(imagePath, Table_GPT); err != nil {
+		t.Fatal(err)
+	}
+	table, err = ReadTable(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Type != Table_GPT || len(table.Partitions) != 0 {
+		t.Errorf("unexpected table after relabel: %+v", table)
+	}
+}
+
+func TestReadSwapDevices(t *testing.T) {
+	swapsFile := filepath.Join(t.TempDir(), "swaps")
+	content := "Filename\t\t\t\tType\t\tSize\t\tUsed\t\tPriority\n" +
+		"/dev/sdb2                               partition\t2097148\t\t0\t\t-2\n" +
+		"/dev/nvme0n1p3                          partition\t8388604\t\t1024\t\t-3\n" +
+		"/swapfile                               file\t\t1048572\t\t0\t\t-4\n"
+	if err := os.WriteFile(swapsFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	swaps, err := readSwapDevices(swapsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(swaps) != 2 || !swaps["sdb2"] || !swaps["nvme0n1p3"] {
+		t.Errorf("expected sdb2 and nvme0n1p3, got %v", swaps)
+	}
+
+	if swaps, err := readSwapDevices(filepath.Join(t.TempDir(), "missing")); err != nil || len(swaps) != 0 {
+		t.Errorf("expected no swap devices without /proc/swaps, got %v (%v)", swaps, err)
+	}
+}
+
+func TestExtendedPartitionNotEditable(t *testing.T) {
+	for _, typeID := range []string{"0x05", "0x0f", "0x85"} {
+		table := &Table{
+			Type:        Table_MBR,
+			SectorSize:  512,
+			FirstUsable: 2048,
+			LastUsable:  131071,
+			Partitions: []*Partition{
+				{Number: 1, Start: 2048, End: 18431, Type: "0x83"},
+				{Number: 2, Start: 18432, End: 67583, Type: typeID},
+			},
+		}
+		if err := table.Delete(2); err != ErrExtendedPartition {
+			t.Errorf("%s: expected ErrExtendedPartition on delete, got %v", typeID, err)
+		}
+		if err := table.Resize(2, 8*1024*1024); err != ErrExtendedPartition {
+			t.Errorf("%s: expected ErrExtendedPartition on resize, got %v", typeID, err)
+		}
+		if len(table.Partitions) != 2 || table.Partitions[1].End != 67583 {
+			t.Errorf("%s: extended partition changed: %+v", typeID, table.Partitions[1])
+		}
+		if err := table.Delete(1); err != nil {
+			t.Errorf("%s: expected primary partition to be deleted, got %v", typeID, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package partition
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+/*
+	types.go
+
+	Partition type aliases, so the API users do not need to
+	remember the type GUIDs and MBR type ids
+*/
+
+type partitionType struct {
+	Alias string
+	GUID  string //GPT partition type GUID
+	MBRID byte   //MBR partition type id
+}
+
+var knownPartitionTypes = []*partitionType{
+	{Alias: "linux", GUID: "0FC63DAF-8483-4772-8E79-3D69D8477DE4", MBRID: 0x83},
+	{Alias: "raid", GUID: "A19D880F-05FC-4D3B-A006-743F0F84911E", MBRID: 0xFD},
+	{Alias: "lvm", GUID: "E6D6D379-F507-44C2-A23C-238F2A3DF928", MBRID: 0x8E},
+	{Alias: "swap", GUID: "0657FD6D-A4AB-43C4-84E5-0933C84B4F4F", MBRID: 0x82},
+	{Alias: "efi", GUID: "C12A7328-F81F-11D2-BA4B-00A0C93EC93B", MBRID: 0xEF},
+	{Alias: "msdata", GUID: "EBD0A0A2-B9E5-4433-87C0-68B6B72699C7", MBRID: 0x07},
+	{Alias: "bios", GUID: "21686148-6449-6E6F-744E-656564454649"},
+}
+
+// resolveType returns the type GUID (GPT) or hex type id (MBR) of an alias, GUID or hex id
+func resolveType(tableType string, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		value = "linux"
+	}
+
+	for _, knownType := range knownPartitionTypes {
+		if strings.EqualFold(knownType.Alias, value) {
+			if tableType == Table_GPT {
+				return knownType.GUID, nil
+			}
+			if knownType.MBRID == 0 {
+				return "", errors.New("partition type " + value + " is not supported by MBR")
+			}
+			return formatMBRType(knownType.MBRID), nil
+		}
+	}
+
+	if tableType == Table_GPT {
+		guid, err := uuid.Parse(value)
+		if err != nil {
+			return "", errors.New("invalid partition type given")
+		}
+		return strings.ToUpper(guid.String()), nil
+	}
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(value), "0x"), 16, 8)
+	if err != nil || id == 0 {
+		return "", errors.New("invalid partition type given")
+	}
+	return formatMBRType(byte(id)), nil
+}
+
+// typeName returns the alias of a type GUID or MBR type id, empty if unknown
+func typeName(tableType string, typeID string) string {
+	for _, knownType := range knownPartitionTypes {
+		if tableType == Table_GPT && strings.EqualFold(knownType.GUID, typeID) {
+			return knownType.Alias
+		}
+		if tableType == Table_MBR && knownType.MBRID != 0 && formatMBRType(knownType.MBRID) == typeID {
+			return knownType.Alias
+		}
+	}
+	if tableType == Table_MBR && isExtendedType(typeID) {
+		return "extended"
+	}
+	return ""
+}
+
+func formatMBRType(id byte) string {
+	return fmt.Sprintf("0x%02x", id)
+}
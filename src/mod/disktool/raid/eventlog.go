@@ -0,0 +1,163 @@
+package raid
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/*
+	eventlog.go
+
+	The event log keeps the RAID events raised by the monitor in a JSON lines
+	file so the history of an array survives a restart. Only the latest
+	events are kept in memory for the API, and the file is compacted to
+	the events in memory on load or when it grows over twice that size
+*/
+
+const DEFAULT_EVENT_LOG_SIZE = 500
+
+type EventLog struct {
+	path        string
+	maxEntries  int
+	events      []*Event
+	fileEntries int //No. of lines in the log file, including broken ones
+	mutex       sync.RWMutex
+}
+
+// NewEventLog opens the event log at the given path and loads the latest events from it
+func NewEventLog(path string, maxEntries int) (*EventLog, error) {
+	if maxEntries <= 0 {
+		maxEntries = DEFAULT_EVENT_LOG_SIZE
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	eventLog := &EventLog{
+		path:       path,
+		maxEntries: maxEntries,
+		events:     []*Event{},
+	}
+
+	if err := eventLog.load(); err != nil {
+		return nil, err
+	}
+	if eventLog.fileEntries > maxEntries {
+		if err := eventLog.compact(); err != nil {
+			return nil, err
+		}
+	}
+	return eventLog, nil
+}
+
+// load reads the events from the log file, keeping the latest maxEntries
+func (l *EventLog) load() error {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		l.fileEntries++
+		event := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			//Skip broken lines, e.g. half written line on power loss
+			continue
+		}
+		l.events = append(l.events, event)
+		if len(l.events) > l.maxEntries {
+			l.events = l.events[1:]
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the log file with the events in memory. The events are written
+// to a temp file first so a crash during compaction will not lose the log
+func (l *EventLog) compact() error {
+	tmpFile := l.path + ".tmp"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, event := range l.events {
+		js, err := json.Marshal(event)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(js, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, l.path); err != nil {
+		return err
+	}
+	l.fileEntries = len(l.events)
+	return nil
+}
+
+// Append writes an event to the log file
+func (l *EventLog) Append(event *Event) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.events = append(l.events, event)
+	if len(l.events) > l.maxEntries {
+		l.events = l.events[len(l.events)-l.maxEntries:]
+	}
+
+	if l.fileEntries >= 2*l.maxEntries {
+		//The new event is already in memory, so it is written by the compaction
+		return l.compact()
+	}
+
+	js, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(js, '\n')); err != nil {
+		return err
+	}
+	l.fileEntries++
+	return nil
+}
+
+// List returns the latest events in time order, optionally filtered by device name (e.g. md0).
+// Set limit to 0 to return all events in memory
+func (l *EventLog) List(deviceName string, limit int) []*Event {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	results := []*Event{}
+	for _, event := range l.events {
+		if deviceName != "" && event.DeviceName != deviceName {
+			continue
+		}
+		results = append(results, event)
+	}
+
+	if limit > 0 && len(results) > limit {
+		results = results[len(results)-limit:]
+	}
+	return results
+}
@@ -21,6 +21,10 @@ import (
 
 // Handle remove a member disk (sdX) from RAID volume (mdX)
 func (m *Manager) HandleRemoveDiskFromRAIDVol(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	//mdadm --remove /dev/md0 /dev/sdb1
 	mdDev, err := utils.PostPara(r, "raidDev")
 	if err != nil {
@@ -77,6 +81,10 @@ func (m *Manager) HandleRemoveDiskFromRAIDVol(w http.ResponseWriter, r *http.Req
 
 // Handle adding a disk (mdX) to RAID volume (mdX)
 func (m *Manager) HandleAddDiskToRAIDVol(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	//mdadm --add /dev/md0 /dev/sdb1
 	mdDev, err := utils.PostPara(r, "raidDev")
 	if err != nil {
@@ -111,6 +119,7 @@ func (m *Manager) HandleAddDiskToRAIDVol(w http.ResponseWriter, r *http.Request)
 	diskUsedByAnotherRAID, err := m.DiskIsUsedInAnotherRAIDVol(sdXDev)
 	if err != nil {
 		utils.SendErrorResponse(w, err.Error())
+		return
 	}
 
 	if diskUsedByAnotherRAID {
@@ -121,6 +130,7 @@ func (m *Manager) HandleAddDiskToRAIDVol(w http.ResponseWriter, r *http.Request)
 	isOSDisk, err := m.DiskIsRoot(sdXDev)
 	if err != nil {
 		utils.SendErrorResponse(w, err.Error())
+		return
 	}
 
 	if isOSDisk {
@@ -128,11 +138,13 @@ func (m *Manager) HandleAddDiskToRAIDVol(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	//OK! Clear the disk
-	err = m.ClearSuperblock(sdXDev)
-	if err != nil {
-		utils.SendErrorResponse(w, "unable to clear superblock of device")
-		return
+	//OK! Clear the disk if it was used in another array
+	if m.HasSuperblock(sdXDev) {
+		err = m.ClearSuperblock(sdXDev)
+		if err != nil {
+			utils.SendErrorResponse(w, "unable to clear superblock of device")
+			return
+		}
 	}
 
 	//Add it to the target RAID array
@@ -164,6 +176,10 @@ func (m *Manager) HandleMdadmFlushReload(w http.ResponseWriter, r *http.Request)
 
 // Handle resolving the disk model label, might return null
 func (m *Manager) HandleResolveDiskModelLabel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	devName, err := utils.GetPara(r, "devName")
 	if err != nil {
 		utils.SendErrorResponse(w, "invalid device name given")
@@ -185,6 +201,10 @@ func (m *Manager) HandleResolveDiskModelLabel(w http.ResponseWriter, r *http.Req
 
 // Handle force flush reloading mdadm to solve the md0 become md127 problem
 func (m *Manager) HandlListChildrenDeviceInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	devName, err := utils.GetPara(r, "devName")
 	if err != nil {
 		utils.SendErrorResponse(w, "invalid device name given")
@@ -223,29 +243,29 @@ func (m *Manager) HandlListChildrenDeviceInfo(w http.ResponseWriter, r *http.Req
 	utils.SendJSONResponse(w, string(js))
 }
 
-// Handle list all the disks that is usable
+// Handle list all the disks that can be used as new RAID members
 func (m *Manager) HandleListUsableDevices(w http.ResponseWriter, r *http.Request) {
-	storageDevices, err := diskfs.ListAllStorageDevices()
-	if err != nil {
-		utils.SendErrorResponse(w, err.Error())
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "invalid method")
 		return
 	}
 
-	//Filter out the block devices that are disks
-	usableDisks := []diskfs.BlockDeviceMeta{}
-	for _, device := range storageDevices.Blockdevices {
-		if device.Type == "disk" {
-			usableDisks = append(usableDisks, device)
-		}
+	usableDisks, err := m.GetUsableDisks()
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
 	}
 
 	js, _ := json.Marshal(usableDisks)
 	utils.SendJSONResponse(w, string(js))
-
 }
 
 // Handle loading the detail of a given RAID array
 func (m *Manager) HandleLoadArrayDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	devName, err := utils.GetPara(r, "dev")
 	if err != nil {
 		utils.SendErrorResponse(w, "invalid device name given")
@@ -273,20 +293,29 @@ func (m *Manager) HandleLoadArrayDetail(w http.ResponseWriter, r *http.Request)
 	utils.SendJSONResponse(w, string(js))
 }
 
-// Handle formating a device
+// Handle formating a RAID device with the default options of the file system,
+// require devName (e.g. md0), format (e.g. ext4) and label (Optional).
+// Returns the UUID of the new file system
 func (m *Manager) HandleFormatRaidDevice(w http.ResponseWriter, r *http.Request) {
-	devName, err := utils.GetPara(r, "devName")
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	devName, err := utils.PostPara(r, "devName")
 	if err != nil {
 		utils.SendErrorResponse(w, "invalid device name given")
 		return
 	}
 
-	format, err := utils.GetPara(r, "format")
+	format, err := utils.PostPara(r, "format")
 	if err != nil {
-		utils.SendErrorResponse(w, "invalid device name given")
+		utils.SendErrorResponse(w, "invalid format given")
 		return
 	}
 
+	label, _ := utils.PostPara(r, "label")
+
 	if !strings.HasPrefix(devName, "/dev/") {
 		devName = "/dev/" + devName
 	}
@@ -298,17 +327,23 @@ func (m *Manager) HandleFormatRaidDevice(w http.ResponseWriter, r *http.Request)
 	}
 
 	//Format the drive
-	err = diskfs.FormatStorageDevice(format, devName)
+	uuid, err := diskfs.Format(devName, &diskfs.FormatOptions{FsType: format, Label: label}, nil)
 	if err != nil {
 		utils.SendErrorResponse(w, err.Error())
 		return
 	}
 
-	utils.SendOK(w)
+	log.Println("[RAID] " + devName + " formatted as " + format)
+	js, _ := json.Marshal(uuid)
+	utils.SendJSONResponse(w, string(js))
 }
 
 // List all the raid device in this system
 func (m *Manager) HandleListRaidDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	rdevs, err := m.GetRAIDDevicesFromProcMDStat()
 	if err != nil {
 		utils.SendErrorResponse(w, err.Error())
@@ -331,6 +366,10 @@ func (m *Manager) HandleListRaidDevices(w http.ResponseWriter, r *http.Request)
 
 // Create a RAID storage pool
 func (m *Manager) HandleCreateRAIDDevice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	devName, err := utils.PostPara(r, "devName")
 	if err != nil || devName == "" {
 		//Use auto generated one
@@ -465,6 +504,10 @@ func (m *Manager) HandleCreateRAIDDevice(w http.ResponseWriter, r *http.Request)
 
 // Request to reload the RAID manager and scan new / fix missing raid pools
 func (m *Manager) HandleRaidDevicesAssemble(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	err := m.RestartRAIDService()
 	if err != nil {
 		utils.SendErrorResponse(w, err.Error())
@@ -476,6 +519,10 @@ func (m *Manager) HandleRaidDevicesAssemble(w http.ResponseWriter, r *http.Reque
 
 // Remove a given raid device with its name, USE WITH CAUTION
 func (m *Manager) HandleRemoveRaideDevice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	targetDevice, err := utils.PostPara(r, "raidDev")
 	if err != nil {
 		utils.SendErrorResponse(w, "target device not given")
@@ -577,6 +624,10 @@ func (m *Manager) HandleRemoveRaideDevice(w http.ResponseWriter, r *http.Request
 
 // Force reload all RAID config from file
 func (m *Manager) HandleForceAssembleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	err := m.FlushReload()
 	if err != nil {
 		log.Println("RAID", "mdadm reload failed: "+err.Error(), err)
@@ -589,6 +640,10 @@ func (m *Manager) HandleForceAssembleReload(w http.ResponseWriter, r *http.Reque
 
 // Grow the raid array to maxmium possible size of the current disks
 func (m *Manager) HandleGrowRAIDArray(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	deviceName, err := utils.PostPara(r, "raidDev")
 	if err != nil {
 		utils.SendErrorResponse(w, "raid device not given")
@@ -624,11 +679,76 @@ func (m *Manager) HandleGrowRAIDArray(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//Grow the file system after the new space is synced
+	go m.ExpandFileSystemAfterSync(deviceName)
+
+	utils.SendOK(w)
+}
+
+// Reshape the raid array, require raidDev (e.g. /dev/md0). level (e.g. raid6), raidDevices (int),
+// chunkSize (int, KiB), backupFile, addDisks (JSON array, e.g. ["/dev/sde"]) and expandfs
+// (bool, default true) are optional. The progress is reported by the sync state as reshape
+func (m *Manager) HandleReshapeRAIDArray(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+	deviceName, err := utils.PostPara(r, "raidDev")
+	if err != nil {
+		utils.SendErrorResponse(w, "raid device not given")
+		return
+	}
+
+	if !m.RAIDDeviceExists(deviceName) {
+		utils.SendErrorResponse(w, "target raid device not exists")
+		return
+	}
+
+	options := &ReshapeOptions{
+		AddDisks:         []string{},
+		ExpandFileSystem: true,
+	}
+	options.Level, _ = utils.PostPara(r, "level")
+	options.BackupFile, _ = utils.PostPara(r, "backupFile")
+	if expand, err := utils.PostBool(r, "expandfs"); err == nil {
+		options.ExpandFileSystem = expand
+	}
+
+	for key, target := range map[string]*int{"raidDevices": &options.RaidDevices, "chunkSize": &options.ChunkSize} {
+		value, err := utils.PostPara(r, key)
+		if err != nil || value == "" {
+			continue
+		}
+		*target, err = strconv.Atoi(value)
+		if err != nil {
+			utils.SendErrorResponse(w, "invalid "+key+" given")
+			return
+		}
+	}
+
+	if addDisksJSON, err := utils.PostPara(r, "addDisks"); err == nil && addDisksJSON != "" {
+		err = json.Unmarshal([]byte(addDisksJSON), &options.AddDisks)
+		if err != nil {
+			utils.SendErrorResponse(w, "unable to parse disks to add into array")
+			return
+		}
+	}
+
+	err = m.ReshapeRAIDDevice(deviceName, options)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
 	utils.SendOK(w)
 }
 
 // HandleRenderOverview List the info and health of all loaded RAID array
 func (m *Manager) HandleRenderOverview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	//Get all raid device from procmd
 	rdevs, err := m.GetRAIDDevicesFromProcMDStat()
 	if err != nil {
@@ -687,6 +807,10 @@ func (m *Manager) HandleRenderOverview(w http.ResponseWriter, r *http.Request) {
 /* Sync State Related Features */
 // HandleGetRAIDSyncState Get the sync state of a given RAID device
 func (m *Manager) HandleGetRAIDSyncState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	devName, err := utils.GetPara(r, "dev")
 	if err != nil {
 		utils.SendErrorResponse(w, "invalid device name given")
@@ -711,6 +835,10 @@ func (m *Manager) HandleGetRAIDSyncState(w http.ResponseWriter, r *http.Request)
 // HandleSyncPendingToReadWrite Set the pending sync to read-write mode
 // to reactivate the resync process
 func (m *Manager) HandleSyncPendingToReadWrite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
 	devName, err := utils.PostPara(r, "dev")
 	if err != nil {
 		utils.SendErrorResponse(w, "invalid device name given")
@@ -730,3 +858,24 @@ func (m *Manager) HandleSyncPendingToReadWrite(w http.ResponseWriter, r *http.Re
 
 	utils.SendOK(w)
 }
+
+// HandleListEvents list the events raised by the RAID monitor, with optional
+// "dev=md0" to filter by array and "limit=50" to return the latest events only
+func (m *Manager) HandleListEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+	devName, _ := utils.GetPara(r, "dev")
+	limit := 0
+	if limitStr, err := utils.GetPara(r, "limit"); err == nil {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			utils.SendErrorResponse(w, "invalid limit given")
+			return
+		}
+	}
+
+	js, _ := json.Marshal(m.GetEvents(devName, limit))
+	utils.SendJSONResponse(w, string(js))
+}
@@ -299,6 +299,35 @@ func (m *Manager) AddDisk(mdDevice, diskPath string) error {
 	return nil
 }
 
+// ReplaceDisk copies the data of a working member to a spare with mdadm --replace, the old
+// disk is marked as faulty when the copy finished. The array keeps its redundancy during the copy
+func (m *Manager) ReplaceDisk(mdDevice, oldDiskPath, newDiskPath string) error {
+	//mdadm commands require full path
+	if !strings.HasPrefix(oldDiskPath, "/dev/") {
+		oldDiskPath = filepath.Join("/dev/", oldDiskPath)
+	}
+	if !strings.HasPrefix(newDiskPath, "/dev/") {
+		newDiskPath = filepath.Join("/dev/", newDiskPath)
+	}
+	if !strings.HasPrefix(mdDevice, "/dev/") {
+		mdDevice = filepath.Join("/dev/", mdDevice)
+	}
+
+	cmd := exec.Command("sudo", "mdadm", mdDevice, "--replace", oldDiskPath, "--with", newDiskPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to replace disk: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// HasSuperblock checks if the disk contains a md superblock, e.g. it was a member of another array
+func (m *Manager) HasSuperblock(diskPath string) bool {
+	if !strings.HasPrefix(diskPath, "/dev/") {
+		diskPath = filepath.Join("/dev/", diskPath)
+	}
+	return exec.Command("sudo", "mdadm", "--examine", diskPath).Run() == nil
+}
+
 // GrowRAIDDevice grows the specified RAID device to its maximum size
 func (m *Manager) GrowRAIDDevice(deviceName string) error {
 	//Prevent anyone passing /dev/md0 into the deviceName field
@@ -0,0 +1,247 @@
+package raid
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+	monitor.go
+
+	The RAID monitor watch /proc/mdstat and mdadm --detail of all arrays in the
+	background and emit typed events when the state of an array changes, e.g.
+	an array becomes degraded or a resync finished. Events are written to the
+	event log and passed to the OnEvent callback for notifications
+*/
+
+const DEFAULT_RAID_MONITOR_INTERVAL = 30 * time.Second
+
+type EventType string
+
+const (
+	Event_ArrayDegraded  EventType = "array_degraded"
+	Event_MemberFailed   EventType = "member_failed"
+	Event_SpareActivated EventType = "spare_activated"
+	Event_ResyncStarted  EventType = "resync_started"
+	Event_ResyncFinished EventType = "resync_finished"
+	Event_ArrayRecovered EventType = "array_recovered"
+)
+
+type Event struct {
+	Type       EventType `json:"type"`
+	DeviceName string    `json:"device_name"` //The array, e.g. md0
+	Member     string    `json:"member"`      //The member disk involved, e.g. /dev/sdb, empty for array events
+	State      string    `json:"state"`       //State of the array from mdadm, e.g. clean, degraded
+	Message    string    `json:"message"`
+	Time       time.Time `json:"time"`
+}
+
+// IsCritical returns true if the event means the array is at risk of data loss
+func (e *Event) IsCritical() bool {
+	return e.Type == Event_ArrayDegraded || e.Type == Event_MemberFailed
+}
+
+type MonitorOptions struct {
+	Interval     time.Duration      //Poll interval, default 30 seconds
+	EventLogFile string             //Path to the persistent event log
+	OnEvent      func(event *Event) //Called for each event after it is logged, can be nil
+}
+
+// arrayState is the snapshot of an array used to detect changes between polls
+type arrayState struct {
+	State    string
+	Degraded bool
+	Syncing  bool
+	Members  map[string]string //Member device path to its state, e.g. "active sync", "faulty", "spare"
+}
+
+// StartMonitor starts the background RAID monitor
+func (m *Manager) StartMonitor(options *MonitorOptions) error {
+	if m.monitorStop != nil {
+		return errors.New("raid monitor already started")
+	}
+	if options.Interval <= 0 {
+		options.Interval = DEFAULT_RAID_MONITOR_INTERVAL
+	}
+
+	eventLog, err := NewEventLog(options.EventLogFile, DEFAULT_EVENT_LOG_SIZE)
+	if err != nil {
+		return err
+	}
+	m.eventLog = eventLog
+	m.monitorOptions = options
+	m.monitorStop = make(chan bool)
+
+	go func() {
+		ticker := time.NewTicker(options.Interval)
+		defer ticker.Stop()
+		lastStates := map[string]*arrayState{}
+		m.pollArrays(lastStates)
+		for {
+			select {
+			case <-m.monitorStop:
+				return
+			case <-ticker.C:
+				m.pollArrays(lastStates)
+			}
+		}
+	}()
+	return nil
+}
+
+// StopMonitor stops the background RAID monitor
+func (m *Manager) StopMonitor() {
+	if m.monitorStop != nil {
+		close(m.monitorStop)
+		m.monitorStop = nil
+	}
+}
+
+// GetEvents returns the latest RAID events, filtered by array name if deviceName is not empty
+func (m *Manager) GetEvents(deviceName string, limit int) []*Event {
+	if m.eventLog == nil {
+		return []*Event{}
+	}
+	return m.eventLog.List(strings.TrimPrefix(deviceName, "/dev/"), limit)
+}
+
+// pollArrays reads the current state of all arrays and emit events for the changes
+func (m *Manager) pollArrays(lastStates map[string]*arrayState) {
+	raidDevices, err := m.GetRAIDDevicesFromProcMDStat()
+	if err != nil {
+		log.Println("[RAID] Unable to read /proc/mdstat: " + err.Error())
+		return
+	}
+
+	syncing := map[string]bool{}
+	if syncStates, err := m.GetSyncStates(); err == nil {
+		syncing = getResyncingArrays(syncStates)
+	}
+
+	found := map[string]bool{}
+	for _, raidDevice := range raidDevices {
+		info, err := m.GetRAIDInfo("/dev/" + raidDevice.Name)
+		if err != nil {
+			log.Println("[RAID] Unable to read detail of " + raidDevice.Name + ": " + err.Error())
+			continue
+		}
+
+		currentState := newArrayState(info, syncing[raidDevice.Name])
+		for _, event := range diffArrayState(raidDevice.Name, lastStates[raidDevice.Name], currentState) {
+			m.emitEvent(event)
+		}
+		lastStates[raidDevice.Name] = currentState
+		found[raidDevice.Name] = true
+	}
+
+	//Forget arrays that are stopped or removed, so they start clean if assembled again
+	for name := range lastStates {
+		if !found[name] {
+			delete(lastStates, name)
+		}
+	}
+}
+
+func (m *Manager) emitEvent(event *Event) {
+	event.Time = time.Now()
+	log.Println("[RAID] " + event.Message)
+	if err := m.eventLog.Append(event); err != nil {
+		log.Println("[RAID] Unable to write event log: " + err.Error())
+	}
+	if m.monitorOptions.OnEvent != nil {
+		m.monitorOptions.OnEvent(event)
+	}
+}
+
+// getResyncingArrays returns the arrays rebuilding their redundancy. Scrubs are reported
+// by the scrubber and reshapes are requested by the user, so they are not resync events
+func getResyncingArrays(syncStates []SyncState) map[string]bool {
+	syncing := map[string]bool{}
+	for _, syncState := range syncStates {
+		if syncState.Action == SYNC_ACTION_RESYNC || syncState.Action == SYNC_ACTION_RECOVERY {
+			syncing[syncState.DeviceName] = true
+		}
+	}
+	return syncing
+}
+
+// newArrayState creates the snapshot of an array from mdadm --detail
+func newArrayState(info *RAIDInfo, syncing bool) *arrayState {
+	state := &arrayState{
+		State:    info.State,
+		Degraded: strings.Contains(info.State, "degraded") || info.FailedDevices > 0,
+		Syncing:  syncing || strings.Contains(info.State, "resyncing") || strings.Contains(info.State, "recovering"),
+		Members:  map[string]string{},
+	}
+	for _, device := range info.DeviceInfo {
+		if device.DevicePath == "" {
+			//Removed slot
+			continue
+		}
+		state.Members[device.DevicePath] = strings.Join(device.State, " ")
+	}
+	return state
+}
+
+// diffArrayState returns the events between two snapshots of an array. previous
+// is nil on the first poll, in which case only existing problems are reported
+func diffArrayState(name string, previous *arrayState, current *arrayState) []*Event {
+	events := []*Event{}
+	newEvent := func(eventType EventType, member string, message string) {
+		events = append(events, &Event{
+			Type:       eventType,
+			DeviceName: name,
+			Member:     member,
+			State:      current.State,
+			Message:    message,
+		})
+	}
+
+	//Member events, sorted so the event order is stable
+	members := []string{}
+	for member := range current.Members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	for _, member := range members {
+		memberState := current.Members[member]
+		previousState := ""
+		if previous != nil {
+			previousState = previous.Members[member]
+		}
+
+		if strings.Contains(memberState, "faulty") && !strings.Contains(previousState, "faulty") {
+			newEvent(Event_MemberFailed, member, member+" in "+name+" is marked as faulty")
+		} else if isIdleSpare(previousState) && !isIdleSpare(memberState) && !strings.Contains(memberState, "faulty") {
+			newEvent(Event_SpareActivated, member, "spare "+member+" is activated in "+name+" ("+memberState+")")
+		}
+	}
+
+	//Array events
+	if current.Degraded && (previous == nil || !previous.Degraded) {
+		newEvent(Event_ArrayDegraded, "", name+" is degraded ("+current.State+")")
+	}
+
+	if previous == nil {
+		return events
+	}
+
+	if current.Syncing && !previous.Syncing {
+		newEvent(Event_ResyncStarted, "", "resync started on "+name)
+	} else if !current.Syncing && previous.Syncing {
+		newEvent(Event_ResyncFinished, "", "resync finished on "+name)
+	}
+
+	if !current.Degraded && previous.Degraded {
+		newEvent(Event_ArrayRecovered, "", name+" is recovered ("+current.State+")")
+	}
+	return events
+}
+
+// isIdleSpare returns true if the member is a spare disk that is not in use
+func isIdleSpare(memberState string) bool {
+	return memberState == "spare"
+}
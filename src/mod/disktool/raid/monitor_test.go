@@ -0,0 +1,204 @@
+package raid
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testDetailClean = `/dev/md0:
+           Version : 1.2
+     Creation Time : Mon Jan  1 10:00:00 2024
+        Raid Level : raid5
+        Array Size : 2093056 (2044.00 MiB 2143.29 MB)
+      Raid Devices : 3
+     Total Devices : 4
+       Persistence : Superblock is persistent
+
+             State : clean
+    Active Devices : 3
+   Working Devices : 4
+    Failed Devices : 0
+     Spare Devices : 1
+
+    Number   Major   Minor   RaidDevice State
+       0       8       16        0      active sync   /dev/sdb
+       1       8       32        1      active sync   /dev/sdc
+       3       8       48        2      active sync   /dev/sdd
+
+       4       8       64        -      spare   /dev/sde
+`
+
+const testDetailDegraded = `/dev/md0:
+           Version : 1.2
+        Raid Level : raid5
+      Raid Devices : 3
+     Total Devices : 4
+
+             State : clean, degraded, recovering
+    Active Devices : 2
+   Working Devices : 3
+    Failed Devices : 1
+     Spare Devices : 1
+
+    Number   Major   Minor   RaidDevice State
+       0       8       16        0      active sync   /dev/sdb
+       4       8       64        1      spare rebuilding   /dev/sde
+       3       8       48        2      active sync   /dev/sdd
+
+       1       8       32        -      faulty   /dev/sdc
+`
+
+func eventTypes(events []*Event) []EventType {
+	types := []EventType{}
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func sameEventTypes(got []EventType, want []EventType) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDiffArrayState(t *testing.T) {
+	clean := newArrayState(parseRAIDInfo(testDetailClean), false)
+	degraded := newArrayState(parseRAIDInfo(testDetailDegraded), true)
+	recovered := newArrayState(parseRAIDInfo(testDetailClean), false)
+
+	tests := []struct {
+		name     string
+		previous *arrayState
+		current  *arrayState
+		want     []EventType
+	}{
+		{"first poll clean", nil, clean, []EventType{}},
+		{"first poll degraded", nil, degraded, []EventType{Event_MemberFailed, Event_ArrayDegraded}},
+		{"member failed", clean, degraded, []EventType{Event_MemberFailed, Event_SpareActivated, Event_ArrayDegraded, Event_ResyncStarted}},
+		{"no change", degraded, degraded, []EventType{}},
+		{"recovered", degraded, recovered, []EventType{Event_ResyncFinished, Event_ArrayRecovered}},
+	}
+
+	for _, tt := range tests {
+		events := diffArrayState("md0", tt.previous, tt.current)
+		if got := eventTypes(events); !sameEventTypes(got, tt.want) {
+			t.Errorf("%s: got events %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	events := diffArrayState("md0", clean, degraded)
+	if events[0].Member != "/dev/sdc" || events[1].Member != "/dev/sde" {
+		t.Errorf("unexpected members: %s, %s", events[0].Member, events[1].Member)
+	}
+	if !events[0].IsCritical() || events[1].IsCritical() {
+		t.Error("only the member failed event should be critical")
+	}
+}
+
+func TestGetResyncingArrays(t *testing.T) {
+	syncing := getResyncingArrays([]SyncState{
+		{DeviceName: "md0", Action: SYNC_ACTION_RESYNC},
+		{DeviceName: "md1", Action: SYNC_ACTION_RECOVERY},
+		{DeviceName: "md2", Action: SYNC_ACTION_CHECK},
+		{DeviceName: "md3", Action: SYNC_ACTION_REPAIR},
+		{DeviceName: "md4", Action: SYNC_ACTION_RESHAPE},
+	})
+	if len(syncing) != 2 || !syncing["md0"] || !syncing["md1"] {
+		t.Errorf("expected only resync and recovery to be tracked, got %v", syncing)
+	}
+
+	//A scrub on a clean array does not start a resync
+	clean := newArrayState(parseRAIDInfo(testDetailClean), false)
+	scrubbing := newArrayState(parseRAIDInfo(testDetailClean), syncing["md2"])
+	if events := diffArrayState("md2", clean, scrubbing); len(events) != 0 {
+		t.Errorf("expected no events for a scrub, got %v", eventTypes(events))
+	}
+}
+
+func TestEventLog(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "raid_events.log")
+	eventLog, err := NewEventLog(logFile, 2)
+	if err != nil {
+		t.Fatalf("unable to create event log: %v", err)
+	}
+
+	eventLog.Append(&Event{Type: Event_ArrayDegraded, DeviceName: "md0"})
+	eventLog.Append(&Event{Type: Event_ResyncStarted, DeviceName: "md1"})
+	eventLog.Append(&Event{Type: Event_ArrayRecovered, DeviceName: "md0"})
+
+	if got := eventTypes(eventLog.List("", 0)); !sameEventTypes(got, []EventType{Event_ResyncStarted, Event_ArrayRecovered}) {
+		t.Errorf("unexpected events in memory: %v", got)
+	}
+
+	//Reopen to check the events are persisted
+	reopened, err := NewEventLog(logFile, 10)
+	if err != nil {
+		t.Fatalf("unable to reopen event log: %v", err)
+	}
+	if got := eventTypes(reopened.List("md0", 0)); !sameEventTypes(got, []EventType{Event_ArrayDegraded, Event_ArrayRecovered}) {
+		t.Errorf("unexpected events after reload: %v", got)
+	}
+	if got := eventTypes(reopened.List("", 1)); !sameEventTypes(got, []EventType{Event_ArrayRecovered}) {
+		t.Errorf("unexpected events with limit: %v", got)
+	}
+}
+
+func TestEventLogCompaction(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "raid_events.log")
+	countLines := func() int {
+		content, err := os.ReadFile(logFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(content), "\n")
+	}
+
+	eventLog, err := NewEventLog(logFile, 3)
+	if err != nil {
+		t.Fatalf("unable to create event log: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		eventLog.Append(&Event{Type: Event_ResyncStarted, DeviceName: "md" + strconv.Itoa(i)})
+	}
+	if lines := countLines(); lines != 6 {
+		t.Errorf("expected 6 lines before compaction, got %d", lines)
+	}
+
+	//The file is compacted to the events in memory when it reaches twice the size
+	eventLog.Append(&Event{Type: Event_ArrayDegraded, DeviceName: "md6"})
+	if lines := countLines(); lines != 3 {
+		t.Errorf("expected 3 lines after compaction, got %d", lines)
+	}
+	eventLog.Append(&Event{Type: Event_ArrayRecovered, DeviceName: "md6"})
+	if lines := countLines(); lines != 4 {
+		t.Errorf("expected appending after compaction, got %d lines", lines)
+	}
+
+	//A broken line and a smaller size on load also compact the file
+	f, _ := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("{\"type\":\n")
+	f.Close()
+	reopened, err := NewEventLog(logFile, 2)
+	if err != nil {
+		t.Fatalf("unable to reopen event log: %v", err)
+	}
+	if lines := countLines(); lines != 2 {
+		t.Errorf("expected 2 lines after reopen, got %d", lines)
+	}
+	if got := eventTypes(reopened.List("md6", 0)); !sameEventTypes(got, []EventType{Event_ArrayDegraded, Event_ArrayRecovered}) {
+		t.Errorf("unexpected events after compaction: %v", got)
+	}
+	if _, err := os.Stat(logFile + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("expected the temp file to be renamed, got %v", err)
+	}
+}
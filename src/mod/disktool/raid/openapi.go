@@ -0,0 +1,22 @@
+package raid
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+/*
+	openapi.go
+
+	The OpenAPI document of the RAID REST API, served as is so
+	clients can generate bindings from a running instance
+*/
+
+//go:embed openapi.yaml
+var openAPIDocument []byte
+
+// HandleOpenAPIDocument serves the OpenAPI document of the RAID API
+func HandleOpenAPIDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPIDocument)
+}
@@ -15,6 +15,10 @@ import (
 */
 
 type Manager struct {
+	/* Monitor */
+	monitorOptions *MonitorOptions
+	monitorStop    chan bool
+	eventLog       *EventLog
 }
 
 func PackageExists(packageName string) (bool, error) {
@@ -10,6 +10,8 @@ import (
 	"strconv"
 	"strings"
 
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
 	"imuslab.com/bokofs/bokofsd/mod/disktool/diskfs"
 )
 
@@ -78,6 +80,39 @@ func (m *Manager) DiskIsUsedInAnotherRAIDVol(sdXDev string) (bool, error) {
 	return false, nil
 }
 
+// GetUsableDisks returns the disks that can be used as RAID members, disks that are
+// (or have partitions) mounted, read only or used by another device (e.g. md0) are excluded
+func (m *Manager) GetUsableDisks() ([]*diskinfo.Disk, error) {
+	disks, err := diskinfo.GetAllDisks()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*diskinfo.Disk{}
+	for _, disk := range disks {
+		device, err := inventory.Default().Get(disk.Name)
+		if err != nil || device.ReadOnly {
+			continue
+		}
+		partitions, err := inventory.Default().Partitions(disk.Name)
+		if err != nil {
+			continue
+		}
+
+		inUse := false
+		for _, thisDevice := range append([]*inventory.Device{device}, partitions...) {
+			if len(thisDevice.MountPoints) > 0 || len(thisDevice.Holders) > 0 {
+				inUse = true
+				break
+			}
+		}
+		if !inUse {
+			results = append(results, disk)
+		}
+	}
+	return results, nil
+}
+
 // Check if the given disk (sdX) is root drive (the disk that install the OS, aka /)
 func (m *Manager) DiskIsRoot(sdXDev string) (bool, error) {
 	bdMeta, err := diskfs.GetBlockDeviceMeta(sdXDev)
@@ -0,0 +1,562 @@
+package raid
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
+	"imuslab.com/bokofs/bokofsd/mod/disktool/diskfs"
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	replace.go
+
+	Replace a member disk of an array as one tracked job. A working
+	member is copied to the new disk with mdadm --replace so the array
+	keeps its redundancy, a failed member is removed and the array is
+	rebuilt on the new disk.
+
+	Every step checks the current state of the array before acting, so
+	a job interrupted by a restart is resumed from the step it was in
+*/
+
+const (
+	REPLACE_JOB_RUNNING = "running"
+	REPLACE_JOB_DONE    = "done"
+	REPLACE_JOB_FAILED  = "failed"
+
+	REPLACE_STEP_FAIL    = "fail"    //Mark the old disk as faulty
+	REPLACE_STEP_REMOVE  = "remove"  //Remove the old disk from the array
+	REPLACE_STEP_CLEAR   = "clear"   //Clear the md superblock of the new disk
+	REPLACE_STEP_ADD     = "add"     //Add the new disk to the array as a spare
+	REPLACE_STEP_REPLACE = "replace" //Copy the old disk to the new disk with mdadm --replace
+	REPLACE_STEP_REBUILD = "rebuild" //Wait for the rebuild or copy to finish
+
+	replacePollInterval    = 5 * time.Second
+	replaceStartTimeout    = 60 * time.Second //Time for the rebuild to start after the new disk is added
+	maxFinishedReplaceJobs = 20               //No. of finished jobs to keep
+)
+
+type ReplaceJob struct {
+	ID        string   `json:"id"`
+	Array     string   `json:"array"`    //e.g. /dev/md0
+	OldDisk   string   `json:"old_disk"` //e.g. /dev/sdb, empty if the disk is already gone
+	NewDisk   string   `json:"new_disk"` //e.g. /dev/sde
+	Steps     []string `json:"steps"`
+	Step      int      `json:"step"` //Index of the current step in Steps
+	Status    string   `json:"status"`
+	Progress  float64  `json:"progress"` //Progress of the rebuild in percent, -1 if not rebuilding
+	Error     string   `json:"error"`
+	StartTime int64    `json:"start_time"`
+	EndTime   int64    `json:"end_time"`
+}
+
+type Replacer struct {
+	OnProgress func(job *ReplaceJob) //Optional, called when the step, status or progress of a job changed
+	manager    *Manager
+	stateFile  string
+	jobs       []*ReplaceJob
+	reserved   map[string]bool //Arrays and new disks of the jobs being started
+	mutex      sync.Mutex
+}
+
+// NewReplacer creates a replacer and loads the jobs from the state file, call Resume
+// to continue the jobs that were running when the service stopped
+func NewReplacer(manager *Manager, stateFile string) (*Replacer, error) {
+	replacer := &Replacer{
+		manager:   manager,
+		stateFile: stateFile,
+		jobs:      []*ReplaceJob{},
+		reserved:  map[string]bool{},
+	}
+
+	if !utils.FileExists(stateFile) {
+		return replacer, nil
+	}
+	content, err := os.ReadFile(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &replacer.jobs); err != nil {
+		return nil, errors.New("unable to parse replace jobs: " + err.Error())
+	}
+	return replacer, nil
+}
+
+// Resume continues the running jobs from the step they were in
+func (rp *Replacer) Resume() {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+	for _, job := range rp.jobs {
+		if job.Status == REPLACE_JOB_RUNNING {
+			log.Println("[RAID] Resuming replacement of " + job.OldDisk + " with " + job.NewDisk + " in " + job.Array)
+			go rp.run(job)
+		}
+	}
+}
+
+// Start checks the disks and replaces oldDisk with newDisk in the array in the background.
+// oldDisk can be empty if the failed disk is already removed from a degraded array
+func (rp *Replacer) Start(arrayPath string, oldDisk string, newDisk string) (*ReplaceJob, error) {
+	arrayPath = toDevicePath(arrayPath)
+	newDisk = toDevicePath(newDisk)
+	if oldDisk != "" {
+		oldDisk = toDevicePath(oldDisk)
+	}
+	if oldDisk == newDisk {
+		return nil, errors.New("old disk and new disk are the same")
+	}
+
+	//Reserve the array and the new disk while checking them, so a concurrent
+	//request cannot start another replacement on them in the meantime
+	rp.mutex.Lock()
+	for _, job := range rp.jobs {
+		if job.Status == REPLACE_JOB_RUNNING && (job.Array == arrayPath || job.NewDisk == newDisk) {
+			rp.mutex.Unlock()
+			return nil, errors.New("another replacement is running on " + job.Array)
+		}
+	}
+	if rp.reserved[arrayPath] || rp.reserved[newDisk] {
+		rp.mutex.Unlock()
+		return nil, errors.New("another replacement is starting on " + arrayPath)
+	}
+	rp.reserved[arrayPath] = true
+	rp.reserved[newDisk] = true
+	rp.mutex.Unlock()
+	defer func() {
+		rp.mutex.Lock()
+		delete(rp.reserved, arrayPath)
+		delete(rp.reserved, newDisk)
+		rp.mutex.Unlock()
+	}()
+
+	info, err := rp.manager.GetRAIDInfo(arrayPath)
+	if err != nil {
+		return nil, errors.New("target RAID array not exists")
+	}
+	if strings.EqualFold(info.RaidLevel, "raid0") {
+		return nil, errors.New("raid0 has no redundancy, its members cannot be replaced")
+	}
+	if oldDisk == "" && !strings.Contains(info.State, "degraded") {
+		return nil, errors.New("old disk not given and the array is not degraded")
+	}
+	if oldDisk != "" {
+		if _, ok := findMember(info, oldDisk); !ok {
+			return nil, errors.New(oldDisk + " is not a member of " + arrayPath)
+		}
+	}
+	if _, ok := findMember(info, newDisk); ok {
+		return nil, errors.New(newDisk + " is already a member of " + arrayPath)
+	}
+	if err := rp.checkNewDisk(newDisk); err != nil {
+		return nil, err
+	}
+	device, err := inventory.Default().Get(newDisk)
+	if err != nil {
+		return nil, errors.New("new disk not found")
+	}
+	if device.ReadOnly {
+		return nil, errors.New("new disk is read only")
+	}
+	if info.UsedDevSize > 0 && device.Size < int64(info.UsedDevSize)*1024 {
+		return nil, errors.New("new disk is smaller than the current members of the array")
+	}
+
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+	job := &ReplaceJob{
+		ID:        uuid.New().String(),
+		Array:     arrayPath,
+		OldDisk:   oldDisk,
+		NewDisk:   newDisk,
+		Steps:     planReplaceSteps(info, oldDisk),
+		Status:    REPLACE_JOB_RUNNING,
+		Progress:  -1,
+		StartTime: time.Now().Unix(),
+	}
+	rp.jobs = append(rp.jobs, job)
+	rp.pruneJobs()
+	if err := rp.saveToFile(); err != nil {
+		log.Println("[RAID] Unable to save replace jobs: " + err.Error())
+	}
+
+	log.Println("[RAID] Replacing " + oldDisk + " with " + newDisk + " in " + arrayPath + " (" + strings.Join(job.Steps, ", ") + ")")
+	go rp.run(job)
+
+	thisJob := *job
+	return &thisJob, nil
+}
+
+// Get returns the job by ID
+func (rp *Replacer) Get(id string) (*ReplaceJob, error) {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+	for _, job := range rp.jobs {
+		if job.ID == id {
+			thisJob := *job
+			return &thisJob, nil
+		}
+	}
+	return nil, errors.New("replace job not found")
+}
+
+// List returns all running jobs and the recently finished jobs
+func (rp *Replacer) List() []*ReplaceJob {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+	results := []*ReplaceJob{}
+	for _, job := range rp.jobs {
+		thisJob := *job
+		results = append(results, &thisJob)
+	}
+	return results
+}
+
+// run executes the steps of the job starting from the current step
+func (rp *Replacer) run(job *ReplaceJob) {
+	rp.mutex.Lock()
+	steps := job.Steps
+	current := job.Step
+	rp.mutex.Unlock()
+
+	for i := current; i < len(steps); i++ {
+		rp.updateJob(job, true, func() bool {
+			job.Step = i
+			return true
+		})
+
+		if err := rp.runStep(job, steps[i]); err != nil {
+			log.Println("[RAID] Replacement of " + job.OldDisk + " in " + job.Array + " failed at " + steps[i] + ": " + err.Error())
+			rp.updateJob(job, true, func() bool {
+				job.Status = REPLACE_JOB_FAILED
+				job.Error = steps[i] + ": " + err.Error()
+				job.EndTime = time.Now().Unix()
+				return true
+			})
+			return
+		}
+	}
+
+	if err := rp.manager.UpdateMDADMConfig(); err != nil {
+		log.Println("[RAID] Unable to update mdadm.conf after replacement: " + err.Error())
+	}
+
+	log.Println("[RAID] " + job.NewDisk + " is now a member of " + job.Array)
+	rp.updateJob(job, true, func() bool {
+		job.Status = REPLACE_JOB_DONE
+		job.Progress = 100
+		job.EndTime = time.Now().Unix()
+		return true
+	})
+}
+
+// runStep executes a step if it is not done yet
+func (rp *Replacer) runStep(job *ReplaceJob, step string) error {
+	info, err := rp.manager.GetRAIDInfo(job.Array)
+	if err != nil {
+		return err
+	}
+	oldMember, oldFound := findMember(info, job.OldDisk)
+	newMember, newFound := findMember(info, job.NewDisk)
+
+	switch step {
+	case REPLACE_STEP_FAIL:
+		if !oldFound || memberHasState(oldMember, "faulty") {
+			return nil
+		}
+		if !rp.manager.IsSafeToRemove(job.Array, job.OldDisk) {
+			return errors.New("removal of the old disk will cause data loss")
+		}
+		return rp.manager.FailDisk(job.Array, job.OldDisk)
+
+	case REPLACE_STEP_REMOVE:
+		if !oldFound {
+			return nil
+		}
+		if !memberHasState(oldMember, "faulty") {
+			return errors.New("old disk is still in use")
+		}
+		//Add some delay for OS level to handle IO closing
+		time.Sleep(300 * time.Millisecond)
+		return rp.manager.RemoveDisk(job.Array, job.OldDisk)
+
+	case REPLACE_STEP_CLEAR:
+		if newFound {
+			return nil
+		}
+		if err := rp.checkNewDisk(job.NewDisk); err != nil {
+			return err
+		}
+		if !rp.manager.HasSuperblock(job.NewDisk) {
+			return nil
+		}
+		return rp.manager.ClearSuperblock(job.NewDisk)
+
+	case REPLACE_STEP_ADD:
+		if newFound && !memberHasState(newMember, "faulty") {
+			return nil
+		}
+		if err := rp.checkNewDisk(job.NewDisk); err != nil {
+			return err
+		}
+		return rp.manager.AddDisk(job.Array, job.NewDisk)
+
+	case REPLACE_STEP_REPLACE:
+		if !newFound {
+			return errors.New("new disk is not a member of the array")
+		}
+		if !oldFound || !memberIsIdleSpare(newMember) {
+			//Copy started or finished already
+			return nil
+		}
+		return rp.manager.ReplaceDisk(job.Array, job.OldDisk, job.NewDisk)
+
+	case REPLACE_STEP_REBUILD:
+		return rp.waitForRebuild(job)
+	}
+	return errors.New("unknown step " + step)
+}
+
+// waitForRebuild waits until the new disk is an active member of the array
+func (rp *Replacer) waitForRebuild(job *ReplaceJob) error {
+	idleSince := time.Now()
+	for {
+		syncState, err := rp.manager.GetSyncStateByPath(job.Array)
+		if err == nil {
+			idleSince = time.Now()
+			rp.updateJob(job, false, func() bool {
+				//Only report whole percent changes
+				if math.Floor(job.Progress) == math.Floor(syncState.ResyncPercent) {
+					return false
+				}
+				job.Progress = syncState.ResyncPercent
+				return true
+			})
+			time.Sleep(replacePollInterval)
+			continue
+		}
+
+		info, err := rp.manager.GetRAIDInfo(job.Array)
+		if err != nil {
+			return err
+		}
+		newMember, found := findMember(info, job.NewDisk)
+		if !found || memberHasState(newMember, "faulty") {
+			return errors.New("new disk failed or removed during rebuild")
+		}
+		if memberHasState(newMember, "active") && memberHasState(newMember, "sync") {
+			return nil
+		}
+		if time.Since(idleSince) > replaceStartTimeout {
+			if !strings.Contains(info.State, "degraded") {
+				//The array is rebuilt with another spare, the new disk is kept as spare
+				return nil
+			}
+			return errors.New("rebuild did not start on the new disk")
+		}
+		time.Sleep(replacePollInterval)
+	}
+}
+
+// checkNewDisk checks the new disk is not the OS disk and not in use
+func (rp *Replacer) checkNewDisk(diskPath string) error {
+	isOSDisk, err := rp.manager.DiskIsRoot(diskPath)
+	if err != nil {
+		return err
+	}
+	if isOSDisk {
+		return errors.New("OS disk cannot be used as RAID member")
+	}
+
+	isMounted, err := diskfs.DeviceIsMounted(diskPath)
+	if err != nil {
+		return errors.New("unable to read device state")
+	}
+	if isMounted {
+		return errors.New("new disk is mounted")
+	}
+
+	usedByAnotherRAID, err := rp.manager.DiskIsUsedInAnotherRAIDVol(diskPath)
+	if err != nil {
+		return err
+	}
+	if usedByAnotherRAID {
+		return errors.New("new disk already been used by another RAID volume")
+	}
+	return nil
+}
+
+// updateJob applies the change to the job, saves the state file if persist is set
+// and notify the progress handler if changed
+func (rp *Replacer) updateJob(job *ReplaceJob, persist bool, change func() bool) {
+	rp.mutex.Lock()
+	changed := change()
+	thisJob := *job
+	if changed && persist {
+		if err := rp.saveToFile(); err != nil {
+			log.Println("[RAID] Unable to save replace jobs: " + err.Error())
+		}
+	}
+	rp.mutex.Unlock()
+
+	if changed && rp.OnProgress != nil {
+		rp.OnProgress(&thisJob)
+	}
+}
+
+// pruneJobs removes the oldest finished jobs, require the mutex to be locked
+func (rp *Replacer) pruneJobs() {
+	finished := 0
+	for _, job := range rp.jobs {
+		if job.Status != REPLACE_JOB_RUNNING {
+			finished++
+		}
+	}
+
+	results := []*ReplaceJob{}
+	for _, job := range rp.jobs {
+		if job.Status != REPLACE_JOB_RUNNING && finished > maxFinishedReplaceJobs {
+			finished--
+			continue
+		}
+		results = append(results, job)
+	}
+	rp.jobs = results
+}
+
+// saveToFile writes the jobs to the state file, require the mutex to be locked
+func (rp *Replacer) saveToFile() error {
+	js, err := json.MarshalIndent(rp.jobs, "", " ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(rp.stateFile), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(rp.stateFile, js, 0644)
+}
+
+// planReplaceSteps returns the steps to replace oldDisk in the array. A working member is
+// copied with mdadm --replace so the array is never degraded, others are removed first
+func planReplaceSteps(info *RAIDInfo, oldDisk string) []string {
+	if oldDisk == "" {
+		return []string{REPLACE_STEP_CLEAR, REPLACE_STEP_ADD, REPLACE_STEP_REBUILD}
+	}
+
+	member, _ := findMember(info, oldDisk)
+	if memberHasState(member, "faulty") {
+		return []string{REPLACE_STEP_REMOVE, REPLACE_STEP_CLEAR, REPLACE_STEP_ADD, REPLACE_STEP_REBUILD}
+	}
+	if memberHasState(member, "active") && memberHasState(member, "sync") {
+		return []string{REPLACE_STEP_CLEAR, REPLACE_STEP_ADD, REPLACE_STEP_REPLACE, REPLACE_STEP_REBUILD, REPLACE_STEP_REMOVE}
+	}
+	return []string{REPLACE_STEP_FAIL, REPLACE_STEP_REMOVE, REPLACE_STEP_CLEAR, REPLACE_STEP_ADD, REPLACE_STEP_REBUILD}
+}
+
+// findMember returns the member of the array with the given device path
+func findMember(info *RAIDInfo, diskPath string) (*DeviceInfo, bool) {
+	if diskPath == "" {
+		return nil, false
+	}
+	for i := range info.DeviceInfo {
+		if info.DeviceInfo[i].DevicePath == diskPath {
+			return &info.DeviceInfo[i], true
+		}
+	}
+	return nil, false
+}
+
+// memberHasState checks if the member is in the given state, e.g. faulty
+func memberHasState(member *DeviceInfo, state string) bool {
+	if member == nil {
+		return false
+	}
+	for _, thisState := range member.State {
+		if thisState == state {
+			return true
+		}
+	}
+	return false
+}
+
+// memberIsIdleSpare checks if the member is a spare that is not being rebuilt
+func memberIsIdleSpare(member *DeviceInfo) bool {
+	return member != nil && isIdleSpare(strings.Join(member.State, " "))
+}
+
+// toDevicePath prepends /dev/ to the device name if not set
+func toDevicePath(name string) string {
+	if !strings.HasPrefix(name, "/dev/") {
+		return "/dev/" + name
+	}
+	return name
+}
+
+/*
+	Handlers
+*/
+
+// HandleReplaceDisk replaces a member disk in the background and returns the job,
+// require raidDev (e.g. /dev/md0) and newDisk (e.g. /dev/sde), oldDisk is optional
+// if the failed disk is already removed from the array
+func (rp *Replacer) HandleReplaceDisk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	mdDev, err := utils.PostPara(r, "raidDev")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid raid device given")
+		return
+	}
+
+	newDisk, err := utils.PostPara(r, "newDisk")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid new disk given")
+		return
+	}
+
+	oldDisk, _ := utils.PostPara(r, "oldDisk")
+	job, err := rp.Start(mdDev, oldDisk, newDisk)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	js, _ := json.Marshal(job)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleListReplaceJobs lists the replace jobs, or returns a single job if id is given as a query parameter
+func (rp *Replacer) HandleListReplaceJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	id, _ := utils.GetPara(r, "id")
+	if id != "" {
+		job, err := rp.Get(id)
+		if err != nil {
+			utils.SendErrorResponse(w, err.Error())
+			return
+		}
+		js, _ := json.Marshal(job)
+		utils.SendJSONResponse(w, string(js))
+		return
+	}
+
+	js, _ := json.Marshal(rp.List())
+	utils.SendJSONResponse(w, string(js))
+}
@@ -0,0 +1,98 @@
+package raid
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPlanReplaceSteps(t *testing.T) {
+	clean := parseRAIDInfo(testDetailClean)
+	degraded := parseRAIDInfo(testDetailDegraded)
+
+	tests := []struct {
+		info     *RAIDInfo
+		oldDisk  string
+		expected []string
+	}{
+		//Working member, copied with mdadm --replace
+		{clean, "/dev/sdb", []string{REPLACE_STEP_CLEAR, REPLACE_STEP_ADD, REPLACE_STEP_REPLACE, REPLACE_STEP_REBUILD, REPLACE_STEP_REMOVE}},
+		//Spare
+		{clean, "/dev/sde", []string{REPLACE_STEP_FAIL, REPLACE_STEP_REMOVE, REPLACE_STEP_CLEAR, REPLACE_STEP_ADD, REPLACE_STEP_REBUILD}},
+		//Failed member
+		{degraded, "/dev/sdc", []string{REPLACE_STEP_REMOVE, REPLACE_STEP_CLEAR, REPLACE_STEP_ADD, REPLACE_STEP_REBUILD}},
+		//Failed member already removed
+		{degraded, "", []string{REPLACE_STEP_CLEAR, REPLACE_STEP_ADD, REPLACE_STEP_REBUILD}},
+	}
+	for _, test := range tests {
+		steps := planReplaceSteps(test.info, test.oldDisk)
+		if !reflect.DeepEqual(steps, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.oldDisk, test.expected, steps)
+		}
+	}
+}
+
+func TestReplacerStateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "replace.json")
+	replacer, err := NewReplacer(&Manager{}, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := &ReplaceJob{ID: "1", Array: "/dev/md0", OldDisk: "/dev/sdc", NewDisk: "/dev/sdf", Steps: []string{REPLACE_STEP_REMOVE, REPLACE_STEP_ADD}, Step: 1, Status: REPLACE_JOB_RUNNING}
+	replacer.jobs = append(replacer.jobs, job)
+	if err := replacer.saveToFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	//The job is loaded at the step it was in
+	reloaded, err := NewReplacer(&Manager{}, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedJob, err := reloaded.Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loadedJob, job) {
+		t.Errorf("expected %+v, got %+v", job, loadedJob)
+	}
+}
+
+func TestReplacerStartConcurrentJob(t *testing.T) {
+	replacer, err := NewReplacer(&Manager{}, filepath.Join(t.TempDir(), "replace.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replacer.jobs = append(replacer.jobs,
+		&ReplaceJob{ID: "1", Array: "/dev/md0", OldDisk: "/dev/sdc", NewDisk: "/dev/sdf", Status: REPLACE_JOB_RUNNING},
+		&ReplaceJob{ID: "2", Array: "/dev/md1", OldDisk: "/dev/sdd", NewDisk: "/dev/sdg", Status: REPLACE_JOB_DONE},
+	)
+	replacer.reserved["/dev/md2"] = true
+
+	tests := []struct {
+		array   string
+		oldDisk string
+		newDisk string
+		message string
+	}{
+		{"md0", "sdb", "sde", "another replacement is running on /dev/md0"},
+		{"/dev/md1", "sdb", "/dev/sdf", "another replacement is running on /dev/md0"},
+		{"md2", "sdb", "sdh", "another replacement is starting on /dev/md2"},
+	}
+	for _, test := range tests {
+		_, err := replacer.Start(test.array, test.oldDisk, test.newDisk)
+		if err == nil || err.Error() != test.message {
+			t.Errorf("%s: expected %q, got %v", test.array, test.message, err)
+		}
+	}
+
+	//A refused request does not release the reservation of the other request,
+	//and the reservation of a request is released after the checks failed
+	if _, err := replacer.Start("md3", "sdb", "sdi"); err == nil {
+		t.Error("expected error for an array that does not exist")
+	}
+	if !replacer.reserved["/dev/md2"] || len(replacer.reserved) != 1 {
+		t.Errorf("unexpected reservations %v", replacer.reserved)
+	}
+}
@@ -0,0 +1,286 @@
+package raid
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
+	"imuslab.com/bokofs/bokofsd/mod/disktool/diskfs"
+)
+
+/*
+	reshape.go
+
+	Online reshape of RAID arrays with mdadm --grow, e.g. add a disk
+	to a 3 disk RAID5, migrate RAID1 to RAID5 or RAID5 to RAID6, or
+	change the chunk size. The reshape runs in the kernel and its
+	progress is reported by GetSyncStates as the "reshape" action
+*/
+
+// Reshape progress is checked at this interval before expanding the file system
+const reshapePollInterval = 10 * time.Second
+
+// Level migrations supported by mdadm that keep the data online
+var supportedLevelMigrations = map[string][]string{
+	"raid1": {"raid5"},
+	"raid4": {"raid5"},
+	"raid5": {"raid6"},
+}
+
+type ReshapeOptions struct {
+	Level            string   //Target level, e.g. raid6, empty to keep the current level
+	RaidDevices      int      //Target number of active disks, 0 to keep the current number (or +1 for raid5 to raid6)
+	ChunkSize        int      //Target chunk size in KiB, 0 to keep the current chunk size
+	BackupFile       string   //Critical section backup file, must not be on the array itself. Optional
+	AddDisks         []string //Disks to add as spares before the reshape, e.g. /dev/sde
+	ExpandFileSystem bool     //Grow the file system on the array after the reshape finished
+}
+
+// ReshapeRAIDDevice validates the options and starts the reshape of the array, the reshape
+// continues in the background and the file system is expanded after it finished if requested
+func (m *Manager) ReshapeRAIDDevice(devicePath string, options *ReshapeOptions) error {
+	if !strings.HasPrefix(devicePath, "/dev/") {
+		devicePath = "/dev/" + devicePath
+	}
+
+	info, err := m.GetRAIDInfo(devicePath)
+	if err != nil {
+		return err
+	}
+	if _, err := m.GetSyncStateByPath(devicePath); err == nil {
+		return errors.New("array is busy, wait for the current sync to finish")
+	}
+
+	//Resolve the size of the new disks
+	usableDisks, err := m.GetUsableDisks()
+	if err != nil {
+		return err
+	}
+	diskSizes := map[string]int64{}
+	for i, disk := range options.AddDisks {
+		if !strings.HasPrefix(disk, "/dev/") {
+			disk = "/dev/" + disk
+			options.AddDisks[i] = disk
+		}
+		for _, usableDisk := range usableDisks {
+			if "/dev/"+usableDisk.Name == disk {
+				diskSizes[disk] = usableDisk.Size
+			}
+		}
+		if _, ok := diskSizes[disk]; !ok {
+			return errors.New(disk + " not found or in use")
+		}
+	}
+
+	if err := checkBackupFile(devicePath, options.BackupFile); err != nil {
+		return err
+	}
+
+	steps, err := planReshape(devicePath, info, options, diskSizes)
+	if err != nil {
+		return err
+	}
+
+	for _, disk := range options.AddDisks {
+		if err := m.AddDisk(devicePath, disk); err != nil {
+			return err
+		}
+	}
+
+	for _, step := range steps {
+		output, err := exec.Command("sudo", step...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to reshape RAID device: %s", strings.TrimSpace(string(output)))
+		}
+		log.Println("[RAID] Reshape started: " + strings.Join(step, " "))
+	}
+
+	if err := m.UpdateMDADMConfig(); err != nil {
+		log.Println("[RAID] Unable to update mdadm.conf after reshape: " + err.Error())
+	}
+
+	if options.ExpandFileSystem {
+		go m.ExpandFileSystemAfterSync(devicePath)
+	}
+	return nil
+}
+
+// ExpandFileSystemAfterSync waits for the running sync or reshape of the array to
+// finish and grows the file system on it to the new size of the array
+func (m *Manager) ExpandFileSystemAfterSync(devicePath string) {
+	for {
+		if _, err := m.GetSyncStateByPath(devicePath); err != nil {
+			break
+		}
+		time.Sleep(reshapePollInterval)
+	}
+
+	if err := diskfs.ExpandFileSystem(devicePath); err != nil {
+		log.Println("[RAID] Unable to expand file system on " + devicePath + ": " + err.Error())
+		return
+	}
+	log.Println("[RAID] File system on " + devicePath + " expanded")
+}
+
+// planReshape runs the pre-flight checks and returns the mdadm commands (without sudo) to
+// reshape the array. diskSizes is the size in bytes of each disk to be added
+func planReshape(devicePath string, info *RAIDInfo, options *ReshapeOptions, diskSizes map[string]int64) ([][]string, error) {
+	if info.FailedDevices > 0 || strings.Contains(info.State, "degraded") {
+		return nil, errors.New("reshape can only be performed on a healthy array")
+	}
+	if strings.Contains(info.State, "reshaping") || strings.Contains(info.State, "resyncing") || strings.Contains(info.State, "recovering") {
+		return nil, errors.New("array is busy, wait for the current sync to finish")
+	}
+
+	currentLevel := normalizeRAIDLevel(info.RaidLevel)
+	if currentLevel == "raid0" {
+		//raid0 cannot hold spares, so there is no safe way to add disks to it
+		return nil, errors.New("reshaping raid0 is not supported")
+	}
+	targetLevel := currentLevel
+	if options.Level != "" {
+		targetLevel = normalizeRAIDLevel(options.Level)
+		if !IsValidRAIDLevel(targetLevel) {
+			return nil, errors.New("invalid raid level given")
+		}
+	}
+
+	levelChanged := targetLevel != currentLevel
+	if levelChanged {
+		supported := false
+		for _, level := range supportedLevelMigrations[currentLevel] {
+			if level == targetLevel {
+				supported = true
+			}
+		}
+		if !supported {
+			return nil, fmt.Errorf("migration from %s to %s is not supported", currentLevel, targetLevel)
+		}
+		if currentLevel == "raid1" && info.RaidDevices != 2 {
+			return nil, errors.New("only a raid1 array with 2 disks can be migrated to raid5")
+		}
+	}
+
+	targetDevices := options.RaidDevices
+	if targetDevices == 0 {
+		targetDevices = info.RaidDevices
+		if currentLevel == "raid5" && targetLevel == "raid6" {
+			//Keep the usable capacity with the extra parity disk
+			targetDevices++
+		}
+	}
+	if targetDevices < info.RaidDevices {
+		return nil, errors.New("reducing the number of disks is not supported")
+	}
+	if currentLevel == "raid5" && targetLevel == "raid6" && targetDevices == info.RaidDevices {
+		return nil, errors.New("raid6 requires one more disk than the current raid5 array")
+	}
+	if minDevices := minRAIDDevices(targetLevel); targetDevices < minDevices && !(currentLevel == "raid1" && targetDevices == 2) {
+		//A raid1 migrated to raid5 keeps its 2 disks until more disks are added
+		return nil, fmt.Errorf("%s requires at least %d disks", targetLevel, minDevices)
+	}
+	if extra := targetDevices - info.RaidDevices; extra > info.SpareDevices+len(diskSizes) {
+		return nil, fmt.Errorf("%d more disks are required, add new disks or spares to the array first", extra-info.SpareDevices-len(diskSizes))
+	}
+
+	//New members must be able to hold the same amount of data as the current members
+	for disk, size := range diskSizes {
+		if info.UsedDevSize > 0 && size < int64(info.UsedDevSize)*1024 {
+			return nil, fmt.Errorf("%s is smaller than the current members of the array", disk)
+		}
+	}
+
+	if options.ChunkSize != 0 {
+		if targetLevel == "raid1" {
+			return nil, errors.New("raid1 does not use chunks")
+		}
+		if options.ChunkSize < 4 || options.ChunkSize&(options.ChunkSize-1) != 0 {
+			return nil, errors.New("chunk size must be a power of 2 and at least 4 KiB")
+		}
+	}
+
+	if !levelChanged && targetDevices == info.RaidDevices && options.ChunkSize == 0 {
+		return nil, errors.New("nothing to reshape")
+	}
+
+	baseArgs := []string{"mdadm", "--grow", devicePath}
+	if options.BackupFile != "" {
+		baseArgs = append(baseArgs, "--backup-file="+options.BackupFile)
+	}
+
+	steps := [][]string{}
+	growArgs := append([]string{}, baseArgs...)
+	if levelChanged {
+		if currentLevel == "raid1" {
+			//mdadm cannot change the number of disks while converting from raid1,
+			//the conversion of a 2 disk raid1 is instant and the reshape follows
+			steps = append(steps, append(append([]string{}, baseArgs...), "--level="+targetLevel))
+		} else {
+			growArgs = append(growArgs, "--level="+targetLevel)
+		}
+	}
+	if targetDevices != info.RaidDevices {
+		growArgs = append(growArgs, "--raid-devices="+strconv.Itoa(targetDevices))
+	}
+	if options.ChunkSize != 0 {
+		growArgs = append(growArgs, "--chunk="+strconv.Itoa(options.ChunkSize))
+	}
+	if len(growArgs) > len(baseArgs) {
+		steps = append(steps, growArgs)
+	}
+	return steps, nil
+}
+
+// checkBackupFile checks the backup file can be created and is not stored on the array
+func checkBackupFile(devicePath string, backupFile string) error {
+	if backupFile == "" {
+		return nil
+	}
+	if !filepath.IsAbs(backupFile) {
+		return errors.New("backup file must be an absolute path")
+	}
+	if _, err := os.Stat(backupFile); err == nil {
+		return errors.New("backup file already exists")
+	}
+	if info, err := os.Stat(filepath.Dir(backupFile)); err != nil || !info.IsDir() {
+		return errors.New("directory of the backup file not exists")
+	}
+
+	device, err := inventory.Default().Get(devicePath)
+	if err != nil {
+		return nil
+	}
+	for _, mountPoint := range device.MountPoints {
+		if backupFile == mountPoint || strings.HasPrefix(backupFile, strings.TrimSuffix(mountPoint, "/")+"/") {
+			return errors.New("backup file must not be stored on the array being reshaped")
+		}
+	}
+	return nil
+}
+
+// normalizeRAIDLevel converts the level to the format used by mdadm, e.g. 5 to raid5
+func normalizeRAIDLevel(level string) string {
+	level = strings.TrimSpace(strings.ToLower(level))
+	if !strings.HasPrefix(level, "raid") {
+		level = "raid" + level
+	}
+	return level
+}
+
+// minRAIDDevices returns the minimum number of disks of the level
+func minRAIDDevices(level string) int {
+	switch level {
+	case "raid5", "raid4":
+		return 3
+	case "raid6", "raid10":
+		return 4
+	}
+	return 2
+}
@@ -0,0 +1,73 @@
+package raid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlanReshape(t *testing.T) {
+	//3 disk raid5 with 1 spare
+	raid5 := parseRAIDInfo(testDetailClean)
+	raid5.UsedDevSize = 1046528
+	raid1 := &RAIDInfo{RaidLevel: "raid1", RaidDevices: 2, State: "clean"}
+
+	tests := []struct {
+		info      *RAIDInfo
+		options   *ReshapeOptions
+		diskSizes map[string]int64
+		expected  []string
+	}{
+		//Use the spare
+		{raid5, &ReshapeOptions{RaidDevices: 4}, nil, []string{"mdadm --grow /dev/md0 --raid-devices=4"}},
+		//Spare and a new disk
+		{raid5, &ReshapeOptions{RaidDevices: 5, BackupFile: "/root/md0.bak"}, map[string]int64{"/dev/sdf": 2 << 30},
+			[]string{"mdadm --grow /dev/md0 --backup-file=/root/md0.bak --raid-devices=5"}},
+		//One more disk is added by default
+		{raid5, &ReshapeOptions{Level: "6"}, nil, []string{"mdadm --grow /dev/md0 --level=raid6 --raid-devices=4"}},
+		{raid5, &ReshapeOptions{ChunkSize: 128}, nil, []string{"mdadm --grow /dev/md0 --chunk=128"}},
+		//raid1 is converted before the disks are added
+		{raid1, &ReshapeOptions{Level: "raid5"}, nil, []string{"mdadm --grow /dev/md0 --level=raid5"}},
+		{raid1, &ReshapeOptions{Level: "raid5", RaidDevices: 3}, map[string]int64{"/dev/sdd": 1 << 30},
+			[]string{"mdadm --grow /dev/md0 --level=raid5", "mdadm --grow /dev/md0 --raid-devices=3"}},
+	}
+	for _, test := range tests {
+		steps, err := planReshape("/dev/md0", test.info, test.options, test.diskSizes)
+		if err != nil {
+			t.Errorf("%+v: unexpected error %v", test.options, err)
+			continue
+		}
+		results := []string{}
+		for _, step := range steps {
+			results = append(results, strings.Join(step, " "))
+		}
+		if strings.Join(results, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("expected %q, got %q", test.expected, results)
+		}
+	}
+
+	degraded := parseRAIDInfo(testDetailDegraded)
+	raid0 := &RAIDInfo{RaidLevel: "raid0", RaidDevices: 2, State: "clean"}
+	raid1Mirror3 := &RAIDInfo{RaidLevel: "raid1", RaidDevices: 3, State: "clean"}
+	invalid := []struct {
+		info      *RAIDInfo
+		options   *ReshapeOptions
+		diskSizes map[string]int64
+	}{
+		{degraded, &ReshapeOptions{RaidDevices: 4}, nil},
+		{raid0, &ReshapeOptions{RaidDevices: 3}, nil},
+		{raid1Mirror3, &ReshapeOptions{Level: "raid5"}, nil},
+		{raid5, &ReshapeOptions{Level: "raid1"}, nil},
+		{raid5, &ReshapeOptions{RaidDevices: 2}, nil},
+		{raid5, &ReshapeOptions{RaidDevices: 5}, nil},
+		{raid5, &ReshapeOptions{Level: "raid6", RaidDevices: 3}, nil},
+		{raid5, &ReshapeOptions{RaidDevices: 4}, map[string]int64{"/dev/sdf": 512 << 20}},
+		{raid5, &ReshapeOptions{ChunkSize: 100}, nil},
+		{raid1, &ReshapeOptions{ChunkSize: 64}, nil},
+		{raid5, &ReshapeOptions{}, nil},
+	}
+	for _, test := range invalid {
+		if _, err := planReshape("/dev/md0", test.info, test.options, test.diskSizes); err == nil {
+			t.Errorf("%+v %+v: expected error", test.info.RaidLevel, test.options)
+		}
+	}
+}
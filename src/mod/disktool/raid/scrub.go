@@ -0,0 +1,723 @@
+package raid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"imuslab.com/bokofs/bokofsd/mod/scheduler"
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	scrub.go
+
+	Scheduled consistency checks of RAID arrays. A scrub writes check
+	or repair to /sys/block/mdX/md/sync_action, the kernel then reads
+	every stripe and counts the blocks where the data and parity (or
+	the mirrors) do not agree in mismatch_cnt. Regular scrubs find
+	silent corruption before a rebuild runs into it.
+
+	Each array can have one cron schedule, the bandwidth of a scrub
+	can be limited with sync_speed_max and the result of every scrub
+	is kept in the history
+*/
+
+const (
+	SCRUB_STATUS_RUNNING   = "running"
+	SCRUB_STATUS_DONE      = "done"
+	SCRUB_STATUS_CANCELLED = "cancelled"
+	SCRUB_STATUS_FAILED    = "failed"
+
+	SCRUB_TRIGGER_SCHEDULE = "schedule"
+	SCRUB_TRIGGER_MANUAL   = "manual"
+
+	scrubPollInterval = 20 * time.Second
+	maxScrubRecords   = 100 //No. of finished scrubs to keep in the history
+)
+
+type ScrubSchedule struct {
+	Array      string `json:"array"`       //e.g. md0
+	Cron       string `json:"cron"`        //e.g. 0 3 1 * * for 03:00 on the first day of every month
+	Action     string `json:"action"`      //check or repair
+	SpeedLimit int    `json:"speed_limit"` //Max sync speed in KiB/s during the scrub, 0 for the system default
+	Enabled    bool   `json:"enabled"`
+	NextRun    int64  `json:"next_run"` //Unix time of the next scrub, 0 if disabled
+}
+
+type ScrubRecord struct {
+	ID            string  `json:"id"`
+	Array         string  `json:"array"`   //e.g. md0
+	Action        string  `json:"action"`  //check or repair
+	Trigger       string  `json:"trigger"` //schedule or manual
+	Status        string  `json:"status"`
+	Progress      float64 `json:"progress"`       //Progress in percent
+	MismatchCount int64   `json:"mismatch_count"` //mismatch_cnt in sectors after the scrub, -1 if unknown
+	SpeedLimit    int     `json:"speed_limit"`
+	Error         string  `json:"error"`
+	StartTime     int64   `json:"start_time"`
+	EndTime       int64   `json:"end_time"`
+
+	//sync_speed_max of the array before the scrub, restored after the scrub
+	RestoreSpeedLimit string `json:"restore_speed_limit,omitempty"`
+}
+
+type scrubState struct {
+	Schedules []*ScrubSchedule `json:"schedules"`
+	History   []*ScrubRecord   `json:"history"`
+}
+
+type Scrubber struct {
+	OnProgress func(record *ScrubRecord) //Optional, called when the status or progress of a scrub changed
+	manager    *Manager
+	stateFile  string
+	sysfsRoot  string //Replaced in tests
+	schedules  []*ScrubSchedule
+	history    []*ScrubRecord
+	stop       chan bool
+	mutex      sync.Mutex
+}
+
+// NewScrubber creates a scrubber and loads the schedules and history from the state file,
+// call Start to run the schedules and track the running scrubs
+func NewScrubber(manager *Manager, stateFile string) (*Scrubber, error) {
+	scrubber := &Scrubber{
+		manager:   manager,
+		stateFile: stateFile,
+		sysfsRoot: "/sys/block",
+		schedules: []*ScrubSchedule{},
+		history:   []*ScrubRecord{},
+	}
+	if !utils.FileExists(stateFile) {
+		return scrubber, nil
+	}
+	content, err := os.ReadFile(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	state := scrubState{}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, errors.New("unable to parse scrub state: " + err.Error())
+	}
+	if state.Schedules != nil {
+		scrubber.schedules = state.Schedules
+	}
+	if state.History != nil {
+		scrubber.history = state.History
+	}
+	return scrubber, nil
+}
+
+// Start runs the schedules in the background. Scrubs missed while the service
+// was stopped are skipped, scrubs still running in the kernel are tracked again
+func (s *Scrubber) Start() error {
+	s.mutex.Lock()
+	if s.stop != nil {
+		s.mutex.Unlock()
+		return errors.New("scrubber already started")
+	}
+	s.stop = make(chan bool)
+	now := time.Now()
+	for _, schedule := range s.schedules {
+		s.updateNextRun(schedule, now)
+	}
+	stop := s.stop
+	s.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(scrubPollInterval)
+		defer ticker.Stop()
+		s.poll(time.Now())
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.poll(time.Now())
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops running the schedules, running scrubs are not cancelled
+func (s *Scrubber) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// StartScrub starts a check or repair on the array. speedLimit is the max
+// sync speed in KiB/s during the scrub, 0 to keep the current limit
+func (s *Scrubber) StartScrub(array string, action string, speedLimit int, trigger string) (*ScrubRecord, error) {
+	s.mutex.Lock()
+	record, err := s.startScrub(strings.TrimPrefix(array, "/dev/"), action, speedLimit, trigger)
+	s.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.notify(record)
+	return record, nil
+}
+
+// CancelScrub stops the running scrub on the array
+func (s *Scrubber) CancelScrub(array string) (*ScrubRecord, error) {
+	array = strings.TrimPrefix(array, "/dev/")
+	s.mutex.Lock()
+	record := s.runningRecord(array)
+	if record == nil {
+		s.mutex.Unlock()
+		return nil, errors.New("no scrub is running on " + array)
+	}
+	if err := s.writeSysfs(array, "sync_action", "idle"); err != nil {
+		s.mutex.Unlock()
+		return nil, errors.New("unable to cancel scrub: " + err.Error())
+	}
+	log.Println("[RAID] Scrub on " + array + " cancelled")
+	s.finishScrub(record, SCRUB_STATUS_CANCELLED, "")
+	thisRecord := *record
+	s.mutex.Unlock()
+
+	s.notify(&thisRecord)
+	return &thisRecord, nil
+}
+
+// History returns the scrubs of the array from the newest to the oldest, or of all arrays if array is empty
+func (s *Scrubber) History(array string) []*ScrubRecord {
+	array = strings.TrimPrefix(array, "/dev/")
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	results := []*ScrubRecord{}
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if array == "" || s.history[i].Array == array {
+			thisRecord := *s.history[i]
+			results = append(results, &thisRecord)
+		}
+	}
+	return results
+}
+
+// ListSchedules returns the scrub schedules of all arrays
+func (s *Scrubber) ListSchedules() []*ScrubSchedule {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	results := []*ScrubSchedule{}
+	for _, schedule := range s.schedules {
+		thisSchedule := *schedule
+		results = append(results, &thisSchedule)
+	}
+	return results
+}
+
+// SetSchedule validates the schedule and adds it, or replaces the current schedule of the array
+func (s *Scrubber) SetSchedule(schedule *ScrubSchedule) error {
+	schedule.Array = strings.TrimPrefix(schedule.Array, "/dev/")
+	if _, err := scheduler.Parse(schedule.Cron); err != nil {
+		return err
+	}
+	if schedule.Action == "" {
+		schedule.Action = SYNC_ACTION_CHECK
+	}
+	if schedule.Action != SYNC_ACTION_CHECK && schedule.Action != SYNC_ACTION_REPAIR {
+		return errors.New("scrub action must be check or repair")
+	}
+	if schedule.SpeedLimit < 0 {
+		return errors.New("invalid speed limit given")
+	}
+	if err := s.checkScrubbable(schedule.Array); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.updateNextRun(schedule, time.Now())
+	newSchedule := *schedule
+	replaced := false
+	for i, thisSchedule := range s.schedules {
+		if thisSchedule.Array == schedule.Array {
+			s.schedules[i] = &newSchedule
+			replaced = true
+		}
+	}
+	if !replaced {
+		s.schedules = append(s.schedules, &newSchedule)
+	}
+	return s.saveToFile()
+}
+
+// RemoveSchedule removes the scrub schedule of the array
+func (s *Scrubber) RemoveSchedule(array string) error {
+	array = strings.TrimPrefix(array, "/dev/")
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	results := []*ScrubSchedule{}
+	for _, schedule := range s.schedules {
+		if schedule.Array != array {
+			results = append(results, schedule)
+		}
+	}
+	if len(results) == len(s.schedules) {
+		return errors.New("no scrub schedule found for " + array)
+	}
+	s.schedules = results
+	return s.saveToFile()
+}
+
+// poll updates the running scrubs and starts the scrubs that are due
+func (s *Scrubber) poll(now time.Time) {
+	syncStates, err := s.manager.GetSyncStates()
+	if err != nil {
+		syncStates = []SyncState{}
+	}
+
+	s.mutex.Lock()
+	changed := []*ScrubRecord{}
+	for _, record := range s.history {
+		if record.Status == SCRUB_STATUS_RUNNING && s.updateRunningScrub(record, syncStates) {
+			thisRecord := *record
+			changed = append(changed, &thisRecord)
+		}
+	}
+
+	for _, schedule := range s.schedules {
+		if !schedule.Enabled || schedule.NextRun == 0 || now.Unix() < schedule.NextRun {
+			continue
+		}
+		s.updateNextRun(schedule, now)
+		record, err := s.startScrub(schedule.Array, schedule.Action, schedule.SpeedLimit, SCRUB_TRIGGER_SCHEDULE)
+		if err != nil {
+			//Keep the skipped scrub in the history so it does not go unnoticed
+			log.Println("[RAID] Scheduled scrub on " + schedule.Array + " skipped: " + err.Error())
+			record = &ScrubRecord{
+				ID:            uuid.New().String(),
+				Array:         schedule.Array,
+				Action:        schedule.Action,
+				Trigger:       SCRUB_TRIGGER_SCHEDULE,
+				Status:        SCRUB_STATUS_FAILED,
+				MismatchCount: -1,
+				SpeedLimit:    schedule.SpeedLimit,
+				Error:         err.Error(),
+				StartTime:     now.Unix(),
+				EndTime:       now.Unix(),
+			}
+			s.history = append(s.history, record)
+			s.pruneHistory()
+			thisRecord := *record
+			changed = append(changed, &thisRecord)
+		} else {
+			changed = append(changed, record)
+		}
+	}
+
+	if len(changed) > 0 {
+		if err := s.saveToFile(); err != nil {
+			log.Println("[RAID] Unable to save scrub state: " + err.Error())
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, record := range changed {
+		s.notify(record)
+	}
+}
+
+// updateRunningScrub updates the progress of the scrub and finishes it when the array
+// is idle again, returns true if changed. Require the mutex to be locked
+func (s *Scrubber) updateRunningScrub(record *ScrubRecord, syncStates []SyncState) bool {
+	syncAction, err := s.readSysfs(record.Array, "sync_action")
+	if err != nil {
+		s.finishScrub(record, SCRUB_STATUS_FAILED, "array not found")
+		return true
+	}
+
+	switch syncAction {
+	case record.Action:
+		for _, syncState := range syncStates {
+			//Only report whole percent changes
+			if syncState.DeviceName == record.Array && math.Floor(syncState.ResyncPercent) != math.Floor(record.Progress) {
+				record.Progress = syncState.ResyncPercent
+				return true
+			}
+		}
+		return false
+	case "idle":
+		s.finishScrub(record, SCRUB_STATUS_DONE, "")
+		log.Printf("[RAID] Scrub on %s finished with %d mismatches\n", record.Array, record.MismatchCount)
+	default:
+		//e.g. a recovery started after a disk failed
+		s.finishScrub(record, SCRUB_STATUS_FAILED, "interrupted by "+syncAction)
+		log.Println("[RAID] Scrub on " + record.Array + " interrupted by " + syncAction)
+	}
+	return true
+}
+
+// startScrub starts the scrub and adds it to the history, require the mutex to be locked
+func (s *Scrubber) startScrub(array string, action string, speedLimit int, trigger string) (*ScrubRecord, error) {
+	if action != SYNC_ACTION_CHECK && action != SYNC_ACTION_REPAIR {
+		return nil, errors.New("scrub action must be check or repair")
+	}
+	if speedLimit < 0 {
+		return nil, errors.New("invalid speed limit given")
+	}
+	if err := s.checkScrubbable(array); err != nil {
+		return nil, err
+	}
+	if s.runningRecord(array) != nil {
+		return nil, errors.New("a scrub is already running on " + array)
+	}
+	syncAction, err := s.readSysfs(array, "sync_action")
+	if err != nil {
+		return nil, err
+	}
+	if syncAction != "idle" {
+		return nil, errors.New("array is busy with " + syncAction + ", try again later")
+	}
+
+	record := &ScrubRecord{
+		ID:            uuid.New().String(),
+		Array:         array,
+		Action:        action,
+		Trigger:       trigger,
+		Status:        SCRUB_STATUS_RUNNING,
+		MismatchCount: -1,
+		SpeedLimit:    speedLimit,
+		StartTime:     time.Now().Unix(),
+	}
+	if speedLimit > 0 {
+		currentLimit, err := s.readSysfs(array, "sync_speed_max")
+		if err != nil {
+			return nil, err
+		}
+		if err := s.writeSysfs(array, "sync_speed_max", strconv.Itoa(speedLimit)); err != nil {
+			return nil, errors.New("unable to set speed limit: " + err.Error())
+		}
+		record.RestoreSpeedLimit = speedLimitToRestore(currentLimit)
+	}
+	if err := s.writeSysfs(array, "sync_action", action); err != nil {
+		s.restoreSpeedLimit(record)
+		return nil, errors.New("unable to start scrub: " + err.Error())
+	}
+
+	log.Println("[RAID] Scrub (" + action + ") started on " + array)
+	s.history = append(s.history, record)
+	s.pruneHistory()
+	if err := s.saveToFile(); err != nil {
+		log.Println("[RAID] Unable to save scrub state: " + err.Error())
+	}
+	thisRecord := *record
+	return &thisRecord, nil
+}
+
+// finishScrub records the mismatch count and restores the speed limit, require the mutex to be locked
+func (s *Scrubber) finishScrub(record *ScrubRecord, status string, errMsg string) {
+	record.Status = status
+	record.Error = errMsg
+	record.EndTime = time.Now().Unix()
+	if status == SCRUB_STATUS_DONE {
+		record.Progress = 100
+	}
+	if value, err := s.readSysfs(record.Array, "mismatch_cnt"); err == nil {
+		if mismatch, err := strconv.ParseInt(value, 10, 64); err == nil {
+			record.MismatchCount = mismatch
+		}
+	}
+	s.restoreSpeedLimit(record)
+	if err := s.saveToFile(); err != nil {
+		log.Println("[RAID] Unable to save scrub state: " + err.Error())
+	}
+}
+
+// restoreSpeedLimit sets sync_speed_max back to the value before the scrub
+func (s *Scrubber) restoreSpeedLimit(record *ScrubRecord) {
+	if record.RestoreSpeedLimit == "" {
+		return
+	}
+	if err := s.writeSysfs(record.Array, "sync_speed_max", record.RestoreSpeedLimit); err != nil {
+		log.Println("[RAID] Unable to restore speed limit of " + record.Array + ": " + err.Error())
+		return
+	}
+	record.RestoreSpeedLimit = ""
+}
+
+// checkScrubbable checks the array exists and has redundancy to be checked
+func (s *Scrubber) checkScrubbable(array string) error {
+	level, err := s.readSysfs(array, "level")
+	if err != nil {
+		return errors.New("target RAID array not exists")
+	}
+	if level == "raid0" || level == "linear" {
+		return errors.New(level + " has no redundancy to be checked")
+	}
+	return nil
+}
+
+// runningRecord returns the running scrub of the array, require the mutex to be locked
+func (s *Scrubber) runningRecord(array string) *ScrubRecord {
+	for _, record := range s.history {
+		if record.Array == array && record.Status == SCRUB_STATUS_RUNNING {
+			return record
+		}
+	}
+	return nil
+}
+
+// updateNextRun calculates the next run of the schedule after now, require the mutex to be locked
+func (s *Scrubber) updateNextRun(schedule *ScrubSchedule, now time.Time) {
+	schedule.NextRun = 0
+	if !schedule.Enabled {
+		return
+	}
+	cron, err := scheduler.Parse(schedule.Cron)
+	if err != nil {
+		log.Println("[RAID] Invalid scrub schedule for " + schedule.Array + ": " + err.Error())
+		return
+	}
+	if next := cron.Next(now); !next.IsZero() {
+		schedule.NextRun = next.Unix()
+	}
+}
+
+// pruneHistory removes the oldest finished scrubs, require the mutex to be locked
+func (s *Scrubber) pruneHistory() {
+	finished := 0
+	for _, record := range s.history {
+		if record.Status != SCRUB_STATUS_RUNNING {
+			finished++
+		}
+	}
+
+	results := []*ScrubRecord{}
+	for _, record := range s.history {
+		if record.Status != SCRUB_STATUS_RUNNING && finished > maxScrubRecords {
+			finished--
+			continue
+		}
+		results = append(results, record)
+	}
+	s.history = results
+}
+
+// saveToFile writes the schedules and history to the state file, require the mutex to be locked
+func (s *Scrubber) saveToFile() error {
+	js, err := json.MarshalIndent(scrubState{
+		Schedules: s.schedules,
+		History:   s.history,
+	}, "", " ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.stateFile), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.stateFile, js, 0644)
+}
+
+func (s *Scrubber) notify(record *ScrubRecord) {
+	if s.OnProgress != nil {
+		s.OnProgress(record)
+	}
+}
+
+// readSysfs reads an attribute in the md folder of the array, e.g. sync_action
+func (s *Scrubber) readSysfs(array string, attribute string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(s.sysfsRoot, array, "md", attribute))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// writeSysfs writes an attribute in the md folder of the array, with sudo if not running as root
+func (s *Scrubber) writeSysfs(array string, attribute string, value string) error {
+	attributePath := filepath.Join(s.sysfsRoot, array, "md", attribute)
+	err := os.WriteFile(attributePath, []byte(value), 0644)
+	if err == nil || !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+
+	cmd := exec.Command("sudo", "tee", attributePath)
+	cmd.Stdin = strings.NewReader(value)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// speedLimitToRestore converts the content of sync_speed_max, e.g. "200000 (system)"
+// or "50000 (local)", to the value to be written back after the scrub
+func speedLimitToRestore(content string) string {
+	fields := strings.Fields(content)
+	if len(fields) == 2 && fields[1] == "(local)" {
+		return fields[0]
+	}
+	return "system"
+}
+
+/*
+	Handlers
+*/
+
+// HandleScrubNow starts a scrub on the array, require raidDev (e.g. /dev/md0), action
+// (check or repair, default check) and speedLimit (KiB/s) are optional
+func (s *Scrubber) HandleScrubNow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	mdDev, err := utils.PostPara(r, "raidDev")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid raid device given")
+		return
+	}
+
+	action, _ := utils.PostPara(r, "action")
+	if action == "" {
+		action = SYNC_ACTION_CHECK
+	}
+
+	speedLimit := 0
+	if value, err := utils.PostPara(r, "speedLimit"); err == nil && value != "" {
+		speedLimit, err = strconv.Atoi(value)
+		if err != nil {
+			utils.SendErrorResponse(w, "invalid speed limit given")
+			return
+		}
+	}
+
+	record, err := s.StartScrub(mdDev, action, speedLimit, SCRUB_TRIGGER_MANUAL)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	js, _ := json.Marshal(record)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleCancelScrub cancels the running scrub on the array, require raidDev (e.g. /dev/md0)
+func (s *Scrubber) HandleCancelScrub(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	mdDev, err := utils.PostPara(r, "raidDev")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid raid device given")
+		return
+	}
+
+	record, err := s.CancelScrub(mdDev)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	js, _ := json.Marshal(record)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleScrubHistory lists the scrubs from the newest to the oldest, filtered by devName (e.g. md0) if given
+func (s *Scrubber) HandleScrubHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	devName, _ := utils.GetPara(r, "devName")
+	js, _ := json.Marshal(s.History(devName))
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleListScrubSchedules lists the scrub schedules of all arrays
+func (s *Scrubber) HandleListScrubSchedules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	js, _ := json.Marshal(s.ListSchedules())
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleSetScrubSchedule sets the scrub schedule of the array, require raidDev (e.g. /dev/md0)
+// and cron (e.g. 0 3 1 * *), action, speedLimit and enabled (default true) are optional
+func (s *Scrubber) HandleSetScrubSchedule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	mdDev, err := utils.PostPara(r, "raidDev")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid raid device given")
+		return
+	}
+
+	cron, err := utils.PostPara(r, "cron")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid cron expression given")
+		return
+	}
+
+	schedule := &ScrubSchedule{
+		Array:   mdDev,
+		Cron:    cron,
+		Enabled: true,
+	}
+	schedule.Action, _ = utils.PostPara(r, "action")
+	if enabled, err := utils.PostBool(r, "enabled"); err == nil {
+		schedule.Enabled = enabled
+	}
+	if value, err := utils.PostPara(r, "speedLimit"); err == nil && value != "" {
+		schedule.SpeedLimit, err = strconv.Atoi(value)
+		if err != nil {
+			utils.SendErrorResponse(w, "invalid speed limit given")
+			return
+		}
+	}
+
+	if err := s.SetSchedule(schedule); err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	js, _ := json.Marshal(schedule)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// HandleRemoveScrubSchedule removes the scrub schedule of the array, require raidDev (e.g. /dev/md0)
+func (s *Scrubber) HandleRemoveScrubSchedule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	mdDev, err := utils.PostPara(r, "raidDev")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid raid device given")
+		return
+	}
+
+	if err := s.RemoveSchedule(mdDev); err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	utils.SendOK(w)
+}
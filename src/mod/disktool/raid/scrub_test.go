@@ -0,0 +1,184 @@
+package raid
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestScrubber creates a scrubber on a fake sysfs with the given md attributes of md0
+func newTestScrubber(t *testing.T, attributes map[string]string) *Scrubber {
+	sysfsRoot := t.TempDir()
+	mdFolder := filepath.Join(sysfsRoot, "md0", "md")
+	if err := os.MkdirAll(mdFolder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range attributes {
+		writeTestAttribute(t, sysfsRoot, name, value)
+	}
+
+	scrubber, err := NewScrubber(&Manager{}, filepath.Join(t.TempDir(), "scrub.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrubber.sysfsRoot = sysfsRoot
+	return scrubber
+}
+
+func writeTestAttribute(t *testing.T, sysfsRoot string, name string, value string) {
+	if err := os.WriteFile(filepath.Join(sysfsRoot, "md0", "md", name), []byte(value+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestAttribute(t *testing.T, sysfsRoot string, name string) string {
+	content, err := os.ReadFile(filepath.Join(sysfsRoot, "md0", "md", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func TestScrubLifecycle(t *testing.T) {
+	scrubber := newTestScrubber(t, map[string]string{
+		"level":          "raid5",
+		"sync_action":    "idle",
+		"sync_speed_max": "200000 (system)",
+		"mismatch_cnt":   "0",
+	})
+	root := scrubber.sysfsRoot
+
+	record, err := scrubber.StartScrub("/dev/md0", SYNC_ACTION_CHECK, 50000, SCRUB_TRIGGER_MANUAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestAttribute(t, root, "sync_action"); got != "check" {
+		t.Errorf("expected sync_action check, got %q", got)
+	}
+	if got := readTestAttribute(t, root, "sync_speed_max"); got != "50000" {
+		t.Errorf("expected sync_speed_max 50000, got %q", got)
+	}
+	if _, err := scrubber.StartScrub("md0", SYNC_ACTION_CHECK, 0, SCRUB_TRIGGER_MANUAL); err == nil {
+		t.Error("expected error when a scrub is already running")
+	}
+
+	//Scrub finished in the kernel
+	writeTestAttribute(t, root, "sync_action", "idle")
+	writeTestAttribute(t, root, "mismatch_cnt", "128")
+	scrubber.poll(time.Now())
+
+	history := scrubber.History("md0")
+	if len(history) != 1 || history[0].ID != record.ID {
+		t.Fatalf("expected 1 record in history, got %d", len(history))
+	}
+	if history[0].Status != SCRUB_STATUS_DONE || history[0].MismatchCount != 128 {
+		t.Errorf("expected done with 128 mismatches, got %s with %d", history[0].Status, history[0].MismatchCount)
+	}
+	if got := readTestAttribute(t, root, "sync_speed_max"); got != "system" {
+		t.Errorf("expected sync_speed_max restored to system, got %q", got)
+	}
+
+	//History is kept in the state file
+	reloaded, err := NewScrubber(&Manager{}, scrubber.stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.History("")) != 1 {
+		t.Error("expected history to be loaded from the state file")
+	}
+}
+
+func TestScrubCancel(t *testing.T) {
+	scrubber := newTestScrubber(t, map[string]string{
+		"level":          "raid1",
+		"sync_action":    "idle",
+		"sync_speed_max": "1000 (local)",
+		"mismatch_cnt":   "0",
+	})
+
+	if _, err := scrubber.CancelScrub("md0"); err == nil {
+		t.Error("expected error when no scrub is running")
+	}
+	if _, err := scrubber.StartScrub("md0", SYNC_ACTION_REPAIR, 500, SCRUB_TRIGGER_MANUAL); err != nil {
+		t.Fatal(err)
+	}
+	record, err := scrubber.CancelScrub("md0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != SCRUB_STATUS_CANCELLED {
+		t.Errorf("expected cancelled, got %s", record.Status)
+	}
+	if got := readTestAttribute(t, scrubber.sysfsRoot, "sync_action"); got != "idle" {
+		t.Errorf("expected sync_action idle, got %q", got)
+	}
+	if got := readTestAttribute(t, scrubber.sysfsRoot, "sync_speed_max"); got != "1000" {
+		t.Errorf("expected local sync_speed_max restored, got %q", got)
+	}
+}
+
+func TestScrubRejected(t *testing.T) {
+	tests := []struct {
+		level      string
+		syncAction string
+		action     string
+	}{
+		{"raid0", "idle", SYNC_ACTION_CHECK},
+		{"raid5", "recover", SYNC_ACTION_CHECK},
+		{"raid5", "idle", "resync"},
+	}
+	for _, test := range tests {
+		scrubber := newTestScrubber(t, map[string]string{
+			"level":       test.level,
+			"sync_action": test.syncAction,
+		})
+		if _, err := scrubber.StartScrub("md0", test.action, 0, SCRUB_TRIGGER_MANUAL); err == nil {
+			t.Errorf("expected %s on %s (%s) to be rejected", test.action, test.level, test.syncAction)
+		}
+	}
+}
+
+func TestScrubSchedule(t *testing.T) {
+	scrubber := newTestScrubber(t, map[string]string{
+		"level":        "raid6",
+		"sync_action":  "idle",
+		"mismatch_cnt": "0",
+	})
+
+	if err := scrubber.SetSchedule(&ScrubSchedule{Array: "md0", Cron: "0 3 * *", Enabled: true}); err == nil {
+		t.Error("expected invalid cron expression to be rejected")
+	}
+	if err := scrubber.SetSchedule(&ScrubSchedule{Array: "md0", Cron: "0 3 * * sun", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	schedules := scrubber.ListSchedules()
+	if len(schedules) != 1 || schedules[0].Action != SYNC_ACTION_CHECK || schedules[0].NextRun == 0 {
+		t.Fatalf("unexpected schedules: %+v", schedules)
+	}
+
+	//Not due yet
+	scrubber.poll(time.Now())
+	if len(scrubber.History("md0")) != 0 {
+		t.Fatal("expected no scrub before the next run")
+	}
+
+	//Due
+	nextRun := time.Unix(schedules[0].NextRun, 0)
+	scrubber.poll(nextRun)
+	history := scrubber.History("md0")
+	if len(history) != 1 || history[0].Trigger != SCRUB_TRIGGER_SCHEDULE || history[0].Status != SCRUB_STATUS_RUNNING {
+		t.Fatalf("expected a running scheduled scrub, got %+v", history)
+	}
+	if next := scrubber.ListSchedules()[0].NextRun; next <= nextRun.Unix() {
+		t.Errorf("expected next run after %d, got %d", nextRun.Unix(), next)
+	}
+
+	if err := scrubber.RemoveSchedule("md0"); err != nil {
+		t.Fatal(err)
+	}
+	if len(scrubber.ListSchedules()) != 0 {
+		t.Error("expected schedule to be removed")
+	}
+}
@@ -4,13 +4,27 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 )
 
+// Sync actions reported in /proc/mdstat
+const (
+	SYNC_ACTION_RESYNC   = "resync"   //Initial sync or after unclean shutdown
+	SYNC_ACTION_RECOVERY = "recovery" //Rebuilding a replaced disk
+	SYNC_ACTION_RESHAPE  = "reshape"  //Changing the level, number of disks or chunk size
+	SYNC_ACTION_CHECK    = "check"    //Scrubbing, mismatches are counted but not repaired
+	SYNC_ACTION_REPAIR   = "repair"   //Scrubbing, mismatches are repaired
+)
+
+var syncActions = []string{SYNC_ACTION_RESYNC, SYNC_ACTION_RECOVERY, SYNC_ACTION_RESHAPE, SYNC_ACTION_CHECK, SYNC_ACTION_REPAIR}
+
 type SyncState struct {
 	DeviceName      string  //e.g, md0
+	Action          string  //resync, recovery, reshape, check or repair
 	ResyncPercent   float64 //e.g, 0.5
 	CompletedBlocks int64
 	TotalBlocks     int64
@@ -44,18 +58,22 @@ func (m *Manager) GetSyncStates() ([]SyncState, error) {
 		return nil, err
 	}
 	defer file.Close()
+	return parseSyncStates(file)
+}
 
+// parseSyncStates parses the progress lines of the content of /proc/mdstat
+func parseSyncStates(mdstat io.Reader) ([]SyncState, error) {
 	var syncStates []SyncState
 	var lastDeviceName string = ""
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(mdstat)
 	for scanner.Scan() {
 		line := scanner.Text()
-		if strings.Contains(line, "resync =") || strings.Contains(line, "recovery =") {
+		if action := getSyncAction(line); action != "" {
 			parts := strings.Fields(line)
-			var syncState SyncState
+			syncState := SyncState{Action: action}
 
 			for i, part := range parts {
-				if part == "resync" || part == "recovery" {
+				if part == action {
 					// Extract percentage
 					if i+2 < len(parts) && strings.HasSuffix(parts[i+2], "%") {
 						fmt.Sscanf(parts[i+2], "%f%%", &syncState.ResyncPercent)
@@ -104,6 +122,17 @@ func (m *Manager) GetSyncStates() ([]SyncState, error) {
 	return syncStates, nil
 }
 
+// getSyncAction returns the sync action of a progress line in /proc/mdstat, e.g.
+// "[=>...]  reshape = 12.6% (...)", or empty string if the line is not a progress line
+func getSyncAction(line string) string {
+	for _, action := range syncActions {
+		if strings.Contains(line, action+" =") {
+			return action
+		}
+	}
+	return ""
+}
+
 // SetSyncPendingToReadWrite sets the RAID device to read-write mode.
 // After a RAID array is created, it may be in a "sync-pending" state.
 // This function changes the state to "read-write".
@@ -131,3 +160,27 @@ func (m *Manager) SetSyncPendingToReadWrite(devname string) error {
 	}
 	return nil
 }
+
+// SpeedBytesPerSecond converts the sync speed to bytes per second, e.g. 1234K/sec
+func (s *SyncState) SpeedBytesPerSecond() int64 {
+	speed := strings.TrimSuffix(strings.TrimSuffix(s.Speed, "/sec"), "/s")
+	if speed == "" {
+		return 0
+	}
+
+	multiplier := int64(1)
+	switch speed[len(speed)-1] {
+	case 'K':
+		multiplier = 1024
+	case 'M':
+		multiplier = 1024 * 1024
+	case 'G':
+		multiplier = 1024 * 1024 * 1024
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimRight(speed, "KMG"), 64)
+	if err != nil {
+		return 0
+	}
+	return int64(value * float64(multiplier))
+}
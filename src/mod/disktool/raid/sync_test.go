@@ -0,0 +1,41 @@
+package raid
+
+import (
+	"strings"
+	"testing"
+)
+
+const testMdstat = `Personalities : [raid1] [raid6] [raid5] [raid4]
+md1 : active raid5 sde[4] sdd[3] sdc[1] sdb[0]
+      2093056 blocks super 1.2 level 5, 512k chunk, algorithm 2 [4/4] [UUUU]
+      [====>................]  reshape = 21.4% (224256/1046528) finish=4.5min speed=3754K/sec
+
+md0 : active raid1 sdg[1] sdf[0]
+      1046528 blocks super 1.2 [2/2] [UU]
+      [=>...................]  check =  5.0% (52352/1046528) finish=0.3min speed=52352K/sec
+
+md2 : active raid1 sdi[1] sdh[0]
+      1046528 blocks super 1.2 [2/2] [UU]
+
+unused devices: <none>
+`
+
+func TestParseSyncStates(t *testing.T) {
+	states, err := parseSyncStates(strings.NewReader(testMdstat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("expected 2 sync states, got %+v", states)
+	}
+
+	expected := []SyncState{
+		{DeviceName: "md1", Action: SYNC_ACTION_RESHAPE, ResyncPercent: 21.4, CompletedBlocks: 224256, TotalBlocks: 1046528, ExpectedTime: "4.5min", Speed: "3754K/sec"},
+		{DeviceName: "md0", Action: SYNC_ACTION_CHECK, ResyncPercent: 5, CompletedBlocks: 52352, TotalBlocks: 1046528, ExpectedTime: "0.3min", Speed: "52352K/sec"},
+	}
+	for i, state := range states {
+		if state != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], state)
+		}
+	}
+}
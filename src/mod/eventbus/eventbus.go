@@ -0,0 +1,154 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Event Bus
+
+	This module push live status updates to the web UI with Server-Sent Events,
+	so the UI does not need to poll the APIs that run lsblk, blkid or mdadm.
+
+	Producers publish to a topic (e.g. netstat, raid.sync) and clients subscribe
+	to the topics they need. Subscribing to a topic also subscribe to its sub-topics,
+	e.g. "raid" receives both "raid.sync" and "raid.event"
+
+	Events of state topics (e.g. raid.sync) are published as retained, the last
+	one is sent to new subscribers. One-shot events (e.g. raid.event) are not,
+	so they are not delivered again when the browser reconnects
+*/
+
+const SUBSCRIBER_BUFFER_SIZE = 64
+
+type Event struct {
+	Topic string
+	Data  json.RawMessage
+	Time  time.Time
+}
+
+type Subscriber struct {
+	topics []string
+	events chan *Event
+	filter func(event *Event) bool //Optional, return false to skip an event for this subscriber
+}
+
+type Hub struct {
+	subscribers map[*Subscriber]bool
+	lastEvents  map[string]*Event //The last retained event of each topic, sent to new subscribers
+	mutex       sync.RWMutex
+}
+
+// NewHub creates a new event hub
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: map[*Subscriber]bool{},
+		lastEvents:  map[string]*Event{},
+	}
+}
+
+// Publish sends data to all subscribers of the topic. Data is encoded as JSON once
+// for all subscribers. Slow subscribers with a full buffer miss the event instead
+// of blocking the producer. Set retained for state updates, so the event is also
+// sent to the clients that subscribe later
+func (h *Hub) Publish(topic string, data interface{}, retained bool) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		log.Println("[Eventbus] Unable to encode event of " + topic + ": " + err.Error())
+		return
+	}
+
+	event := &Event{
+		Topic: topic,
+		Data:  js,
+		Time:  time.Now(),
+	}
+
+	h.mutex.Lock()
+	if retained {
+		h.lastEvents[topic] = event
+	}
+	subscribers := []*Subscriber{}
+	for s := range h.subscribers {
+		if s.accept(event) {
+			subscribers = append(subscribers, s)
+		}
+	}
+	h.mutex.Unlock()
+
+	for _, s := range subscribers {
+		select {
+		case s.events <- event:
+		default:
+		}
+	}
+}
+
+// HasSubscribers returns true if anyone is listening to the topic, producers can
+// use this to skip expensive work when no client is connected
+func (h *Hub) HasSubscribers(topic string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for s := range h.subscribers {
+		if s.matchTopic(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe creates a subscriber of the given topics. The last retained event of each topic
+// is queued immediately so the client does not need to wait for the next update
+func (h *Hub) Subscribe(topics []string, filter func(event *Event) bool) *Subscriber {
+	s := &Subscriber{
+		topics: topics,
+		events: make(chan *Event, SUBSCRIBER_BUFFER_SIZE),
+		filter: filter,
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.subscribers[s] = true
+	for _, event := range h.lastEvents {
+		if s.accept(event) {
+			select {
+			case s.events <- event:
+			default:
+			}
+		}
+	}
+	return s
+}
+
+// Unsubscribe removes the subscriber from the hub
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.subscribers, s)
+}
+
+// Events returns the channel to receive the events of this subscriber
+func (s *Subscriber) Events() <-chan *Event {
+	return s.events
+}
+
+func (s *Subscriber) accept(event *Event) bool {
+	if !s.matchTopic(event.Topic) {
+		return false
+	}
+	return s.filter == nil || s.filter(event)
+}
+
+// matchTopic returns true if the topic or its parent topic is subscribed
+func (s *Subscriber) matchTopic(topic string) bool {
+	for _, t := range s.topics {
+		if t == topic || strings.HasPrefix(topic, t+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package eventbus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// receivedTopics returns the topics of the events queued in the subscriber
+func receivedTopics(s *Subscriber) []string {
+	topics := []string{}
+	for {
+		select {
+		case event := <-s.Events():
+			topics = append(topics, event.Topic)
+		default:
+			return topics
+		}
+	}
+}
+
+func TestTopicMatching(t *testing.T) {
+	hub := NewHub()
+	raid := hub.Subscribe([]string{"raid"}, nil)
+	exact := hub.Subscribe([]string{"raid.sync", "netstat"}, nil)
+
+	for _, topic := range []string{"raid.sync", "raid.event", "raidx", "raid", "netstat", "disk.hotplug"} {
+		hub.Publish(topic, topic, false)
+	}
+
+	if got := strings.Join(receivedTopics(raid), ","); got != "raid.sync,raid.event,raid" {
+		t.Errorf("expected raid and its sub-topics, got %s", got)
+	}
+	if got := strings.Join(receivedTopics(exact), ","); got != "raid.sync,netstat" {
+		t.Errorf("expected exact topics only, got %s", got)
+	}
+
+	if !hub.HasSubscribers("raid.replace") || hub.HasSubscribers("disk.hotplug") {
+		t.Error("unexpected HasSubscribers result")
+	}
+	hub.Unsubscribe(raid)
+	hub.Unsubscribe(exact)
+	if hub.HasSubscribers("raid.sync") {
+		t.Error("expected no subscribers after unsubscribe")
+	}
+}
+
+func TestSubscribeReceivesLastEvents(t *testing.T) {
+	hub := NewHub()
+	hub.Publish("raid.sync", 1, true)
+	hub.Publish("raid.sync", 2, true)
+	hub.Publish("netstat", 3, true)
+	hub.Publish("raid.event", 4, false)
+
+	//One-shot events are not retained, only the last raid.sync is sent
+	s := hub.Subscribe([]string{"raid"}, nil)
+	event := <-s.Events()
+	if event.Topic != "raid.sync" || string(event.Data) != "2" {
+		t.Errorf("expected the last raid.sync event, got %s %s", event.Topic, event.Data)
+	}
+	if topics := receivedTopics(s); len(topics) != 0 {
+		t.Errorf("expected no other events, got %v", topics)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	hub := NewHub()
+	s := hub.Subscribe([]string{"disk"}, func(event *Event) bool {
+		return event.Topic != "disk.hidden"
+	})
+	hub.Publish("disk.hidden", nil, false)
+	hub.Publish("disk.hotplug", nil, false)
+	if got := strings.Join(receivedTopics(s), ","); got != "disk.hotplug" {
+		t.Errorf("expected filtered events, got %s", got)
+	}
+}
+
+func TestSlowSubscriberDrop(t *testing.T) {
+	hub := NewHub()
+	slow := hub.Subscribe([]string{"netstat"}, nil)
+	fast := hub.Subscribe([]string{"netstat"}, nil)
+
+	//Publish must not block on the full buffer of the slow subscriber
+	received := 0
+	for i := 0; i < SUBSCRIBER_BUFFER_SIZE*2; i++ {
+		hub.Publish("netstat", i, true)
+		received += len(receivedTopics(fast))
+	}
+
+	if received != SUBSCRIBER_BUFFER_SIZE*2 {
+		t.Errorf("expected the fast subscriber to receive all %d events, got %d", SUBSCRIBER_BUFFER_SIZE*2, received)
+	}
+	if len(slow.Events()) != SUBSCRIBER_BUFFER_SIZE {
+		t.Fatalf("expected a full buffer of %d events, got %d", SUBSCRIBER_BUFFER_SIZE, len(slow.Events()))
+	}
+	//The events over the buffer size are dropped, the oldest are kept
+	if event := <-slow.Events(); string(event.Data) != "0" {
+		t.Errorf("expected the first event to be kept, got %s", event.Data)
+	}
+}
+
+func TestFormatEvent(t *testing.T) {
+	hub := NewHub()
+	hub.Publish("raid.sync", map[string]int{"progress": 50}, true)
+	s := hub.Subscribe([]string{"raid"}, nil)
+
+	expected := "data: {\"topic\":\"raid.sync\",\"data\":{\"progress\":50}}\n\n"
+	if got := string(formatEvent(<-s.Events())); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestHandleSubscribeInvalidRequest(t *testing.T) {
+	hub := NewHub()
+	for _, target := range []string{"/api/events", "/api/events?topics=,,"} {
+		w := httptest.NewRecorder()
+		hub.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if !strings.Contains(w.Body.String(), "no topics given") {
+			t.Errorf("%s: expected error, got %s", target, w.Body.String())
+		}
+	}
+}
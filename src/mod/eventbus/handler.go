@@ -0,0 +1,100 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	handler.go
+
+	Serve the events to the browser as a Server-Sent Events stream
+*/
+
+const HEARTBEAT_INTERVAL = 15 * time.Second
+
+// ServeHTTP streams events of the topics given in the "topics" query parameter,
+// e.g. /api/events?topics=netstat,raid.sync
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.HandleSubscribe(w, r, nil)
+}
+
+// HandleSubscribe streams events like ServeHTTP, with a filter to hide events
+// the requester is not allowed to see. filter can be nil
+func (h *Hub) HandleSubscribe(w http.ResponseWriter, r *http.Request, filter func(event *Event) bool) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	topicsStr, err := utils.GetPara(r, "topics")
+	if err != nil {
+		utils.SendErrorResponse(w, "no topics given")
+		return
+	}
+	topics := []string{}
+	for _, topic := range strings.Split(topicsStr, ",") {
+		topic = strings.TrimSpace(topic)
+		if topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) == 0 {
+		utils.SendErrorResponse(w, "no topics given")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	subscriber := h.Subscribe(topics, filter)
+	defer h.Unsubscribe(subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") //Disable buffering in nginx reverse proxy
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("retry: 3000\n\n"))
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			//Comment line to keep the connection alive behind proxies
+			if _, err := w.Write([]byte(": ping\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event := <-subscriber.Events():
+			if _, err := w.Write(formatEvent(event)); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// formatEvent returns the event in text/event-stream format. The event is sent
+// without an event name and carries its topic in the data, as the browser only
+// dispatches named events to listeners of the exact name and the client has to
+// match sub-topics (e.g. raid.sync for raid) itself. The JSON data never contains
+// a new line so it fits in a single data field
+func formatEvent(event *Event) []byte {
+	js, _ := json.Marshal(struct {
+		Topic string          `json:"topic"`
+		Data  json.RawMessage `json:"data"`
+	}{event.Topic, event.Data})
+	return []byte("data: " + string(js) + "\n\n")
+}
@@ -0,0 +1,221 @@
+package exporter
+
+import (
+	"bufio"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Exporter
+
+	This module export metrics in the Prometheus text exposition format.
+	Metrics are produced by collectors that run in the background at their
+	own interval, and scraping only serve the cached values so expensive
+	collectors (e.g. smartctl) never run on scrape
+*/
+
+type MetricType string
+
+const (
+	Gauge   MetricType = "gauge"
+	Counter MetricType = "counter"
+)
+
+type Metric struct {
+	Name   string
+	Help   string
+	Type   MetricType
+	Labels map[string]string
+	Value  float64
+}
+
+// CollectFunc returns the current metrics of a collector
+type CollectFunc func() ([]*Metric, error)
+
+type collector struct {
+	name     string
+	interval time.Duration //0 means collect on every scrape, only for cheap collectors
+	collect  CollectFunc
+	cache    []*Metric
+	mutex    sync.RWMutex
+}
+
+type Exporter struct {
+	collectors []*collector
+	stopChan   chan bool
+	mutex      sync.RWMutex
+}
+
+// NewExporter creates a new Prometheus exporter
+func NewExporter() *Exporter {
+	return &Exporter{
+		collectors: []*collector{},
+		stopChan:   make(chan bool),
+	}
+}
+
+// Register adds a collector to the exporter. Set interval to 0 to run the
+// collector on every scrape, which should only be used for in-memory values
+func (e *Exporter) Register(name string, interval time.Duration, collect CollectFunc) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.collectors = append(e.collectors, &collector{
+		name:     name,
+		interval: interval,
+		collect:  collect,
+		cache:    []*Metric{},
+	})
+}
+
+// Start runs the background collectors
+func (e *Exporter) Start() {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	for _, c := range e.collectors {
+		if c.interval <= 0 {
+			continue
+		}
+
+		go func(c *collector) {
+			c.refresh()
+			ticker := time.NewTicker(c.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-e.stopChan:
+					return
+				case <-ticker.C:
+					c.refresh()
+				}
+			}
+		}(c)
+	}
+}
+
+// Stop stops all the background collectors
+func (e *Exporter) Stop() {
+	close(e.stopChan)
+}
+
+func (c *collector) refresh() {
+	metrics, err := c.collect()
+	if err != nil {
+		log.Println("[Exporter] Collector " + c.name + " failed: " + err.Error())
+		//Keep serving the last known values
+		return
+	}
+
+	c.mutex.Lock()
+	c.cache = metrics
+	c.mutex.Unlock()
+}
+
+func (c *collector) metrics() []*Metric {
+	if c.interval <= 0 {
+		metrics, err := c.collect()
+		if err != nil {
+			return []*Metric{}
+		}
+		return metrics
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.cache
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mutex.RLock()
+	allMetrics := []*Metric{}
+	for _, c := range e.collectors {
+		allMetrics = append(allMetrics, c.metrics()...)
+	}
+	e.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	writeMetrics(bw, allMetrics)
+	bw.Flush()
+}
+
+// writeMetrics writes the metrics grouped by name, with HELP and TYPE once per metric name
+func writeMetrics(w *bufio.Writer, metrics []*Metric) {
+	groups := map[string][]*Metric{}
+	names := []string{}
+	for _, m := range metrics {
+		if _, ok := groups[m.Name]; !ok {
+			names = append(names, m.Name)
+		}
+		groups[m.Name] = append(groups[m.Name], m)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		group := groups[name]
+		if group[0].Help != "" {
+			w.WriteString("# HELP " + name + " " + escapeHelp(group[0].Help) + "\n")
+		}
+		metricType := group[0].Type
+		if metricType == "" {
+			metricType = Gauge
+		}
+		w.WriteString("# TYPE " + name + " " + string(metricType) + "\n")
+
+		for _, m := range group {
+			w.WriteString(name)
+			w.WriteString(formatLabels(m.Labels))
+			w.WriteString(" ")
+			w.WriteString(formatValue(m.Value))
+			w.WriteString("\n")
+		}
+	}
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := []string{}
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, k := range keys {
+		pairs = append(pairs, k+"=\""+escapeLabelValue(labels[k])+"\"")
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return helpEscaper.Replace(v)
+}
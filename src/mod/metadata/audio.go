@@ -0,0 +1,59 @@
+package metadata
+
+import (
+	"os"
+
+	"github.com/dhowden/tag"
+)
+
+type AudioMetadata struct {
+	Format      string `json:"format"`    //Tag format, e.g. ID3v2.3
+	FileType    string `json:"file_type"` //e.g. MP3, FLAC
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	AlbumArtist string `json:"album_artist,omitempty"`
+	Composer    string `json:"composer,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+	Year        int    `json:"year,omitempty"`
+	Track       int    `json:"track,omitempty"`
+	TotalTracks int    `json:"total_tracks,omitempty"`
+	Disc        int    `json:"disc,omitempty"`
+	TotalDiscs  int    `json:"total_discs,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+	HasPicture  bool   `json:"has_picture"`
+}
+
+// GetAudioMetadata reads the ID3 (or equivalent) tags of an audio file
+func GetAudioMetadata(realPath string) (*AudioMetadata, error) {
+	f, err := os.Open(realPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := tag.ReadFrom(f)
+	if err != nil {
+		return nil, err
+	}
+
+	track, totalTracks := m.Track()
+	disc, totalDiscs := m.Disc()
+	return &AudioMetadata{
+		Format:      string(m.Format()),
+		FileType:    string(m.FileType()),
+		Title:       m.Title(),
+		Artist:      m.Artist(),
+		Album:       m.Album(),
+		AlbumArtist: m.AlbumArtist(),
+		Composer:    m.Composer(),
+		Genre:       m.Genre(),
+		Year:        m.Year(),
+		Track:       track,
+		TotalTracks: totalTracks,
+		Disc:        disc,
+		TotalDiscs:  totalDiscs,
+		Comment:     m.Comment(),
+		HasPicture:  m.Picture() != nil,
+	}, nil
+}
@@ -0,0 +1,406 @@
+package metadata
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+	image.go
+
+	This file read the dimension and EXIF data of images.
+	EXIF is parsed from the APP1 segment of JPEG files or
+	the IFDs of TIFF files
+*/
+
+type ImageMetadata struct {
+	Width  int       `json:"width,omitempty"`
+	Height int       `json:"height,omitempty"`
+	Exif   *ExifData `json:"exif,omitempty"`
+}
+
+type ExifData struct {
+	Make             string   `json:"make,omitempty"`
+	Model            string   `json:"model,omitempty"`
+	Software         string   `json:"software,omitempty"`
+	Orientation      int      `json:"orientation,omitempty"`
+	DateTime         string   `json:"date_time,omitempty"`
+	DateTimeOriginal string   `json:"date_time_original,omitempty"`
+	ExposureTime     string   `json:"exposure_time,omitempty"` //e.g. 1/125
+	FNumber          float64  `json:"f_number,omitempty"`
+	ISO              int      `json:"iso,omitempty"`
+	FocalLength      float64  `json:"focal_length,omitempty"` //In mm
+	LensModel        string   `json:"lens_model,omitempty"`
+	GPSLatitude      *float64 `json:"gps_latitude,omitempty"`
+	GPSLongitude     *float64 `json:"gps_longitude,omitempty"`
+	GPSAltitude      *float64 `json:"gps_altitude,omitempty"`
+}
+
+const (
+	exifTagMake             = 0x010F
+	exifTagModel            = 0x0110
+	exifTagOrientation      = 0x0112
+	exifTagSoftware         = 0x0131
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagGPSIFD           = 0x8825
+	exifTagExposureTime     = 0x829A
+	exifTagFNumber          = 0x829D
+	exifTagISO              = 0x8827
+	exifTagDateTimeOriginal = 0x9003
+	exifTagFocalLength      = 0x920A
+	exifTagLensModel        = 0xA434
+	gpsTagLatitudeRef       = 0x0001
+	gpsTagLatitude          = 0x0002
+	gpsTagLongitudeRef      = 0x0003
+	gpsTagLongitude         = 0x0004
+	gpsTagAltitudeRef       = 0x0005
+	gpsTagAltitude          = 0x0006
+
+	maxExifSize = 1 << 20 //Do not read more than 1MB of TIFF data
+)
+
+// GetImageMetadata reads the dimension and the EXIF data of an image
+func GetImageMetadata(realPath string) (*ImageMetadata, error) {
+	f, err := os.Open(realPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := ImageMetadata{}
+	config, _, err := image.DecodeConfig(f)
+	if err == nil {
+		result.Width = config.Width
+		result.Height = config.Height
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var tiffData []byte
+	switch strings.ToLower(filepath.Ext(realPath)) {
+	case ".jpg", ".jpeg":
+		tiffData, err = findJPEGExif(bufio.NewReader(f))
+	case ".tif", ".tiff":
+		tiffData, err = io.ReadAll(io.LimitReader(f, maxExifSize))
+	default:
+		return &result, nil
+	}
+
+	if err != nil || tiffData == nil {
+		//Image without EXIF
+		return &result, nil
+	}
+
+	result.Exif, err = parseExif(tiffData)
+	if err != nil {
+		return &result, err
+	}
+	return &result, nil
+}
+
+// findJPEGExif looks for the EXIF APP1 segment in a JPEG stream and return the TIFF data in it
+func findJPEGExif(r *bufio.Reader) ([]byte, error) {
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(r, soi); err != nil {
+		return nil, err
+	}
+	if soi[0] != 0xFF || soi[1] != 0xD8 {
+		return nil, errors.New("not a jpeg file")
+	}
+
+	for {
+		marker := make([]byte, 2)
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return nil, err
+		}
+		if marker[0] != 0xFF {
+			return nil, errors.New("invalid jpeg marker")
+		}
+
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			//Start of scan or end of image, no more metadata segments
+			return nil, nil
+		}
+
+		lengthBytes := make([]byte, 2)
+		if _, err := io.ReadFull(r, lengthBytes); err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint16(lengthBytes)) - 2
+		if length < 0 {
+			return nil, errors.New("invalid jpeg segment length")
+		}
+
+		if marker[1] == 0xE1 {
+			segment := make([]byte, length)
+			if _, err := io.ReadFull(r, segment); err != nil {
+				return nil, err
+			}
+			if len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+				return segment[6:], nil
+			}
+			//Other APP1 segments, e.g. XMP
+			continue
+		}
+
+		if _, err := r.Discard(length); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// tiffReader reads the IFD entries in a TIFF structure
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	tag      uint16
+	dataType uint16
+	count    uint32
+	value    []byte //Raw value of the entry
+}
+
+// parseExif parses the TIFF structure of the EXIF data
+func parseExif(data []byte) (*ExifData, error) {
+	if len(data) < 8 {
+		return nil, errors.New("exif data too short")
+	}
+
+	t := tiffReader{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid tiff byte order")
+	}
+
+	if t.order.Uint16(data[2:4]) != 42 {
+		return nil, errors.New("invalid tiff header")
+	}
+
+	result := ExifData{}
+	ifd0, err := t.readIFD(t.order.Uint32(data[4:8]))
+	if err != nil {
+		return nil, err
+	}
+
+	var exifOffset, gpsOffset uint32
+	for _, entry := range ifd0 {
+		switch entry.tag {
+		case exifTagMake:
+			result.Make = t.asString(entry)
+		case exifTagModel:
+			result.Model = t.asString(entry)
+		case exifTagSoftware:
+			result.Software = t.asString(entry)
+		case exifTagOrientation:
+			result.Orientation = int(t.asUint(entry))
+		case exifTagDateTime:
+			result.DateTime = t.asString(entry)
+		case exifTagExifIFD:
+			exifOffset = t.asUint(entry)
+		case exifTagGPSIFD:
+			gpsOffset = t.asUint(entry)
+		}
+	}
+
+	if exifOffset > 0 {
+		exifIFD, err := t.readIFD(exifOffset)
+		if err == nil {
+			for _, entry := range exifIFD {
+				switch entry.tag {
+				case exifTagExposureTime:
+					num, den := t.asRational(entry, 0)
+					if den != 0 {
+						result.ExposureTime = formatExposureTime(num, den)
+					}
+				case exifTagFNumber:
+					result.FNumber = t.asFloat(entry, 0)
+				case exifTagISO:
+					result.ISO = int(t.asUint(entry))
+				case exifTagDateTimeOriginal:
+					result.DateTimeOriginal = t.asString(entry)
+				case exifTagFocalLength:
+					result.FocalLength = t.asFloat(entry, 0)
+				case exifTagLensModel:
+					result.LensModel = t.asString(entry)
+				}
+			}
+		}
+	}
+
+	if gpsOffset > 0 {
+		gpsIFD, err := t.readIFD(gpsOffset)
+		if err == nil {
+			t.parseGPS(gpsIFD, &result)
+		}
+	}
+
+	return &result, nil
+}
+
+// readIFD reads all the entries of the IFD at the given offset
+func (t *tiffReader) readIFD(offset uint32) ([]*ifdEntry, error) {
+	if int(offset)+2 > len(t.data) {
+		return nil, errors.New("ifd offset out of range")
+	}
+
+	count := int(t.order.Uint16(t.data[offset:]))
+	entries := []*ifdEntry{}
+	for i := 0; i < count; i++ {
+		start := int(offset) + 2 + i*12
+		if start+12 > len(t.data) {
+			return entries, errors.New("ifd entry out of range")
+		}
+
+		raw := t.data[start : start+12]
+		entry := ifdEntry{
+			tag:      t.order.Uint16(raw[0:2]),
+			dataType: t.order.Uint16(raw[2:4]),
+			count:    t.order.Uint32(raw[4:8]),
+		}
+
+		size := exifTypeSize(entry.dataType) * int(entry.count)
+		if size <= 0 {
+			continue
+		}
+
+		if size <= 4 {
+			entry.value = raw[8 : 8+size]
+		} else {
+			valueOffset := int(t.order.Uint32(raw[8:12]))
+			if valueOffset+size > len(t.data) || valueOffset < 0 {
+				continue
+			}
+			entry.value = t.data[valueOffset : valueOffset+size]
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
+
+func (t *tiffReader) parseGPS(entries []*ifdEntry, result *ExifData) {
+	var latRef, lonRef string
+	var lat, lon, alt *float64
+	altBelowSeaLevel := false
+	for _, entry := range entries {
+		switch entry.tag {
+		case gpsTagLatitudeRef:
+			latRef = t.asString(entry)
+		case gpsTagLongitudeRef:
+			lonRef = t.asString(entry)
+		case gpsTagLatitude:
+			lat = t.asDegrees(entry)
+		case gpsTagLongitude:
+			lon = t.asDegrees(entry)
+		case gpsTagAltitudeRef:
+			altBelowSeaLevel = len(entry.value) > 0 && entry.value[0] == 1
+		case gpsTagAltitude:
+			a := t.asFloat(entry, 0)
+			alt = &a
+		}
+	}
+
+	if lat != nil && latRef == "S" {
+		*lat = -*lat
+	}
+	if lon != nil && lonRef == "W" {
+		*lon = -*lon
+	}
+	if alt != nil && altBelowSeaLevel {
+		*alt = -*alt
+	}
+
+	result.GPSLatitude = lat
+	result.GPSLongitude = lon
+	result.GPSAltitude = alt
+}
+
+// exifTypeSize returns the size in bytes of the given TIFF data type
+func exifTypeSize(dataType uint16) int {
+	switch dataType {
+	case 1, 2, 6, 7: //BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: //SHORT, SSHORT
+		return 2
+	case 4, 9, 11: //LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: //RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
+
+func (t *tiffReader) asString(entry *ifdEntry) string {
+	return strings.TrimSpace(strings.TrimRight(string(entry.value), "\x00"))
+}
+
+func (t *tiffReader) asUint(entry *ifdEntry) uint32 {
+	switch entry.dataType {
+	case 1, 7:
+		return uint32(entry.value[0])
+	case 3, 8:
+		return uint32(t.order.Uint16(entry.value))
+	case 4, 9:
+		return t.order.Uint32(entry.value)
+	}
+	return 0
+}
+
+// asRational returns the numerator and denominator of the n-th rational value
+func (t *tiffReader) asRational(entry *ifdEntry, n int) (int64, int64) {
+	if (entry.dataType != 5 && entry.dataType != 10) || len(entry.value) < (n+1)*8 {
+		return 0, 0
+	}
+
+	raw := entry.value[n*8 : n*8+8]
+	if entry.dataType == 10 {
+		return int64(int32(t.order.Uint32(raw[0:4]))), int64(int32(t.order.Uint32(raw[4:8])))
+	}
+	return int64(t.order.Uint32(raw[0:4])), int64(t.order.Uint32(raw[4:8]))
+}
+
+func (t *tiffReader) asFloat(entry *ifdEntry, n int) float64 {
+	num, den := t.asRational(entry, n)
+	if den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
+
+// asDegrees converts the GPS degrees, minutes and seconds to decimal degrees
+func (t *tiffReader) asDegrees(entry *ifdEntry) *float64 {
+	if entry.count < 3 {
+		return nil
+	}
+	degrees := t.asFloat(entry, 0) + t.asFloat(entry, 1)/60 + t.asFloat(entry, 2)/3600
+	return &degrees
+}
+
+// formatExposureTime formats the exposure time like cameras do, e.g. 1/125 or 2.5
+func formatExposureTime(num int64, den int64) string {
+	if num == 0 {
+		return "0"
+	}
+	if num < den {
+		return fmt.Sprintf("1/%d", (den+num/2)/num)
+	}
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", float64(num)/float64(den)), "0"), ".")
+}
@@ -0,0 +1,286 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+type testIFDEntry struct {
+	tag      uint16
+	dataType uint16
+	count    uint32
+	value    []byte //Values longer than 4 bytes are written after the IFD
+}
+
+// testIFDSize returns the size of an IFD with its out of line values
+func testIFDSize(entries []testIFDEntry) int {
+	size := 2 + 12*len(entries) + 4
+	for _, entry := range entries {
+		if len(entry.value) > 4 {
+			size += len(entry.value)
+		}
+	}
+	return size
+}
+
+// buildTestIFD encodes an IFD that is placed at the given offset of the TIFF data
+func buildTestIFD(order binary.ByteOrder, offset int, entries []testIFDEntry) []byte {
+	buf := make([]byte, 2+12*len(entries)+4)
+	order.PutUint16(buf, uint16(len(entries)))
+	dataOffset := offset + len(buf)
+	values := []byte{}
+	for i, entry := range entries {
+		raw := buf[2+12*i : 2+12*i+12]
+		order.PutUint16(raw[0:2], entry.tag)
+		order.PutUint16(raw[2:4], entry.dataType)
+		order.PutUint32(raw[4:8], entry.count)
+		if len(entry.value) <= 4 {
+			copy(raw[8:12], entry.value)
+		} else {
+			order.PutUint32(raw[8:12], uint32(dataOffset+len(values)))
+			values = append(values, entry.value...)
+		}
+	}
+	return append(buf, values...)
+}
+
+// buildTestTIFF encodes IFD0, the EXIF IFD and the GPS IFD in a TIFF structure
+func buildTestTIFF(order binary.ByteOrder, ifd0 []testIFDEntry, exifIFD []testIFDEntry, gpsIFD []testIFDEntry) []byte {
+	header := []byte("II\x2a\x00\x08\x00\x00\x00")
+	if order == binary.BigEndian {
+		header = []byte("MM\x00\x2a\x00\x00\x00\x08")
+	}
+
+	//IFD0 points to the EXIF and GPS IFDs that follow it
+	exifOffset := 8 + testIFDSize(ifd0) + 24
+	gpsOffset := exifOffset + testIFDSize(exifIFD)
+	if exifIFD != nil {
+		ifd0 = append(ifd0, testIFDEntry{exifTagExifIFD, 4, 1, testLong(order, uint32(exifOffset))})
+	}
+	if gpsIFD != nil {
+		ifd0 = append(ifd0, testIFDEntry{exifTagGPSIFD, 4, 1, testLong(order, uint32(gpsOffset))})
+	}
+
+	data := append(header, buildTestIFD(order, 8, ifd0)...)
+	if exifIFD != nil {
+		data = append(data, buildTestIFD(order, exifOffset, exifIFD)...)
+	}
+	if gpsIFD != nil {
+		data = append(data, buildTestIFD(order, gpsOffset, gpsIFD)...)
+	}
+	return data
+}
+
+func testASCII(s string) testIFDEntry {
+	return testIFDEntry{value: append([]byte(s), 0), dataType: 2, count: uint32(len(s) + 1)}
+}
+
+func testShort(order binary.ByteOrder, v uint16) []byte {
+	b := make([]byte, 2)
+	order.PutUint16(b, v)
+	return b
+}
+
+func testLong(order binary.ByteOrder, v uint32) []byte {
+	b := make([]byte, 4)
+	order.PutUint32(b, v)
+	return b
+}
+
+func testRationals(order binary.ByteOrder, values ...uint32) []byte {
+	b := []byte{}
+	for _, v := range values {
+		b = append(b, testLong(order, v)...)
+	}
+	return b
+}
+
+func withTag(tag uint16, entry testIFDEntry) testIFDEntry {
+	entry.tag = tag
+	return entry
+}
+
+func TestParseExif(t *testing.T) {
+	le := binary.LittleEndian
+	full := buildTestTIFF(le,
+		[]testIFDEntry{
+			withTag(exifTagMake, testASCII("Canon")),
+			withTag(exifTagModel, testASCII("Canon EOS R6")),
+			{exifTagOrientation, 3, 1, testShort(le, 6)},
+		},
+		[]testIFDEntry{
+			{exifTagExposureTime, 5, 1, testRationals(le, 1, 125)},
+			{exifTagFNumber, 5, 1, testRationals(le, 28, 10)},
+			{exifTagISO, 3, 1, testShort(le, 400)},
+			{exifTagFocalLength, 5, 1, testRationals(le, 50, 1)},
+			withTag(exifTagLensModel, testASCII("RF24-105mm F4 L IS USM")),
+		},
+		[]testIFDEntry{
+			withTag(gpsTagLatitudeRef, testASCII("N")),
+			{gpsTagLatitude, 5, 3, testRationals(le, 22, 1, 30, 1, 0, 1)},
+			withTag(gpsTagLongitudeRef, testASCII("W")),
+			{gpsTagLongitude, 5, 3, testRationals(le, 114, 1, 0, 1, 36, 1)},
+			{gpsTagAltitudeRef, 1, 1, []byte{1}},
+			{gpsTagAltitude, 5, 1, testRationals(le, 10, 1)},
+		},
+	)
+
+	exif, err := parseExif(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exif.Make != "Canon" || exif.Model != "Canon EOS R6" || exif.Orientation != 6 {
+		t.Errorf("unexpected IFD0 values: %+v", exif)
+	}
+	if exif.ExposureTime != "1/125" || exif.FNumber != 2.8 || exif.ISO != 400 || exif.FocalLength != 50 || exif.LensModel != "RF24-105mm F4 L IS USM" {
+		t.Errorf("unexpected EXIF IFD values: %+v", exif)
+	}
+	if exif.GPSLatitude == nil || *exif.GPSLatitude != 22.5 {
+		t.Errorf("unexpected latitude: %v", exif.GPSLatitude)
+	}
+	if exif.GPSLongitude == nil || math.Abs(*exif.GPSLongitude+114.01) > 1e-9 {
+		t.Errorf("unexpected longitude: %v", exif.GPSLongitude)
+	}
+	if exif.GPSAltitude == nil || *exif.GPSAltitude != -10 {
+		t.Errorf("unexpected altitude: %v", exif.GPSAltitude)
+	}
+
+	be := binary.BigEndian
+	exif, err = parseExif(buildTestTIFF(be, []testIFDEntry{
+		withTag(exifTagMake, testASCII("NIKON")),
+		{exifTagOrientation, 3, 1, testShort(be, 1)},
+	}, nil, nil))
+	if err != nil || exif.Make != "NIKON" || exif.Orientation != 1 {
+		t.Errorf("unexpected big endian result: %+v, %v", exif, err)
+	}
+}
+
+func TestParseMalformedExif(t *testing.T) {
+	le := binary.LittleEndian
+	valid := buildTestTIFF(le, []testIFDEntry{withTag(exifTagMake, testASCII("Canon"))}, nil, nil)
+
+	//IFD0 with a pointer to an EXIF IFD that is not in the data
+	danglingExif := buildTestTIFF(le, []testIFDEntry{
+		withTag(exifTagMake, testASCII("Canon")),
+		{exifTagExifIFD, 4, 1, testLong(le, 0xFFFFFF00)},
+	}, nil, nil)
+
+	//Value offset and value size out of range
+	badValues := buildTestTIFF(le, []testIFDEntry{
+		withTag(exifTagMake, testASCII("Canon")),
+		{exifTagModel, 2, 32, testLong(le, 0xFFFFFFF0)},
+		{exifTagSoftware, 2, 0xFFFFFFFF, testLong(le, 8)},
+		{exifTagOrientation, 0xFF, 1, testShort(le, 6)},
+	}, nil, nil)
+
+	//GPS coordinates with too few or wrongly typed values
+	badGPS := buildTestTIFF(le, nil, nil, []testIFDEntry{
+		{gpsTagLatitude, 5, 2, testRationals(le, 22, 1, 30, 1)},
+		{gpsTagLongitude, 3, 3, []byte{1, 0, 2, 0, 3, 0}},
+	})
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantErr  bool
+		wantMake string
+	}{
+		{"empty", []byte{}, true, ""},
+		{"short header", []byte("II\x2a\x00"), true, ""},
+		{"invalid byte order", append([]byte("XX"), valid[2:]...), true, ""},
+		{"invalid magic", append([]byte("II\x2b\x00"), valid[4:]...), true, ""},
+		{"ifd0 out of range", []byte("II\x2a\x00\xff\xff\xff\xff"), true, ""},
+		{"ifd0 at end of data", []byte("II\x2a\x00\x07\x00\x00\x00"), true, ""},
+		{"truncated ifd0", valid[:8+2+6], true, ""},
+		{"entry count beyond data", append([]byte("II\x2a\x00\x08\x00\x00\x00"), 0xff, 0xff), true, ""},
+		{"truncated value", valid[:len(valid)-3], false, ""},
+		{"dangling exif ifd", danglingExif, false, "Canon"},
+		{"values out of range", badValues, false, "Canon"},
+		{"malformed gps", badGPS, false, ""},
+	}
+	for _, test := range tests {
+		exif, err := parseExif(test.data)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.wantErr, err)
+			continue
+		}
+		if err == nil && exif.Make != test.wantMake {
+			t.Errorf("%s: expected make %q, got %q", test.name, test.wantMake, exif.Make)
+		}
+	}
+
+	exif, _ := parseExif(badValues)
+	if exif.Model != "" || exif.Software != "" || exif.Orientation != 0 {
+		t.Errorf("expected out of range values to be skipped, got %+v", exif)
+	}
+	exif, _ = parseExif(badGPS)
+	if exif.GPSLatitude != nil {
+		t.Errorf("expected latitude with 2 values to be skipped, got %v", *exif.GPSLatitude)
+	}
+}
+
+func TestFindJPEGExif(t *testing.T) {
+	tiff := buildTestTIFF(binary.LittleEndian, []testIFDEntry{withTag(exifTagMake, testASCII("Canon"))}, nil, nil)
+	segment := func(marker byte, payload []byte) []byte {
+		length := make([]byte, 2)
+		binary.BigEndian.PutUint16(length, uint16(len(payload)+2))
+		return append(append([]byte{0xFF, marker}, length...), payload...)
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	soi := []byte{0xFF, 0xD8}
+	exifSegment := segment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantErr  bool
+		wantExif bool
+	}{
+		{"exif after app0", join(soi, segment(0xE0, []byte("JFIF\x00\x01\x01")), exifSegment), false, true},
+		{"exif after xmp", join(soi, segment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00")), exifSegment), false, true},
+		{"no exif", join(soi, segment(0xE0, []byte("JFIF\x00")), []byte{0xFF, 0xDA}), false, false},
+		{"not a jpeg", []byte("\x89PNG\r\n\x1a\n"), true, false},
+		{"empty", []byte{}, true, false},
+		{"invalid marker", join(soi, []byte{0x00, 0xE1}), true, false},
+		{"truncated length", join(soi, []byte{0xFF, 0xE1, 0x00}), true, false},
+		{"invalid length", join(soi, []byte{0xFF, 0xE1, 0x00, 0x01}), true, false},
+		{"truncated segment", join(soi, exifSegment[:20]), true, false},
+		{"truncated skipped segment", join(soi, segment(0xE0, make([]byte, 100))[:50]), true, false},
+	}
+	for _, test := range tests {
+		data, err := findJPEGExif(bufio.NewReader(bytes.NewReader(test.data)))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.wantErr, err)
+			continue
+		}
+		if test.wantExif && !bytes.Equal(data, tiff) {
+			t.Errorf("%s: expected the TIFF data of the EXIF segment", test.name)
+		} else if !test.wantExif && data != nil {
+			t.Errorf("%s: expected no EXIF data", test.name)
+		}
+	}
+}
+
+func TestFormatExposureTime(t *testing.T) {
+	tests := []struct {
+		num, den int64
+		expected string
+	}{
+		{1, 125, "1/125"},
+		{10, 1250, "1/125"},
+		{3, 10, "1/3"},
+		{5, 2, "2.5"},
+		{30, 1, "30"},
+		{0, 1, "0"},
+	}
+	for _, test := range tests {
+		if got := formatExposureTime(test.num, test.den); got != test.expected {
+			t.Errorf("%d/%d: expected %s, got %s", test.num, test.den, test.expected, got)
+		}
+	}
+}
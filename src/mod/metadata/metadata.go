@@ -0,0 +1,209 @@
+package metadata
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Metadata
+
+	This module extract structured metadata from files, including
+	basic file properties, EXIF of images, ID3 tags of audio,
+	stream information of videos and geometry of 3D models
+*/
+
+type FileMetadata struct {
+	Name     string         `json:"name"`
+	Path     string         `json:"path"` //Virtual path of the file, e.g. /disk1/photos/a.jpg
+	IsDir    bool           `json:"is_dir"`
+	Size     int64          `json:"size"`
+	ModTime  time.Time      `json:"mtime"`
+	MimeType string         `json:"mime_type,omitempty"`
+	SHA256   string         `json:"sha256,omitempty"` //Only if requested and the file is not larger than maxChecksumSize
+	Image    *ImageMetadata `json:"image,omitempty"`
+	Audio    *AudioMetadata `json:"audio,omitempty"`
+	Video    *VideoMetadata `json:"video,omitempty"`
+	Model    *ModelMetadata `json:"model,omitempty"`
+}
+
+var (
+	imageFormats = []string{".jpg", ".jpeg", ".png", ".gif", ".tif", ".tiff", ".webp"}
+	audioFormats = []string{".mp3", ".flac", ".ogg", ".m4a", ".aac", ".wav", ".dsf"}
+	videoFormats = []string{".mp4", ".mkv", ".webm", ".mov", ".avi", ".flv", ".wmv", ".m4v", ".ts"}
+	modelFormats = []string{".stl", ".obj", ".ply", ".3ds"}
+)
+
+const (
+	maxChecksumSize    = 2 << 30 //Hashing larger files takes minutes, their checksum is skipped
+	maxCachedChecksums = 4096    //Least recently used checksums are evicted
+)
+
+// checksumCache stores the checksum of files so unchanged files are not hashed again
+var checksumCache = struct {
+	sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List //Most recently used at the front
+}{
+	entries: map[string]*list.Element{},
+	order:   list.New(),
+}
+
+type cachedChecksum struct {
+	path    string
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// GetFileMetadata returns the metadata of a file on disk. Failure of
+// extracting the type specific metadata will not fail the whole request.
+// Set withChecksum to hash the file, which reads the whole file
+func GetFileMetadata(realPath string, withChecksum bool) (*FileMetadata, error) {
+	info, err := os.Stat(realPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := FileMetadata{
+		Name:    info.Name(),
+		IsDir:   info.IsDir(),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+
+	if info.IsDir() {
+		return &result, nil
+	}
+
+	result.MimeType = getMimeType(realPath)
+	if withChecksum && info.Size() <= maxChecksumSize {
+		result.SHA256, err = getChecksum(realPath, info)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ext := strings.ToLower(filepath.Ext(realPath))
+	if stringInSlice(ext, imageFormats) {
+		result.Image, err = GetImageMetadata(realPath)
+		if err != nil {
+			log.Println("[Metadata] Unable to read image metadata of " + realPath + ": " + err.Error())
+		}
+	} else if stringInSlice(ext, audioFormats) {
+		result.Audio, err = GetAudioMetadata(realPath)
+		if err != nil {
+			log.Println("[Metadata] Unable to read audio metadata of " + realPath + ": " + err.Error())
+		}
+	} else if stringInSlice(ext, videoFormats) {
+		result.Video, err = GetVideoMetadata(realPath)
+		if err != nil {
+			log.Println("[Metadata] Unable to read video metadata of " + realPath + ": " + err.Error())
+		}
+	} else if stringInSlice(ext, modelFormats) {
+		result.Model, err = GetModelMetadata(realPath)
+		if err != nil {
+			log.Println("[Metadata] Unable to read model metadata of " + realPath + ": " + err.Error())
+		}
+	}
+
+	return &result, nil
+}
+
+// getMimeType returns the MIME type by file extension, or by sniffing the file content
+func getMimeType(realPath string) string {
+	mimeType := mime.TypeByExtension(filepath.Ext(realPath))
+	if mimeType != "" {
+		return mimeType
+	}
+
+	f, err := os.Open(realPath)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	return http.DetectContentType(buf[:n])
+}
+
+// getChecksum returns the SHA256 checksum of the file, cached by file size and mtime
+func getChecksum(realPath string, info os.FileInfo) (string, error) {
+	if sum, ok := loadCachedChecksum(realPath, info); ok {
+		return sum, nil
+	}
+
+	f, err := os.Open(realPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	storeCachedChecksum(&cachedChecksum{
+		path:    realPath,
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		sum:     sum,
+	})
+	return sum, nil
+}
+
+// loadCachedChecksum returns the cached checksum if the file is not changed since it was hashed
+func loadCachedChecksum(realPath string, info os.FileInfo) (string, bool) {
+	checksumCache.Lock()
+	defer checksumCache.Unlock()
+	element, ok := checksumCache.entries[realPath]
+	if !ok {
+		return "", false
+	}
+	cached := element.Value.(*cachedChecksum)
+	if cached.size != info.Size() || !cached.modTime.Equal(info.ModTime()) {
+		return "", false
+	}
+	checksumCache.order.MoveToFront(element)
+	return cached.sum, true
+}
+
+// storeCachedChecksum caches a checksum and evicts the least recently used ones above maxCachedChecksums
+func storeCachedChecksum(cached *cachedChecksum) {
+	checksumCache.Lock()
+	defer checksumCache.Unlock()
+	if element, ok := checksumCache.entries[cached.path]; ok {
+		element.Value = cached
+		checksumCache.order.MoveToFront(element)
+	} else {
+		checksumCache.entries[cached.path] = checksumCache.order.PushFront(cached)
+	}
+
+	for checksumCache.order.Len() > maxCachedChecksums {
+		oldest := checksumCache.order.Back()
+		checksumCache.order.Remove(oldest)
+		delete(checksumCache.entries, oldest.Value.(*cachedChecksum).path)
+	}
+}
+
+func stringInSlice(a string, list []string) bool {
+	for _, b := range list {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGetFileMetadataChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hello.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := GetFileMetadata(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SHA256 != "" {
+		t.Errorf("expected no checksum unless requested, got %s", result.SHA256)
+	}
+
+	result, err = GetFileMetadata(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("unexpected checksum %s", result.SHA256)
+	}
+
+	//A modified file is hashed again
+	if err := os.WriteFile(path, []byte("world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+	result, _ = GetFileMetadata(path, true)
+	if result.SHA256 != "486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7" {
+		t.Errorf("expected the checksum of the modified file, got %s", result.SHA256)
+	}
+}
+
+func TestChecksumCacheEviction(t *testing.T) {
+	for i := 0; i < maxCachedChecksums+10; i++ {
+		storeCachedChecksum(&cachedChecksum{path: "/tmp/file" + strconv.Itoa(i), sum: strconv.Itoa(i)})
+	}
+	//Touch the oldest remaining entry so it is not evicted next
+	checksumCache.order.MoveToFront(checksumCache.entries["/tmp/file10"])
+	storeCachedChecksum(&cachedChecksum{path: "/tmp/new"})
+
+	checksumCache.Lock()
+	defer checksumCache.Unlock()
+	if checksumCache.order.Len() != maxCachedChecksums || len(checksumCache.entries) != maxCachedChecksums {
+		t.Fatalf("expected %d cached checksums, got %d", maxCachedChecksums, checksumCache.order.Len())
+	}
+	for _, evicted := range []string{"/tmp/file0", "/tmp/file9", "/tmp/file11"} {
+		if _, ok := checksumCache.entries[evicted]; ok {
+			t.Errorf("expected %s to be evicted", evicted)
+		}
+	}
+	for _, kept := range []string{"/tmp/file10", "/tmp/file12", "/tmp/new"} {
+		if _, ok := checksumCache.entries[kept]; !ok {
+			t.Errorf("expected %s to be cached", kept)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package metadata
+
+import (
+	"github.com/fogleman/fauxgl"
+)
+
+type ModelMetadata struct {
+	Vertices int        `json:"vertices"`   //Number of unique vertices
+	Faces    int        `json:"faces"`      //Number of triangles
+	Size     [3]float64 `json:"dimensions"` //Size of the bounding box in x, y, z
+}
+
+// GetModelMetadata loads a 3D model and count its vertices and faces
+func GetModelMetadata(realPath string) (*ModelMetadata, error) {
+	mesh, err := fauxgl.LoadMesh(realPath)
+	if err != nil {
+		return nil, err
+	}
+
+	//STL stores vertices per triangle, dedup them by position
+	uniqueVertices := map[fauxgl.Vector]struct{}{}
+	for _, t := range mesh.Triangles {
+		uniqueVertices[t.V1.Position] = struct{}{}
+		uniqueVertices[t.V2.Position] = struct{}{}
+		uniqueVertices[t.V3.Position] = struct{}{}
+	}
+
+	result := ModelMetadata{
+		Vertices: len(uniqueVertices),
+		Faces:    len(mesh.Triangles),
+	}
+
+	if len(mesh.Triangles) > 0 {
+		size := mesh.BoundingBox().Size()
+		result.Size = [3]float64{size.X, size.Y, size.Z}
+	}
+	return &result, nil
+}
@@ -0,0 +1,107 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ffprobeTimeout = 30 * time.Second //Broken or remote files might hang ffprobe
+
+type VideoMetadata struct {
+	Container  string  `json:"container"`         //e.g. mov,mp4,m4a,3gp,3g2,mj2
+	Duration   float64 `json:"duration"`          //In seconds
+	Bitrate    int64   `json:"bitrate,omitempty"` //In bits per second
+	VideoCodec string  `json:"video_codec,omitempty"`
+	AudioCodec string  `json:"audio_codec,omitempty"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	FrameRate  float64 `json:"frame_rate,omitempty"`
+}
+
+// ffprobeOutput is the subset of ffprobe json output used
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType    string `json:"codec_type"`
+		CodecName    string `json:"codec_name"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// GetVideoMetadata reads the duration, codecs and resolution of a video with ffprobe
+func GetVideoMetadata(realPath string) (*VideoMetadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ffprobeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "quiet", "-print_format", "json", "-show_format", "-show_streams", realPath)
+	output, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, errors.New("ffprobe timed out reading " + realPath)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return parseFFprobeOutput(output)
+}
+
+// parseFFprobeOutput parses the json output of ffprobe
+func parseFFprobeOutput(output []byte) (*VideoMetadata, error) {
+	probe := ffprobeOutput{}
+	err := json.Unmarshal(output, &probe)
+	if err != nil {
+		return nil, err
+	}
+
+	result := VideoMetadata{
+		Container: probe.Format.FormatName,
+	}
+	result.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	result.Bitrate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "video":
+			if result.VideoCodec != "" {
+				//Only report the first video stream, the rest are usually cover arts
+				continue
+			}
+			result.VideoCodec = stream.CodecName
+			result.Width = stream.Width
+			result.Height = stream.Height
+			result.FrameRate = parseFrameRate(stream.AvgFrameRate)
+		case "audio":
+			if result.AudioCodec == "" {
+				result.AudioCodec = stream.CodecName
+			}
+		}
+	}
+
+	return &result, nil
+}
+
+// parseFrameRate parses the frame rate in fraction format, e.g. 30000/1001
+func parseFrameRate(rate string) float64 {
+	num, den, found := strings.Cut(rate, "/")
+	if !found {
+		f, _ := strconv.ParseFloat(rate, 64)
+		return f
+	}
+
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
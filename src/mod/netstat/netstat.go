@@ -5,9 +5,12 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/v4/net"
+	"imuslab.com/bokofs/bokofsd/mod/timeseries"
 	"imuslab.com/bokofs/bokofsd/mod/utils"
 )
 
@@ -23,40 +26,33 @@ type RawFlowStat struct {
 	TX int64
 }
 
+const (
+	SERIES_RX = "net.rx" //Received bits per second
+	SERIES_TX = "net.tx" //Transmitted bits per second
+)
+
 type NetStatBuffers struct {
-	StatRecordCount int          //No. of record number to keep
-	PreviousStat    *RawFlowStat //The value of the last instance of netstats
-	Stats           []*FlowStat  //Statistic of the flow
-	StopChan        chan bool    //Channel to stop the ticker
-	EventTicker     *time.Ticker //Ticker for event logging
+	StatRecordCount int               //No. of record number to return in the 1s resolution
+	PreviousStat    *RawFlowStat      //The value of the last instance of netstats
+	Store           *timeseries.Store //Time series store to keep the flow history
+	StopChan        chan bool         //Channel to stop the ticker
+	EventTicker     *time.Ticker      //Ticker for event logging
+	statMutex       sync.Mutex
+	onSample        func(rx int64, tx int64) //Optional, called with the bits per second of each sample
 }
 
-// Get a new network statistic buffers
-func NewNetStatBuffer(recordCount int) (*NetStatBuffers, error) {
-	//Flood fill the stats with 0
-	initialStats := []*FlowStat{}
-	for i := 0; i < recordCount; i++ {
-		initialStats = append(initialStats, &FlowStat{
-			RX: 0,
-			TX: 0,
-		})
-	}
-
+// Get a new network statistic buffers, the flow history will be recorded into the given store
+func NewNetStatBuffer(recordCount int, store *timeseries.Store) (*NetStatBuffers, error) {
 	//Setup a timer to get the value from NIC accumulation stats
 	ticker := time.NewTicker(time.Second)
 
 	//Setup a stop channel
 	stopCh := make(chan bool)
 
-	currnetNetSpec := RawFlowStat{
-		RX: 0,
-		TX: 0,
-	}
-
 	thisNetBuffer := NetStatBuffers{
 		StatRecordCount: recordCount,
-		PreviousStat:    &currnetNetSpec,
-		Stats:           initialStats,
+		PreviousStat:    &RawFlowStat{},
+		Store:           store,
 		StopChan:        stopCh,
 		EventTicker:     ticker,
 	}
@@ -92,39 +88,37 @@ func NewNetStatBuffer(recordCount int) (*NetStatBuffers, error) {
 				return
 
 			case <-ticker.C:
-				if n.PreviousStat.RX == 0 && n.PreviousStat.TX == 0 {
-					//Initiation state is still not done. Ignore request
-					log.Println("netstat", "No initial states. Waiting", nil)
-					return
-				}
 				// Get the latest network interface stats
-				rx, tx, err := thisNetBuffer.GetNetworkInterfaceStats()
+				rx, tx, err := n.GetNetworkInterfaceStats()
 				if err != nil {
 					// Log the error, but don't stop the buffer
 					log.Println("netstat", "Failed to get network interface stats", err)
 					continue
 				}
 
-				//Calculate the difference between this and last values
-				drx := rx - n.PreviousStat.RX
-				dtx := tx - n.PreviousStat.TX
-
-				// Push the new stats to the buffer
-				newStat := &FlowStat{
-					RX: drx,
-					TX: dtx,
-				}
-
-				//Set current rx tx as the previous rxtx
+				n.statMutex.Lock()
+				previous := n.PreviousStat
 				n.PreviousStat = &RawFlowStat{
 					RX: rx,
 					TX: tx,
 				}
+				n.statMutex.Unlock()
 
-				newStats := n.Stats[1:]
-				newStats = append(newStats, newStat)
+				if previous.RX == 0 && previous.TX == 0 {
+					//Initiation state is still not done. Use this value as the initial states
+					continue
+				}
 
-				n.Stats = newStats
+				//Calculate the difference between this and last values
+				n.Store.Record(SERIES_RX, float64(rx-previous.RX))
+				n.Store.Record(SERIES_TX, float64(tx-previous.TX))
+
+				n.statMutex.Lock()
+				onSample := n.onSample
+				n.statMutex.Unlock()
+				if onSample != nil {
+					onSample(rx-previous.RX, tx-previous.TX)
+				}
 			}
 		}
 	}(&thisNetBuffer)
@@ -132,14 +126,96 @@ func NewNetStatBuffer(recordCount int) (*NetStatBuffers, error) {
 	return &thisNetBuffer, nil
 }
 
+// SetSampleHandler sets the function to be called with the rx and tx bits per second of each sample
+func (n *NetStatBuffers) SetSampleHandler(handler func(rx int64, tx int64)) {
+	n.statMutex.Lock()
+	defer n.statMutex.Unlock()
+	n.onSample = handler
+}
+
+// GetTotals returns the accumulated rx and tx bits of the latest sample
+func (n *NetStatBuffers) GetTotals() (int64, int64) {
+	n.statMutex.Lock()
+	defer n.statMutex.Unlock()
+	return n.PreviousStat.RX, n.PreviousStat.TX
+}
+
+// GetStats returns the flow history in the given resolution, oldest first.
+// The 1s resolution is padded with zeros to StatRecordCount records
+func (n *NetStatBuffers) GetStats(resolution string) ([]*FlowStat, error) {
+	res, err := n.Store.GetResolution(resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	rxPoints, _ := n.Store.Query(SERIES_RX, res.Name)
+	txPoints, _ := n.Store.Query(SERIES_TX, res.Name)
+
+	if res.Name == n.Store.Options.Resolutions[0].Name {
+		//Align the records to the last StatRecordCount seconds
+		stats := make([]*FlowStat, n.StatRecordCount)
+		now := time.Now().Truncate(res.Interval).Unix()
+		for i := range stats {
+			stats[i] = &FlowStat{}
+		}
+		for _, p := range rxPoints {
+			if idx := n.StatRecordCount - 1 - int(now-p.Time); idx >= 0 && idx < n.StatRecordCount {
+				stats[idx].RX = int64(p.Value)
+			}
+		}
+		for _, p := range txPoints {
+			if idx := n.StatRecordCount - 1 - int(now-p.Time); idx >= 0 && idx < n.StatRecordCount {
+				stats[idx].TX = int64(p.Value)
+			}
+		}
+		return stats, nil
+	}
+
+	//Coarser resolutions, merge the rx and tx by bucket time
+	statsByTime := map[int64]*FlowStat{}
+	times := []int64{}
+	for _, p := range rxPoints {
+		statsByTime[p.Time] = &FlowStat{RX: int64(p.Value)}
+		times = append(times, p.Time)
+	}
+	for _, p := range txPoints {
+		if stat, ok := statsByTime[p.Time]; ok {
+			stat.TX = int64(p.Value)
+		} else {
+			statsByTime[p.Time] = &FlowStat{TX: int64(p.Value)}
+			times = append(times, p.Time)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	stats := []*FlowStat{}
+	for _, t := range times {
+		stats = append(stats, statsByTime[t])
+	}
+	return stats, nil
+}
+
+// HandleGetBufferedNetworkInterfaceStats returns the flow history,
+// accept resolution (Optional, default 1s) and array (Optional, bool)
 func (n *NetStatBuffers) HandleGetBufferedNetworkInterfaceStats(w http.ResponseWriter, r *http.Request) {
+	resolution, err := utils.GetPara(r, "resolution")
+	if err != nil {
+		resolution = n.Store.Options.Resolutions[0].Name
+	}
+
+	stats, err := n.GetStats(resolution)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
 	arr, _ := utils.GetPara(r, "array")
 	if arr == "true" {
 		//Restructure it into array
 		rx := []int{}
 		tx := []int{}
 
-		for _, state := range n.Stats {
+		for _, state := range stats {
 			rx = append(rx, int(state.RX))
 			tx = append(tx, int(state.TX))
 		}
@@ -155,7 +231,7 @@ func (n *NetStatBuffers) HandleGetBufferedNetworkInterfaceStats(w http.ResponseW
 		})
 		utils.SendJSONResponse(w, string(js))
 	} else {
-		js, _ := json.Marshal(n.Stats)
+		js, _ := json.Marshal(stats)
 		utils.SendJSONResponse(w, string(js))
 	}
 
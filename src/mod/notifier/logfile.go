@@ -0,0 +1,58 @@
+package notifier
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	logfile.go
+
+	Append notifications to a local log file, one line per notification
+*/
+
+type LogFileNotifier struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// NewLogFileNotifier creates a notifier that appends to the given file
+func NewLogFileNotifier(path string) (*LogFileNotifier, error) {
+	if path == "" {
+		return nil, errors.New("log file path not set")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return &LogFileNotifier{
+		path: path,
+	}, nil
+}
+
+func (l *LogFileNotifier) Name() string {
+	return "logfile"
+}
+
+func (l *LogFileNotifier) Send(n *Notification) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line := n.Time.Format(time.RFC3339) + " " + formatSubject(n)
+	if n.Device != "" {
+		line += " (" + n.Device + ")"
+	}
+	//Keep one notification per line
+	line += ": " + strings.ReplaceAll(n.Message, "\n", " ") + "\n"
+	_, err = f.WriteString(line)
+	return err
+}
@@ -0,0 +1,100 @@
+package notifier
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Notifier
+
+	This module deliver alerts raised by the background monitors (e.g. SMART health)
+	to the administrator. Each delivery method implements the Notifier interface
+	and the Dispatcher send a notification to all of the registered notifiers
+*/
+
+type Level string
+
+const (
+	LevelInfo     Level = "info"
+	LevelWarning  Level = "warning"
+	LevelCritical Level = "critical"
+)
+
+type Notification struct {
+	Source  string    `json:"source"` //The module that raise this notification, e.g. smart
+	Level   Level     `json:"level"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Device  string    `json:"device,omitempty"` //The device this notification is about, e.g. sda
+	Time    time.Time `json:"time"`
+}
+
+// Notifier delivers a notification to its destination
+type Notifier interface {
+	Name() string
+	Send(n *Notification) error
+}
+
+type Dispatcher struct {
+	notifiers []Notifier
+	mutex     sync.RWMutex
+}
+
+// NewDispatcher creates a dispatcher with the given notifiers
+func NewDispatcher(notifiers ...Notifier) *Dispatcher {
+	return &Dispatcher{
+		notifiers: notifiers,
+	}
+}
+
+// Add registers a notifier to the dispatcher
+func (d *Dispatcher) Add(n Notifier) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.notifiers = append(d.notifiers, n)
+}
+
+// List returns the names of the registered notifiers
+func (d *Dispatcher) List() []string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	names := []string{}
+	for _, n := range d.notifiers {
+		names = append(names, n.Name())
+	}
+	return names
+}
+
+// Notify sends the notification to all notifiers. A failing notifier does not
+// stop the others, the errors are logged and returned together
+func (d *Dispatcher) Notify(n *Notification) error {
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+
+	d.mutex.RLock()
+	notifiers := append([]Notifier{}, d.notifiers...)
+	d.mutex.RUnlock()
+
+	errMsgs := []string{}
+	for _, thisNotifier := range notifiers {
+		if err := thisNotifier.Send(n); err != nil {
+			log.Println("[Notifier] Unable to send notification via " + thisNotifier.Name() + ": " + err.Error())
+			errMsgs = append(errMsgs, thisNotifier.Name()+": "+err.Error())
+		}
+	}
+
+	if len(errMsgs) > 0 {
+		return errors.New(strings.Join(errMsgs, "; "))
+	}
+	return nil
+}
+
+// formatSubject returns the one line summary of a notification
+func formatSubject(n *Notification) string {
+	return "[bokoFS][" + strings.ToUpper(string(n.Level)) + "] " + n.Title
+}
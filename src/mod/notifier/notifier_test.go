@@ -0,0 +1,219 @@
+package notifier
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestNotification() *Notification {
+	return &Notification{
+		Source:  "smart",
+		Level:   LevelCritical,
+		Title:   "SMART health check failed",
+		Message: "sda reported a FAILED self-assessment",
+		Device:  "sda",
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+// stubSMTPServer is a local stand-in of a SMTP server that accepts one
+// message without auth and sends the received DATA to the returned channel
+func stubSMTPServer(t *testing.T) (string, int, chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) {
+			conn.Write([]byte(line + "\r\n"))
+		}
+		reply("220 localhost ESMTP stub")
+
+		inData := false
+		var data strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				inData = true
+				reply("354 End data with <CR><LF>.<CR><LF>")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return "127.0.0.1", addr.Port, received
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	host, port, received := stubSMTPServer(t)
+	n, err := NewSMTPNotifier(&SMTPOptions{
+		Host: host,
+		Port: port,
+		From: "bokofs@localhost",
+		To:   []string{"admin@localhost"},
+	})
+	if err != nil {
+		t.Fatalf("unable to create smtp notifier: %v", err)
+	}
+
+	if err := n.Send(newTestNotification()); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	select {
+	case data := <-received:
+		if !strings.Contains(data, "Subject: [bokoFS][CRITICAL] SMART health check failed") {
+			t.Errorf("subject not found in message: %q", data)
+		}
+		if !strings.Contains(data, "Device: sda") {
+			t.Errorf("device not found in message: %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stub server did not receive the message")
+	}
+}
+
+func TestSMTPNotifierOptions(t *testing.T) {
+	if _, err := NewSMTPNotifier(&SMTPOptions{From: "a@localhost", To: []string{"b@localhost"}}); err == nil {
+		t.Error("expected error without host")
+	}
+	if _, err := NewSMTPNotifier(&SMTPOptions{Host: "localhost"}); err == nil {
+		t.Error("expected error without sender and receiver")
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got Notification
+	var gotToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	n, err := NewWebhookNotifier(&WebhookOptions{
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	})
+	if err != nil {
+		t.Fatalf("unable to create webhook notifier: %v", err)
+	}
+
+	if err := n.Send(newTestNotification()); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if got.Device != "sda" || got.Level != LevelCritical {
+		t.Errorf("unexpected payload: %+v", got)
+	}
+	if gotToken != "Bearer token" {
+		t.Errorf("extra header not sent, got %q", gotToken)
+	}
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	n, _ := NewWebhookNotifier(&WebhookOptions{URL: server.URL})
+	err := n.Send(newTestNotification())
+	if err == nil || !strings.Contains(err.Error(), strconv.Itoa(http.StatusInternalServerError)) {
+		t.Errorf("expected status error, got %v", err)
+	}
+}
+
+func TestLogFileNotifier(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "logs", "alerts.log")
+	n, err := NewLogFileNotifier(logFile)
+	if err != nil {
+		t.Fatalf("unable to create log file notifier: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := n.Send(newTestNotification()); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("unable to read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), content)
+	}
+	want := "2024-01-02T03:04:05Z [bokoFS][CRITICAL] SMART health check failed (sda): sda reported a FAILED self-assessment"
+	if lines[0] != want {
+		t.Errorf("unexpected line\n got: %s\nwant: %s", lines[0], want)
+	}
+}
+
+type failingNotifier struct{}
+
+func (f *failingNotifier) Name() string               { return "failing" }
+func (f *failingNotifier) Send(n *Notification) error { return errors.New("unreachable") }
+
+func TestDispatcher(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "alerts.log")
+	logNotifier, _ := NewLogFileNotifier(logFile)
+	d := NewDispatcher(&failingNotifier{}, logNotifier)
+
+	err := d.Notify(newTestNotification())
+	if err == nil || !strings.Contains(err.Error(), "failing") {
+		t.Errorf("expected error from the failing notifier, got %v", err)
+	}
+
+	//The failing notifier must not stop the others
+	if _, err := os.Stat(logFile); err != nil {
+		t.Errorf("log file notifier was not called: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package notifier
+
+import (
+	"errors"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	smtp.go
+
+	Send notifications as plain text email
+*/
+
+type SMTPOptions struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"` //Leave empty if the server does not require auth
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+type SMTPNotifier struct {
+	options *SMTPOptions
+}
+
+// NewSMTPNotifier creates a notifier that sends email via the given SMTP server
+func NewSMTPNotifier(options *SMTPOptions) (*SMTPNotifier, error) {
+	if options.Host == "" {
+		return nil, errors.New("smtp host not set")
+	}
+	if options.From == "" || len(options.To) == 0 {
+		return nil, errors.New("smtp sender or receiver not set")
+	}
+	if options.Port == 0 {
+		options.Port = 25
+	}
+	return &SMTPNotifier{
+		options: options,
+	}, nil
+}
+
+func (s *SMTPNotifier) Name() string {
+	return "smtp"
+}
+
+func (s *SMTPNotifier) Send(n *Notification) error {
+	var auth smtp.Auth
+	if s.options.Username != "" {
+		//PlainAuth refuse to send the password without TLS unless the server is on localhost
+		auth = smtp.PlainAuth("", s.options.Username, s.options.Password, s.options.Host)
+	}
+
+	addr := net.JoinHostPort(s.options.Host, strconv.Itoa(s.options.Port))
+	return smtp.SendMail(addr, auth, s.options.From, s.options.To, s.buildMessage(n))
+}
+
+// buildMessage returns the email with headers in RFC 5322 format
+func (s *SMTPNotifier) buildMessage(n *Notification) []byte {
+	var sb strings.Builder
+	sb.WriteString("From: " + s.options.From + "\r\n")
+	sb.WriteString("To: " + strings.Join(s.options.To, ", ") + "\r\n")
+	sb.WriteString("Subject: " + formatSubject(n) + "\r\n")
+	sb.WriteString("Date: " + n.Time.Format(time.RFC1123Z) + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	sb.WriteString("\r\n")
+	body := n.Message
+	if n.Device != "" {
+		body += "\n\nDevice: " + n.Device
+	}
+	body += "\nSource: " + n.Source
+	body += "\nTime: " + n.Time.Format(time.RFC3339)
+	sb.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	sb.WriteString("\r\n")
+	return []byte(sb.String())
+}
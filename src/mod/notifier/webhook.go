@@ -0,0 +1,73 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+	webhook.go
+
+	POST notifications as JSON to a generic webhook endpoint
+*/
+
+type WebhookOptions struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"` //Extra headers, e.g. Authorization
+	Timeout int               `json:"timeout"` //In seconds, default 10
+}
+
+type WebhookNotifier struct {
+	options *WebhookOptions
+	client  *http.Client
+}
+
+// NewWebhookNotifier creates a notifier that posts to the given URL
+func NewWebhookNotifier(options *WebhookOptions) (*WebhookNotifier, error) {
+	if options.URL == "" {
+		return nil, errors.New("webhook url not set")
+	}
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = 10
+	}
+	return &WebhookNotifier{
+		options: options,
+		client:  &http.Client{Timeout: time.Duration(timeout) * time.Second},
+	}, nil
+}
+
+func (wh *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (wh *WebhookNotifier) Send(n *Notification) error {
+	js, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", wh.options.URL, bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range wh.options.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("webhook returned status " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	cron.go
+
+	Parser for the standard 5 field cron expressions
+	(minute hour day-of-month month day-of-week), e.g.
+
+	0 3 * * 0       03:00 every Sunday
+	30 2 1-7 * 6    02:30 on the first Saturday of the month
+	15 0-23/6 * * * Every 6 hours at 15 minutes past
+
+	Lists (1,15), ranges (1-5), steps (0-30/5, or a step after *),
+	month and weekday names (jan, sun) and the @yearly, @monthly,
+	@weekly, @daily and @hourly macros are supported. Same as cron, if
+	both day-of-month and day-of-week are restricted the schedule
+	matches either of them
+*/
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	domRestricted bool
+	dowRestricted bool
+}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Give up searching for the next run after this many years, e.g. for 30 Feb
+const maxSearchYears = 5
+
+// Parse parses a cron expression
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(strings.ToLower(spec))
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New("cron expression must have 5 fields: minute hour day-of-month month day-of-week")
+	}
+
+	schedule := &Schedule{}
+	var err error
+	if schedule.minute, err = parseField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = parseField(fields[2], domField); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = parseField(fields[4], dowField); err != nil {
+		return nil, err
+	}
+
+	//7 is also Sunday
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow = schedule.dow&^(1<<7) | 1
+	}
+	schedule.domRestricted = !strings.HasPrefix(fields[2], "*")
+	schedule.dowRestricted = !strings.HasPrefix(fields[4], "*")
+	return schedule, nil
+}
+
+// Matches checks if the schedule runs at the minute of t
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.minute&(1<<uint(t.Minute())) != 0 &&
+		s.hour&(1<<uint(t.Hour())) != 0 &&
+		s.month&(1<<uint(t.Month())) != 0 &&
+		s.matchesDay(t)
+}
+
+// Next returns the next time the schedule runs after t, or zero time if it never runs
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// parseField parses a field into a bitset of the matching values
+func parseField(value string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(value, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field: %s", field.name, part)
+			}
+		}
+
+		start, end := field.min, field.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = parseValue(bounds[0], field); err != nil {
+				return 0, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = parseValue(bounds[1], field); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				//e.g. 5/15 means 5-59/15
+				end = field.max
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid range in %s field: %s", field.name, part)
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(value string, field cronField) (int, error) {
+	if number, ok := field.names[value]; ok {
+		return number, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < field.min || number > field.max {
+		return 0, fmt.Errorf("invalid value in %s field: %s", field.name, value)
+	}
+	return number, nil
+}
@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{"* * * * *", "0 3 * * 0", "30 2 1-7 * 6", "*/15 0-23/6 * * mon-fri", "0 0 1 jan,jul *", "@weekly", "5/10 * * * 7"}
+	for _, spec := range valid {
+		if _, err := Parse(spec); err != nil {
+			t.Errorf("%q: unexpected error %v", spec, err)
+		}
+	}
+
+	invalid := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *"}
+	for _, spec := range invalid {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	//Wednesday
+	now := time.Date(2024, 5, 15, 10, 20, 30, 0, time.UTC)
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 15, 10, 21, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * 0", time.Date(2024, 5, 19, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2024, 5, 19, 3, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		//Day of month or day of week
+		{"0 0 20 * fri", time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", test.spec, err)
+		}
+		next := schedule.Next(now)
+		if !next.Equal(test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.spec, test.expected, next)
+		}
+		if !next.IsZero() && !schedule.Matches(next) {
+			t.Errorf("%q: next run %v does not match the schedule", test.spec, next)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package timeseries
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+// HandleQuery returns the history of a series, require name and resolution (Optional, default 1s).
+// List all series names if name is not given
+func (s *Store) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	name, err := utils.GetPara(r, "name")
+	if err != nil {
+		js, _ := json.Marshal(s.List())
+		utils.SendJSONResponse(w, string(js))
+		return
+	}
+
+	resolution, err := utils.GetPara(r, "resolution")
+	if err != nil {
+		resolution = s.Options.Resolutions[0].Name
+	}
+
+	points, err := s.Query(name, resolution)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	js, _ := json.Marshal(points)
+	utils.SendJSONResponse(w, string(js))
+}
@@ -0,0 +1,147 @@
+package timeseries
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+	series.go
+
+	A series holds one ring buffer per resolution
+*/
+
+type Point struct {
+	Time  int64   `json:"t"` //Unix timestamp of the start of the bucket
+	Value float64 `json:"v"` //Average value of the samples in the bucket
+}
+
+type ring struct {
+	resolution Resolution
+	points     []Point
+	head       int //Index of the next write
+	count      int //No. of valid points
+	lastCount  int //No. of samples averaged into the latest point
+}
+
+type Series struct {
+	rings []*ring
+	mutex sync.RWMutex
+}
+
+func newSeries(resolutions []Resolution) *Series {
+	rings := []*ring{}
+	for _, res := range resolutions {
+		rings = append(rings, &ring{
+			resolution: res,
+			points:     make([]Point, res.Capacity),
+		})
+	}
+	return &Series{
+		rings: rings,
+	}
+}
+
+// Add adds a sample to every resolution of the series
+func (s *Series) Add(t time.Time, value float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, r := range s.rings {
+		r.add(t, value)
+	}
+}
+
+// Points returns the points of the given resolution, oldest first
+func (s *Series) Points(resolution string) ([]Point, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, r := range s.rings {
+		if r.resolution.Name == resolution {
+			return r.ordered(), nil
+		}
+	}
+	return nil, errors.New("invalid resolution given")
+}
+
+// Latest returns the latest point of the finest resolution
+func (s *Series) Latest() (Point, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if len(s.rings) == 0 || s.rings[0].count == 0 {
+		return Point{}, false
+	}
+	r := s.rings[0]
+	return r.points[r.prev(r.head)], true
+}
+
+func (s *Series) export() map[string][]Point {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	results := map[string][]Point{}
+	for _, r := range s.rings {
+		results[r.resolution.Name] = r.ordered()
+	}
+	return results
+}
+
+func (s *Series) restore(data map[string][]Point) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, r := range s.rings {
+		for _, p := range data[r.resolution.Name] {
+			r.push(p)
+			//Restored points are treated as a single sample
+			r.lastCount = 1
+		}
+	}
+}
+
+/*
+	Ring Buffer
+*/
+
+// add averages the sample into the bucket it belongs to
+func (r *ring) add(t time.Time, value float64) {
+	bucket := t.Truncate(r.resolution.Interval).Unix()
+	if r.count > 0 {
+		last := &r.points[r.prev(r.head)]
+		if last.Time == bucket {
+			//Same bucket, update the running average
+			r.lastCount++
+			last.Value += (value - last.Value) / float64(r.lastCount)
+			return
+		} else if bucket < last.Time {
+			//Out of order sample (e.g. clock change), drop it
+			return
+		}
+	}
+
+	r.push(Point{Time: bucket, Value: value})
+	r.lastCount = 1
+}
+
+func (r *ring) push(p Point) {
+	if len(r.points) == 0 {
+		return
+	}
+	r.points[r.head] = p
+	r.head = (r.head + 1) % len(r.points)
+	if r.count < len(r.points) {
+		r.count++
+	}
+}
+
+func (r *ring) prev(i int) int {
+	return (i - 1 + len(r.points)) % len(r.points)
+}
+
+// ordered returns a copy of the valid points, oldest first
+func (r *ring) ordered() []Point {
+	results := make([]Point, 0, r.count)
+	start := (r.head - r.count + len(r.points)) % len(r.points)
+	for i := 0; i < r.count; i++ {
+		results = append(results, r.points[(start+i)%len(r.points)])
+	}
+	return results
+}
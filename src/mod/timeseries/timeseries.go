@@ -0,0 +1,232 @@
+package timeseries
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	Time Series
+
+	This module store metrics history in fixed size ring buffers at
+	multiple resolutions. Samples recorded into a series are averaged
+	into the buckets of every resolution, so a series keep 5 minutes of
+	1s samples, 24 hours of 1 minute averages and 30 days of 1 hour
+	averages by default. The store can be persisted to disk and
+	restored on startup
+*/
+
+type Resolution struct {
+	Name     string        //Name used in API, e.g. 1s
+	Interval time.Duration //Bucket size of this resolution
+	Capacity int           //No. of buckets to keep
+}
+
+// DefaultResolutions keeps 1s for 5 min, 1 min for 24 h and 1 h for 30 days
+var DefaultResolutions = []Resolution{
+	{Name: "1s", Interval: time.Second, Capacity: 300},
+	{Name: "1m", Interval: time.Minute, Capacity: 1440},
+	{Name: "1h", Interval: time.Hour, Capacity: 720},
+}
+
+type Options struct {
+	PersistFile  string        //File to persist the store, leave empty to keep in memory only
+	SaveInterval time.Duration //Interval to save the store to file, default 5 minutes
+	Resolutions  []Resolution  //Resolutions of each series, default DefaultResolutions
+}
+
+type Store struct {
+	Options *Options
+
+	/* Private Properties */
+	series      map[string]*Series
+	seriesMutex sync.RWMutex
+	stopChan    chan bool
+}
+
+// NewStore creates a new time series store and restore the persisted data if any
+func NewStore(options *Options) (*Store, error) {
+	if len(options.Resolutions) == 0 {
+		options.Resolutions = DefaultResolutions
+	}
+
+	if options.SaveInterval <= 0 {
+		options.SaveInterval = 5 * time.Minute
+	}
+
+	thisStore := Store{
+		Options:  options,
+		series:   map[string]*Series{},
+		stopChan: make(chan bool),
+	}
+
+	if options.PersistFile != "" {
+		err := thisStore.load()
+		if err != nil && !os.IsNotExist(err) {
+			//Corrupted history should not stop the daemon from starting
+			log.Println("[Timeseries] Unable to restore history: " + err.Error())
+		}
+
+		go func() {
+			ticker := time.NewTicker(options.SaveInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-thisStore.stopChan:
+					return
+				case <-ticker.C:
+					if err := thisStore.Save(); err != nil {
+						log.Println("[Timeseries] Unable to save history: " + err.Error())
+					}
+				}
+			}
+		}()
+	}
+
+	return &thisStore, nil
+}
+
+// Record adds a sample to the series with the current time
+func (s *Store) Record(name string, value float64) {
+	s.RecordAt(name, time.Now(), value)
+}
+
+// RecordAt adds a sample to the series at a given time.
+// The series will be created if it does not exist
+func (s *Store) RecordAt(name string, t time.Time, value float64) {
+	s.getOrCreateSeries(name).Add(t, value)
+}
+
+// Query returns the points of a series at the given resolution, oldest first
+func (s *Store) Query(name string, resolution string) ([]Point, error) {
+	s.seriesMutex.RLock()
+	thisSeries, ok := s.series[name]
+	s.seriesMutex.RUnlock()
+	if !ok {
+		return nil, errors.New("series not found")
+	}
+
+	return thisSeries.Points(resolution)
+}
+
+// Latest returns the latest point of a series at the finest resolution
+func (s *Store) Latest(name string) (Point, bool) {
+	s.seriesMutex.RLock()
+	thisSeries, ok := s.series[name]
+	s.seriesMutex.RUnlock()
+	if !ok {
+		return Point{}, false
+	}
+	return thisSeries.Latest()
+}
+
+// List returns the name of all series in the store, sorted
+func (s *Store) List() []string {
+	s.seriesMutex.RLock()
+	defer s.seriesMutex.RUnlock()
+	names := []string{}
+	for name := range s.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetResolution returns the resolution by name
+func (s *Store) GetResolution(name string) (Resolution, error) {
+	for _, res := range s.Options.Resolutions {
+		if res.Name == name {
+			return res, nil
+		}
+	}
+	return Resolution{}, errors.New("invalid resolution given")
+}
+
+// Close stops the background saving and save the store to file
+func (s *Store) Close() error {
+	if s.Options.PersistFile == "" {
+		return nil
+	}
+
+	s.stopChan <- true
+	return s.Save()
+}
+
+func (s *Store) getOrCreateSeries(name string) *Series {
+	s.seriesMutex.RLock()
+	thisSeries, ok := s.series[name]
+	s.seriesMutex.RUnlock()
+	if ok {
+		return thisSeries
+	}
+
+	s.seriesMutex.Lock()
+	defer s.seriesMutex.Unlock()
+	if thisSeries, ok := s.series[name]; ok {
+		//Created by another goroutine while waiting for the lock
+		return thisSeries
+	}
+	thisSeries = newSeries(s.Options.Resolutions)
+	s.series[name] = thisSeries
+	return thisSeries
+}
+
+/*
+	Persistence
+*/
+
+// persistedStore is the on disk format, series name to resolution name to points
+type persistedStore map[string]map[string][]Point
+
+// Save writes the store to the persist file
+func (s *Store) Save() error {
+	if s.Options.PersistFile == "" {
+		return nil
+	}
+
+	data := persistedStore{}
+	s.seriesMutex.RLock()
+	for name, thisSeries := range s.series {
+		data[name] = thisSeries.export()
+	}
+	s.seriesMutex.RUnlock()
+
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	//Write to a temp file first so a crash during saving will not corrupt the history
+	tmpFile := s.Options.PersistFile + ".tmp"
+	if err := os.WriteFile(tmpFile, js, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, s.Options.PersistFile)
+}
+
+// load restores the store from the persist file
+func (s *Store) load() error {
+	content, err := os.ReadFile(s.Options.PersistFile)
+	if err != nil {
+		return err
+	}
+
+	data := persistedStore{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return err
+	}
+
+	s.seriesMutex.Lock()
+	defer s.seriesMutex.Unlock()
+	for name, resolutions := range data {
+		thisSeries := newSeries(s.Options.Resolutions)
+		thisSeries.restore(resolutions)
+		s.series[name] = thisSeries
+	}
+	return nil
+}
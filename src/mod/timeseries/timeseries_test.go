@@ -0,0 +1,151 @@
+package timeseries
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRingWrapAround(t *testing.T) {
+	store, _ := NewStore(&Options{
+		Resolutions: []Resolution{{Name: "1s", Interval: time.Second, Capacity: 3}},
+	})
+
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < 5; i++ {
+		store.RecordAt("cpu", start.Add(time.Duration(i)*time.Second), float64(i))
+	}
+
+	points, err := store.Query("cpu", "1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Point{
+		{Time: start.Unix() + 2, Value: 2},
+		{Time: start.Unix() + 3, Value: 3},
+		{Time: start.Unix() + 4, Value: 4},
+	}
+	if !reflect.DeepEqual(points, expected) {
+		t.Errorf("expected the latest 3 points %v, got %v", expected, points)
+	}
+
+	latest, ok := store.Latest("cpu")
+	if !ok || latest != expected[2] {
+		t.Errorf("expected latest point %v, got %v", expected[2], latest)
+	}
+
+	//Out of order samples are dropped instead of overwriting the history
+	store.RecordAt("cpu", start, 100)
+	if points, _ := store.Query("cpu", "1s"); !reflect.DeepEqual(points, expected) {
+		t.Errorf("expected out of order sample to be dropped, got %v", points)
+	}
+}
+
+func TestDownsampling(t *testing.T) {
+	store, _ := NewStore(&Options{})
+
+	//2 hours of samples every 30s, the value is the minute since start
+	start := time.Unix(1700000000, 0).Truncate(time.Hour)
+	for i := 0; i < 240; i++ {
+		store.RecordAt("netstat.rx", start.Add(time.Duration(i)*30*time.Second), float64(i/2))
+	}
+
+	seconds, _ := store.Query("netstat.rx", "1s")
+	if len(seconds) != 240 {
+		t.Errorf("expected 240 points at 1s, got %d", len(seconds))
+	}
+
+	minutes, err := store.Query("netstat.rx", "1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(minutes) != 120 {
+		t.Fatalf("expected 120 points at 1m, got %d", len(minutes))
+	}
+	for i, p := range minutes {
+		if p.Time != start.Unix()+int64(i)*60 || p.Value != float64(i) {
+			t.Errorf("unexpected 1m point %d: %v", i, p)
+			break
+		}
+	}
+
+	hours, _ := store.Query("netstat.rx", "1h")
+	expected := []Point{
+		{Time: start.Unix(), Value: 29.5},
+		{Time: start.Unix() + 3600, Value: 89.5},
+	}
+	if !reflect.DeepEqual(hours, expected) {
+		t.Errorf("expected 1h points %v, got %v", expected, hours)
+	}
+
+	if _, err := store.Query("netstat.rx", "1d"); err == nil {
+		t.Error("expected error on invalid resolution")
+	}
+	if _, err := store.Query("netstat.tx", "1m"); err == nil {
+		t.Error("expected error on missing series")
+	}
+}
+
+func TestSaveAndReload(t *testing.T) {
+	persistFile := filepath.Join(t.TempDir(), "history.json")
+	resolutions := []Resolution{
+		{Name: "1s", Interval: time.Second, Capacity: 4},
+		{Name: "1m", Interval: time.Minute, Capacity: 4},
+	}
+	store, err := NewStore(&Options{PersistFile: persistFile, SaveInterval: time.Hour, Resolutions: resolutions})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1700000000, 0).Truncate(time.Minute)
+	for i := 0; i < 6; i++ {
+		store.RecordAt("disk.sda.temperature", start.Add(time.Duration(i)*time.Second), float64(30+i))
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//The temp file is renamed to the persist file
+	if _, err := os.Stat(persistFile + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("expected the temp file to be renamed, got %v", err)
+	}
+
+	reloaded, err := NewStore(&Options{PersistFile: persistFile, SaveInterval: time.Hour, Resolutions: resolutions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	for _, res := range resolutions {
+		original, _ := store.Query("disk.sda.temperature", res.Name)
+		restored, err := reloaded.Query("disk.sda.temperature", res.Name)
+		if err != nil || !reflect.DeepEqual(original, restored) {
+			t.Errorf("%s: expected %v after reload, got %v (%v)", res.Name, original, restored, err)
+		}
+	}
+
+	//Samples after the reload continue the restored buckets, which count as a single sample
+	reloaded.RecordAt("disk.sda.temperature", start.Add(6*time.Second), 36)
+	minutes, _ := reloaded.Query("disk.sda.temperature", "1m")
+	if len(minutes) != 1 || minutes[0].Value != 34.25 {
+		t.Errorf("expected the restored bucket to be updated, got %v", minutes)
+	}
+}
+
+func TestLoadCorruptedFile(t *testing.T) {
+	persistFile := filepath.Join(t.TempDir(), "history.json")
+	if err := os.WriteFile(persistFile, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewStore(&Options{PersistFile: persistFile, SaveInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if len(store.List()) != 0 {
+		t.Errorf("expected an empty store, got %v", store.List())
+	}
+}
@@ -0,0 +1,128 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+	TLS Certificate
+
+	This module handle the certificate used for HTTPS serving.
+	If cert.pem and key.pem exist in the config folder, they will be used.
+	Otherwise a self-signed certificate will be generated on first boot
+*/
+
+const (
+	CERT_FILENAME = "cert.pem"
+	KEY_FILENAME  = "key.pem"
+
+	selfSignedValidity = 10 * 365 * 24 * time.Hour
+)
+
+// LoadOrGenerate loads the certificate pair from the config folder.
+// A self-signed certificate will be generated if the pair does not exist
+func LoadOrGenerate(configFolder string, sysuuid string) (*tls.Certificate, error) {
+	certFile := filepath.Join(configFolder, CERT_FILENAME)
+	keyFile := filepath.Join(configFolder, KEY_FILENAME)
+
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		log.Println("[TLS] Certificate not found, generating self-signed certificate")
+		err := GenerateSelfSigned(certFile, keyFile, sysuuid)
+		if err != nil {
+			return nil, err
+		}
+	} else if os.IsNotExist(certErr) || os.IsNotExist(keyErr) {
+		return nil, errors.New("both " + CERT_FILENAME + " and " + KEY_FILENAME + " are required in the config folder")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// GenerateSelfSigned generates a self-signed certificate keyed to the system UUID
+// and write the certificate and private key to the given paths in PEM format
+func GenerateSelfSigned(certFile string, keyFile string, sysuuid string) error {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	//Derive the serial number from the system UUID so the certificate can be traced to this host
+	uuidHash := sha256.Sum256([]byte(sysuuid))
+	serialNumber := new(big.Int).SetBytes(uuidHash[:16])
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "bokofs"
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:         hostname,
+			Organization:       []string{"bokoFS"},
+			OrganizationalUnit: []string{sysuuid},
+		},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{hostname, "localhost"},
+		IPAddresses:           getLocalIPAddresses(),
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return err
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+}
+
+// getLocalIPAddresses returns the IP addresses of this host, including loopback
+func getLocalIPAddresses() []net.IP {
+	results := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return results
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		results = append(results, ipNet.IP)
+	}
+	return results
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/smart"
+	"imuslab.com/bokofs/bokofsd/mod/disktool/raid"
+	"imuslab.com/bokofs/bokofsd/mod/notifier"
+)
+
+/*
+	notify.go
+
+	This file setup the notifiers from the system config and
+	the background monitors (SMART health and RAID) that raise
+	alerts through them
+*/
+
+// initNotifyAgent creates the notification dispatcher from the notifiers in the system config
+func initNotifyAgent(configFolderPath string) *notifier.Dispatcher {
+	dispatcher := notifier.NewDispatcher()
+	notifierConfig := systemConfig.Notifiers
+
+	if notifierConfig.LogFile != "" {
+		logFile := notifierConfig.LogFile
+		if !filepath.IsAbs(logFile) {
+			logFile = filepath.Join(configFolderPath, logFile)
+		}
+		n, err := notifier.NewLogFileNotifier(logFile)
+		if err != nil {
+			log.Println("[Notifier] Unable to setup log file notifier: " + err.Error())
+		} else {
+			dispatcher.Add(n)
+		}
+	}
+
+	if notifierConfig.SMTP != nil {
+		n, err := notifier.NewSMTPNotifier(notifierConfig.SMTP)
+		if err != nil {
+			log.Println("[Notifier] Unable to setup SMTP notifier: " + err.Error())
+		} else {
+			dispatcher.Add(n)
+		}
+	}
+
+	if notifierConfig.Webhook != nil {
+		n, err := notifier.NewWebhookNotifier(notifierConfig.Webhook)
+		if err != nil {
+			log.Println("[Notifier] Unable to setup webhook notifier: " + err.Error())
+		} else {
+			dispatcher.Add(n)
+		}
+	}
+
+	return dispatcher
+}
+
+// initSMARTMonitor creates the SMART health monitor that sends alerts via the notify agent
+func initSMARTMonitor() *smart.HealthMonitor {
+	return smart.NewHealthMonitor(&smart.MonitorOptions{
+		Interval:         time.Duration(systemConfig.SMARTCheckInterval) * time.Minute,
+		TemperatureLimit: systemConfig.SMARTTemperatureLimit,
+		ListDevices:      listSMARTDevices,
+		OnAlert:          handleSMARTAlert,
+		OnUpdate:         recordSMARTTemperature,
+	})
+}
+
+// listSMARTDevices returns the names of the disks polled by the SMART health monitor
+func listSMARTDevices() ([]string, error) {
+	devices, err := smart.ListDevices()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, device := range devices {
+		names = append(names, device.Name)
+	}
+	return names, nil
+}
+
+// handleSMARTAlert forwards an alert from the SMART health monitor to the notifiers
+func handleSMARTAlert(alert *smart.Alert) {
+	log.Println("[SMART] " + alert.Message)
+
+	level := notifier.LevelWarning
+	title := "SMART warning on " + alert.DeviceName
+	if alert.Critical {
+		level = notifier.LevelCritical
+		title = "SMART health check failed on " + alert.DeviceName
+	}
+
+	// Errors are logged by the dispatcher
+	go notifyAgent.Notify(&notifier.Notification{
+		Source:  "smart",
+		Level:   level,
+		Title:   title,
+		Message: alert.Message,
+		Device:  alert.DeviceName,
+	})
+}
+
+// startRAIDMonitor starts watching the RAID arrays and sends their events via the notify agent
+func startRAIDMonitor(configFolderPath string) error {
+	return raidManager.StartMonitor(&raid.MonitorOptions{
+		Interval:     time.Duration(systemConfig.RAIDCheckInterval) * time.Second,
+		EventLogFile: filepath.Join(configFolderPath, RAID_EVENT_LOG_FILE),
+		OnEvent:      handleRAIDEvent,
+	})
+}
+
+// handleRAIDEvent forwards an event from the RAID monitor to the web UI and the notifiers
+func handleRAIDEvent(event *raid.Event) {
+	eventHub.Publish(TOPIC_RAID_EVENT, event, false)
+
+	level := notifier.LevelInfo
+	title := "RAID event on " + event.DeviceName
+	switch event.Type {
+	case raid.Event_ArrayDegraded:
+		level = notifier.LevelCritical
+		title = "RAID array " + event.DeviceName + " is degraded"
+	case raid.Event_MemberFailed:
+		level = notifier.LevelCritical
+		title = "Disk failed in RAID array " + event.DeviceName
+	case raid.Event_SpareActivated:
+		level = notifier.LevelWarning
+		title = "Spare disk activated in RAID array " + event.DeviceName
+	case raid.Event_ArrayRecovered:
+		title = "RAID array " + event.DeviceName + " is recovered"
+	case raid.Event_ResyncStarted:
+		title = "Resync started on RAID array " + event.DeviceName
+	case raid.Event_ResyncFinished:
+		title = "Resync finished on RAID array " + event.DeviceName
+	}
+
+	// Errors are logged by the dispatcher
+	go notifyAgent.Notify(&notifier.Notification{
+		Source:  "raid",
+		Level:   level,
+		Title:   title,
+		Message: event.Message,
+		Device:  event.DeviceName,
+		Time:    event.Time,
+	})
+}
+
+// handleRAIDScrubProgress forwards the progress of a RAID scrub to the web UI and
+// sends a notification when a scrub found mismatches or failed
+func handleRAIDScrubProgress(record *raid.ScrubRecord) {
+	eventHub.Publish(TOPIC_RAID_SCRUB, record, false)
+
+	var level notifier.Level
+	var title, message string
+	switch {
+	case record.Status == raid.SCRUB_STATUS_DONE && record.MismatchCount > 0:
+		level = notifier.LevelWarning
+		title = "RAID scrub found mismatches on " + record.Array
+		message = fmt.Sprintf("%s on %s finished with %d mismatched sectors", record.Action, record.Array, record.MismatchCount)
+		if record.Action == raid.SYNC_ACTION_REPAIR {
+			message += ", the mismatches are repaired"
+		}
+	case record.Status == raid.SCRUB_STATUS_FAILED:
+		level = notifier.LevelWarning
+		title = "RAID scrub failed on " + record.Array
+		message = record.Error
+	default:
+		return
+	}
+
+	// Errors are logged by the dispatcher
+	go notifyAgent.Notify(&notifier.Notification{
+		Source:  "raid",
+		Level:   level,
+		Title:   title,
+		Message: message,
+		Device:  record.Array,
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"imuslab.com/bokofs/bokofsd/mod/disktool/partition"
+)
+
+/*
+	partition.go
+
+	This file handles the partition table editing API routing
+
+	Support APIs
+
+	/partition/list - List the partitions and free spaces of a disk
+	/partition/label - Create a new GPT or MBR partition table on a disk
+	/partition/add - Add a partition to a disk
+	/partition/delete - Delete a partition from a disk
+	/partition/resize - Resize a partition
+*/
+
+func HandlePartitionCalls() http.Handler {
+	return http.StripPrefix("/partition/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(r.URL.Path, "/")
+
+		switch pathParts[0] {
+		case "list":
+			// List the partition table of a disk, require "dev=sdb" as a query parameter
+			partition.HandleListPartitions(w, r)
+			return
+		case "label":
+			// Create a new partition table, require dev and type (gpt or dos)
+			partition.HandleCreateLabel(w, r)
+			return
+		case "add":
+			// Add a partition, require dev, size (Optional), start (Optional), type (Optional) and name (Optional)
+			partition.HandleAddPartition(w, r)
+			return
+		case "delete":
+			// Delete a partition, require dev and number
+			partition.HandleDeletePartition(w, r)
+			return
+		case "resize":
+			// Resize a partition, require dev, number and size (Optional, default grow to fill the free space)
+			partition.HandleResizePartition(w, r)
+			return
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+	}))
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"imuslab.com/bokofs/bokofsd/mod/diskinfo/blkstat"
+	"imuslab.com/bokofs/bokofsd/mod/disktool/raid"
 	"imuslab.com/bokofs/bokofsd/mod/utils"
 )
 
@@ -37,26 +38,107 @@ func HandleRAIDCalls() http.Handler {
 			// Render the RAID overview page
 			raidManager.HandleRenderOverview(w, r)
 			return
+		case "events":
+			// List the events raised by the RAID monitor, optional "dev=md0" and "limit=50" as query parameters
+			raidManager.HandleListEvents(w, r)
+			return
 		case "sync":
 			// Get the RAID sync state, require "dev=md0" as a query parameter
 			raidManager.HandleGetRAIDSyncState(w, r)
 			return
 		case "start-resync":
-			// Activate a RAID device, require "dev=md0" as a query parameter
+			// Activate a RAID device, require "dev=md0" as a POST parameter
 			raidManager.HandleSyncPendingToReadWrite(w, r)
 			return
 		case "reassemble":
 			// Reassemble all RAID devices
 			raidManager.HandleForceAssembleReload(w, r)
 			return
+		case "flush-reload":
+			// Flush mdadm.conf and reassemble all RAID devices, fix md0 showing up as md127
+			raidManager.HandleMdadmFlushReload(w, r)
+			return
+		case "assemble":
+			// Restart the mdadm service to assemble new or missing RAID devices
+			raidManager.HandleRaidDevicesAssemble(w, r)
+			return
 		case "delete":
-			// Delete a RAID device, require "raidDev=md0" as a query parameter
+			// Delete a RAID device, require "raidDev=/dev/md0" as a POST parameter
 			raidManager.HandleRemoveRaideDevice(w, r)
 			return
+		case "grow":
+			// Grow a RAID device to the size of its members, require "raidDev=/dev/md0" as a POST parameter
+			raidManager.HandleGrowRAIDArray(w, r)
+			return
+		case "reshape":
+			// Reshape a RAID device, require "raidDev=/dev/md0" as a POST parameter, level, raidDevices,
+			// chunkSize, backupFile, addDisks (JSON array) and expandfs (bool) are optional
+			raidManager.HandleReshapeRAIDArray(w, r)
+			return
+		case "format":
+			// Create a file system on a RAID device, require devName (e.g. md0), format (e.g. ext4)
+			// and label (Optional) as POST parameters
+			raidManager.HandleFormatRaidDevice(w, r)
+			return
 		case "add":
-			// Add a new disk to the RAID device, require "dev=md0" as a query parameter
+			// Add a new disk to the RAID device, require "raidDev=/dev/md0" and "memDev=/dev/sdc" as POST parameters
 			raidManager.HandleAddDiskToRAIDVol(w, r)
 			return
+		case "remove-disk":
+			// Remove a disk from the RAID device, require "raidDev=/dev/md0" and "memDev=/dev/sdc" as POST parameters
+			raidManager.HandleRemoveDiskFromRAIDVol(w, r)
+			return
+		case "replace":
+			// Replace a member disk as a background job, require "raidDev=/dev/md0" and "newDisk=/dev/sde" as POST
+			// parameters, "oldDisk=/dev/sdb" is optional if the failed disk is already removed
+			raidReplacer.HandleReplaceDisk(w, r)
+			return
+		case "replace-jobs":
+			// List the disk replacement jobs, optional "id" as a query parameter
+			raidReplacer.HandleListReplaceJobs(w, r)
+			return
+		case "scrub":
+			// Start a scrub now, require "raidDev=/dev/md0" as a POST parameter, "action=check|repair"
+			// (default check) and "speedLimit" (KiB/s) are optional
+			raidScrubber.HandleScrubNow(w, r)
+			return
+		case "scrub-cancel":
+			// Cancel the running scrub, require "raidDev=/dev/md0" as a POST parameter
+			raidScrubber.HandleCancelScrub(w, r)
+			return
+		case "scrub-history":
+			// List the past and running scrubs with their mismatch count, optional "devName=md0" as a query parameter
+			raidScrubber.HandleScrubHistory(w, r)
+			return
+		case "scrub-schedules":
+			// List the scrub schedules of all arrays
+			raidScrubber.HandleListScrubSchedules(w, r)
+			return
+		case "set-scrub-schedule":
+			// Set the scrub schedule of an array, require "raidDev=/dev/md0" and "cron=0 3 1 * *" as POST
+			// parameters, "action", "speedLimit" and "enabled" are optional
+			raidScrubber.HandleSetScrubSchedule(w, r)
+			return
+		case "remove-scrub-schedule":
+			// Remove the scrub schedule of an array, require "raidDev=/dev/md0" as a POST parameter
+			raidScrubber.HandleRemoveScrubSchedule(w, r)
+			return
+		case "members":
+			// List the block device info of the RAID members, require "devName=md0" as a query parameter
+			raidManager.HandlListChildrenDeviceInfo(w, r)
+			return
+		case "usable":
+			// List the disks that can be used as new RAID members
+			raidManager.HandleListUsableDevices(w, r)
+			return
+		case "disk-model":
+			// Get the model and size label of a disk, require "devName=sda" as a query parameter
+			raidManager.HandleResolveDiskModelLabel(w, r)
+			return
+		case "openapi.yaml":
+			// The OpenAPI document of this API
+			raid.HandleOpenAPIDocument(w, r)
+			return
 		case "test":
 			//DEBUG Code
 			devname, err := utils.GetPara(r, "dev")
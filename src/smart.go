@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"strings"
 
-	"imuslab.com/bokofs/bokofsd/mod/diskinfo"
 	"imuslab.com/bokofs/bokofsd/mod/diskinfo/smart"
 	"imuslab.com/bokofs/bokofsd/mod/utils"
 )
@@ -18,9 +17,19 @@ import (
 
 	Support APIs
 
+	/smart/devices/all - List the disks with SMART support, their transport and smartctl device type
 	/smart/health/{diskname} - Get the health status of a disk
 	/smart/health/all - Get the health status of all disks
 	/smart/info/{diskname} - Get the SMART information of a disk
+	/smart/report/{diskname} - Get the full smartctl report with all attributes, health values and logs
+	/smart/selftest/{diskname} - Start a self-test (POST, type=short|long|conveyance)
+	/smart/selftest-abort/{diskname} - Abort the running self-test (POST)
+	/smart/selftest-log/{diskname} - Get the self-test log stored in the disk
+	/smart/error-log/{diskname} - Get the error log stored in the disk
+	/smart/selftest-history/{diskname} - Get the self-tests run by this server, or of all disks with "all"
+	/smart/selftest-schedules/all - Get the self-test schedules of all disks
+	/smart/selftest-schedule/{diskname} - Set a self-test schedule (POST, type, cron and enabled)
+	/smart/selftest-schedule-remove/{diskname} - Remove a self-test schedule (POST, type)
 */
 
 // Handler for SMART API calls
@@ -38,10 +47,20 @@ func HandleSMARTCalls() http.Handler {
 			return
 		}
 		switch subPath {
+		case "devices":
+			// List the disks with the detected transport, e.g. usb or raid
+			devices, err := smart.ListDevices()
+			if err != nil {
+				utils.SendErrorResponse(w, err.Error())
+				return
+			}
+			js, _ := json.Marshal(devices)
+			utils.SendJSONResponse(w, string(js))
+			return
 		case "health":
 			if diskName == "all" {
-				// Get the SMART information for all disks
-				allDisks, err := diskinfo.GetAllDisks()
+				// Get the SMART information for all disks, including the ones behind RAID controllers
+				devices, err := smart.ListDevices()
 				if err != nil {
 					log.Println("Error getting all disks:", err)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -50,9 +69,8 @@ func HandleSMARTCalls() http.Handler {
 
 				// Create a map to hold the SMART information for each disk
 				diskInfoMap := []*smart.DriveHealthInfo{}
-				for _, disk := range allDisks {
-					diskName := disk.Name
-					health, err := smart.GetDiskSMARTHealthSummary(diskName)
+				for _, device := range devices {
+					health, err := smart.GetDiskSMARTHealthSummary(device.Name)
 					if err != nil {
 						log.Println("Error getting disk health:", err)
 						continue
@@ -86,8 +104,8 @@ func HandleSMARTCalls() http.Handler {
 				return
 			}
 
-			if dt == smart.DiskType_SATA {
-				// Get SATA disk information
+			if dt == smart.DiskType_SATA || dt == smart.DiskType_SAS {
+				// Get SATA or SAS disk information
 				sataInfo, err := smart.GetSATAInfo(diskName)
 				if err != nil {
 					log.Println("Error getting SATA disk info:", err)
@@ -116,9 +134,164 @@ func HandleSMARTCalls() http.Handler {
 				return
 			}
 			return
+		case "report":
+			// The report exposes the decoded smartctl JSON output as is
+			if _, err := smart.GetDiskType(diskName); err != nil {
+				utils.SendErrorResponse(w, err.Error())
+				return
+			}
+			report, err := smart.GetSMARTReport(diskName)
+			if err != nil {
+				utils.SendErrorResponse(w, err.Error())
+				return
+			}
+			js, _ := json.Marshal(report)
+			utils.SendJSONResponse(w, string(js))
+			return
+		case "selftest":
+			handleStartSelfTest(w, r, diskName)
+			return
+		case "selftest-abort":
+			handleAbortSelfTest(w, r, diskName)
+			return
+		case "selftest-log":
+			entries, err := smart.GetSelfTestLog(diskName)
+			if err != nil {
+				utils.SendErrorResponse(w, err.Error())
+				return
+			}
+			js, _ := json.Marshal(entries)
+			utils.SendJSONResponse(w, string(js))
+			return
+		case "error-log":
+			errorLog, err := smart.GetErrorLog(diskName)
+			if err != nil {
+				utils.SendErrorResponse(w, err.Error())
+				return
+			}
+			js, _ := json.Marshal(errorLog)
+			utils.SendJSONResponse(w, string(js))
+			return
+		case "selftest-history":
+			if diskName == "all" {
+				diskName = ""
+			}
+			js, _ := json.Marshal(smartSelfTests.History(diskName))
+			utils.SendJSONResponse(w, string(js))
+			return
+		case "selftest-schedules":
+			js, _ := json.Marshal(smartSelfTests.ListSchedules())
+			utils.SendJSONResponse(w, string(js))
+			return
+		case "selftest-schedule":
+			handleSetSelfTestSchedule(w, r, diskName)
+			return
+		case "selftest-schedule-remove":
+			handleRemoveSelfTestSchedule(w, r, diskName)
+			return
 		default:
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
 		}
 	}))
 }
+
+// handleStartSelfTest starts a self-test on the disk, require type (short, long or conveyance) as a POST parameter
+func handleStartSelfTest(w http.ResponseWriter, r *http.Request, diskName string) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	testType, err := utils.PostPara(r, "type")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid self-test type given")
+		return
+	}
+
+	record, err := smartSelfTests.StartTest(diskName, smart.SelfTestType(testType), smart.SELFTEST_TRIGGER_MANUAL)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	js, _ := json.Marshal(record)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// handleAbortSelfTest aborts the running self-test on the disk
+func handleAbortSelfTest(w http.ResponseWriter, r *http.Request, diskName string) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	record, err := smartSelfTests.AbortTest(diskName)
+	if err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	js, _ := json.Marshal(record)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// handleSetSelfTestSchedule sets the schedule of a test type on the disk, require type and
+// cron (e.g. 0 2 * * 6) as POST parameters, enabled is optional and default true
+func handleSetSelfTestSchedule(w http.ResponseWriter, r *http.Request, diskName string) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	testType, err := utils.PostPara(r, "type")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid self-test type given")
+		return
+	}
+
+	cron, err := utils.PostPara(r, "cron")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid cron expression given")
+		return
+	}
+
+	schedule := &smart.SelfTestSchedule{
+		DeviceName: diskName,
+		Type:       smart.SelfTestType(testType),
+		Cron:       cron,
+		Enabled:    true,
+	}
+	if enabled, err := utils.PostBool(r, "enabled"); err == nil {
+		schedule.Enabled = enabled
+	}
+
+	if err := smartSelfTests.SetSchedule(schedule); err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	js, _ := json.Marshal(schedule)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// handleRemoveSelfTestSchedule removes the schedule of a test type on the disk, require type as a POST parameter
+func handleRemoveSelfTestSchedule(w http.ResponseWriter, r *http.Request, diskName string) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "invalid method")
+		return
+	}
+
+	testType, err := utils.PostPara(r, "type")
+	if err != nil {
+		utils.SendErrorResponse(w, "invalid self-test type given")
+		return
+	}
+
+	if err := smartSelfTests.RemoveSchedule(diskName, smart.SelfTestType(testType)); err != nil {
+		utils.SendErrorResponse(w, err.Error())
+		return
+	}
+
+	utils.SendOK(w)
+}
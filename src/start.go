@@ -8,11 +8,22 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/csrf"
+	"imuslab.com/bokofs/bokofsd/mod/auth"
+	"imuslab.com/bokofs/bokofsd/mod/bokofs"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/blkstat"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/inventory"
+	"imuslab.com/bokofs/bokofsd/mod/diskinfo/smart"
+	"imuslab.com/bokofs/bokofsd/mod/disktool/diskfs"
 	"imuslab.com/bokofs/bokofsd/mod/disktool/raid"
+	"imuslab.com/bokofs/bokofsd/mod/eventbus"
 	"imuslab.com/bokofs/bokofsd/mod/netstat"
+	"imuslab.com/bokofs/bokofsd/mod/timeseries"
+	"imuslab.com/bokofs/bokofsd/mod/tlscert"
 )
 
 /*
@@ -23,7 +34,7 @@ import (
 
 func initialization() error {
 	/* Check and generate system UUID */
-	configFolderPath := "./config"
+	configFolderPath := *config
 	if _, err := os.Stat(configFolderPath); os.IsNotExist(err) {
 		fmt.Printf("Config folder does not exist. Creating folder at %s\n", configFolderPath)
 		if err := os.Mkdir(configFolderPath, os.ModePerm); err != nil {
@@ -48,6 +59,33 @@ func initialization() error {
 	}
 	sysuuid = string(uuidBytes)
 
+	/* System Config */
+	sc, err := loadSystemConfig(configFolderPath)
+	if err != nil {
+		return err
+	}
+	systemConfig = sc
+
+	/* Authentication */
+	am, err := auth.NewAuthManager(&auth.Options{
+		UserFile:     filepath.Join(configFolderPath, USER_STORE_FILE),
+		AuthServer:   systemConfig.AuthServer,
+		SecureCookie: *serveSecure,
+	})
+	if err != nil {
+		return fmt.Errorf("error loading auth manager: %v", err)
+	}
+	authManager = am
+
+	/* TLS Certificate */
+	if *serveSecure {
+		cert, err := tlscert.LoadOrGenerate(configFolderPath, sysuuid)
+		if err != nil {
+			return fmt.Errorf("error loading TLS certificate: %v", err)
+		}
+		tlsCertificate = cert
+	}
+
 	/* File system handler */
 	if *devMode {
 		fmt.Println("Development mode enabled. Serving files from ./web directory.")
@@ -62,8 +100,17 @@ func initialization() error {
 		webfs = http.FS(subFS)
 	}
 
+	/* Metrics History */
+	ms, err := timeseries.NewStore(&timeseries.Options{
+		PersistFile: filepath.Join(configFolderPath, METRICS_HISTORY_FILE),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating metrics store: %v", err)
+	}
+	metricsStore = ms
+
 	/* Network statistics */
-	nsb, err := netstat.NewNetStatBuffer(300)
+	nsb, err := netstat.NewNetStatBuffer(300, metricsStore)
 	if err != nil {
 		return fmt.Errorf("error creating netstat buffer: %v", err)
 	}
@@ -81,11 +128,110 @@ func initialization() error {
 	}
 	raidManager = rm
 
+	/* Disk I/O Sampler */
+	blkstatSampler = blkstat.NewSampler(time.Second)
+
+	/* Live Status Event Hub */
+	eventHub = eventbus.NewHub()
+
+	/* Notifiers and Health Monitoring */
+	notifyAgent = initNotifyAgent(configFolderPath)
+	smartMonitor = initSMARTMonitor()
+
+	/* Metrics History Collectors */
+	startHistoryCollectors()
+	blkstatSampler.Start()
+	smartMonitor.Start()
+	if err := startRAIDMonitor(configFolderPath); err != nil {
+		return fmt.Errorf("error starting RAID monitor: %v", err)
+	}
+
+	/* RAID Disk Replacement, resume the jobs interrupted by the last shutdown */
+	rr, err := raid.NewReplacer(raidManager, filepath.Join(configFolderPath, RAID_REPLACE_FILE))
+	if err != nil {
+		return fmt.Errorf("error loading RAID replace jobs: %v", err)
+	}
+	raidReplacer = rr
+	raidReplacer.OnProgress = func(job *raid.ReplaceJob) {
+		eventHub.Publish(TOPIC_RAID_REPLACE, job, false)
+	}
+	raidReplacer.Resume()
+
+	/* SMART Self-test Scheduler */
+	st, err := smart.NewSelfTestRunner(filepath.Join(configFolderPath, SMART_SELFTEST_FILE))
+	if err != nil {
+		return fmt.Errorf("error loading SMART self-test schedules: %v", err)
+	}
+	smartSelfTests = st
+	smartSelfTests.OnProgress = func(record *smart.SelfTestRecord) {
+		eventHub.Publish(TOPIC_SMART_TEST, record, false)
+	}
+	if err := smartSelfTests.Start(); err != nil {
+		return fmt.Errorf("error starting SMART self-test scheduler: %v", err)
+	}
+
+	/* RAID Scrub Scheduler */
+	rs, err := raid.NewScrubber(raidManager, filepath.Join(configFolderPath, RAID_SCRUB_FILE))
+	if err != nil {
+		return fmt.Errorf("error loading RAID scrub schedules: %v", err)
+	}
+	raidScrubber = rs
+	raidScrubber.OnProgress = handleRAIDScrubProgress
+	if err := raidScrubber.Start(); err != nil {
+		return fmt.Errorf("error starting RAID scrub scheduler: %v", err)
+	}
+
+	/* WebDAV Server */
+	wds, err := bokofs.NewWebdavInterfaceServer("/disk/", "/thumb/")
+	if err != nil {
+		return err
+	}
+	webdavServer = wds
+	webdavServer.SetAccessChecker(authManager.CheckWorkerAccess)
+	startEventPublishers()
+
+	/* Mount Table, mounted before the registry so workers can serve folders on them */
+	mt, err := diskfs.NewMountTable(filepath.Join(configFolderPath, MOUNT_TABLE_FILE))
+	if err != nil {
+		return fmt.Errorf("error loading mount table: %v", err)
+	}
+	mountTable = mt
+	mountTable.SetUnmountChecker(checkMountPointNotServed)
+	mountTable.RestoreAll()
+
+	/* Formatter */
+	formatter = diskfs.NewFormatter()
+	formatter.OnProgress = func(job *diskfs.FormatJob) {
+		eventHub.Publish(TOPIC_DISK_FORMAT, job, false)
+	}
+
+	/* Worker Registry */
+	wr, err := bokofs.NewWorkerRegistry(wds, filepath.Join(configFolderPath, WORKER_REGISTRY_FILE), filepath.Join(configFolderPath, "thumbs"))
+	if err != nil {
+		return fmt.Errorf("error loading worker registry: %v", err)
+	}
+	workerRegistry = wr
+
+	/* Auto Mount and Hotplug */
+	//The auto mounter reserves the node names of the saved workers, and mount the
+	//drives of the rules first as the saved workers might serve folders on them
+	mounter, err := initAutoMounter(configFolderPath)
+	if err != nil {
+		return fmt.Errorf("error loading auto mount rules: %v", err)
+	}
+	autoMounter = mounter
+	autoMounter.Sync()
+	startHotplugWatcher()
+	workerRegistry.LoadAll()
+
+	/* Prometheus Exporter */
+	metricExporter = initMetricsExporter()
+
 	/* CSRF Middleware */
 	csrfMiddleware = csrf.Protect(
 		[]byte(sysuuid),
 		csrf.CookieName(CSRF_COOKIENAME),
-		csrf.Secure(false),
+		csrf.Secure(*serveSecure),
 		csrf.Path("/"),
 		csrf.SameSite(csrf.SameSiteLaxMode),
 	)
@@ -163,5 +309,34 @@ func cleanup() {
 		netstatBuffer.Close()
 	}
 
+	// Stop listening to block device uevents and release the auto mounted drives
+	inventory.Default().Stop()
+	if autoMounter != nil {
+		fmt.Println("Unmounting auto mounted drives...")
+		autoMounter.UnmountAll()
+	}
+
+	// Stop polling SMART health and RAID arrays
+	if smartMonitor != nil {
+		smartMonitor.Stop()
+	}
+	if raidManager != nil {
+		raidManager.StopMonitor()
+	}
+
+	// Stop the background collectors of the metrics exporter
+	if metricExporter != nil {
+		fmt.Println("Stopping metrics exporter...")
+		metricExporter.Stop()
+	}
+
+	// Save the metrics history so it survives a restart
+	if metricsStore != nil {
+		fmt.Println("Saving metrics history...")
+		if err := metricsStore.Close(); err != nil {
+			fmt.Println("Error saving metrics history:", err)
+		}
+	}
+
 	fmt.Println("Cleanup completed.")
 }
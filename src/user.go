@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"imuslab.com/bokofs/bokofsd/mod/auth"
+	"imuslab.com/bokofs/bokofsd/mod/bokofs"
+	"imuslab.com/bokofs/bokofsd/mod/utils"
+)
+
+/*
+	user.go
+
+	This file handles the login and user management API routing
+
+	Support APIs
+
+	/auth/login - Login with username and password, set the session cookie
+	/auth/logout - Logout and clear the session cookie
+	/auth/whoami - Get the current user
+
+	/users/list - List all users (Admin only)
+	/users/add - Add a new user (Admin only)
+	/users/remove - Remove a user (Admin only)
+	/users/passwd - Change password, admin can change the password of other users
+	/users/permission - Set the permission of a user on a worker (Admin only)
+*/
+
+// HandleAuthCalls handles the login API, which can be accessed without login
+func HandleAuthCalls() http.Handler {
+	return http.StripPrefix("/api/auth/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(r.URL.Path, "/")
+
+		switch pathParts[0] {
+		case "login":
+			// Login with username and password
+			authManager.HandleLogin(w, r)
+			return
+		case "logout":
+			// Logout the current session
+			authManager.HandleLogout(w, r)
+			return
+		case "whoami":
+			// Get the current user
+			authManager.HandleAuthAPI(http.HandlerFunc(authManager.HandleWhoAmI)).ServeHTTP(w, r)
+			return
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+	}))
+}
+
+// HandleUserCalls handles the user management API
+func HandleUserCalls() http.Handler {
+	return http.StripPrefix("/users/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(r.URL.Path, "/")
+
+		switch pathParts[0] {
+		case "list":
+			// List all users
+			authManager.HandleListUsers(w, r)
+			return
+		case "add":
+			// Add a new user, require username, password (Optional if auth server is used) and admin (Optional, bool)
+			authManager.HandleAddUser(w, r)
+			return
+		case "remove":
+			// Remove a user, require username
+			authManager.HandleRemoveUser(w, r)
+			return
+		case "passwd":
+			// Change password, require password and username (Optional, default current user)
+			authManager.HandleSetPassword(w, r)
+			return
+		case "permission":
+			// Set the permission of a user on a worker, require username, nodeName and permission (none, read or read-write)
+			authManager.HandleSetPermission(w, r)
+			return
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+	}))
+}
+
+// handleListAccessibleWorkers lists the workers the current user has access to
+func handleListAccessibleWorkers(w http.ResponseWriter, r *http.Request) {
+	results := []*bokofs.WorkerRecord{}
+	for _, record := range workerRegistry.List() {
+		if authManager.CheckWorkerAccess(r.Context(), record.NodeName, false) {
+			results = append(results, record)
+		}
+	}
+
+	js, _ := json.Marshal(results)
+	utils.SendJSONResponse(w, string(js))
+}
+
+// isAdminRequest checks if the request is made by an admin user
+func isAdminRequest(r *http.Request) bool {
+	user, ok := auth.GetUserFromContext(r.Context())
+	return ok && user.IsAdmin
+}
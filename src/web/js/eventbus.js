@@ -0,0 +1,64 @@
+/*
+    eventbus.js
+
+    Share one Server-Sent Events connection to /api/events
+    between all components in the page, e.g.
+
+    subscribeEvent("netstat", function(data){
+        console.log(data.RX, data.TX);
+    });
+
+    Subscribing to a topic also receives its sub-topics, e.g. "raid"
+    receives both "raid.sync" and "raid.event". The topic of the event
+    is passed to the callback as the second argument
+*/
+
+var eventSource = undefined;
+var eventHandlers = {};
+var eventReconnectTimer = undefined;
+
+function subscribeEvent(topic, callback){
+    if (eventHandlers[topic] == undefined){
+        eventHandlers[topic] = [];
+    }
+    eventHandlers[topic].push(callback);
+
+    //Reconnect with the new topic list. Wait a bit so components
+    //loaded at the same time share a single reconnection
+    if (eventReconnectTimer != undefined){
+        clearTimeout(eventReconnectTimer);
+    }
+    eventReconnectTimer = setTimeout(connectEventSource, 100);
+}
+
+function connectEventSource(){
+    eventReconnectTimer = undefined;
+    if (eventSource != undefined){
+        eventSource.close();
+    }
+
+    let topics = Object.keys(eventHandlers);
+    if (topics.length == 0){
+        return;
+    }
+
+    //The browser reconnects automatically if the connection drops
+    eventSource = new EventSource("./api/events?topics=" + encodeURIComponent(topics.join(",")));
+    eventSource.onmessage = function(e){
+        let event = JSON.parse(e.data);
+        Object.keys(eventHandlers).forEach(function(topic){
+            if (!eventTopicMatch(topic, event.topic)){
+                return;
+            }
+            eventHandlers[topic].forEach(function(callback){
+                callback(event.data, event.topic);
+            });
+        });
+    };
+}
+
+//Check if the event topic is the subscribed topic or one of its sub-topics,
+//same as the topic matching of the server
+function eventTopicMatch(subscribed, topic){
+    return topic == subscribed || topic.startsWith(subscribed + ".");
+}
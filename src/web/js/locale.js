@@ -65,6 +65,16 @@ let translatedMessages = {
         "raid_device_deleted_fail": 'RAID device delete failed',
         "raid_device_created_succ": 'RAID device created',
         "raid_device_created_fail": 'RAID device create failed',
+        "raid_device_mounted_succ": 'RAID device mounted',
+        "raid_device_unmounted_succ": 'RAID device unmounted',
+        "raid_disk_added_succ": 'Disk added to RAID device',
+        "raid_disk_removed_succ": 'Disk removed from RAID device',
+        "raid_disk_replace_started": 'Disk replacement started',
+        "raid_disk_replaced_succ": 'Disk replaced',
+        "raid_no_usable_disk": 'No usable disks found',
+        "raid_device_grow_started_succ": 'RAID device grow started',
+        "raid_device_format_started": 'Formatting RAID device, please wait...',
+        "raid_device_formatted_succ": 'RAID device formatted',
     },
     'zh': {
         'disk_info_refreshed': '磁碟資訊已重新載入',
@@ -75,5 +85,15 @@ let translatedMessages = {
         "raid_device_deleted_fail": 'RAID 裝置刪除失敗',
         "raid_device_created_succ": 'RAID 裝置已建立',
         "raid_device_created_fail": 'RAID 裝置建立失敗',
+        "raid_device_mounted_succ": 'RAID 裝置已掛載',
+        "raid_device_unmounted_succ": 'RAID 裝置已卸載',
+        "raid_disk_added_succ": '磁碟已加入 RAID 裝置',
+        "raid_disk_removed_succ": '磁碟已從 RAID 裝置移除',
+        "raid_disk_replace_started": '已開始更換磁碟',
+        "raid_disk_replaced_succ": '磁碟已更換',
+        "raid_no_usable_disk": '找不到可用的磁碟',
+        "raid_device_grow_started_succ": 'RAID 裝置已開始擴展容量',
+        "raid_device_format_started": '正在格式化 RAID 裝置，請稍候...',
+        "raid_device_formatted_succ": 'RAID 裝置已格式化',
     }
 };
\ No newline at end of file
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+/*
+	worker.go
+
+	This file handles the worker (share) management API routing
+
+	Support APIs
+
+	/workers/list - List all registered workers
+	/workers/add - Add a new worker
+	/workers/edit - Edit an existing worker
+	/workers/remove - Remove a worker
+	/workers/automount - List the workers of auto mounted drives
+*/
+
+func HandleWorkerCalls() http.Handler {
+	return http.StripPrefix("/workers/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(r.URL.Path, "/")
+
+		switch pathParts[0] {
+		case "list":
+			// List all registered workers
+			workerRegistry.HandleListWorkers(w, r)
+			return
+		case "add":
+			// Add a new worker, require nodeName, servePath, thumbStore (Optional) and readonly (Optional)
+			workerRegistry.HandleAddWorker(w, r)
+			return
+		case "edit":
+			// Edit a worker, require target (node name of the worker to edit) and the same parameters as add
+			workerRegistry.HandleEditWorker(w, r)
+			return
+		case "remove":
+			// Remove a worker, require nodeName
+			workerRegistry.HandleRemoveWorker(w, r)
+			return
+		case "automount":
+			// List the auto mounted drives, these workers are not saved in the registry
+			autoMounter.HandleListMounts(w, r)
+			return
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+	}))
+}